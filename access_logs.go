@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// Access log LOG_CONTENT values, each in the server's default format
+const (
+	accessLogApache = "apache"
+	accessLogNginx  = "nginx"
+	accessLogEnvoy  = "envoy"
+)
+
+// accessLogStatuses weights response codes like a healthy public site
+var accessLogStatuses = []weightedName{
+	{"200", 80}, {"201", 4}, {"204", 2}, {"301", 2}, {"302", 2}, {"304", 3},
+	{"400", 2}, {"401", 1}, {"403", 1}, {"404", 3}, {"429", 0.5},
+	{"500", 1}, {"502", 0.5}, {"503", 0.5}, {"504", 0.5},
+}
+
+// accessLogPaths are request paths; {id} is replaced with a number
+var accessLogPaths = []string{
+	"/", "/index.html", "/login", "/logout", "/cart", "/checkout",
+	"/api/v1/users/{id}", "/api/v1/orders", "/api/v1/orders/{id}",
+	"/api/v1/products", "/api/v1/products/{id}", "/api/v1/search",
+	"/static/js/app.js", "/static/css/main.css", "/images/logo.png",
+	"/favicon.ico", "/robots.txt", "/healthz", "/metrics",
+}
+
+var accessLogMethods = []weightedName{
+	{"GET", 80}, {"POST", 12}, {"PUT", 4}, {"DELETE", 2}, {"PATCH", 1}, {"HEAD", 1},
+}
+
+// accessLogProtocols weights the HTTP versions clients use
+var accessLogProtocols = []weightedName{{"HTTP/1.1", 60}, {"HTTP/2.0", 35}, {"HTTP/1.0", 5}}
+
+// accessLogRequest is a request as an access log line describes it
+type accessLogRequest struct {
+	ClientIP, User           string
+	Method, Path, Protocol   string
+	Status                   string
+	BytesReceived, BytesSent int
+	Referer, UserAgent       string
+	DurationMs               float64
+}
+
+// generateAccessLog fills record with an access log line in style, with the
+// level following the status class
+func generateAccessLog(record *LogRecord, style string) {
+	req := accessLogRequest{
+		ClientIP:   logClientIPPool.get(randomClientIP),
+		User:       accessLogUser(),
+		Method:     pickWeighted(accessLogMethods),
+		Path:       logPathPool.get(accessLogPath),
+		Protocol:   pickWeighted(accessLogProtocols),
+		Status:     pickWeighted(accessLogStatuses),
+		Referer:    "-",
+		UserAgent:  gofakeit.UserAgent(),
+		DurationMs: latencyDist.Sample(),
+	}
+	if req.Status != "204" && req.Status != "304" && req.Method != "HEAD" {
+		req.BytesSent = 200 + rand.Intn(50000)
+	}
+	if req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH" {
+		req.BytesReceived = 50 + rand.Intn(2000)
+	}
+	if rand.Intn(3) == 0 {
+		req.Referer = gofakeit.URL()
+	}
+	writeAccessLog(record, style, req)
+}
+
+// writeAccessLog fills record with req logged in style, with the level
+// following the status class
+func writeAccessLog(record *LogRecord, style string, req accessLogRequest) {
+	record.logClient = newLogClient(req.ClientIP)
+	switch req.Status[0] {
+	case '5':
+		record.Level = "error"
+	case '4':
+		record.Level = "warn"
+	default:
+		record.Level = "info"
+	}
+
+	switch style {
+	case accessLogEnvoy:
+		// Envoy's default format
+		flags := "-"
+		if req.Status == "503" {
+			flags = "UF"
+		} else if req.Status == "504" {
+			flags = "UT"
+		}
+		record.Log = fmt.Sprintf(`[%s] "%s %s %s" %s %s %d %d %d %d "%s" "%s" "%s" "%s" "%s"`,
+			record.Time.UTC().Format("2006-01-02T15:04:05.000Z"), req.Method, req.Path, req.Protocol, req.Status, flags,
+			req.BytesReceived, req.BytesSent, int(req.DurationMs), max(0, int(req.DurationMs)-rand.Intn(3)),
+			req.ClientIP, req.UserAgent, gofakeit.UUID(), record.Job, fmt.Sprintf("10.0.%d.%d:8080", rand.Intn(256), rand.Intn(256)))
+	case accessLogNginx:
+		// nginx's combined format followed by X-Forwarded-For and $request_time
+		record.Log = fmt.Sprintf(`%s - %s [%s] "%s %s %s" %s %d "%s" "%s" "%s" %.3f`,
+			req.ClientIP, req.User, record.Time.Format("02/Jan/2006:15:04:05 -0700"), req.Method, req.Path, req.Protocol,
+			req.Status, req.BytesSent, req.Referer, req.UserAgent, gofakeit.IPv4Address(), req.DurationMs/1000)
+	default:
+		// Apache's combined format; %b logs an empty body as "-"
+		size := fmt.Sprint(req.BytesSent)
+		if req.BytesSent == 0 {
+			size = "-"
+		}
+		record.Log = fmt.Sprintf(`%s - %s [%s] "%s %s %s" %s %s "%s" "%s"`,
+			req.ClientIP, req.User, record.Time.Format("02/Jan/2006:15:04:05 -0700"), req.Method, req.Path, req.Protocol,
+			req.Status, size, req.Referer, req.UserAgent)
+	}
+}
+
+// accessLogPath returns a request path with its resource id or query
+func accessLogPath() string {
+	path := strings.ReplaceAll(accessLogPaths[rand.Intn(len(accessLogPaths))], "{id}", fmt.Sprint(rand.Intn(100000)))
+	if path == "/api/v1/search" {
+		path += "?q=" + url.QueryEscape(gofakeit.Word())
+	}
+	return path
+}
+
+// accessLogUser returns the authenticated user of a request, usually none
+func accessLogUser() string {
+	if rand.Intn(10) == 0 {
+		return logUsername()
+	}
+	return "-"
+}
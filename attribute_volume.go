@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+var (
+	// attributeSizeDist is the length of the extra attribute values in bytes
+	attributeSizeDist = loadTraceDistribution("TRACE_ATTRIBUTE_SIZE", "_BYTES", valueDistribution{
+		Kind: distUniform, Min: 8, Max: 64, Mean: 32, StdDev: 16, Alpha: 1.5,
+	})
+	// attributeLimits are value sizes backends commonly truncate at
+	attributeLimits = loadTraceSetting(loadAttributeLimits)
+)
+
+func loadAttributeLimits() []int {
+	var limits []int
+	for _, field := range strings.Split(getEnvOrDefault("TRACE_ATTRIBUTE_LIMITS", "4096,16384"), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		limit, err := strconv.Atoi(field)
+		if err != nil || limit <= 0 {
+			configProblem("TRACE_ATTRIBUTE_LIMITS entry %q must be a positive number of bytes", field)
+			continue
+		}
+		limits = append(limits, limit)
+	}
+	return limits
+}
+
+// addAttributeVolume pads every span with TRACE_EXTRA_ATTRIBUTES random
+// attributes and gives TRACE_LARGE_ATTRIBUTE_PERCENT of the spans a value
+// one byte under, at or over one of TRACE_ATTRIBUTE_LIMITS
+func addAttributeVolume(trace *Trace) {
+	if tracesConfig.ExtraAttributes <= 0 && tracesConfig.LargeAttributePercent <= 0 {
+		return
+	}
+	for i := range trace.Spans {
+		attrs := trace.Spans[i].Attributes
+		for n := 0; n < tracesConfig.ExtraAttributes; n++ {
+			attrs[fmt.Sprintf("load_gen.attr_%03d", n)] = randomText(attributeSizeDist.SampleInt())
+		}
+		if len(attributeLimits) > 0 && rand.Float64()*100 < tracesConfig.LargeAttributePercent {
+			size := attributeLimits[rand.Intn(len(attributeLimits))] + rand.Intn(3) - 1
+			attrs["load_gen.large_value"] = randomText(size)
+		}
+	}
+}
+
+const randomTextAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randomText returns n random alphanumeric bytes
+func randomText(n int) string {
+	b := make([]byte, max(n, 0))
+	for i := range b {
+		b[i] = randomTextAlphabet[rand.Intn(len(randomTextAlphabet))]
+	}
+	return string(b)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Supported values for AUTH_TYPE
+const (
+	authTypeHeader = "header"
+	authTypeBasic  = "basic"
+	authTypeBearer = "bearer"
+)
+
+// authenticator builds the Authorization header shared by every sender.
+// The header is stored atomically so a token refresh never races with the
+// goroutines that are sending.
+type authenticator struct {
+	kind            string
+	tokenFile       string
+	refreshInterval time.Duration
+	header          atomic.Value // string
+}
+
+var auth = loadAuth()
+
+func loadAuth() *authenticator {
+	a := &authenticator{
+		kind:            strings.ToLower(getEnvOrDefault("AUTH_TYPE", authTypeHeader)),
+		tokenFile:       os.Getenv("AUTH_TOKEN_FILE"),
+		refreshInterval: getEnvDuration("AUTH_REFRESH_INTERVAL", 0),
+	}
+	a.header.Store("")
+
+	switch a.kind {
+	case authTypeHeader:
+		a.header.Store(os.Getenv("AUTH_HEADER"))
+	case authTypeBasic:
+		credentials := os.Getenv("AUTH_USER") + ":" + os.Getenv("AUTH_PASS")
+		a.header.Store("Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)))
+	case authTypeBearer:
+		if a.tokenFile != "" {
+			if err := a.reload(); err != nil {
+				configProblem("AUTH_TOKEN_FILE: %v", err)
+			}
+		} else if token := os.Getenv("AUTH_TOKEN"); token != "" {
+			a.header.Store("Bearer " + token)
+		}
+	default:
+		configProblem("AUTH_TYPE=%q is not supported (use header, basic or bearer)", a.kind)
+	}
+	return a
+}
+
+// Header returns the current Authorization header value, or "" when none is configured
+func (a *authenticator) Header() string {
+	return a.header.Load().(string)
+}
+
+// apply sets the Authorization header on req when one is configured
+func (a *authenticator) apply(req *http.Request) {
+	if header := a.Header(); header != "" {
+		req.Header.Set("Authorization", header)
+	}
+}
+
+// reload reads the bearer token from AUTH_TOKEN_FILE
+func (a *authenticator) reload() error {
+	data, err := os.ReadFile(a.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read token file %s: %w", a.tokenFile, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("token file %s is empty", a.tokenFile)
+	}
+	a.header.Store("Bearer " + token)
+	return nil
+}
+
+// refreshes reports whether the token should be periodically reloaded
+func (a *authenticator) refreshes() bool {
+	return a.kind == authTypeBearer && a.tokenFile != "" && a.refreshInterval > 0
+}
+
+// startAuthRefresh reloads the token file every refresh interval until ctx is
+// done. A failed reload keeps the previous token.
+func (a *authenticator) startAuthRefresh(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(a.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.reload(); err != nil {
+				log.Printf("Auth token refresh failed, keeping previous token: %v", err)
+			}
+		}
+	}
+}
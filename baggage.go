@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var baggageConfig = loadTraceSetting(loadBaggageConfig)
+
+type BaggageConfig struct {
+	// Enabled gives every trace baggage entries copied onto all its spans
+	Enabled bool
+	// Tenants is the number of distinct tenant ids
+	Tenants int
+	// Experiments are feature flags switched on or off per trace
+	Experiments []string
+}
+
+func loadBaggageConfig() BaggageConfig {
+	cfg := BaggageConfig{
+		Enabled: getEnvBool("TRACE_BAGGAGE", false),
+		Tenants: getEnvInt("TRACE_BAGGAGE_TENANTS", 50),
+	}
+	for _, name := range strings.Split(getEnvOrDefault("TRACE_BAGGAGE_EXPERIMENTS", "checkout_redesign,new_search"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.Experiments = append(cfg.Experiments, name)
+		}
+	}
+	return cfg
+}
+
+// userTiers are weighted so most tenants are on the free tier
+var userTiers = []weightedName{{"free", 70}, {"pro", 25}, {"enterprise", 5}}
+
+// traceBaggage draws the baggage a request carries: a tenant, the tier
+// that tenant is on and the experiment flags of this request
+func traceBaggage() map[string]string {
+	tenant := fmt.Sprintf("tenant-%04d", rand.Intn(baggageConfig.Tenants))
+	baggage := map[string]string{
+		"tenant.id": tenant,
+		"user.tier": tenantTier(tenant),
+	}
+	for _, name := range baggageConfig.Experiments {
+		flag := "off"
+		if rand.Intn(2) == 0 {
+			flag = "on"
+		}
+		baggage["experiment."+name] = flag
+	}
+	return baggage
+}
+
+// tenantTier returns the tier of tenant, the same for every trace
+func tenantTier(tenant string) string {
+	h := fnv.New32a()
+	h.Write([]byte(tenant))
+	total := 0.0
+	for _, tier := range userTiers {
+		total += tier.Weight
+	}
+	point := float64(h.Sum32()) / (1 << 32) * total
+	for _, tier := range userTiers {
+		if point < tier.Weight {
+			return tier.Name
+		}
+		point -= tier.Weight
+	}
+	return userTiers[len(userTiers)-1].Name
+}
+
+// addBaggage copies one set of baggage entries onto every span of trace,
+// as the baggage span processor does. With TRACE_CONTEXT_ATTRIBUTES the
+// W3C baggage header each non-root span received is recorded too.
+func addBaggage(trace *Trace) {
+	if !baggageConfig.Enabled {
+		return
+	}
+	baggage := traceBaggage()
+	header := baggageHeader(baggage)
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		for key, value := range baggage {
+			span.Attributes[key] = value
+		}
+		if tracesConfig.ContextAttributes && span.ParentID != "" {
+			span.Attributes["baggage"] = header
+		}
+	}
+}
+
+// baggageHeader renders entries as a W3C baggage header value
+func baggageHeader(baggage map[string]string) string {
+	members := make([]string, 0, len(baggage))
+	for key, value := range baggage {
+		members = append(members, key+"="+url.PathEscape(value))
+	}
+	sort.Strings(members)
+	return strings.Join(members, ",")
+}
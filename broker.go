@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Message brokers are selected per signal by the scheme of its endpoint:
+// kafka:// or kafkas:// (kafka.go), nats:// (nats.go), amqp:// or amqps://
+// (amqp.go), mqtt:// or mqtts:// (mqtt.go) and kinesis:// or firehose://
+// (kinesis.go). Log records are a message each in the formats that can
+// encode one; log batches in other formats, traces and metrics are sent as
+// one message per payload.
+
+// brokerMessage is a message for a broker. Key picks the Kafka partition or
+// Kinesis shard; other brokers ignore it.
+type brokerMessage struct {
+	Key, Value []byte
+}
+
+// isBrokerEndpoint reports whether endpoint selects a message broker
+func isBrokerEndpoint(endpoint string) bool {
+	return isKafkaEndpoint(endpoint) || isNATSEndpoint(endpoint) || isAMQPEndpoint(endpoint) ||
+		isMQTTEndpoint(endpoint) || isKinesisEndpoint(endpoint) || isFirehoseEndpoint(endpoint)
+}
+
+// validateBrokerEndpoint checks a message broker endpoint
+func validateBrokerEndpoint(key, endpoint string) {
+	switch {
+	case isNATSEndpoint(endpoint):
+		validateNATSEndpoint(key, endpoint)
+	case isAMQPEndpoint(endpoint):
+		validateAMQPEndpoint(key, endpoint)
+	case isMQTTEndpoint(endpoint):
+		validateMQTTEndpoint(key, endpoint)
+	case isKinesisEndpoint(endpoint), isFirehoseEndpoint(endpoint):
+		validateKinesisEndpoint(key, endpoint)
+	default:
+		validateKafkaEndpoint(key, endpoint)
+	}
+}
+
+// publishBroker sends messages to the broker and topic, subject, exchange or
+// stream of endpoint
+func publishBroker(ctx context.Context, endpoint string, messages []brokerMessage) error {
+	switch {
+	case isNATSEndpoint(endpoint):
+		return publishNATS(ctx, endpoint, messages)
+	case isAMQPEndpoint(endpoint):
+		return publishAMQP(ctx, endpoint, messages)
+	case isMQTTEndpoint(endpoint):
+		return publishMQTT(ctx, endpoint, messages)
+	case isKinesisEndpoint(endpoint), isFirehoseEndpoint(endpoint):
+		return publishKinesis(ctx, endpoint, messages)
+	}
+	return produceKafka(ctx, endpoint, messages)
+}
+
+// brokerPartitionKey returns what messages to endpoint are keyed by:
+// KINESIS_PARTITION_KEY for Kinesis, else KAFKA_PARTITION_KEY
+func brokerPartitionKey(endpoint string) string {
+	if isKinesisEndpoint(endpoint) {
+		return kinesisConfig.PartitionKey
+	}
+	return kafkaConfig.PartitionKey
+}
+
+// brokerLogKey returns the partition key of record for endpoint, or nil
+func brokerLogKey(endpoint string, record LogRecord) []byte {
+	switch by := brokerPartitionKey(endpoint); {
+	case by == kafkaKeyJob:
+		return []byte(record.Job)
+	case by == kafkaKeyTraceID && record.TraceID != "":
+		return []byte(record.TraceID)
+	}
+	return nil
+}
+
+// brokerTraceKey returns the partition key of an encoded part of a trace
+// for endpoint: its trace id or the service of its first span
+func brokerTraceKey(endpoint string, part *Trace) []byte {
+	if len(part.Spans) == 0 {
+		return nil
+	}
+	switch brokerPartitionKey(endpoint) {
+	case kafkaKeyJob:
+		return []byte(part.Spans[0].ServiceName)
+	case kafkaKeyTraceID:
+		return []byte(part.Spans[0].TraceID)
+	}
+	return nil
+}
+
+// recordLogEncoder is implemented by log encoders that can write a single
+// record as a message of its own
+type recordLogEncoder interface {
+	logEncoder
+	EncodeRecord(record LogRecord) ([]byte, error)
+}
+
+func (jsonLogEncoder) EncodeRecord(record LogRecord) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+// sendBrokerLogs sends records to a message broker: one message per record
+// for formats that can encode one, else the encoded batch as one message
+func sendBrokerLogs(ctx context.Context, endpoint string, logBatch []LogRecord) error {
+	var messages []brokerMessage
+	size := 0
+	if enc, ok := logEnc.(recordLogEncoder); ok {
+		for _, record := range logBatch {
+			value, err := enc.EncodeRecord(record)
+			if err != nil {
+				return fmt.Errorf("failed to marshal log record: %w", err)
+			}
+			messages = append(messages, brokerMessage{Key: brokerLogKey(endpoint, record), Value: value})
+			size += len(value)
+		}
+	} else {
+		value, err := logEnc.Encode(logBatch)
+		if err != nil {
+			return fmt.Errorf("failed to marshal log batch: %w", err)
+		}
+		messages = append(messages, brokerMessage{Value: value})
+		size = len(value)
+	}
+	if err := publishBroker(ctx, endpoint, messages); err != nil {
+		return fmt.Errorf("failed to send log batch: %w", err)
+	}
+	countLogsSent(len(logBatch), size)
+	return nil
+}
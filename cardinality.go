@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// Cardinality knobs limit how many distinct values a log field takes, to
+// dial index size and query cost up or down. Hosts and pods are set by
+// RESOURCE_INSTANCES and the K8S_* settings.
+var (
+	logUserPool     = newValuePool("LOG_USER_CARDINALITY")
+	logClientIPPool = newValuePool("LOG_CLIENT_IP_CARDINALITY")
+	logPathPool     = newValuePool("LOG_PATH_CARDINALITY")
+	logTraceIDPool  = newValuePool("LOG_TRACE_ID_CARDINALITY")
+)
+
+// valuePool hands out at most Size distinct values; Size 0 is unlimited
+type valuePool struct {
+	Env  string
+	Size int
+
+	mu     sync.Mutex
+	values []string
+}
+
+func newValuePool(env string) *valuePool {
+	return &valuePool{Env: env, Size: getEnvInt(env, 0)}
+}
+
+// get returns a fresh value from sample until the pool is full, then one of
+// the pooled values
+func (p *valuePool) get(sample func() string) string {
+	if p.Size <= 0 {
+		return sample()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.values) < p.Size {
+		value := sample()
+		p.values = append(p.values, value)
+		return value
+	}
+	return p.values[rand.Intn(len(p.values))]
+}
+
+// logUserEmail returns the email of a user, one of LOG_USER_CARDINALITY
+func logUserEmail() string {
+	return logUserPool.get(gofakeit.Email)
+}
+
+// logUsername returns the username of the same users logUserEmail draws from
+func logUsername() string {
+	name, _, _ := strings.Cut(logUserEmail(), "@")
+	return name
+}
+
+// cardinalityPools are the knobs, for validation and the effective config
+var cardinalityPools = []*valuePool{logUserPool, logClientIPPool, logPathPool, logTraceIDPool}
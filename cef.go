@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// LOG_CONTENT values for SIEM event formats
+const (
+	logContentCEF  = "cef"
+	logContentLEEF = "leef"
+)
+
+// securityEvent is a device event in CEF terms: header fields plus
+// extension fields keyed by CEF dictionary names
+type securityEvent struct {
+	Vendor, Product, Version string
+	SignatureID, Name        string
+	// Severity is 0 (lowest) to 10
+	Severity int
+	Fields   [][2]string
+}
+
+// securityEventSources are the devices events come from, with a relative
+// weight and a function building one of their events
+var securityEventSources = []struct {
+	Weight float64
+	Event  func() securityEvent
+}{
+	{40, paloAltoTrafficEvent},
+	{20, fortigateTrafficEvent},
+	{10, ciscoASADenyEvent},
+	{8, zscalerWebEvent},
+	{8, windowsLogonFailureEvent},
+	{6, snortAlertEvent},
+	{2, crowdStrikeDetectionEvent},
+}
+
+// cefToLEEF maps the CEF extension keys used here to LEEF attribute names
+var cefToLEEF = map[string]string{
+	"src": "src", "dst": "dst", "spt": "srcPort", "dpt": "dstPort",
+	"proto": "proto", "act": "action", "suser": "usrName", "duser": "usrName",
+	"request": "url", "requestMethod": "method", "cat": "cat", "msg": "msg",
+	"in": "srcBytes", "out": "dstBytes", "shost": "srcHost", "dhost": "dstHost",
+	"deviceExternalId": "devExternalId", "cs1": "policy", "fname": "fileName",
+}
+
+// generateSecurityEvent fills record with a firewall, proxy, IDS or EDR
+// event rendered as CEF or LEEF. The job is the product and the level
+// follows the severity.
+func generateSecurityEvent(record *LogRecord, content string) {
+	total := 0.0
+	for _, source := range securityEventSources {
+		total += source.Weight
+	}
+	x := rand.Float64() * total
+	event := securityEventSources[len(securityEventSources)-1].Event
+	for _, source := range securityEventSources {
+		if x -= source.Weight; x < 0 {
+			event = source.Event
+			break
+		}
+	}
+	e := event()
+
+	record.Job = strings.ToLower(strings.ReplaceAll(e.Product, " ", "-"))
+	switch {
+	case e.Severity >= 7:
+		record.Level = "error"
+	case e.Severity >= 4:
+		record.Level = "warn"
+	default:
+		record.Level = "info"
+	}
+	millis := strconv.FormatInt(record.Time.UnixMilli(), 10)
+	if content == logContentLEEF {
+		record.Log = formatLEEF(e, millis)
+	} else {
+		record.Log = formatCEF(e, millis)
+	}
+}
+
+// formatCEF renders e as an ArcSight CEF:0 line with rt set to millis
+func formatCEF(e securityEvent, millis string) string {
+	header := []string{e.Vendor, e.Product, e.Version, e.SignatureID, e.Name, strconv.Itoa(e.Severity)}
+	for i, field := range header {
+		header[i] = cefHeaderEscaper.Replace(field)
+	}
+	ext := []string{"rt=" + millis}
+	for _, field := range e.Fields {
+		ext = append(ext, field[0]+"="+cefExtensionEscaper.Replace(field[1]))
+	}
+	return "CEF:0|" + strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// formatLEEF renders e as a QRadar LEEF:1.0 line with tab-separated
+// attributes and devTime set to millis
+func formatLEEF(e securityEvent, millis string) string {
+	header := []string{e.Vendor, e.Product, e.Version, e.SignatureID}
+	for i, field := range header {
+		header[i] = strings.ReplaceAll(field, "|", "/")
+	}
+	attrs := []string{
+		"devTime=" + millis,
+		"devTimeFormat=epoch",
+		"sev=" + strconv.Itoa(e.Severity),
+		"name=" + leefEscaper.Replace(e.Name),
+	}
+	for _, field := range e.Fields {
+		key, ok := cefToLEEF[field[0]]
+		if !ok {
+			key = field[0]
+		}
+		attrs = append(attrs, key+"="+leefEscaper.Replace(field[1]))
+	}
+	return "LEEF:1.0|" + strings.Join(header, "|") + "|" + strings.Join(attrs, "\t")
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+	leefEscaper         = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
+
+// internalIP returns an address on the simulated corporate network
+func internalIP() string {
+	return fmt.Sprintf("10.%d.%d.%d", 10+rand.Intn(4), rand.Intn(32), 2+rand.Intn(250))
+}
+
+func ephemeralPort() string {
+	return strconv.Itoa(49152 + rand.Intn(16384))
+}
+
+func paloAltoTrafficEvent() securityEvent {
+	port := []string{"443", "443", "443", "80", "53", "22", "3389"}[rand.Intn(7)]
+	proto := "tcp"
+	if port == "53" {
+		proto = "udp"
+	}
+	action := "allow"
+	severity := 1
+	if rand.Intn(10) == 0 {
+		action, severity = "deny", 4
+	}
+	return securityEvent{
+		Vendor: "Palo Alto Networks", Product: "PAN-OS", Version: "10.2.4",
+		SignatureID: "end", Name: "TRAFFIC", Severity: severity,
+		Fields: [][2]string{
+			{"deviceExternalId", "0" + strconv.Itoa(10000000000+rand.Intn(899999999))},
+			{"src", internalIP()}, {"dst", gofakeit.IPv4Address()},
+			{"spt", ephemeralPort()}, {"dpt", port},
+			{"proto", proto},
+			{"act", action},
+			{"cs1", []string{"allow-outbound-web", "allow-dns", "default-deny"}[rand.Intn(3)]},
+			{"cat", []string{"business-and-economy", "computer-and-internet-info", "streaming-media", "unknown"}[rand.Intn(4)]},
+			{"in", strconv.Itoa(rand.Intn(200000))}, {"out", strconv.Itoa(rand.Intn(50000))},
+		},
+	}
+}
+
+func fortigateTrafficEvent() securityEvent {
+	action := []string{"accept", "accept", "accept", "close", "deny"}[rand.Intn(5)]
+	severity := 3
+	if action == "deny" {
+		severity = 5
+	}
+	return securityEvent{
+		Vendor: "Fortinet", Product: "Fortigate", Version: "v7.2.5",
+		SignatureID: "0000000013", Name: "traffic:forward " + action, Severity: severity,
+		Fields: [][2]string{
+			{"src", internalIP()}, {"spt", ephemeralPort()},
+			{"dst", gofakeit.IPv4Address()}, {"dpt", []string{"443", "80", "8443", "25"}[rand.Intn(4)]},
+			{"proto", "6"}, {"act", action},
+			{"deviceExternalId", "FGT60F" + strings.ToUpper(gofakeit.LetterN(10))},
+			{"msg", "Connection " + action},
+		},
+	}
+}
+
+func ciscoASADenyEvent() securityEvent {
+	src, dst := gofakeit.IPv4Address(), internalIP()
+	sport, dport := ephemeralPort(), []string{"22", "23", "445", "3389", "1433"}[rand.Intn(5)]
+	return securityEvent{
+		Vendor: "Cisco", Product: "ASA", Version: "9.16",
+		SignatureID: "106023", Severity: 5,
+		Name: fmt.Sprintf("Deny tcp src outside:%s/%s dst inside:%s/%s by access-group \"outside_access_in\"", src, sport, dst, dport),
+		Fields: [][2]string{
+			{"src", src}, {"spt", sport}, {"dst", dst}, {"dpt", dport},
+			{"proto", "TCP"}, {"act", "Deny"}, {"cs1", "outside_access_in"},
+		},
+	}
+}
+
+func zscalerWebEvent() securityEvent {
+	action, severity := "Allowed", 1
+	category := []string{"Professional Services", "Web Search", "Social Networking", "News and Media"}[rand.Intn(4)]
+	if rand.Intn(8) == 0 {
+		action, severity, category = "Blocked", 6, []string{"Malicious Content", "Phishing", "Anonymizer"}[rand.Intn(3)]
+	}
+	host := gofakeit.DomainName()
+	return securityEvent{
+		Vendor: "Zscaler", Product: "NSSWeblog", Version: "5.7",
+		SignatureID: action, Name: action, Severity: severity,
+		Fields: [][2]string{
+			{"act", action}, {"cat", category},
+			{"dhost", host}, {"dst", gofakeit.IPv4Address()},
+			{"src", internalIP()}, {"suser", strings.ToLower(gofakeit.FirstName()) + "@example.com"},
+			{"requestMethod", []string{"GET", "GET", "POST", "CONNECT"}[rand.Intn(4)]},
+			{"request", "https://" + host + "/" + gofakeit.Word()},
+			{"requestClientApplication", gofakeit.UserAgent()},
+		},
+	}
+}
+
+func windowsLogonFailureEvent() securityEvent {
+	user := windowsUsers[rand.Intn(len(windowsUsers))]
+	return securityEvent{
+		Vendor: "Microsoft", Product: "Microsoft Windows", Version: "",
+		SignatureID: "Microsoft-Windows-Security-Auditing:4625", Name: "An account failed to log on.", Severity: 5,
+		Fields: [][2]string{
+			{"cat", "Security"}, {"duser", user}, {"dntdom", "CORP"},
+			{"shost", fmt.Sprintf("WS-%04d", 1+rand.Intn(40))}, {"src", internalIP()},
+			{"dhost", fmt.Sprintf("DC%02d.corp.example.com", 1+rand.Intn(2))},
+			{"reason", "Unknown user name or bad password."},
+			{"outcome", "Failure"},
+		},
+	}
+}
+
+// snortRules are Emerging Threats signatures with their Snort priority
+var snortRules = []struct {
+	SID, Name string
+	Severity  int
+}{
+	{"1:2019401:3", "ET POLICY Vulnerable Java Version 1.8.x Detected", 3},
+	{"1:2010935:3", "ET SCAN Suspicious inbound to MSSQL port 1433", 6},
+	{"1:2001219:20", "ET SCAN Potential SSH Scan", 6},
+	{"1:2024792:4", "ET EXPLOIT Possible ETERNALBLUE MS17-010 Echo Response", 9},
+	{"1:2012887:3", "ET POLICY Http Client Body contains pass= in cleartext", 4},
+	{"1:2027865:3", "ET INFO Observed DNS Query to .cloud TLD", 2},
+}
+
+func snortAlertEvent() securityEvent {
+	rule := snortRules[rand.Intn(len(snortRules))]
+	return securityEvent{
+		Vendor: "Snort", Product: "Snort", Version: "2.9.20",
+		SignatureID: rule.SID, Name: rule.Name, Severity: rule.Severity,
+		Fields: [][2]string{
+			{"src", gofakeit.IPv4Address()}, {"spt", ephemeralPort()},
+			{"dst", internalIP()}, {"dpt", []string{"22", "80", "443", "445", "1433"}[rand.Intn(5)]},
+			{"proto", "TCP"}, {"act", "alert"},
+		},
+	}
+}
+
+func crowdStrikeDetectionEvent() securityEvent {
+	detection := []struct{ Name, Tactic string }{
+		{"Suspicious PowerShell command line", "Execution"},
+		{"Credential dumping via LSASS access", "Credential Access"},
+		{"Ransomware file encryption behaviour", "Impact"},
+		{"Known malware hash executed", "Malware"},
+	}[rand.Intn(4)]
+	host := fmt.Sprintf("WS-%04d", 1+rand.Intn(40))
+	return securityEvent{
+		Vendor: "CrowdStrike", Product: "FalconHost", Version: "1.0",
+		SignatureID: "DetectionSummaryEvent", Name: detection.Name, Severity: 7 + rand.Intn(4),
+		Fields: [][2]string{
+			{"shost", host}, {"src", internalIP()},
+			{"suser", windowsUsers[rand.Intn(len(windowsUsers))]},
+			{"cat", detection.Tactic},
+			{"fname", []string{"powershell.exe", "rundll32.exe", "procdump64.exe", "invoice.pdf.exe"}[rand.Intn(4)]},
+			{"act", []string{"Process Killed", "Quarantined", "Detection only"}[rand.Intn(3)]},
+			{"msg", detection.Name + " on " + host},
+		},
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// Supported values for CHECKS_FORMAT
+const (
+	checksFormatLogs    = "logs"
+	checksFormatMetrics = "metrics"
+)
+
+var (
+	checkResultsSent  int64
+	checkSendAttempts int64
+	checkSendErrors   int64
+
+	checksConfig = loadChecksConfig()
+)
+
+type ChecksConfig struct {
+	// Endpoint receives OTLP/JSON logs or metrics, one request per round;
+	// empty disables synthetic checks
+	Endpoint string
+	// Format is logs (one log record per result) or metrics (gauges)
+	Format string
+	// Interval is how often every target is checked from every region
+	Interval time.Duration
+	Targets  int
+	Regions  []string
+	// FailurePercent is the chance a healthy target starts an outage in a round
+	FailurePercent float64
+}
+
+func loadChecksConfig() ChecksConfig {
+	cfg := ChecksConfig{
+		Endpoint:       os.Getenv("CHECKS_ENDPOINT"),
+		Format:         getEnvOrDefault("CHECKS_FORMAT", checksFormatLogs),
+		Interval:       getEnvDuration("CHECKS_INTERVAL", time.Minute),
+		Targets:        getEnvInt("CHECKS_TARGETS", 20),
+		FailurePercent: getEnvFloat("CHECKS_FAILURE_PERCENT", 2),
+	}
+	for _, region := range strings.Split(getEnvOrDefault("CHECKS_REGIONS", "us-east-1,eu-west-1,ap-southeast-1"), ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			cfg.Regions = append(cfg.Regions, region)
+		}
+	}
+	return cfg
+}
+
+// checkTarget is a monitored URL. While down is above zero the target is in
+// an outage and fails from every region.
+type checkTarget struct {
+	ID   string
+	Name string
+	URL  string
+	down int
+}
+
+// checkResult is the outcome of one check run from one region
+type checkResult struct {
+	Target   *checkTarget
+	Region   string
+	Success  bool
+	Status   int
+	Duration time.Duration
+	// Phases of the request; zero when the check failed before reaching them
+	DNS, Connect, TLS, FirstByte time.Duration
+	Error                        string
+}
+
+func newCheckTargets(n int) []*checkTarget {
+	paths := []string{"/", "/health", "/login", "/api/status", "/checkout"}
+	targets := make([]*checkTarget, n)
+	for i := range targets {
+		host := gofakeit.DomainName()
+		path := paths[rand.Intn(len(paths))]
+		targets[i] = &checkTarget{
+			ID:   gofakeit.UUID(),
+			Name: fmt.Sprintf("%s %s", host, path),
+			URL:  "https://" + host + path,
+		}
+	}
+	return targets
+}
+
+// runChecks advances outages and returns one result per target and region
+func runChecks(targets []*checkTarget) []checkResult {
+	results := make([]checkResult, 0, len(targets)*len(checksConfig.Regions))
+	for _, t := range targets {
+		if t.down > 0 {
+			t.down--
+		} else if rand.Float64()*100 < checksConfig.FailurePercent {
+			// Outages last a few rounds so consecutive-failure alerts fire
+			t.down = 3 + rand.Intn(8)
+		}
+		for _, region := range checksConfig.Regions {
+			results = append(results, runCheck(t, region))
+		}
+	}
+	return results
+}
+
+func runCheck(t *checkTarget, region string) checkResult {
+	r := checkResult{
+		Target:    t,
+		Region:    region,
+		Success:   true,
+		Status:    http.StatusOK,
+		DNS:       time.Duration(1+rand.Intn(30)) * time.Millisecond,
+		Connect:   time.Duration(5+rand.Intn(80)) * time.Millisecond,
+		TLS:       time.Duration(10+rand.Intn(120)) * time.Millisecond,
+		FirstByte: latencyDist.SampleDuration(),
+	}
+	switch {
+	case t.down > 0:
+		r.Success = false
+		switch rand.Intn(3) {
+		case 0:
+			r.Status, r.Error = http.StatusServiceUnavailable, "unexpected status code 503"
+		case 1:
+			r.Status, r.Error = http.StatusBadGateway, "unexpected status code 502"
+		default:
+			r.Status, r.Error = 0, "connection refused"
+			r.TLS, r.FirstByte = 0, 0
+		}
+	case rand.Intn(100) == 0:
+		// A single region occasionally times out on its own
+		r.Success, r.Status, r.Error = false, 0, "timeout after 10s"
+		r.FirstByte = 10*time.Second - r.DNS - r.Connect - r.TLS
+	}
+	r.Duration = r.DNS + r.Connect + r.TLS + r.FirstByte + time.Duration(rand.Intn(20))*time.Millisecond
+	return r
+}
+
+func (r checkResult) attributes() []otlpKeyValue {
+	attrs := []otlpKeyValue{
+		otlpString("check.id", r.Target.ID),
+		otlpString("check.name", r.Target.Name),
+		otlpString("check.type", "http"),
+		otlpString("check.region", r.Region),
+		otlpString("url.full", r.Target.URL),
+	}
+	if r.Status != 0 {
+		attrs = append(attrs, otlpInt("http.response.status_code", int64(r.Status)))
+	}
+	return attrs
+}
+
+// encodeCheckResults renders a round of results as OTLP/JSON logs or metrics
+func encodeCheckResults(results []checkResult, now time.Time) ([]byte, error) {
+	resource := otlpResource{Attributes: []otlpKeyValue{otlpString("service.name", "synthetics")}}
+	scope := otlpScope{Name: otlpScopeName}
+	nanos := otlpUnixNano(now.UnixNano())
+
+	if checksConfig.Format == checksFormatMetrics {
+		var success, duration, status []otlpNumberDataPoint
+		for _, r := range results {
+			point := func(value float64) otlpNumberDataPoint {
+				return otlpNumberDataPoint{Attributes: r.attributes(), StartTimeUnixNano: nanos, TimeUnixNano: nanos, AsDouble: value}
+			}
+			up := 0.0
+			if r.Success {
+				up = 1
+			}
+			success = append(success, point(up))
+			duration = append(duration, point(r.Duration.Seconds()))
+			status = append(status, point(float64(r.Status)))
+		}
+		request := otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+			Resource: resource,
+			ScopeMetrics: []otlpScopeMetrics{{Scope: scope, Metrics: []otlpMetric{
+				{Name: "synthetics.check.success", Description: "Whether the check passed", Gauge: &otlpGauge{DataPoints: success}},
+				{Name: "synthetics.check.duration", Description: "Total check duration", Unit: "s", Gauge: &otlpGauge{DataPoints: duration}},
+				{Name: "synthetics.check.status_code", Description: "HTTP status code returned, 0 when none", Gauge: &otlpGauge{DataPoints: status}},
+			}}},
+		}}}
+		return json.Marshal(request)
+	}
+
+	records := make([]otlpLogRecord, len(results))
+	for i, r := range results {
+		severity, severityText := severityNumbers["info"], "INFO"
+		body := fmt.Sprintf("Check %q passed from %s in %dms", r.Target.Name, r.Region, r.Duration.Milliseconds())
+		if !r.Success {
+			severity, severityText = severityNumbers["error"], "ERROR"
+			body = fmt.Sprintf("Check %q failed from %s: %s", r.Target.Name, r.Region, r.Error)
+		}
+		attrs := append(r.attributes(),
+			otlpBool("check.success", r.Success),
+			otlpInt("check.duration_ms", r.Duration.Milliseconds()),
+			otlpInt("check.timing.dns_ms", r.DNS.Milliseconds()),
+			otlpInt("check.timing.connect_ms", r.Connect.Milliseconds()),
+			otlpInt("check.timing.tls_ms", r.TLS.Milliseconds()),
+			otlpInt("check.timing.first_byte_ms", r.FirstByte.Milliseconds()))
+		if r.Error != "" {
+			attrs = append(attrs, otlpString("error.message", r.Error))
+		}
+		records[i] = otlpLogRecord{
+			TimeUnixNano:         nanos,
+			ObservedTimeUnixNano: nanos,
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 otlpAnyValue{StringValue: &body},
+			Attributes:           attrs,
+		}
+	}
+	request := otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource:  resource,
+		ScopeLogs: []otlpScopeLogs{{Scope: scope, LogRecords: records}},
+	}}}
+	return json.Marshal(request)
+}
+
+// sendCheckResults posts one round of results
+func sendCheckResults(ctx context.Context, client *http.Client, results []checkResult, now time.Time) error {
+	payload, err := encodeCheckResults(results, now)
+	if err != nil {
+		return fmt.Errorf("failed to marshal check results: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, checksConfig.Endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.apply(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send check results: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+	}
+	atomic.AddInt64(&checkResultsSent, int64(len(results)))
+	atomic.AddInt64(&totalBytesSent, int64(len(payload)))
+	return nil
+}
+
+// generateChecks runs every target from every region each CHECKS_INTERVAL
+// until ctx is done
+func generateChecks(ctx context.Context, wg *sync.WaitGroup, client *http.Client) {
+	defer wg.Done()
+	log.Printf("Starting synthetic checks (%s): %d targets from %d regions every %v",
+		checksConfig.Format, checksConfig.Targets, len(checksConfig.Regions), checksConfig.Interval)
+
+	targets := newCheckTargets(checksConfig.Targets)
+	ticker := time.NewTicker(checksConfig.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping synthetic checks...")
+			return
+		case now := <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			results := runChecks(targets)
+			atomic.AddInt64(&checkSendAttempts, 1)
+			if err := sendCheckResults(ctx, client, results, now); err != nil {
+				if errors.Is(err, context.Canceled) {
+					log.Println("Stopping synthetic checks...")
+					return
+				}
+				atomic.AddInt64(&checkSendErrors, 1)
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					log.Printf("Checks endpoint throttled, pausing %v", throttled.RetryAfter)
+					select {
+					case <-ctx.Done():
+						log.Println("Stopping synthetic checks...")
+						return
+					case <-time.After(throttled.RetryAfter):
+					}
+				} else {
+					log.Printf("Failed to send check results: %v", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// clientGeo is a location clients connect from
+type clientGeo struct {
+	Country, Region, City string
+	Lat, Lon              float64
+}
+
+// clientGeos are the locations of the default client networks and of RUM
+// sessions
+var clientGeos = []clientGeo{
+	{"US", "US-NY", "New York", 40.71, -74.01},
+	{"US", "US-CA", "San Francisco", 37.77, -122.42},
+	{"GB", "GB-LND", "London", 51.51, -0.13},
+	{"DE", "DE-BE", "Berlin", 52.52, 13.40},
+	{"IN", "IN-KA", "Bengaluru", 12.97, 77.59},
+	{"JP", "JP-13", "Tokyo", 35.68, 139.69},
+	{"BR", "BR-SP", "São Paulo", -23.55, -46.63},
+	{"AU", "AU-NSW", "Sydney", -33.87, 151.21},
+}
+
+// defaultClientNetworks are ranges of large ISPs in each of clientGeos, so
+// GeoIP databases place most addresses near the location they're tagged
+// with, weighted roughly by internet population
+const defaultClientNetworks = "72.229.0.0/16@US-NY:15,2603:7000::/24@US-NY:15," +
+	"98.207.0.0/16@US-CA:15,2601:640::/28@US-CA:15," +
+	"81.2.69.0/24@GB-LND:10,2a02:c7c::/32@GB-LND:10," +
+	"85.214.0.0/15@DE-BE:10,2a01:238::/32@DE-BE:10," +
+	"49.204.0.0/14@IN-KA:15,2401:4900::/32@IN-KA:15," +
+	"126.0.0.0/8@JP-13:10,2400:4050::/30@JP-13:10," +
+	"177.32.0.0/12@BR-SP:10,2804:14c::/32@BR-SP:10," +
+	"1.120.0.0/13@AU-NSW:5,2001:8003::/32@AU-NSW:5"
+
+// clientNetwork is a range client addresses are drawn from, with the
+// location of its clients, if known
+type clientNetwork struct {
+	Prefix netip.Prefix
+	Geo    *clientGeo
+	Weight float64
+}
+
+// clientConfig sets where the clients of access logs, security scenarios
+// and RUM sessions connect from
+var clientConfig = struct {
+	Networks []clientNetwork
+	// IPv6Percent of clients connect from an IPv6 network
+	IPv6Percent float64
+	// Geo attaches the location of the client to records
+	Geo bool
+}{
+	Networks:    loadClientNetworks(getEnvOrDefault("LOG_CLIENT_NETWORKS", defaultClientNetworks)),
+	IPv6Percent: getEnvFloat("LOG_CLIENT_IPV6_PERCENT", 0),
+	Geo:         getEnvBool("LOG_CLIENT_GEO", false),
+}
+
+// loadClientNetworks parses a comma-separated list of CIDRs, each with an
+// optional @region of clientGeos and :weight, e.g.
+// "81.2.69.0/24@GB-LND:3,2001:db8::/32"
+func loadClientNetworks(value string) []clientNetwork {
+	var networks []clientNetwork
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		network, err := parseClientNetwork(field)
+		if err != nil {
+			configProblem("LOG_CLIENT_NETWORKS=%q is invalid: %v", value, err)
+			return nil
+		}
+		networks = append(networks, network)
+	}
+	if len(networks) == 0 {
+		configProblem("LOG_CLIENT_NETWORKS is empty")
+	}
+	return networks
+}
+
+func parseClientNetwork(field string) (clientNetwork, error) {
+	network := clientNetwork{Weight: 1}
+	// IPv6 addresses contain colons, so a weight can only follow the
+	// prefix length
+	spec := field
+	if slash := strings.Index(field, "/"); slash >= 0 {
+		if colon := strings.LastIndex(field[slash:], ":"); colon >= 0 {
+			weight, err := strconv.ParseFloat(field[slash+colon+1:], 64)
+			if err != nil || weight < 0 {
+				return network, fmt.Errorf("invalid weight in %q", field)
+			}
+			spec, network.Weight = field[:slash+colon], weight
+		}
+	}
+	cidr, region, hasRegion := strings.Cut(spec, "@")
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return network, err
+	}
+	network.Prefix = prefix.Masked()
+	if hasRegion {
+		for i := range clientGeos {
+			if strings.EqualFold(clientGeos[i].Region, region) {
+				network.Geo = &clientGeos[i]
+			}
+		}
+		if network.Geo == nil {
+			return network, fmt.Errorf("unknown region %q in %q", region, field)
+		}
+	}
+	return network, nil
+}
+
+// formatClientNetworks renders networks as LOG_CLIENT_NETWORKS takes them
+func formatClientNetworks(networks []clientNetwork) string {
+	parts := make([]string, len(networks))
+	for i, n := range networks {
+		parts[i] = n.Prefix.String()
+		if n.Geo != nil {
+			parts[i] += "@" + n.Geo.Region
+		}
+		parts[i] += ":" + strconv.FormatFloat(n.Weight, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// hasIPv6ClientNetworks reports whether any client network is IPv6
+func hasIPv6ClientNetworks() bool {
+	for _, n := range clientConfig.Networks {
+		if !n.Prefix.Addr().Is4() {
+			return true
+		}
+	}
+	return false
+}
+
+// randomClientIP returns the address of a client in one of the networks,
+// from an IPv6 network for LOG_CLIENT_IPV6_PERCENT of clients
+func randomClientIP() string {
+	ipv6 := rand.Float64()*100 < clientConfig.IPv6Percent
+	var networks []clientNetwork
+	total := 0.0
+	for _, n := range clientConfig.Networks {
+		if n.Prefix.Addr().Is4() != ipv6 {
+			networks = append(networks, n)
+			total += n.Weight
+		}
+	}
+	if len(networks) == 0 {
+		networks = clientConfig.Networks
+		for _, n := range networks {
+			total += n.Weight
+		}
+	}
+	network := networks[len(networks)-1]
+	r := rand.Float64() * total
+	for _, n := range networks {
+		if r -= n.Weight; r < 0 {
+			network = n
+			break
+		}
+	}
+	return randomAddrIn(network.Prefix).String()
+}
+
+// randomAddrIn returns a random address of prefix, avoiding the network and
+// broadcast addresses of IPv4 subnets
+func randomAddrIn(prefix netip.Prefix) netip.Addr {
+	bits := prefix.Bits()
+	for {
+		b := prefix.Addr().AsSlice()
+		for i := range b {
+			start := i * 8
+			if start+8 <= bits {
+				continue
+			}
+			mask := byte(0xff)
+			if start < bits {
+				mask >>= bits - start
+			}
+			b[i] = b[i]&^mask | byte(rand.Intn(256))&mask
+		}
+		addr, _ := netip.AddrFromSlice(b)
+		last := b[len(b)-1]
+		if addr.Is4() && bits <= 24 && (last == 0 || last == 255) {
+			continue
+		}
+		return addr
+	}
+}
+
+// clientGeoOf returns the location of the network ip is in, or nil
+func clientGeoOf(ip string) *clientGeo {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	for _, n := range clientConfig.Networks {
+		if n.Prefix.Contains(addr) {
+			return n.Geo
+		}
+	}
+	return nil
+}
+
+// logClient is the client of a request and where it connected from, in
+// Elastic Common Schema field names
+type logClient struct {
+	IP       string    `json:"client.ip"`
+	Country  string    `json:"client.geo.country_iso_code,omitempty"`
+	Region   string    `json:"client.geo.region_iso_code,omitempty"`
+	City     string    `json:"client.geo.city_name,omitempty"`
+	Location *geoPoint `json:"client.geo.location,omitempty"`
+}
+
+// geoPoint is an Elasticsearch geo_point
+type geoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// newLogClient returns the client ip with the location of its network, if
+// LOG_CLIENT_GEO is on
+func newLogClient(ip string) *logClient {
+	if !clientConfig.Geo {
+		return nil
+	}
+	client := &logClient{IP: ip}
+	if geo := clientGeoOf(ip); geo != nil {
+		client.Country, client.Region, client.City = geo.Country, geo.Region, geo.City
+		client.Location = &geoPoint{Lat: geo.Lat, Lon: geo.Lon}
+	}
+	return client
+}
+
+// attributes returns the client as OTel attributes, as RUM spans carry them
+func (c *logClient) attributes() []otlpKeyValue {
+	attrs := []otlpKeyValue{otlpString("client.address", c.IP)}
+	if c.Location != nil {
+		attrs = append(attrs,
+			otlpString("geo.country.iso_code", c.Country),
+			otlpString("geo.region.iso_code", c.Region),
+			otlpString("geo.locality.name", c.City),
+			otlpKeyValue{Key: "geo.location.lat", Value: otlpAnyValue{DoubleValue: &c.Location.Lat}},
+			otlpKeyValue{Key: "geo.location.lon", Value: otlpAnyValue{DoubleValue: &c.Location.Lon}})
+	}
+	return attrs
+}
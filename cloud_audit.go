@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// LOG_CONTENT values for cloud provider audit trails
+const (
+	logContentCloudTrail = "cloudtrail"
+	logContentGCPAudit   = "gcp_audit"
+)
+
+// cloudAuditAction is an API call found in both providers' audit trails
+type cloudAuditAction struct {
+	Name   string
+	Weight float64
+	// ReadOnly calls don't change anything; Data calls touch data rather
+	// than configuration and are logged as data events / data access
+	ReadOnly, Data                    bool
+	AWSSource, AWSEvent               string
+	GCPService, GCPMethod, Permission string
+}
+
+var cloudAuditActions = []cloudAuditAction{
+	{"object_read", 30, true, true, "s3.amazonaws.com", "GetObject", "storage.googleapis.com", "storage.objects.get", "storage.objects.get"},
+	{"object_write", 10, false, true, "s3.amazonaws.com", "PutObject", "storage.googleapis.com", "storage.objects.create", "storage.objects.create"},
+	{"assume_role", 15, true, false, "sts.amazonaws.com", "AssumeRole", "iamcredentials.googleapis.com", "GenerateAccessToken", "iam.serviceAccounts.getAccessToken"},
+	{"list_instances", 15, true, false, "ec2.amazonaws.com", "DescribeInstances", "compute.googleapis.com", "v1.compute.instances.list", "compute.instances.list"},
+	{"decrypt", 10, true, true, "kms.amazonaws.com", "Decrypt", "cloudkms.googleapis.com", "Decrypt", "cloudkms.cryptoKeyVersions.useToDecrypt"},
+	{"get_secret", 8, true, true, "secretsmanager.amazonaws.com", "GetSecretValue", "secretmanager.googleapis.com", "google.cloud.secretmanager.v1.SecretManagerService.AccessSecretVersion", "secretmanager.versions.access"},
+	{"console_login", 4, false, false, "signin.amazonaws.com", "ConsoleLogin", "login.googleapis.com", "google.login.LoginService.loginSuccess", ""},
+	{"start_instance", 2, false, false, "ec2.amazonaws.com", "RunInstances", "compute.googleapis.com", "v1.compute.instances.insert", "compute.instances.create"},
+	{"bucket_policy", 1, false, false, "s3.amazonaws.com", "PutBucketPolicy", "storage.googleapis.com", "storage.setIamPermissions", "storage.buckets.setIamPolicy"},
+	{"create_user", 1, false, false, "iam.amazonaws.com", "CreateUser", "iam.googleapis.com", "google.iam.admin.v1.CreateServiceAccount", "iam.serviceAccounts.create"},
+	{"grant_admin", 0.5, false, false, "iam.amazonaws.com", "AttachUserPolicy", "cloudresourcemanager.googleapis.com", "SetIamPolicy", "resourcemanager.projects.setIamPolicy"},
+	{"stop_logging", 0.1, false, false, "cloudtrail.amazonaws.com", "StopLogging", "logging.googleapis.com", "google.logging.v2.ConfigServiceV2.DeleteSink", "logging.sinks.delete"},
+}
+
+var cloudAuditConfig = loadCloudAuditConfig()
+
+type CloudAuditConfig struct {
+	// Actions weights the API calls that are logged
+	Actions []weightedName
+	// ErrorPercent of calls are denied
+	ErrorPercent float64
+	// Accounts is the number of AWS accounts / GCP projects calls are spread over
+	Accounts int
+}
+
+func loadCloudAuditConfig() CloudAuditConfig {
+	cfg := CloudAuditConfig{
+		ErrorPercent: getEnvFloat("CLOUD_AUDIT_ERROR_PERCENT", 5),
+		Accounts:     getEnvInt("CLOUD_ACCOUNTS", 3),
+	}
+	for _, action := range cloudAuditActions {
+		cfg.Actions = append(cfg.Actions, weightedName{action.Name, action.Weight})
+	}
+	value := os.Getenv("CLOUD_AUDIT_EVENTS")
+	if value == "" {
+		return cfg
+	}
+	actions, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("CLOUD_AUDIT_EVENTS=%q is invalid: %v", value, err)
+		return cfg
+	}
+	for _, action := range actions {
+		if _, ok := findCloudAuditAction(action.Name); !ok {
+			configProblem("CLOUD_AUDIT_EVENTS lists unknown event %q (use %s)", action.Name, strings.Join(cloudAuditActionNames(), ", "))
+			return cfg
+		}
+	}
+	cfg.Actions = actions
+	return cfg
+}
+
+// findCloudAuditAction returns the action called name
+func findCloudAuditAction(name string) (cloudAuditAction, bool) {
+	for _, action := range cloudAuditActions {
+		if action.Name == name {
+			return action, true
+		}
+	}
+	return cloudAuditAction{}, false
+}
+
+// cloudAuditActionNames lists the supported CLOUD_AUDIT_EVENTS names
+func cloudAuditActionNames() []string {
+	names := make([]string, len(cloudAuditActions))
+	for i, action := range cloudAuditActions {
+		names[i] = action.Name
+	}
+	return names
+}
+
+var (
+	cloudAuditRegions = []string{"us-east-1", "us-west-2", "eu-west-1", "ap-southeast-2"}
+	cloudAuditPeople  = []string{"alice", "bob", "carol", "dave", "erin", "frank"}
+)
+
+// cloudAuditCall is the provider-neutral description of one logged call
+type cloudAuditCall struct {
+	Action   cloudAuditAction
+	Account  int
+	Region   string
+	Time     time.Time
+	Denied   bool
+	Person   string // set for human callers, otherwise the caller is a service
+	Service  string
+	SourceIP string
+	// UserAgent is empty for services, which use their provider's SDK
+	UserAgent string
+	// Resource is the bucket/object, instance, key, secret or principal acted on
+	Resource string
+}
+
+// newCloudAuditCall picks the next call to log
+func newCloudAuditCall(now time.Time) cloudAuditCall {
+	action, _ := findCloudAuditAction(pickWeighted(cloudAuditConfig.Actions))
+	call := cloudAuditCall{
+		Action:  action,
+		Account: rand.Intn(cloudAuditConfig.Accounts),
+		Region:  cloudAuditRegions[rand.Intn(len(cloudAuditRegions))],
+		Time:    now,
+		Denied:  rand.Float64()*100 < cloudAuditConfig.ErrorPercent,
+		Service: randomJob(),
+	}
+	// Workloads make most calls; people log in and change IAM
+	if action.Name == "console_login" || (!action.ReadOnly && !action.Data) || rand.Intn(10) == 0 {
+		call.Person = cloudAuditPeople[rand.Intn(len(cloudAuditPeople))]
+		call.SourceIP = gofakeit.IPv4Address()
+		call.UserAgent = gofakeit.UserAgent()
+	} else {
+		call.SourceIP = fmt.Sprintf("10.%d.%d.%d", call.Account, rand.Intn(16), 2+rand.Intn(250))
+	}
+
+	switch action.Name {
+	case "object_read", "object_write":
+		call.Resource = fmt.Sprintf("%s-data/%s/%s.json", call.Service, now.UTC().Format("2006/01/02"), gofakeit.UUID())
+	case "list_instances", "start_instance":
+		call.Resource = fmt.Sprintf("i-%017x", rand.Int63n(1<<60))
+	case "decrypt":
+		call.Resource = call.Service + "-key"
+	case "get_secret":
+		call.Resource = call.Service + "/credentials"
+	case "bucket_policy":
+		call.Resource = call.Service + "-data"
+	case "assume_role":
+		call.Resource = call.Service + "-role"
+	case "create_user", "grant_admin":
+		call.Resource = strings.ToLower(gofakeit.FirstName())
+	case "stop_logging":
+		call.Resource = "organization-trail"
+	}
+	return call
+}
+
+// cloudAuditAccountID is the 12-digit id of AWS account n
+func cloudAuditAccountID(n int) string {
+	return fmt.Sprintf("%012d", 111122223333+n*101010101)
+}
+
+// cloudAuditProject is the id of GCP project n
+func cloudAuditProject(n int) string {
+	return fmt.Sprintf("loadgen-%s-%d", []string{"prod", "staging", "shared"}[n%3], 100000+n*7919)
+}
+
+// generateCloudAudit fills record with a CloudTrail or GCP Cloud Audit Logs
+// event of content's provider. Denied calls are logged as warnings.
+func generateCloudAudit(record *LogRecord, content string) {
+	call := newCloudAuditCall(record.Time)
+	var event any
+	if content == logContentCloudTrail {
+		record.Job = "cloudtrail"
+		event = cloudTrailEvent(call)
+	} else {
+		record.Job = "cloud-audit-logs"
+		event = gcpAuditEntry(call)
+	}
+	record.Level = "info"
+	if call.Denied {
+		record.Level = "warn"
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		record.Log = fmt.Sprintf("failed to marshal audit event: %v", err)
+		return
+	}
+	record.Log = string(data)
+}
+
+type cloudTrailIdentity struct {
+	Type        string `json:"type"`
+	PrincipalID string `json:"principalId"`
+	ARN         string `json:"arn"`
+	AccountID   string `json:"accountId"`
+	AccessKeyID string `json:"accessKeyId,omitempty"`
+	UserName    string `json:"userName,omitempty"`
+}
+
+// cloudTrailRecord is a CloudTrail event record
+type cloudTrailRecord struct {
+	EventVersion       string             `json:"eventVersion"`
+	UserIdentity       cloudTrailIdentity `json:"userIdentity"`
+	EventTime          string             `json:"eventTime"`
+	EventSource        string             `json:"eventSource"`
+	EventName          string             `json:"eventName"`
+	AWSRegion          string             `json:"awsRegion"`
+	SourceIPAddress    string             `json:"sourceIPAddress"`
+	UserAgent          string             `json:"userAgent"`
+	ErrorCode          string             `json:"errorCode,omitempty"`
+	ErrorMessage       string             `json:"errorMessage,omitempty"`
+	RequestParameters  map[string]any     `json:"requestParameters"`
+	ResponseElements   map[string]any     `json:"responseElements"`
+	RequestID          string             `json:"requestID"`
+	EventID            string             `json:"eventID"`
+	ReadOnly           bool               `json:"readOnly"`
+	EventType          string             `json:"eventType"`
+	ManagementEvent    bool               `json:"managementEvent"`
+	RecipientAccountID string             `json:"recipientAccountId"`
+	EventCategory      string             `json:"eventCategory"`
+}
+
+func cloudTrailEvent(call cloudAuditCall) cloudTrailRecord {
+	account := cloudAuditAccountID(call.Account)
+	identity := cloudTrailIdentity{AccountID: account}
+	if call.Person != "" {
+		identity.Type = "IAMUser"
+		identity.PrincipalID = fmt.Sprintf("AIDA%016X", fnvString(call.Person))
+		identity.ARN = "arn:aws:iam::" + account + ":user/" + call.Person
+		identity.UserName = call.Person
+	} else {
+		role := call.Service + "-role"
+		identity.Type = "AssumedRole"
+		identity.PrincipalID = fmt.Sprintf("AROA%016X:%s", fnvString(role), call.Service)
+		identity.ARN = "arn:aws:sts::" + account + ":assumed-role/" + role + "/" + call.Service
+		identity.AccessKeyID = fmt.Sprintf("ASIA%016X", rand.Uint64())
+	}
+
+	if call.UserAgent == "" {
+		call.UserAgent = "aws-sdk-go-v2/1.30.3 os/linux lang/go#1.22.5"
+	}
+	action := call.Action
+	event := cloudTrailRecord{
+		EventVersion:       "1.09",
+		UserIdentity:       identity,
+		EventTime:          call.Time.UTC().Format(time.RFC3339),
+		EventSource:        action.AWSSource,
+		EventName:          action.AWSEvent,
+		AWSRegion:          call.Region,
+		SourceIPAddress:    call.SourceIP,
+		UserAgent:          call.UserAgent,
+		RequestID:          strings.ToUpper(fmt.Sprintf("%016x", rand.Uint64())),
+		EventID:            gofakeit.UUID(),
+		ReadOnly:           action.ReadOnly,
+		EventType:          "AwsApiCall",
+		ManagementEvent:    !action.Data,
+		RecipientAccountID: account,
+		EventCategory:      "Management",
+	}
+	if action.Data && action.AWSSource == "s3.amazonaws.com" {
+		event.EventCategory = "Data"
+	}
+
+	bucket, key, _ := strings.Cut(call.Resource, "/")
+	switch action.Name {
+	case "object_read", "object_write":
+		event.RequestParameters = map[string]any{"bucketName": bucket, "key": key}
+	case "bucket_policy":
+		event.RequestParameters = map[string]any{"bucketName": bucket}
+	case "list_instances":
+		event.RequestParameters = map[string]any{"instancesSet": map[string]any{"items": []map[string]string{{"instanceId": call.Resource}}}}
+	case "start_instance":
+		event.RequestParameters = map[string]any{"instanceType": "m5.large", "minCount": 1, "maxCount": 1}
+		if !call.Denied {
+			event.ResponseElements = map[string]any{"instancesSet": map[string]any{"items": []map[string]string{{"instanceId": call.Resource}}}}
+		}
+	case "decrypt":
+		event.RequestParameters = map[string]any{"encryptionAlgorithm": "SYMMETRIC_DEFAULT"}
+	case "get_secret":
+		event.RequestParameters = map[string]any{"secretId": "arn:aws:secretsmanager:" + call.Region + ":" + account + ":secret:" + call.Resource}
+	case "assume_role":
+		event.RequestParameters = map[string]any{"roleArn": "arn:aws:iam::" + account + ":role/" + call.Resource, "roleSessionName": call.Service}
+	case "create_user":
+		event.RequestParameters = map[string]any{"userName": call.Resource}
+	case "grant_admin":
+		event.RequestParameters = map[string]any{"userName": call.Resource, "policyArn": "arn:aws:iam::aws:policy/AdministratorAccess"}
+	case "stop_logging":
+		event.RequestParameters = map[string]any{"name": "arn:aws:cloudtrail:" + call.Region + ":" + account + ":trail/" + call.Resource}
+	case "console_login":
+		event.EventType = "AwsConsoleSignIn"
+		event.EventSource = "signin.amazonaws.com"
+		event.RequestParameters = nil
+		result := "Success"
+		if call.Denied {
+			result = "Failure"
+			event.ErrorMessage = "Failed authentication"
+		}
+		event.ResponseElements = map[string]any{"ConsoleLogin": result}
+		return event
+	}
+	if call.Denied {
+		event.ErrorCode = "AccessDenied"
+		event.ErrorMessage = fmt.Sprintf("User: %s is not authorized to perform: %s:%s",
+			identity.ARN, strings.TrimSuffix(action.AWSSource, ".amazonaws.com"), action.AWSEvent)
+		event.ResponseElements = nil
+	}
+	return event
+}
+
+// fnvString hashes s, to derive stable ids from names
+func fnvString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+type gcpAuditAuthorization struct {
+	Resource   string `json:"resource"`
+	Permission string `json:"permission"`
+	Granted    bool   `json:"granted"`
+}
+
+type gcpAuditStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type gcpAuditLog struct {
+	Type               string         `json:"@type"`
+	Status             gcpAuditStatus `json:"status"`
+	AuthenticationInfo struct {
+		PrincipalEmail string `json:"principalEmail"`
+	} `json:"authenticationInfo"`
+	RequestMetadata struct {
+		CallerIP                string `json:"callerIp"`
+		CallerSuppliedUserAgent string `json:"callerSuppliedUserAgent"`
+	} `json:"requestMetadata"`
+	ServiceName       string                  `json:"serviceName"`
+	MethodName        string                  `json:"methodName"`
+	AuthorizationInfo []gcpAuditAuthorization `json:"authorizationInfo,omitempty"`
+	ResourceName      string                  `json:"resourceName"`
+}
+
+type gcpMonitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+// gcpAuditLogEntry is a Cloud Logging LogEntry holding an AuditLog
+type gcpAuditLogEntry struct {
+	ProtoPayload     gcpAuditLog          `json:"protoPayload"`
+	InsertID         string               `json:"insertId"`
+	Resource         gcpMonitoredResource `json:"resource"`
+	Timestamp        string               `json:"timestamp"`
+	Severity         string               `json:"severity"`
+	LogName          string               `json:"logName"`
+	ReceiveTimestamp string               `json:"receiveTimestamp"`
+}
+
+func gcpAuditEntry(call cloudAuditCall) gcpAuditLogEntry {
+	project := cloudAuditProject(call.Account)
+	action := call.Action
+
+	var payload gcpAuditLog
+	payload.Type = "type.googleapis.com/google.cloud.audit.AuditLog"
+	payload.ServiceName = action.GCPService
+	payload.MethodName = action.GCPMethod
+	if call.Person != "" {
+		payload.AuthenticationInfo.PrincipalEmail = call.Person + "@example.com"
+	} else {
+		payload.AuthenticationInfo.PrincipalEmail = call.Service + "@" + project + ".iam.gserviceaccount.com"
+	}
+	payload.RequestMetadata.CallerIP = call.SourceIP
+	if call.UserAgent == "" {
+		call.UserAgent = "google-api-go-client/0.5 gl-go/1.22.5 gdcl/0.189.0"
+	}
+	payload.RequestMetadata.CallerSuppliedUserAgent = call.UserAgent
+
+	resource := gcpMonitoredResource{Type: "project", Labels: map[string]string{"project_id": project}}
+	zone := gcpZone(call.Region)
+	bucket, object, _ := strings.Cut(call.Resource, "/")
+	switch action.Name {
+	case "object_read", "object_write":
+		payload.ResourceName = "projects/_/buckets/" + bucket + "/objects/" + object
+		resource = gcpMonitoredResource{Type: "gcs_bucket", Labels: map[string]string{"project_id": project, "bucket_name": bucket, "location": zone[:len(zone)-2]}}
+	case "bucket_policy":
+		payload.ResourceName = "projects/_/buckets/" + bucket
+		resource = gcpMonitoredResource{Type: "gcs_bucket", Labels: map[string]string{"project_id": project, "bucket_name": bucket, "location": zone[:len(zone)-2]}}
+	case "list_instances", "start_instance":
+		payload.ResourceName = "projects/" + project + "/zones/" + zone + "/instances/" + call.Resource
+		resource = gcpMonitoredResource{Type: "gce_instance", Labels: map[string]string{"project_id": project, "zone": zone, "instance_id": fmt.Sprint(fnvString(call.Resource) >> 1)}}
+	case "decrypt":
+		payload.ResourceName = "projects/" + project + "/locations/global/keyRings/" + call.Service + "/cryptoKeys/" + call.Resource
+	case "get_secret":
+		payload.ResourceName = "projects/" + project + "/secrets/" + strings.ReplaceAll(call.Resource, "/", "-") + "/versions/latest"
+	case "assume_role":
+		payload.ResourceName = "projects/-/serviceAccounts/" + call.Resource + "@" + project + ".iam.gserviceaccount.com"
+	case "create_user":
+		payload.ResourceName = "projects/" + project + "/serviceAccounts/" + call.Resource + "@" + project + ".iam.gserviceaccount.com"
+	case "grant_admin":
+		payload.ResourceName = "projects/" + project
+	case "stop_logging":
+		payload.ResourceName = "projects/" + project + "/sinks/" + call.Resource
+	case "console_login":
+		payload.ResourceName = "organizations/" + fmt.Sprint(fnvString(project)>>20)
+		resource = gcpMonitoredResource{Type: "audited_resource", Labels: map[string]string{"service": action.GCPService, "method": action.GCPMethod}}
+		if call.Denied {
+			payload.MethodName = "google.login.LoginService.loginFailure"
+		}
+	}
+	if action.Permission != "" {
+		payload.AuthorizationInfo = []gcpAuditAuthorization{{payload.ResourceName, action.Permission, !call.Denied}}
+	}
+
+	severity := "NOTICE"
+	logName := "activity"
+	if action.ReadOnly || action.Data {
+		severity = "INFO"
+		logName = "data_access"
+	}
+	if call.Denied {
+		severity = "ERROR"
+		if action.Permission != "" {
+			payload.Status = gcpAuditStatus{Code: 7, Message: "PERMISSION_DENIED"}
+		}
+	}
+	return gcpAuditLogEntry{
+		ProtoPayload:     payload,
+		InsertID:         strings.ToLower(gofakeit.LetterN(12)),
+		Resource:         resource,
+		Timestamp:        call.Time.UTC().Format(time.RFC3339Nano),
+		Severity:         severity,
+		LogName:          "projects/" + project + "/logs/cloudaudit.googleapis.com%2F" + logName,
+		ReceiveTimestamp: call.Time.Add(time.Duration(200+rand.Intn(800)) * time.Millisecond).UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// gcpZone maps an AWS region to a GCP zone in the same area
+func gcpZone(region string) string {
+	switch region {
+	case "us-west-2":
+		return "us-west1-b"
+	case "eu-west-1":
+		return "europe-west1-c"
+	case "ap-southeast-2":
+		return "australia-southeast1-a"
+	default:
+		return "us-east1-b"
+	}
+}
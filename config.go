@@ -0,0 +1,887 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configProblems collects every configuration error found while loading so
+// they can be reported together instead of failing on the first one
+var configProblems []string
+
+// configProblem records a configuration error
+func configProblem(format string, args ...any) {
+	configProblems = append(configProblems, fmt.Sprintf(format, args...))
+}
+
+// loadTraceSetting runs load, keeping the configuration problems it records
+// only when TRACES_ENABLED=true, since trace settings go unused otherwise
+func loadTraceSetting[T any](load func() T) T {
+	n := len(configProblems)
+	setting := load()
+	if !tracesConfig.Enabled {
+		configProblems = configProblems[:n]
+	}
+	return setting
+}
+
+// getEnvOrDefault retrieves a string from environment variables with a default value
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt retrieves an integer from environment variables with a default value
+func getEnvInt(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil {
+		configProblem("%s=%q is not a valid integer", key, raw)
+		return defaultValue
+	}
+	return val
+}
+
+// getEnvFloat retrieves a float from environment variables with a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		configProblem("%s=%q is not a valid number", key, raw)
+		return defaultValue
+	}
+	return val
+}
+
+// getEnvBool retrieves a boolean from environment variables with a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	val, err := strconv.ParseBool(raw)
+	if err != nil {
+		configProblem("%s=%q is not a valid boolean", key, raw)
+		return defaultValue
+	}
+	return val
+}
+
+// getEnvDuration retrieves a duration from environment variables with a default value.
+// Plain integers are interpreted as seconds.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	if secs, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		configProblem("%s=%q is not a valid duration", key, raw)
+		return defaultValue
+	}
+	return d
+}
+
+// parseKeyValueList parses "key=value,key2=value2" into a map
+func parseKeyValueList(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", field)
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return result, nil
+}
+
+// getEnvFloatList retrieves a comma-separated list of floats with a default value
+func getEnvFloatList(key string, defaultValue []float64) []float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	var values []float64
+	for _, field := range strings.Split(raw, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			configProblem("%s=%q contains an invalid number %q", key, raw, field)
+			return defaultValue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// formatFloatList renders floats as a comma-separated list
+func formatFloatList(values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatKeyValueList renders a map as sorted "key=value" pairs
+func formatKeyValueList(values map[string]string) string {
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parsePercentList parses "name:percent,..." such as
+// "payment-service:5,inventory-service:0.5"; every name needs its percent
+func parsePercentList(value string) (map[string]float64, error) {
+	percents := make(map[string]float64)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not name:percent", item)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || percent < 0 {
+			return nil, fmt.Errorf("%q: percent must be a non-negative number", item)
+		}
+		percents[name] = percent
+	}
+	return percents, nil
+}
+
+// formatPercentList renders per-name percentages as name:percent pairs in
+// key order, the format they are configured in
+func formatPercentList(values map[string]float64) string {
+	pairs := make([]string, 0, len(values))
+	for name, percent := range values {
+		pairs = append(pairs, name+":"+strconv.FormatFloat(percent, 'g', -1, 64))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parseDurationList parses "name:duration,..." such as
+// "payment-service:3s,cart:-250ms"
+func parseDurationList(value string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not name:duration", item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", item, err)
+		}
+		durations[name] = d
+	}
+	return durations, nil
+}
+
+// formatDurationList is the inverse of parseDurationList, sorted by name
+func formatDurationList(values map[string]time.Duration) string {
+	pairs := make([]string, 0, len(values))
+	for name, d := range values {
+		pairs = append(pairs, name+":"+d.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// formatWeightedList renders weighted names as name:weight pairs, the
+// format parseWeightedList reads
+func formatWeightedList(items []weightedName) string {
+	pairs := make([]string, len(items))
+	for i, item := range items {
+		pairs[i] = fmt.Sprintf("%s:%g", item.Name, item.Weight)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// formatIntList joins numbers with commas
+func formatIntList(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// validateEndpointURL checks that an endpoint is an absolute http(s) URL
+func validateEndpointURL(key, endpoint string) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		configProblem("%s=%q is not a valid URL: %v", key, endpoint, err)
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		configProblem("%s=%q must use http or https", key, endpoint)
+	}
+	if u.Host == "" {
+		configProblem("%s=%q has no host", key, endpoint)
+	}
+}
+
+// validateConfig checks the loaded configuration and returns every problem found
+func validateConfig() []string {
+	if config.LogEndpoint == "" {
+		configProblem("LOG_ENDPOINT is required")
+	} else if isGRPCEndpoint(config.LogEndpoint) {
+		validateGRPCEndpoint("LOG_ENDPOINT", config.LogEndpoint, "LOG_FORMAT", config.LogFormat)
+	} else if isSocketEndpoint(config.LogEndpoint) {
+		validateSocketEndpoint("LOG_ENDPOINT", config.LogEndpoint)
+	} else if isBrokerEndpoint(config.LogEndpoint) {
+		validateBrokerEndpoint("LOG_ENDPOINT", config.LogEndpoint)
+	} else {
+		validateEndpointURL("LOG_ENDPOINT", config.LogEndpoint)
+		if slices.Contains(socketLogFormats, config.LogFormat) {
+			configProblem("LOG_FORMAT=%s requires a udp://, tcp:// or tls:// LOG_ENDPOINT (got %q)", config.LogFormat, config.LogEndpoint)
+		}
+	}
+	validateKafkaConfig()
+	validateAMQPConfig()
+	validateMQTTConfig()
+	validateKinesisConfig()
+	switch gelfConfig.Compression {
+	case gelfCompressionNone, gelfCompressionGzip, gelfCompressionZlib:
+	default:
+		configProblem("GELF_COMPRESSION=%q is not supported (use none, gzip or zlib)", gelfConfig.Compression)
+	}
+	if gelfConfig.ChunkSize <= gelfChunkHeaderSize || gelfConfig.ChunkSize > 65507 {
+		configProblem("GELF_CHUNK_SIZE must be between %d and 65507 (got %d)", gelfChunkHeaderSize+1, gelfConfig.ChunkSize)
+	}
+	if syslogConfig.RFC != syslogRFC5424 && syslogConfig.RFC != syslogRFC3164 {
+		configProblem("SYSLOG_RFC=%q is not supported (use 5424 or 3164)", syslogConfig.RFC)
+	}
+	if syslogConfig.Framing != syslogFramingOctet && syslogConfig.Framing != syslogFramingNewline {
+		configProblem("SYSLOG_FRAMING=%q is not supported (use octet or newline)", syslogConfig.Framing)
+	}
+	if tracesConfig.Enabled {
+		validateTracesConfig()
+	}
+	if resourceConfig.Instances <= 0 {
+		configProblem("RESOURCE_INSTANCES must be greater than 0 (got %d)", resourceConfig.Instances)
+	}
+	if grpcConfig.Keepalive < 0 {
+		configProblem("OTLP_GRPC_KEEPALIVE must not be negative (got %v)", grpcConfig.Keepalive)
+	}
+
+	if config.LogRate <= 0 {
+		configProblem("LOG_RATE must be greater than 0 (got %d)", config.LogRate)
+	}
+	if config.BatchSize <= 0 {
+		configProblem("BATCH_SIZE must be greater than 0 (got %d)", config.BatchSize)
+	}
+	if config.MaxPayloadBytes < 0 {
+		configProblem("MAX_PAYLOAD_BYTES must not be negative (got %d)", config.MaxPayloadBytes)
+	}
+	if lokiExtraLabels < 0 {
+		configProblem("LOKI_EXTRA_LABELS must not be negative (got %d)", lokiExtraLabels)
+	}
+	if lokiLabelValues <= 0 {
+		configProblem("LOKI_LABEL_VALUES must be greater than 0 (got %d)", lokiLabelValues)
+	}
+	if esBulkConfig.Index == "" || esBulkConfig.Index != strings.ToLower(esBulkConfig.Index) {
+		configProblem("ES_INDEX must be a non-empty lowercase index name (got %q)", esBulkConfig.Index)
+	}
+	if hostMetadataConfig.Hosts <= 0 {
+		configProblem("LOG_HOSTS must be greater than 0 (got %d)", hostMetadataConfig.Hosts)
+	}
+	if k8sLogsConfig.Nodes <= 0 {
+		configProblem("K8S_NODES must be greater than 0 (got %d)", k8sLogsConfig.Nodes)
+	}
+	if k8sLogsConfig.PodsPerService <= 0 {
+		configProblem("K8S_PODS_PER_SERVICE must be greater than 0 (got %d)", k8sLogsConfig.PodsPerService)
+	}
+	if len(k8sLogsConfig.Namespaces) == 0 {
+		configProblem("K8S_NAMESPACES must list at least one namespace")
+	}
+	if windowsEventFormat != windowsEventXML && windowsEventFormat != windowsEventJSON {
+		configProblem("WINDOWS_EVENT_FORMAT must be %s or %s (got %q)", windowsEventXML, windowsEventJSON, windowsEventFormat)
+	}
+	if len(securityScenarios) > 0 && securityScenarioRate <= 0 {
+		configProblem("SECURITY_SCENARIO_RATE must be greater than 0 (got %g)", securityScenarioRate)
+	}
+	if cloudAuditConfig.ErrorPercent < 0 || cloudAuditConfig.ErrorPercent > 100 {
+		configProblem("CLOUD_AUDIT_ERROR_PERCENT must be between 0 and 100 (got %g)", cloudAuditConfig.ErrorPercent)
+	}
+	if cloudAuditConfig.Accounts <= 0 {
+		configProblem("CLOUD_ACCOUNTS must be greater than 0 (got %d)", cloudAuditConfig.Accounts)
+	}
+	if config.MultilinePercent < 0 || config.MultilinePercent > 100 {
+		configProblem("LOG_MULTILINE_PERCENT must be between 0 and 100 (got %g)", config.MultilinePercent)
+	}
+	if config.TraceContextPercent < 0 || config.TraceContextPercent > 100 {
+		configProblem("LOG_TRACE_CONTEXT_PERCENT must be between 0 and 100 (got %g)", config.TraceContextPercent)
+	}
+	if config.TraceCorrelationPercent < 0 || config.TraceCorrelationPercent > 100 {
+		configProblem("LOG_TRACE_CORRELATION_PERCENT must be between 0 and 100 (got %g)", config.TraceCorrelationPercent)
+	}
+	if config.TraceCorrelationPercent > 0 && !tracesConfig.Enabled {
+		configProblem("LOG_TRACE_CORRELATION_PERCENT needs TRACES_ENABLED=true")
+	}
+	if config.BackdatePercent < 0 || config.BackdatePercent > 100 {
+		configProblem("LOG_BACKDATE_PERCENT must be between 0 and 100 (got %g)", config.BackdatePercent)
+	}
+	if config.BackdateMin <= 0 || config.BackdateMax < config.BackdateMin {
+		configProblem("LOG_BACKDATE_MIN must be positive and at most LOG_BACKDATE_MAX (got %s and %s)", config.BackdateMin, config.BackdateMax)
+	}
+	if config.DuplicatePercent < 0 || config.DuplicatePercent > 100 {
+		configProblem("LOG_DUPLICATE_PERCENT must be between 0 and 100 (got %g)", config.DuplicatePercent)
+	}
+	if config.DuplicateBatchPercent < 0 || config.DuplicateBatchPercent > 100 {
+		configProblem("LOG_DUPLICATE_BATCH_PERCENT must be between 0 and 100 (got %g)", config.DuplicateBatchPercent)
+	}
+	if config.InvalidTextPercent < 0 || config.InvalidTextPercent > 100 {
+		configProblem("LOG_INVALID_TEXT_PERCENT must be between 0 and 100 (got %g)", config.InvalidTextPercent)
+	}
+	if piiConfig.Percent < 0 || piiConfig.Percent > 100 {
+		configProblem("LOG_PII_PERCENT must be between 0 and 100 (got %g)", piiConfig.Percent)
+	}
+	if piiConfig.Manifest != "" && piiConfig.Percent == 0 {
+		configProblem("LOG_PII_MANIFEST needs LOG_PII_PERCENT above 0")
+	}
+	if logSequenceConfig.Enabled && logSchema != nil {
+		configProblem("LOG_SEQUENCE cannot number LOG_SCHEMA_FILE documents, which are sent as they are")
+	}
+	if clientConfig.IPv6Percent < 0 || clientConfig.IPv6Percent > 100 {
+		configProblem("LOG_CLIENT_IPV6_PERCENT must be between 0 and 100 (got %g)", clientConfig.IPv6Percent)
+	} else if clientConfig.IPv6Percent > 0 && !hasIPv6ClientNetworks() {
+		configProblem("LOG_CLIENT_IPV6_PERCENT needs an IPv6 network in LOG_CLIENT_NETWORKS")
+	}
+	for _, pool := range cardinalityPools {
+		if pool.Size < 0 {
+			configProblem("%s must not be negative (got %d)", pool.Env, pool.Size)
+		}
+	}
+	if logTimestamp.Field == "" {
+		configProblem("LOG_TIMESTAMP_FIELD must not be empty")
+	}
+	switch logTimestamp.Format {
+	case timestampRFC3339, timestampRFC3339Nano, timestampUnix, timestampUnixMs, timestampUnixUs, timestampUnixNs:
+	default:
+		// A layout without any time element formats to itself
+		if time.Unix(0, 0).Format(logTimestamp.Format) == logTimestamp.Format {
+			configProblem("LOG_TIMESTAMP_FORMAT=%q is not rfc3339, rfc3339nano, unix, unix_ms, unix_us, unix_ns or a Go time layout such as 2006-01-02 15:04:05.000", logTimestamp.Format)
+		}
+	}
+	if isGRPCEndpoint(metricsConfig.Endpoint) {
+		validateGRPCEndpoint("METRICS_ENDPOINT", metricsConfig.Endpoint, "METRICS_FORMAT", metricsConfig.Format)
+	} else if isBrokerEndpoint(metricsConfig.Endpoint) {
+		validateBrokerEndpoint("METRICS_ENDPOINT", metricsConfig.Endpoint)
+	} else if metricsConfig.Endpoint != "" {
+		validateEndpointURL("METRICS_ENDPOINT", metricsConfig.Endpoint)
+	}
+	if metricsConfig.Rate <= 0 {
+		configProblem("METRIC_RATE must be greater than 0 (got %g)", metricsConfig.Rate)
+	}
+	if metricsConfig.Series <= 0 {
+		configProblem("METRIC_SERIES must be greater than 0 (got %d)", metricsConfig.Series)
+	}
+	if metricsConfig.ExtraLabels < 0 {
+		configProblem("METRIC_EXTRA_LABELS must not be negative (got %d)", metricsConfig.ExtraLabels)
+	}
+	if metricsConfig.LabelValues <= 0 {
+		configProblem("METRIC_LABEL_VALUES must be greater than 0 (got %d)", metricsConfig.LabelValues)
+	}
+	if metricsConfig.OutOfOrderPercent < 0 || metricsConfig.OutOfOrderPercent > 100 {
+		configProblem("METRIC_OUT_OF_ORDER_PERCENT must be between 0 and 100 (got %g)", metricsConfig.OutOfOrderPercent)
+	}
+	if metricsConfig.OutOfOrderMaxAge <= 0 {
+		configProblem("METRIC_OUT_OF_ORDER_MAX_AGE must be greater than 0 (got %v)", metricsConfig.OutOfOrderMaxAge)
+	}
+	if metricsConfig.CounterResetInterval < 0 {
+		configProblem("METRIC_COUNTER_RESET_INTERVAL must not be negative (got %v)", metricsConfig.CounterResetInterval)
+	}
+	if metricsConfig.ChurnPercent < 0 || metricsConfig.ChurnPercent > 100 {
+		configProblem("METRIC_CHURN_PERCENT must be between 0 and 100 (got %g)", metricsConfig.ChurnPercent)
+	}
+	if metricsConfig.HighCardinality && metricsConfig.ActiveSeries <= 0 {
+		configProblem("METRIC_ACTIVE_SERIES must be greater than 0 (got %d)", metricsConfig.ActiveSeries)
+	}
+	if metricsConfig.ChurnInterval < 0 {
+		configProblem("METRIC_CHURN_INTERVAL must not be negative (got %v)", metricsConfig.ChurnInterval)
+	}
+	if statsInterval < 0 {
+		configProblem("STATS_INTERVAL must not be negative (got %v)", statsInterval)
+	}
+	if auth.refreshInterval < 0 {
+		configProblem("AUTH_REFRESH_INTERVAL must not be negative (got %v)", auth.refreshInterval)
+	}
+
+	validateDistribution("LATENCY", "_MS", latencyDist)
+	validateDistribution("LOG_SIZE", "_BYTES", logSizeDist)
+	if logSizeDist.Min < 0 || logSizeDist.Max < logSizeDist.Min {
+		configProblem("LOG_SIZE_MIN_BYTES must not be negative or above LOG_SIZE_MAX_BYTES (got %g and %g)", logSizeDist.Min, logSizeDist.Max)
+	}
+	if hugeLinePercent < 0 || hugeLinePercent > 100 {
+		configProblem("LOG_HUGE_LINE_PERCENT must be between 0 and 100 (got %g)", hugeLinePercent)
+	}
+	if hugeLineBytes < 2 {
+		configProblem("LOG_HUGE_LINE_BYTES must be at least 2 (got %d)", hugeLineBytes)
+	}
+	validateDistribution("METRIC_VALUE", "", metricsConfig.ValueDist)
+	if !sort.Float64sAreSorted(metricsConfig.HistogramBounds) {
+		configProblem("METRIC_HISTOGRAM_BUCKETS must be in increasing order")
+	}
+	if metricsConfig.ExpHistogramScale < -4 || metricsConfig.ExpHistogramScale > 8 {
+		configProblem("METRIC_EXP_HISTOGRAM_SCALE must be between -4 and 8 (got %d)", metricsConfig.ExpHistogramScale)
+	}
+	if metricsConfig.ExpHistogramMaxBuckets < 1 {
+		configProblem("METRIC_EXP_HISTOGRAM_MAX_BUCKETS must be at least 1 (got %d)", metricsConfig.ExpHistogramMaxBuckets)
+	}
+	switch metricsConfig.Temporality {
+	case temporalityCumulative:
+	case temporalityDelta:
+		if metricsConfig.Format != metricsFormatOTLP && metricsConfig.Format != metricsFormatOTLPProto {
+			configProblem("METRIC_TEMPORALITY=delta requires METRICS_FORMAT=otlp or otlp_proto (got %q)", metricsConfig.Format)
+		}
+		if metricsConfig.ListenAddr != "" || graphiteConfig.Addr != "" {
+			configProblem("METRIC_TEMPORALITY=delta cannot be combined with METRICS_LISTEN_ADDR or GRAPHITE_ADDR")
+		}
+	default:
+		configProblem("METRIC_TEMPORALITY=%q is not supported (use cumulative or delta)", metricsConfig.Temporality)
+	}
+	for _, q := range metricsConfig.SummaryQuantiles {
+		if q < 0 || q > 1 {
+			configProblem("METRIC_SUMMARY_QUANTILES must be between 0 and 1 (got %g)", q)
+		}
+	}
+
+	if statsdConfig.Addr != "" {
+		if _, _, err := net.SplitHostPort(statsdConfig.Addr); err != nil {
+			configProblem("STATSD_ADDR=%q must be host:port: %v", statsdConfig.Addr, err)
+		}
+	}
+	if checksConfig.Endpoint != "" {
+		validateEndpointURL("CHECKS_ENDPOINT", checksConfig.Endpoint)
+	}
+	if checksConfig.Format != checksFormatLogs && checksConfig.Format != checksFormatMetrics {
+		configProblem("CHECKS_FORMAT must be %s or %s (got %q)", checksFormatLogs, checksFormatMetrics, checksConfig.Format)
+	}
+	if checksConfig.Interval <= 0 {
+		configProblem("CHECKS_INTERVAL must be greater than 0 (got %v)", checksConfig.Interval)
+	}
+	if checksConfig.Targets <= 0 {
+		configProblem("CHECKS_TARGETS must be greater than 0 (got %d)", checksConfig.Targets)
+	}
+	if len(checksConfig.Regions) == 0 {
+		configProblem("CHECKS_REGIONS must list at least one region")
+	}
+	if checksConfig.FailurePercent < 0 || checksConfig.FailurePercent > 100 {
+		configProblem("CHECKS_FAILURE_PERCENT must be between 0 and 100 (got %g)", checksConfig.FailurePercent)
+	}
+	if rumConfig.Endpoint != "" {
+		validateEndpointURL("RUM_ENDPOINT", rumConfig.Endpoint)
+	}
+	if rumConfig.Rate <= 0 {
+		configProblem("RUM_RATE must be greater than 0 (got %g)", rumConfig.Rate)
+	}
+	if rumConfig.Sessions <= 0 {
+		configProblem("RUM_SESSIONS must be greater than 0 (got %d)", rumConfig.Sessions)
+	}
+	if k8sEventsConfig.Endpoint != "" {
+		validateEndpointURL("K8S_EVENTS_ENDPOINT", k8sEventsConfig.Endpoint)
+	}
+	if k8sEventsConfig.Format != k8sEventsOTLP && k8sEventsConfig.Format != k8sEventsAPI {
+		configProblem("K8S_EVENTS_FORMAT=%q is not supported (use otlp or k8s)", k8sEventsConfig.Format)
+	}
+	if k8sEventsConfig.Rate <= 0 {
+		configProblem("K8S_EVENTS_RATE must be greater than 0 (got %g)", k8sEventsConfig.Rate)
+	}
+	if len(k8sEventsConfig.Namespaces) == 0 {
+		configProblem("K8S_EVENTS_NAMESPACES must list at least one namespace")
+	}
+	if profilesConfig.Endpoint != "" {
+		validateEndpointURL("PROFILES_ENDPOINT", profilesConfig.Endpoint)
+	}
+	if profilesConfig.Stacks <= 0 {
+		configProblem("PROFILES_STACKS must be greater than 0 (got %d)", profilesConfig.Stacks)
+	}
+	if graphiteConfig.Addr != "" {
+		if _, _, err := net.SplitHostPort(graphiteConfig.Addr); err != nil {
+			configProblem("GRAPHITE_ADDR=%q must be host:port: %v", graphiteConfig.Addr, err)
+		}
+	}
+	if graphiteConfig.Depth < 0 {
+		configProblem("GRAPHITE_DEPTH must not be negative (got %d)", graphiteConfig.Depth)
+	}
+	if statsdConfig.Flavor != statsdPlain && statsdConfig.Flavor != statsdDog {
+		configProblem("STATSD_FLAVOR=%q is not supported (use statsd or dogstatsd)", statsdConfig.Flavor)
+	}
+	if statsdConfig.Rate <= 0 {
+		configProblem("STATSD_RATE must be greater than 0 (got %g)", statsdConfig.Rate)
+	}
+	if statsdConfig.LinesPerPacket <= 0 {
+		configProblem("STATSD_LINES_PER_PACKET must be greater than 0 (got %d)", statsdConfig.LinesPerPacket)
+	}
+
+	return configProblems
+}
+
+// validateTracesConfig checks the trace settings, which only matter when
+// TRACES_ENABLED=true
+func validateTracesConfig() {
+	if isGRPCEndpoint(tracesConfig.Endpoint) {
+		validateGRPCEndpoint("TRACES_ENDPOINT", tracesConfig.Endpoint, "TRACE_FORMAT", tracesConfig.Format, traceFormatJaegerProto)
+	} else if isBrokerEndpoint(tracesConfig.Endpoint) {
+		validateBrokerEndpoint("TRACES_ENDPOINT", tracesConfig.Endpoint)
+		if tracesConfig.Format == traceFormatJaegerProto {
+			configProblem("TRACE_FORMAT=jaeger_proto is only sent over gRPC; use TRACES_ENDPOINT=grpc://jaeger-collector:14250")
+		}
+	} else {
+		validateEndpointURL("TRACES_ENDPOINT", tracesConfig.Endpoint)
+		if tracesConfig.Format == traceFormatJaegerProto {
+			configProblem("TRACE_FORMAT=jaeger_proto is only sent over gRPC; use TRACES_ENDPOINT=grpc://jaeger-collector:14250")
+		}
+	}
+	if tracesConfig.LinkPercent < 0 || tracesConfig.LinkPercent > 100 {
+		configProblem("TRACE_LINK_PERCENT must be between 0 and 100 (got %g)", tracesConfig.LinkPercent)
+	}
+	if tracesConfig.Rate < 0 {
+		configProblem("TRACE_RATE must not be negative (got %g)", tracesConfig.Rate)
+	}
+	if tracesConfig.SpansPerSec < 0 {
+		configProblem("TRACE_SPANS_PER_SEC must not be negative (got %g)", tracesConfig.SpansPerSec)
+	}
+	if tracesConfig.Rate == 0 && tracesConfig.SpansPerSec <= 0 {
+		configProblem("TRACE_RATE=0 needs TRACE_SPANS_PER_SEC to limit the rate")
+	}
+	if tracesConfig.Workers <= 0 {
+		configProblem("TRACE_WORKERS must be greater than 0 (got %d)", tracesConfig.Workers)
+	}
+	if tracesConfig.DropParentPercent < 0 || tracesConfig.DropParentPercent > 100 {
+		configProblem("TRACE_DROP_PARENT_PERCENT must be between 0 and 100 (got %g)", tracesConfig.DropParentPercent)
+	}
+	if tracesConfig.OrphanPercent < 0 || tracesConfig.OrphanPercent > 100 {
+		configProblem("TRACE_ORPHAN_PERCENT must be between 0 and 100 (got %g)", tracesConfig.OrphanPercent)
+	}
+	if tracesConfig.LatePercent < 0 || tracesConfig.LatePercent > 100 {
+		configProblem("TRACE_LATE_PERCENT must be between 0 and 100 (got %g)", tracesConfig.LatePercent)
+	}
+	if tracesConfig.LateDelay < 0 {
+		configProblem("TRACE_LATE_DELAY must not be negative (got %v)", tracesConfig.LateDelay)
+	}
+	if tracesConfig.TraceState != "" && !validTraceState(tracesConfig.TraceState) {
+		configProblem("TRACE_TRACESTATE=%q is not a valid W3C tracestate (key=value,...)", tracesConfig.TraceState)
+	}
+	if baggageConfig.Tenants <= 0 {
+		configProblem("TRACE_BAGGAGE_TENANTS must be greater than 0 (got %d)", baggageConfig.Tenants)
+	}
+	if tracesConfig.RetryPercent < 0 || tracesConfig.RetryPercent > 100 {
+		configProblem("TRACE_RETRY_PERCENT must be between 0 and 100 (got %g)", tracesConfig.RetryPercent)
+	}
+	if tracesConfig.ChainPercent < 0 || tracesConfig.ChainPercent > 100 {
+		configProblem("TRACE_CHAIN_PERCENT must be between 0 and 100 (got %g)", tracesConfig.ChainPercent)
+	}
+	if tracesConfig.ChainPercent > 0 && len(tracesConfig.ChainStages) < 2 {
+		configProblem("TRACE_CHAIN_STAGES must list at least two stages (got %q)", strings.Join(tracesConfig.ChainStages, ","))
+	}
+	if tracesConfig.ChainDelay < 0 {
+		configProblem("TRACE_CHAIN_DELAY must not be negative (got %v)", tracesConfig.ChainDelay)
+	}
+	if tracesConfig.ExtraAttributes < 0 {
+		configProblem("TRACE_EXTRA_ATTRIBUTES must not be negative (got %d)", tracesConfig.ExtraAttributes)
+	}
+	if tracesConfig.LargeAttributePercent < 0 || tracesConfig.LargeAttributePercent > 100 {
+		configProblem("TRACE_LARGE_ATTRIBUTE_PERCENT must be between 0 and 100 (got %g)", tracesConfig.LargeAttributePercent)
+	}
+	switch tracesConfig.OTLPGrouping {
+	case otlpGroupingService, otlpGroupingScope, otlpGroupingInstance:
+	default:
+		configProblem("TRACE_OTLP_GROUPING=%q is not supported (use service, scope or instance)", tracesConfig.OTLPGrouping)
+	}
+	if len(tracesConfig.Streams) == 0 {
+		configProblem("TRACES_STREAMS must list at least one stream")
+	}
+	if tracesConfig.ParallelPercent < 0 || tracesConfig.ParallelPercent > 100 {
+		configProblem("TRACE_PARALLEL_PERCENT must be between 0 and 100 (got %g)", tracesConfig.ParallelPercent)
+	}
+	if tracesConfig.GiantPercent < 0 || tracesConfig.GiantPercent > 100 {
+		configProblem("TRACE_GIANT_PERCENT must be between 0 and 100 (got %g)", tracesConfig.GiantPercent)
+	}
+	if tracesConfig.SpansPerRequest < 0 {
+		configProblem("TRACE_SPANS_PER_REQUEST must not be negative (got %d)", tracesConfig.SpansPerRequest)
+	}
+	if tracesConfig.SamplePercent < 0 || tracesConfig.SamplePercent > 100 {
+		configProblem("TRACE_SAMPLE_PERCENT must be between 0 and 100 (got %g)", tracesConfig.SamplePercent)
+	}
+	if tracesConfig.ErrorPercent < 0 || tracesConfig.ErrorPercent > 100 {
+		configProblem("TRACE_ERROR_PERCENT must be between 0 and 100 (got %g)", tracesConfig.ErrorPercent)
+	}
+	for service, percent := range tracesConfig.ServiceErrorPercent {
+		if percent > 100 {
+			configProblem("SERVICE_ERROR_PERCENT for %s must be between 0 and 100 (got %g)", service, percent)
+		}
+	}
+	for service, dist := range serviceLatencyDists {
+		validateDistribution("SERVICE_LATENCY["+service+"]", "_MS", dist)
+	}
+	validateDistribution("TRACE_DEPTH", "", traceDepthDist)
+	validateDistribution("TRACE_FANOUT", "", traceFanoutDist)
+	validateDistribution("TRACE_SPANS", "", traceSpansDist)
+	validateDistribution("TRACE_GIANT_SPANS", "", traceGiantSpansDist)
+	validateDistribution("TRACE_ATTRIBUTE_SIZE", "_BYTES", attributeSizeDist)
+	validateDistribution("TRACE_CONSUMER_LAG", "_MS", consumerLagDist)
+}
+
+// redactURL hides any password embedded in an endpoint
+func redactURL(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Redacted()
+	}
+	return endpoint
+}
+
+// redactSecret reports whether a secret is set without revealing it
+func redactSecret(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return "(redacted)"
+}
+
+// logEffectiveConfig prints the configuration the generator actually parsed
+func logEffectiveConfig() {
+	settings := [][2]string{
+		{"LOG_ENDPOINT", redactURL(config.LogEndpoint)},
+		{"LOG_METHOD", config.LogMethod},
+		{"LOG_FORMAT", config.LogFormat},
+		{"LOG_CONTENT", config.LogContent},
+		{"WINDOWS_EVENT_FORMAT", windowsEventFormat},
+		{"CLOUD_AUDIT_EVENTS", formatWeightedList(cloudAuditConfig.Actions)},
+		{"CLOUD_AUDIT_ERROR_PERCENT", strconv.FormatFloat(cloudAuditConfig.ErrorPercent, 'g', -1, 64)},
+		{"CLOUD_ACCOUNTS", strconv.Itoa(cloudAuditConfig.Accounts)},
+		{"LOG_TEMPLATES_FILE", os.Getenv("LOG_TEMPLATES_FILE")},
+		{"LOG_LOCALES", formatWeightedList(logLocales)},
+		{"LOG_SCHEMA_FILE", os.Getenv("LOG_SCHEMA_FILE")},
+		{"LOG_STREAM", config.LogStream},
+		{"EMF_NAMESPACE", emfNamespace},
+		{"LOKI_EXTRA_LABELS", strconv.Itoa(lokiExtraLabels)},
+		{"LOKI_LABEL_VALUES", strconv.Itoa(lokiLabelValues)},
+		{"ES_INDEX", esBulkConfig.Index},
+		{"ES_DATA_STREAM", strconv.FormatBool(esBulkConfig.DataStream)},
+		{"ES_DOCUMENT_IDS", strconv.FormatBool(esBulkConfig.DocumentIDs)},
+		{"SPLUNK_HEC_TOKEN", redactSecret(splunkHECConfig.Token)},
+		{"SPLUNK_INDEX", splunkHECConfig.Index},
+		{"SPLUNK_SOURCE", splunkHECConfig.Source},
+		{"SPLUNK_SOURCETYPE", splunkHECConfig.Sourcetype},
+		{"DD_API_KEY", redactSecret(datadogConfig.APIKey)},
+		{"DD_SOURCE", datadogConfig.Source},
+		{"DD_TAGS", datadogConfig.Tags},
+		{"SYSLOG_RFC", syslogConfig.RFC},
+		{"SYSLOG_FRAMING", syslogConfig.Framing},
+		{"SYSLOG_FACILITY", syslogFacilityName(syslogConfig.Facility)},
+		{"SYSLOG_SEVERITY", syslogSeverityName(syslogConfig.Severity)},
+		{"GELF_COMPRESSION", gelfConfig.Compression},
+		{"GELF_CHUNK_SIZE", strconv.Itoa(gelfConfig.ChunkSize)},
+		{"GELF_FIELDS", formatKeyValueList(gelfConfig.Fields)},
+		{"FLUENT_TAG", fluentConfig.Tag},
+		{"FLUENT_ACK", strconv.FormatBool(fluentConfig.Ack)},
+		{"LOG_RATE", strconv.Itoa(config.LogRate)},
+		{"BATCH_SIZE", strconv.Itoa(config.BatchSize)},
+		{"MAX_PAYLOAD_BYTES", strconv.Itoa(config.MaxPayloadBytes)},
+		{"SECURITY_SCENARIOS", formatSecurityScenarios()},
+		{"SECURITY_SCENARIO_RATE", strconv.FormatFloat(securityScenarioRate, 'g', -1, 64)},
+		{"LOG_MULTILINE_PERCENT", strconv.FormatFloat(config.MultilinePercent, 'g', -1, 64)},
+		{"LOG_MULTILINE_SPLIT", strconv.FormatBool(config.MultilineSplit)},
+		{"LOG_SIZE_DISTRIBUTION", formatLogSize()},
+		{"LOG_HUGE_LINE_PERCENT", strconv.FormatFloat(hugeLinePercent, 'g', -1, 64)},
+		{"LOG_HUGE_LINE_BYTES", strconv.Itoa(hugeLineBytes)},
+		{"LOG_HOST_METADATA", strconv.FormatBool(hostMetadataConfig.Enabled)},
+		{"LOG_HOSTS", strconv.Itoa(hostMetadataConfig.Hosts)},
+		{"LOG_K8S_METADATA", strconv.FormatBool(k8sLogsConfig.Enabled)},
+		{"K8S_NAMESPACES", strings.Join(k8sLogsConfig.Namespaces, ",")},
+		{"K8S_NODES", strconv.Itoa(k8sLogsConfig.Nodes)},
+		{"K8S_PODS_PER_SERVICE", strconv.Itoa(k8sLogsConfig.PodsPerService)},
+		{"LOG_TRACE_CONTEXT_PERCENT", strconv.FormatFloat(config.TraceContextPercent, 'g', -1, 64)},
+		{"LOG_BACKDATE_PERCENT", strconv.FormatFloat(config.BackdatePercent, 'g', -1, 64)},
+		{"LOG_BACKDATE_MIN", config.BackdateMin.String()},
+		{"LOG_BACKDATE_MAX", config.BackdateMax.String()},
+		{"LOG_DUPLICATE_PERCENT", strconv.FormatFloat(config.DuplicatePercent, 'g', -1, 64)},
+		{"LOG_DUPLICATE_BATCH_PERCENT", strconv.FormatFloat(config.DuplicateBatchPercent, 'g', -1, 64)},
+		{"LOG_STABLE_IDS", strconv.FormatBool(config.StableIDs)},
+		{"LOG_INVALID_TEXT_PERCENT", strconv.FormatFloat(config.InvalidTextPercent, 'g', -1, 64)},
+		{"LOG_INVALID_TEXT_KINDS", formatWeightedList(logInvalidText)},
+		{"LOG_PII_PERCENT", strconv.FormatFloat(piiConfig.Percent, 'g', -1, 64)},
+		{"LOG_PII_TYPES", formatWeightedList(piiConfig.Types)},
+		{"LOG_PII_MANIFEST", piiConfig.Manifest},
+		{"LOG_CLIENT_NETWORKS", formatClientNetworks(clientConfig.Networks)},
+		{"LOG_CLIENT_IPV6_PERCENT", strconv.FormatFloat(clientConfig.IPv6Percent, 'g', -1, 64)},
+		{"LOG_CLIENT_GEO", strconv.FormatBool(clientConfig.Geo)},
+		{"LOG_SEQUENCE", strconv.FormatBool(logSequenceConfig.Enabled)},
+		{"LOG_GENERATOR_ID", logSequenceConfig.Generator},
+		{"LOG_USER_CARDINALITY", strconv.Itoa(logUserPool.Size)},
+		{"LOG_CLIENT_IP_CARDINALITY", strconv.Itoa(logClientIPPool.Size)},
+		{"LOG_PATH_CARDINALITY", strconv.Itoa(logPathPool.Size)},
+		{"LOG_TRACE_ID_CARDINALITY", strconv.Itoa(logTraceIDPool.Size)},
+		{"LOG_JOBS", formatWeightedList(logJobs)},
+		{"LOG_LEVELS", formatWeightedList(logLevels)},
+		{"LOG_SEVERITY_NUMBERS", strconv.FormatBool(config.SeverityNumbers)},
+		{"LOG_TIMESTAMP_FIELD", logTimestamp.Field},
+		{"LOG_TIMESTAMP_FORMAT", logTimestamp.Format},
+		{"LOG_TIMEZONES", formatWeightedList(logTimezones)},
+		{"LOG_TRACE_CORRELATION_PERCENT", strconv.FormatFloat(config.TraceCorrelationPercent, 'g', -1, 64)},
+		{"TRACES_ENABLED", strconv.FormatBool(tracesConfig.Enabled)},
+		{"TRACES_ENDPOINT", redactURL(tracesConfig.Endpoint)},
+		{"TRACES_METHOD", tracesConfig.Method},
+		{"TRACE_FORMAT", tracesConfig.Format},
+		{"TRACE_OTLP_GROUPING", tracesConfig.OTLPGrouping},
+		{"TRACE_RATE", strconv.FormatFloat(tracesConfig.Rate, 'g', -1, 64)},
+		{"TRACE_SPANS_PER_SEC", strconv.FormatFloat(tracesConfig.SpansPerSec, 'g', -1, 64)},
+		{"TRACE_WORKERS", strconv.Itoa(tracesConfig.Workers)},
+		{"KAFKA_PARTITION_KEY", kafkaConfig.PartitionKey},
+		{"KAFKA_ACKS", kafkaConfig.Acks},
+		{"KAFKA_COMPRESSION", kafkaConfig.Compression},
+		{"KAFKA_CLIENT_ID", kafkaConfig.ClientID},
+		{"NATS_JETSTREAM", strconv.FormatBool(natsConfig.JetStream)},
+		{"AMQP_DELIVERY_MODE", amqpConfig.DeliveryMode},
+		{"MQTT_DEVICES", strconv.Itoa(mqttConfig.Devices)},
+		{"MQTT_QOS", strconv.Itoa(mqttConfig.QoS)},
+		{"MQTT_CLIENT_ID_PREFIX", mqttConfig.ClientIDPrefix},
+		{"KINESIS_PARTITION_KEY", kinesisConfig.PartitionKey},
+		{"KINESIS_AGGREGATE", strconv.FormatBool(kinesisConfig.Aggregate)},
+		{"KINESIS_MAX_RETRIES", strconv.Itoa(kinesisConfig.MaxRetries)},
+		{"AWS_REGION", awsRegion},
+		{"OTLP_GRPC_KEEPALIVE", grpcConfig.Keepalive.String()},
+		{"OTLP_GRPC_METADATA", redactSecret(formatKeyValueList(grpcConfig.Metadata))},
+		{"TRACES_STREAM", tracesConfig.Headers["stream-name"]},
+		{"TRACES_STREAMS", strings.Join(tracesConfig.Streams, ",")},
+		{"SERVICE_NAMES", formatWeightedList(traceServices)},
+		{"TRACE_TOPOLOGY_FILE", os.Getenv("TRACE_TOPOLOGY_FILE")},
+		{"TRACE_ERROR_PERCENT", strconv.FormatFloat(tracesConfig.ErrorPercent, 'g', -1, 64)},
+		{"SERVICE_ERROR_PERCENT", formatPercentList(tracesConfig.ServiceErrorPercent)},
+		{"TRACE_CLIENT_SPANS", strconv.FormatBool(tracesConfig.ClientSpans)},
+		{"TRACE_LINK_PERCENT", strconv.FormatFloat(tracesConfig.LinkPercent, 'g', -1, 64)},
+		{"TRACE_SAMPLE_PERCENT", strconv.FormatFloat(tracesConfig.SamplePercent, 'g', -1, 64)},
+		{"TRACE_DROP_UNSAMPLED", strconv.FormatBool(tracesConfig.DropUnsampled)},
+		{"TRACE_DROP_PARENT_PERCENT", strconv.FormatFloat(tracesConfig.DropParentPercent, 'g', -1, 64)},
+		{"TRACE_ORPHAN_PERCENT", strconv.FormatFloat(tracesConfig.OrphanPercent, 'g', -1, 64)},
+		{"SERVICE_CLOCK_SKEW", formatDurationList(tracesConfig.ClockSkew)},
+		{"TRACE_CONTEXT_ATTRIBUTES", strconv.FormatBool(tracesConfig.ContextAttributes)},
+		{"TRACE_TRACESTATE", tracesConfig.TraceState},
+		{"TRACE_BAGGAGE", strconv.FormatBool(baggageConfig.Enabled)},
+		{"TRACE_BAGGAGE_TENANTS", strconv.Itoa(baggageConfig.Tenants)},
+		{"TRACE_BAGGAGE_EXPERIMENTS", strings.Join(baggageConfig.Experiments, ",")},
+		{"TRACE_LATE_PERCENT", strconv.FormatFloat(tracesConfig.LatePercent, 'g', -1, 64)},
+		{"TRACE_LATE_DELAY", tracesConfig.LateDelay.String()},
+		{"TRACE_DEPTH_DISTRIBUTION", traceDepthDist.Kind},
+		{"TRACE_FANOUT_DISTRIBUTION", traceFanoutDist.Kind},
+		{"TRACE_SPANS_DISTRIBUTION", traceSpansDist.Kind},
+		{"TRACE_RETRY_PERCENT", strconv.FormatFloat(tracesConfig.RetryPercent, 'g', -1, 64)},
+		{"TRACE_CHAIN_PERCENT", strconv.FormatFloat(tracesConfig.ChainPercent, 'g', -1, 64)},
+		{"TRACE_CHAIN_STAGES", strings.Join(tracesConfig.ChainStages, ",")},
+		{"TRACE_CHAIN_DELAY", tracesConfig.ChainDelay.String()},
+		{"TRACE_EXTRA_ATTRIBUTES", strconv.Itoa(tracesConfig.ExtraAttributes)},
+		{"TRACE_ATTRIBUTE_SIZE_DISTRIBUTION", attributeSizeDist.Kind},
+		{"TRACE_LARGE_ATTRIBUTE_PERCENT", strconv.FormatFloat(tracesConfig.LargeAttributePercent, 'g', -1, 64)},
+		{"TRACE_ATTRIBUTE_LIMITS", formatIntList(attributeLimits)},
+		{"TRACE_PARALLEL_PERCENT", strconv.FormatFloat(tracesConfig.ParallelPercent, 'g', -1, 64)},
+		{"TRACE_GIANT_PERCENT", strconv.FormatFloat(tracesConfig.GiantPercent, 'g', -1, 64)},
+		{"TRACE_GIANT_SPANS_DISTRIBUTION", traceGiantSpansDist.Kind},
+		{"TRACE_SPANS_PER_REQUEST", strconv.Itoa(tracesConfig.SpansPerRequest)},
+		{"TRACE_CONSUMER_LAG_DISTRIBUTION", consumerLagDist.Kind},
+		{"METRICS_ENDPOINT", redactURL(metricsConfig.Endpoint)},
+		{"METRICS_METHOD", metricsConfig.Method},
+		{"METRICS_FORMAT", metricsConfig.Format},
+		{"METRIC_RATE", strconv.FormatFloat(metricsConfig.Rate, 'g', -1, 64)},
+		{"METRIC_SERIES", strconv.Itoa(metricsConfig.Series)},
+		{"RESOURCE_ATTRIBUTES", formatKeyValueList(resourceConfig.Attributes)},
+		{"RESOURCE_SIMULATE", strconv.FormatBool(resourceConfig.Simulate)},
+		{"RESOURCE_INSTANCES", strconv.Itoa(resourceConfig.Instances)},
+		{"METRIC_RESOURCE_ATTRIBUTES", formatKeyValueList(metricsConfig.ResourceAttributes)},
+		{"METRICS_HEADERS", redactSecret(formatKeyValueList(metricsConfig.Headers))},
+		{"METRICS_LISTEN_ADDR", metricsConfig.ListenAddr},
+		{"METRIC_EXTRA_LABELS", strconv.Itoa(metricsConfig.ExtraLabels)},
+		{"METRIC_LABEL_VALUES", strconv.Itoa(metricsConfig.LabelValues)},
+		{"METRIC_CHURN_INTERVAL", metricsConfig.ChurnInterval.String()},
+		{"METRIC_CHURN_PERCENT", strconv.FormatFloat(metricsConfig.ChurnPercent, 'g', -1, 64)},
+		{"METRIC_COUNTER_RESET_INTERVAL", metricsConfig.CounterResetInterval.String()},
+		{"METRIC_HIGH_CARDINALITY", strconv.FormatBool(metricsConfig.HighCardinality)},
+		{"METRIC_ACTIVE_SERIES", strconv.Itoa(metricsConfig.ActiveSeries)},
+		{"METRIC_HISTOGRAM_BUCKETS", formatFloatList(metricsConfig.HistogramBounds)},
+		{"METRIC_SUMMARY_QUANTILES", formatFloatList(metricsConfig.SummaryQuantiles)},
+		{"METRIC_VALUE_DISTRIBUTION", metricsConfig.ValueDist.Kind},
+		{"METRIC_EXP_HISTOGRAMS", strconv.FormatBool(metricsConfig.ExpHistograms)},
+		{"METRIC_EXP_HISTOGRAM_SCALE", strconv.Itoa(metricsConfig.ExpHistogramScale)},
+		{"METRIC_EXP_HISTOGRAM_MAX_BUCKETS", strconv.Itoa(metricsConfig.ExpHistogramMaxBuckets)},
+		{"METRIC_EXEMPLARS", strconv.FormatBool(metricsConfig.Exemplars)},
+		{"METRIC_TEMPORALITY", metricsConfig.Temporality},
+		{"METRIC_OUT_OF_ORDER_PERCENT", strconv.FormatFloat(metricsConfig.OutOfOrderPercent, 'g', -1, 64)},
+		{"METRIC_OUT_OF_ORDER_MAX_AGE", metricsConfig.OutOfOrderMaxAge.String()},
+		{"INFLUX_TOKEN", redactSecret(metricsConfig.InfluxToken)},
+		{"RUM_ENDPOINT", redactURL(rumConfig.Endpoint)},
+		{"RUM_RATE", strconv.FormatFloat(rumConfig.Rate, 'g', -1, 64)},
+		{"RUM_SESSIONS", strconv.Itoa(rumConfig.Sessions)},
+		{"RUM_APP", rumConfig.App},
+		{"RUM_ORIGIN", rumConfig.Origin},
+		{"CHECKS_ENDPOINT", redactURL(checksConfig.Endpoint)},
+		{"CHECKS_FORMAT", checksConfig.Format},
+		{"CHECKS_INTERVAL", checksConfig.Interval.String()},
+		{"CHECKS_TARGETS", strconv.Itoa(checksConfig.Targets)},
+		{"CHECKS_REGIONS", strings.Join(checksConfig.Regions, ",")},
+		{"CHECKS_FAILURE_PERCENT", strconv.FormatFloat(checksConfig.FailurePercent, 'g', -1, 64)},
+		{"K8S_EVENTS_ENDPOINT", redactURL(k8sEventsConfig.Endpoint)},
+		{"K8S_EVENTS_FORMAT", k8sEventsConfig.Format},
+		{"K8S_EVENTS_RATE", strconv.FormatFloat(k8sEventsConfig.Rate, 'g', -1, 64)},
+		{"K8S_EVENTS_NAMESPACES", strings.Join(k8sEventsConfig.Namespaces, ",")},
+		{"PROFILES_ENDPOINT", redactURL(profilesConfig.Endpoint)},
+		{"PROFILES_METHOD", profilesConfig.Method},
+		{"PROFILES_INTERVAL", profilesConfig.Interval.String()},
+		{"PROFILES_TYPES", strings.Join(profilesConfig.Types, ",")},
+		{"PROFILES_STACKS", strconv.Itoa(profilesConfig.Stacks)},
+		{"GRAPHITE_ADDR", graphiteConfig.Addr},
+		{"GRAPHITE_PREFIX", graphiteConfig.Prefix},
+		{"GRAPHITE_DEPTH", strconv.Itoa(graphiteConfig.Depth)},
+		{"STATSD_ADDR", statsdConfig.Addr},
+		{"STATSD_FLAVOR", statsdConfig.Flavor},
+		{"STATSD_PREFIX", statsdConfig.Prefix},
+		{"STATSD_RATE", strconv.FormatFloat(statsdConfig.Rate, 'g', -1, 64)},
+		{"STATSD_LINES_PER_PACKET", strconv.Itoa(statsdConfig.LinesPerPacket)},
+		{"LATENCY_DISTRIBUTION", latencyDist.Kind},
+		{"SERVICE_LATENCY", os.Getenv("SERVICE_LATENCY")},
+		{"LATENCY_IN_LOGS", strconv.FormatBool(latencyInLogs)},
+		{"AUTH_TYPE", auth.kind},
+		{"AUTHORIZATION", redactSecret(auth.Header())},
+		{"AUTH_REFRESH_INTERVAL", auth.refreshInterval.String()},
+		{"STATS_INTERVAL", statsInterval.String()},
+		{"CONTROL_ADDR", controlAddr},
+	}
+
+	log.Println("Effective configuration:")
+	for _, setting := range settings {
+		log.Printf("  %s=%s", setting[0], setting[1])
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// paused suspends sending in every generator while keeping counters alive
+	paused atomic.Bool
+
+	// controlAddr is the listen address of the control/health server; empty disables it
+	controlAddr = os.Getenv("CONTROL_ADDR")
+)
+
+// setPaused switches generation on or off and logs transitions
+func setPaused(p bool) {
+	if paused.Swap(p) != p {
+		if p {
+			log.Println("Generation paused")
+		} else {
+			log.Println("Generation resumed")
+		}
+	}
+}
+
+// generatorState reports "paused" or "running"
+func generatorState() string {
+	if paused.Load() {
+		return "paused"
+	}
+	return "running"
+}
+
+// healthStatus is the JSON document served on /healthz
+type healthStatus struct {
+	State           string  `json:"state"`
+	LogRate         float64 `json:"log_rate"`
+	LogTargetRate   float64 `json:"log_target_rate"`
+	TraceRate       float64 `json:"trace_rate"`
+	TraceTargetRate float64 `json:"trace_target_rate"`
+	RecordsSent     int64   `json:"records_sent"`
+	BatchesSent     int64   `json:"batches_sent"`
+	BytesSent       int64   `json:"bytes_sent"`
+	TracesSent      int64   `json:"traces_sent"`
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	snapshot := takeStatsSnapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(healthStatus{
+		State:           generatorState(),
+		LogRate:         logRate.Rate(),
+		LogTargetRate:   logRate.Target(),
+		TraceRate:       traceRate.Rate(),
+		TraceTargetRate: traceRate.Target(),
+		RecordsSent:     snapshot.records,
+		BatchesSent:     snapshot.batches,
+		BytesSent:       snapshot.bytes,
+		TracesSent:      snapshot.traces,
+	})
+}
+
+// controlHandler returns a handler that pauses or resumes generation
+func controlHandler(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		setPaused(pause)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"state": generatorState()})
+	}
+}
+
+// startControlServer serves /healthz and /control/{pause,resume} until ctx is done
+func startControlServer(ctx context.Context, wg *sync.WaitGroup, addr string) {
+	defer wg.Done()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealth)
+	mux.HandleFunc("/control/pause", controlHandler(true))
+	mux.HandleFunc("/control/resume", controlHandler(false))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Control server listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Control server failed: %v", err)
+	}
+}
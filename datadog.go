@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const logFormatDatadog = "datadog"
+
+// datadogConfig fills the reserved attributes of LOG_FORMAT=datadog logs
+var datadogConfig = struct {
+	// APIKey is sent as the DD-API-KEY header
+	APIKey string
+	Source string
+	Tags   string
+}{
+	APIKey: os.Getenv("DD_API_KEY"),
+	Source: getEnvOrDefault("DD_SOURCE", "load-gen"),
+	Tags:   getEnvOrDefault("DD_TAGS", "env:loadtest"),
+}
+
+type datadogLog struct {
+	Source  string `json:"ddsource"`
+	Tags    string `json:"ddtags,omitempty"`
+	Service string `json:"service"`
+	// Hostname is only set with LOG_HOST_METADATA
+	Hostname string `json:"hostname,omitempty"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	// Date is in milliseconds since the epoch
+	Date    int64  `json:"date"`
+	TraceID string `json:"dd.trace_id,omitempty"`
+	SpanID  string `json:"dd.span_id,omitempty"`
+}
+
+// datadogLogEncoder sends records as a Datadog logs intake JSON array, with
+// the job as the service
+type datadogLogEncoder struct{}
+
+func (datadogLogEncoder) ContentType() string { return "application/json" }
+
+func (datadogLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	logs := make([]datadogLog, len(batch))
+	for i, record := range batch {
+		logs[i] = datadogLog{
+			Source:  datadogConfig.Source,
+			Tags:    datadogConfig.Tags,
+			Service: record.Job,
+			Status:  record.Level,
+			Message: record.Log,
+			Date:    record.Time.UnixMilli(),
+			TraceID: datadogID(record.TraceID),
+			SpanID:  datadogID(record.SpanID),
+		}
+		if record.logEmitter != nil {
+			logs[i].Hostname = record.HostName
+		}
+	}
+	data, err := json.Marshal(logs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Datadog logs: %w", err)
+	}
+	return data, nil
+}
+
+// datadogID converts a hex trace or span id to the decimal form Datadog uses
+// to correlate logs, keeping the low 64 bits of trace ids
+func datadogID(id string) string {
+	if len(id) > 16 {
+		id = id[len(id)-16:]
+	}
+	if id == "" {
+		return ""
+	}
+	v, err := strconv.ParseUint(id, 16, 64)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(v, 10)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// dbTable is a table of the fake application schema that database spans
+// query
+type dbTable struct {
+	Name    string
+	Columns []string
+	// Filter is the column most queries select rows by
+	Filter string
+	// Joins names a table and the column of this table referencing it
+	Joins [2]string
+}
+
+var dbTables = []dbTable{
+	{Name: "users", Columns: []string{"id", "email", "name", "status", "created_at"}, Filter: "email"},
+	{Name: "orders", Columns: []string{"id", "user_id", "status", "total_cents", "currency", "created_at"}, Filter: "user_id", Joins: [2]string{"users", "user_id"}},
+	{Name: "order_items", Columns: []string{"id", "order_id", "product_id", "quantity", "price_cents"}, Filter: "order_id", Joins: [2]string{"products", "product_id"}},
+	{Name: "products", Columns: []string{"id", "sku", "name", "price_cents", "category", "updated_at"}, Filter: "category"},
+	{Name: "payments", Columns: []string{"id", "order_id", "amount_cents", "provider", "status", "created_at"}, Filter: "order_id", Joins: [2]string{"orders", "order_id"}},
+	{Name: "inventory", Columns: []string{"product_id", "warehouse_id", "quantity", "reserved", "updated_at"}, Filter: "warehouse_id", Joins: [2]string{"products", "product_id"}},
+}
+
+// dbPorts are the default ports of the systems in dbTypes
+var dbPorts = map[string]int{
+	"postgres": 5432, "mysql": 3306, "mongodb": 27017,
+	"redis": 6379, "elasticsearch": 9200, "cassandra": 9042,
+}
+
+// dbClientSpan returns the name and attributes of a call to one of the
+// databases in dbTypes, with a statement in that system's query language
+func dbClientSpan() (string, map[string]string) {
+	system := dbTypes[rand.Intn(len(dbTypes))]
+	table := dbTables[rand.Intn(len(dbTables))]
+	host := fmt.Sprintf("%s-%d.db.internal", system, 1+rand.Intn(3))
+	port := dbPorts[system]
+	attrs := map[string]string{
+		"span.kind":     "client",
+		"db.system":     system,
+		"db.name":       "shop",
+		"db.user":       "app_rw",
+		"net.peer.name": host,
+		"net.peer.port": strconv.Itoa(port),
+	}
+
+	var operation, statement string
+	var rows int
+	switch system {
+	case "postgres", "mysql":
+		operation, statement, rows = sqlStatement(system, table)
+		attrs["db.sql.table"] = table.Name
+		attrs["db.connection_string"] = fmt.Sprintf("%s://%s:%d/shop", map[string]string{"postgres": "postgresql", "mysql": "mysql"}[system], host, port)
+	case "cassandra":
+		operation, statement, rows = cqlStatement(table)
+		attrs["db.name"] = "shop_ks"
+		attrs["db.cassandra.table"] = table.Name
+		attrs["db.cassandra.consistency_level"] = []string{"local_quorum", "one", "quorum"}[rand.Intn(3)]
+		attrs["db.cassandra.coordinator.dc"] = "dc1"
+	case "mongodb":
+		operation, statement, rows = mongoCommand(table)
+		attrs["db.mongodb.collection"] = table.Name
+	case "redis":
+		operation, statement, rows = redisCommand(table)
+		attrs["db.redis.database_index"] = "0"
+		delete(attrs, "db.name")
+	case "elasticsearch":
+		operation, statement, rows = elasticsearchRequest(table)
+		path := map[string]string{"search": "_search", "index": "_doc", "update": "_update"}[operation]
+		if operation != "search" {
+			path += "/" + strconv.Itoa(rand.Intn(100000))
+		}
+		attrs["http.method"] = map[string]string{"search": "POST", "index": "PUT", "update": "POST"}[operation]
+		attrs["url.full"] = fmt.Sprintf("http://%s:%d/%s/%s", host, port, table.Name, path)
+		delete(attrs, "db.user")
+	}
+	attrs["db.operation"] = operation
+	attrs["db.statement"] = statement
+	switch {
+	case rows < 0:
+	case operation == "SELECT" || operation == "find" || operation == "aggregate" || operation == "search":
+		attrs["db.response.returned_rows"] = strconv.Itoa(rows)
+	default:
+		attrs["db.rows_affected"] = strconv.Itoa(rows)
+	}
+
+	// Span names follow "{db.operation} {db.name}.{table}"; Redis has no table
+	if system == "redis" {
+		return operation, attrs
+	}
+	return operation + " " + attrs["db.name"] + "." + table.Name, attrs
+}
+
+// sqlStatement returns a parameterized SQL statement against table, its
+// operation and the number of rows read or written
+func sqlStatement(system string, table dbTable) (string, string, int) {
+	cols := strings.Join(table.Columns, ", ")
+	var operation, statement string
+	rows := 1
+	switch r := rand.Intn(10); {
+	case r < 3:
+		operation = "SELECT"
+		statement = fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", cols, table.Name, table.Columns[0])
+		rows = rand.Intn(2)
+	case r < 5:
+		operation = "SELECT"
+		statement = fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? ORDER BY %s DESC LIMIT %d",
+			cols, table.Name, table.Filter, table.Columns[len(table.Columns)-1], []int{10, 20, 50, 100}[rand.Intn(4)])
+		rows = rand.Intn(50)
+	case r < 6 && table.Joins[0] != "":
+		operation = "SELECT"
+		statement = fmt.Sprintf("SELECT t.%s, j.* FROM %s t JOIN %s j ON j.id = t.%s WHERE t.%s IN (?, ?, ?)",
+			table.Columns[0], table.Name, table.Joins[0], table.Joins[1], table.Filter)
+		rows = rand.Intn(200)
+	case r < 7:
+		operation = "SELECT"
+		statement = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", table.Name, table.Filter)
+	case r < 8:
+		operation = "INSERT"
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+		statement = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.Name, cols, marks)
+		if system == "postgres" {
+			statement += fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", table.Columns[0])
+		}
+	case r < 9:
+		operation = "UPDATE"
+		statement = fmt.Sprintf("UPDATE %s SET %s = ?, %s = ? WHERE %s = ?",
+			table.Name, table.Columns[len(table.Columns)-2], table.Columns[len(table.Columns)-1], table.Columns[0])
+	default:
+		operation = "DELETE"
+		statement = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table.Name, table.Columns[0])
+		rows = rand.Intn(2)
+	}
+	if system == "postgres" {
+		statement = numberPlaceholders(statement)
+	}
+	return operation, statement, rows
+}
+
+// numberPlaceholders rewrites ? placeholders as PostgreSQL's $1, $2, ...
+func numberPlaceholders(statement string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range statement {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// cqlStatement returns a CQL statement; Cassandra has no joins and reads by
+// partition key
+func cqlStatement(table dbTable) (string, string, int) {
+	switch rand.Intn(4) {
+	case 0, 1:
+		return "SELECT", fmt.Sprintf("SELECT %s FROM shop_ks.%s WHERE %s = ? LIMIT 100",
+			strings.Join(table.Columns, ", "), table.Name, table.Columns[0]), rand.Intn(100)
+	case 2:
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+		return "INSERT", fmt.Sprintf("INSERT INTO shop_ks.%s (%s) VALUES (%s) USING TTL 86400",
+			table.Name, strings.Join(table.Columns, ", "), marks), 1
+	}
+	return "UPDATE", fmt.Sprintf("UPDATE shop_ks.%s SET %s = ? WHERE %s = ?",
+		table.Name, table.Columns[len(table.Columns)-1], table.Columns[0]), 1
+}
+
+// mongoCommand returns a MongoDB command document with values redacted
+func mongoCommand(table dbTable) (string, string, int) {
+	switch rand.Intn(5) {
+	case 0, 1:
+		return "find", fmt.Sprintf(`{"find":%q,"filter":{%q:"?"},"sort":{%q:-1},"limit":50}`,
+			table.Name, table.Filter, table.Columns[len(table.Columns)-1]), rand.Intn(50)
+	case 2:
+		return "aggregate", fmt.Sprintf(`{"aggregate":%q,"pipeline":[{"$match":{%q:"?"}},{"$group":{"_id":"$%s","count":{"$sum":1}}}]}`,
+			table.Name, table.Filter, table.Filter), rand.Intn(20)
+	case 3:
+		return "insert", fmt.Sprintf(`{"insert":%q,"documents":[{"_id":"?"}],"ordered":true}`, table.Name), 1
+	}
+	return "update", fmt.Sprintf(`{"update":%q,"updates":[{"q":{"_id":"?"},"u":{"$set":{%q:"?"}}}]}`,
+		table.Name, table.Columns[len(table.Columns)-1]), 1
+}
+
+// redisCommand returns a cache command on a key derived from table; -1 rows
+// means the command does not return rows
+func redisCommand(table dbTable) (string, string, int) {
+	key := fmt.Sprintf("%s:%d", strings.TrimSuffix(table.Name, "s"), rand.Intn(100000))
+	switch rand.Intn(6) {
+	case 0, 1:
+		return "GET", "GET " + key, -1
+	case 2:
+		return "SET", fmt.Sprintf("SET %s ? EX %d", key, []int{60, 300, 3600}[rand.Intn(3)]), -1
+	case 3:
+		return "HGETALL", "HGETALL " + key, -1
+	case 4:
+		return "MGET", fmt.Sprintf("MGET %s %s:%d", key, strings.TrimSuffix(table.Name, "s"), rand.Intn(100000)), -1
+	}
+	return "INCR", fmt.Sprintf("INCR ratelimit:%s", gofakeit.IPv4Address()), -1
+}
+
+// elasticsearchRequest returns a search or document request body
+func elasticsearchRequest(table dbTable) (string, string, int) {
+	switch rand.Intn(4) {
+	case 0, 1:
+		return "search", fmt.Sprintf(`{"query":{"bool":{"must":[{"match":{%q:"?"}}],"filter":[{"range":{"%s":{"gte":"now-7d"}}}]}},"size":20}`,
+			table.Filter, table.Columns[len(table.Columns)-1]), rand.Intn(20)
+	case 2:
+		return "index", `{"id":"?","doc":"?"}`, 1
+	}
+	return "update", fmt.Sprintf(`{"doc":{%q:"?"}}`, table.Columns[len(table.Columns)-1]), 1
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported distribution names
+const (
+	distUniform   = "uniform"
+	distNormal    = "normal"
+	distLognormal = "lognormal"
+	distPareto    = "pareto"
+	distBimodal   = "bimodal"
+)
+
+// valueDistribution draws non-negative random values from a configurable
+// distribution. Values are unit-less; callers decide what they mean.
+type valueDistribution struct {
+	Kind   string
+	Min    float64 // uniform lower bound, pareto scale
+	Max    float64 // uniform upper bound
+	Mean   float64 // normal and lognormal mean
+	StdDev float64 // normal and lognormal standard deviation
+	Alpha  float64 // pareto shape; smaller means a heavier tail
+	// Bimodal samples are lognormal around Mean, or around SlowMean for
+	// SlowPercent of them, like cache hits and misses
+	SlowMean    float64
+	SlowPercent float64
+}
+
+var (
+	// latencyDist describes span durations and request timings in milliseconds
+	latencyDist = loadDistribution("LATENCY", "_MS", valueDistribution{
+		Kind: distUniform, Min: 100, Max: 300, Mean: 200, StdDev: 50, Alpha: 1.5,
+		SlowMean: 2000, SlowPercent: 5,
+	})
+	// serviceLatencyDists overrides latencyDist for the spans of single
+	// services, from SERVICE_LATENCY
+	serviceLatencyDists = loadTraceSetting(func() map[string]valueDistribution {
+		return loadServiceLatency(os.Getenv("SERVICE_LATENCY"))
+	})
+	// latencyInLogs makes the "%dms" values in log messages follow latencyDist
+	latencyInLogs = getEnvBool("LATENCY_IN_LOGS", false)
+)
+
+// loadDistribution reads <prefix>_DISTRIBUTION and its parameters, e.g.
+// <prefix>_MEAN<suffix>, falling back to defaults
+func loadDistribution(prefix, suffix string, defaults valueDistribution) valueDistribution {
+	dist := valueDistribution{
+		Kind:   getEnvOrDefault(prefix+"_DISTRIBUTION", defaults.Kind),
+		Min:    getEnvFloat(prefix+"_MIN"+suffix, defaults.Min),
+		Max:    getEnvFloat(prefix+"_MAX"+suffix, defaults.Max),
+		Mean:   getEnvFloat(prefix+"_MEAN"+suffix, defaults.Mean),
+		StdDev: getEnvFloat(prefix+"_STDDEV"+suffix, defaults.StdDev),
+		Alpha:  getEnvFloat(prefix+"_PARETO_ALPHA", defaults.Alpha),
+
+		SlowMean:    getEnvFloat(prefix+"_SLOW_MEAN"+suffix, defaults.SlowMean),
+		SlowPercent: getEnvFloat(prefix+"_SLOW_PERCENT", defaults.SlowPercent),
+	}
+	if !knownDistribution(dist.Kind) {
+		configProblem("%s_DISTRIBUTION=%q is not supported (use uniform, normal, lognormal, pareto or bimodal)", prefix, dist.Kind)
+	}
+	return dist
+}
+
+// loadTraceDistribution is loadDistribution for a setting only traces use
+func loadTraceDistribution(prefix, suffix string, defaults valueDistribution) valueDistribution {
+	return loadTraceSetting(func() valueDistribution { return loadDistribution(prefix, suffix, defaults) })
+}
+
+// loadServiceLatency reads per-service latency models in the form
+// "service=kind,param=value,...;service=...", e.g.
+// "payment-service=lognormal,mean=300,stddev=200;search=bimodal,slow_mean=900".
+// Parameters are in milliseconds and default to the LATENCY_* settings.
+func loadServiceLatency(value string) map[string]valueDistribution {
+	dists := make(map[string]valueDistribution)
+	if value == "" {
+		return dists
+	}
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		service, spec, ok := strings.Cut(entry, "=")
+		service = strings.TrimSpace(service)
+		if !ok || service == "" {
+			configProblem("SERVICE_LATENCY entry %q must look like service=kind,param=value", entry)
+			continue
+		}
+		dist, err := parseDistribution(spec, latencyDist)
+		if err != nil {
+			configProblem("SERVICE_LATENCY for %s: %v", service, err)
+			continue
+		}
+		dists[service] = dist
+	}
+	log.Printf("Using custom latency for %d services", len(dists))
+	return dists
+}
+
+// parseDistribution reads "kind,param=value,..." on top of defaults
+func parseDistribution(spec string, defaults valueDistribution) (valueDistribution, error) {
+	fields := strings.Split(spec, ",")
+	dist := defaults
+	dist.Kind = strings.TrimSpace(fields[0])
+	if !knownDistribution(dist.Kind) {
+		return dist, fmt.Errorf("distribution %q is not supported (use uniform, normal, lognormal, pareto or bimodal)", dist.Kind)
+	}
+	params := map[string]*float64{
+		"min": &dist.Min, "max": &dist.Max, "mean": &dist.Mean, "stddev": &dist.StdDev,
+		"alpha": &dist.Alpha, "slow_mean": &dist.SlowMean, "slow_percent": &dist.SlowPercent,
+	}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		param, ok := params[key]
+		if !ok {
+			return dist, fmt.Errorf("unknown parameter %q", key)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return dist, fmt.Errorf("parameter %s=%q is not a number", key, value)
+		}
+		*param = v
+	}
+	return dist, nil
+}
+
+// latencyFor returns the latency model for spans of service
+func latencyFor(service string) valueDistribution {
+	if dist, ok := serviceLatencyDists[service]; ok {
+		return dist
+	}
+	return latencyDist
+}
+
+// validateDistribution records problems with the parameters of a distribution
+// loaded by loadDistribution
+func validateDistribution(prefix, suffix string, d valueDistribution) {
+	switch d.Kind {
+	case distUniform:
+		if d.Max < d.Min {
+			configProblem("%s_MAX%s (%g) must not be below %s_MIN%s (%g)", prefix, suffix, d.Max, prefix, suffix, d.Min)
+		}
+	case distNormal, distLognormal:
+		if d.StdDev < 0 {
+			configProblem("%s_STDDEV%s must not be negative (got %g)", prefix, suffix, d.StdDev)
+		}
+	case distPareto:
+		if d.Alpha <= 0 {
+			configProblem("%s_PARETO_ALPHA must be greater than 0 (got %g)", prefix, d.Alpha)
+		}
+		// Pareto values are multiples of the minimum
+		if d.Min <= 0 {
+			configProblem("%s_MIN%s must be greater than 0 for the pareto distribution (got %g)", prefix, suffix, d.Min)
+		}
+	case distBimodal:
+		if d.StdDev < 0 {
+			configProblem("%s_STDDEV%s must not be negative (got %g)", prefix, suffix, d.StdDev)
+		}
+		if d.SlowMean <= 0 {
+			configProblem("%s_SLOW_MEAN%s must be greater than 0 (got %g)", prefix, suffix, d.SlowMean)
+		}
+		if d.SlowPercent < 0 || d.SlowPercent > 100 {
+			configProblem("%s_SLOW_PERCENT must be between 0 and 100 (got %g)", prefix, d.SlowPercent)
+		}
+	}
+}
+
+// Sample returns a single value, clamped to be non-negative
+func (d valueDistribution) Sample() float64 {
+	var v float64
+	switch d.Kind {
+	case distNormal:
+		v = d.Mean + rand.NormFloat64()*d.StdDev
+	case distLognormal:
+		v = sampleLognormal(d.Mean, d.StdDev)
+	case distBimodal:
+		// The slow mode keeps the fast mode's relative spread
+		if rand.Float64()*100 < d.SlowPercent && d.Mean > 0 {
+			v = sampleLognormal(d.SlowMean, d.StdDev*d.SlowMean/d.Mean)
+		} else {
+			v = sampleLognormal(d.Mean, d.StdDev)
+		}
+	case distPareto:
+		alpha := d.Alpha
+		if alpha <= 0 {
+			alpha = 1
+		}
+		v = d.Min / math.Pow(1-rand.Float64(), 1/alpha)
+	default:
+		v = d.Min + rand.Float64()*(d.Max-d.Min)
+	}
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+// sampleLognormal derives the parameters of the underlying normal so the
+// resulting distribution has the given mean and standard deviation
+func sampleLognormal(mean, stddev float64) float64 {
+	if mean <= 0 {
+		return 0
+	}
+	sigma2 := math.Log(1 + (stddev*stddev)/(mean*mean))
+	mu := math.Log(mean) - sigma2/2
+	return math.Exp(mu + rand.NormFloat64()*math.Sqrt(sigma2))
+}
+
+// SampleDuration interprets a sample as milliseconds
+func (d valueDistribution) SampleDuration() time.Duration {
+	return time.Duration(d.Sample() * float64(time.Millisecond))
+}
+
+// SampleInt returns a sample rounded to the nearest integer
+func (d valueDistribution) SampleInt() int {
+	return int(math.Round(d.Sample()))
+}
+
+// knownDistribution reports whether kind is a supported distribution name
+func knownDistribution(kind string) bool {
+	switch kind {
+	case distUniform, distNormal, distLognormal, distPareto, distBimodal:
+		return true
+	}
+	return false
+}
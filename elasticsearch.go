@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const logFormatESBulk = "es_bulk"
+
+// esBulkConfig routes LOG_FORMAT=es_bulk documents
+var esBulkConfig = struct {
+	// Index is the index or data stream written to; {job} is replaced with
+	// the record's job
+	Index string
+	// DataStream writes with the create action that data streams require
+	DataStream bool
+	// DocumentIDs sets an _id on every document instead of letting the
+	// cluster assign one
+	DocumentIDs bool
+}{
+	Index:       getEnvOrDefault("ES_INDEX", "logs-loadgen-default"),
+	DataStream:  getEnvBool("ES_DATA_STREAM", true),
+	DocumentIDs: getEnvBool("ES_DOCUMENT_IDS", false),
+}
+
+type esBulkMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
+
+// esDocument is a record in Elastic Common Schema field names
+type esDocument struct {
+	Timestamp string `json:"@timestamp"`
+	Level     string `json:"log.level"`
+	Severity  int    `json:"event.severity,omitempty"`
+	Service   string `json:"service.name"`
+	Message   string `json:"message"`
+	TraceID   string `json:"trace.id,omitempty"`
+	SpanID    string `json:"span.id,omitempty"`
+	// Kubernetes is kept in the layout Fluent Bit ships it in
+	Kubernetes *k8sMetadata `json:"kubernetes,omitempty"`
+	// logEmitter fields are already ECS names
+	*logEmitter
+	*logClient
+	*logSequence
+}
+
+// esBulkLogEncoder sends records as an Elasticsearch/OpenSearch _bulk request:
+// an action line and a document line per record, each newline-terminated
+type esBulkLogEncoder struct{}
+
+func (esBulkLogEncoder) ContentType() string { return "application/x-ndjson" }
+
+func (esBulkLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	action := "index"
+	if esBulkConfig.DataStream {
+		action = "create"
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range batch {
+		meta := esBulkMeta{Index: strings.ReplaceAll(esBulkConfig.Index, "{job}", record.Job)}
+		if record.ID != "" {
+			// Duplicates overwrite the first copy instead of being indexed twice
+			meta.ID = record.ID
+		} else if esBulkConfig.DocumentIDs {
+			meta.ID = generateTraceID()
+		}
+		if err := enc.Encode(map[string]esBulkMeta{action: meta}); err != nil {
+			return nil, fmt.Errorf("failed to marshal bulk action: %w", err)
+		}
+		doc := esDocument{
+			Timestamp:   record.Time.UTC().Format(time.RFC3339Nano),
+			Level:       record.Level,
+			Severity:    record.SeverityNumber,
+			Service:     record.Job,
+			Message:     record.Log,
+			TraceID:     record.TraceID,
+			SpanID:      record.SpanID,
+			Kubernetes:  record.Kubernetes,
+			logEmitter:  record.logEmitter,
+			logClient:   record.logClient,
+			logSequence: record.logSequence,
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to marshal bulk document: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
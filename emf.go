@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const logFormatEMF = "emf"
+
+// emfNamespace is the CloudWatch namespace of the embedded metrics
+var emfNamespace = getEnvOrDefault("EMF_NAMESPACE", "LoadGen")
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDocument struct {
+	AWS       emfMetadata `json:"_aws"`
+	Service   string      `json:"Service"`
+	Level     string      `json:"Level"`
+	Latency   float64     `json:"Latency"`
+	Requests  int         `json:"Requests"`
+	Errors    int         `json:"Errors"`
+	Message   string      `json:"message"`
+	Timestamp string      `json:"timestamp"`
+}
+
+var emfDirectives = []emfDirective{{
+	Dimensions: [][]string{{"Service"}, {"Service", "Level"}},
+	Metrics: []emfMetric{
+		{Name: "Latency", Unit: "Milliseconds"},
+		{Name: "Requests", Unit: "Count"},
+		{Name: "Errors", Unit: "Count"},
+	},
+}}
+
+// emfLogEncoder sends records as newline-delimited CloudWatch Embedded Metric
+// Format documents, each carrying the record's latency, a request count and
+// an error count
+type emfLogEncoder struct{}
+
+func (emfLogEncoder) ContentType() string { return "application/x-ndjson" }
+
+func (emfLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	directives := make([]emfDirective, len(emfDirectives))
+	for i, d := range emfDirectives {
+		d.Namespace = emfNamespace
+		directives[i] = d
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range batch {
+		doc := emfDocument{
+			AWS:       emfMetadata{Timestamp: record.Time.UnixMilli(), CloudWatchMetrics: directives},
+			Service:   record.Job,
+			Level:     record.Level,
+			Latency:   record.LatencyMs,
+			Requests:  1,
+			Message:   record.Log,
+			Timestamp: record.Timestamp,
+		}
+		if severityNumbers[record.Level] >= severityNumbers["error"] {
+			doc.Errors = 1
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to marshal EMF document: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseHTTPMethod normalizes a configured HTTP method and rejects methods
+// that cannot carry a request body
+func parseHTTPMethod(key, value string) (string, error) {
+	method := strings.ToUpper(strings.TrimSpace(value))
+	if method == "" {
+		return http.MethodPost, nil
+	}
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return method, nil
+	}
+	return "", fmt.Errorf("%s=%q is not supported (use POST, PUT or PATCH)", key, value)
+}
+
+// expandEndpoint replaces {name} placeholders in an endpoint template with
+// path-escaped values. Unknown placeholders are left untouched.
+func expandEndpoint(template string, vars map[string]string) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+	pairs := make([]string, 0, len(vars)*2)
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", url.PathEscape(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// exceptionTemplate is a kind of failure with a stack trace in the format of
+// the language that raised it
+type exceptionTemplate struct {
+	Type    string
+	Message func() string
+	// Stack renders the stack trace for type and message
+	Stack func(typ, message string) string
+}
+
+var exceptionTemplates = []exceptionTemplate{
+	{
+		Type: "java.sql.SQLTransientConnectionException",
+		Message: func() string {
+			return fmt.Sprintf("HikariPool-1 - Connection is not available, request timed out after %dms.", 30000+rand.Intn(5000))
+		},
+		Stack: javaStack("com.zaxxer.hikari.pool.HikariPool.createTimeoutException(HikariPool.java:696)",
+			"com.zaxxer.hikari.pool.HikariPool.getConnection(HikariPool.java:181)",
+			"com.example.orders.repository.OrderRepository.findById(OrderRepository.java:%d)",
+			"com.example.orders.service.OrderService.getOrder(OrderService.java:%d)",
+			"com.example.orders.web.OrderController.get(OrderController.java:%d)"),
+	},
+	{
+		Type: "java.lang.NullPointerException",
+		Message: func() string {
+			return fmt.Sprintf("Cannot invoke \"com.example.cart.model.Item.getPrice()\" because \"items[%d]\" is null", rand.Intn(10))
+		},
+		Stack: javaStack("com.example.cart.service.PricingService.total(PricingService.java:%d)",
+			"com.example.cart.service.CartService.checkout(CartService.java:%d)",
+			"com.example.cart.web.CartController.checkout(CartController.java:%d)"),
+	},
+	{
+		Type: "requests.exceptions.ConnectionError",
+		Message: func() string {
+			return fmt.Sprintf("HTTPConnectionPool(host='%s', port=8080): Max retries exceeded with url: /api/v1/items", gofakeit.DomainName())
+		},
+		Stack: pythonStack([2]string{"/app/service/client.py", "fetch_items"},
+			[2]string{"/usr/local/lib/python3.12/site-packages/requests/api.py", "get"},
+			[2]string{"/usr/local/lib/python3.12/site-packages/requests/adapters.py", "send"}),
+	},
+	{
+		Type: "KeyError",
+		Message: func() string {
+			return fmt.Sprintf("'%s'", gofakeit.Word())
+		},
+		Stack: pythonStack([2]string{"/app/service/handlers.py", "handle_event"},
+			[2]string{"/app/service/serializers.py", "to_payload"}),
+	},
+	{
+		Type: "*net.OpError",
+		Message: func() string {
+			return fmt.Sprintf("dial tcp %s:5432: connect: connection refused", gofakeit.IPv4Address())
+		},
+		Stack: goStack([2]string{"net.(*Dialer).DialContext", "/usr/local/go/src/net/dial.go"},
+			[2]string{"database/sql.(*DB).conn", "/usr/local/go/src/database/sql/sql.go"},
+			[2]string{"main.(*store).loadInventory", "/app/store.go"},
+			[2]string{"main.(*server).handleInventory", "/app/server.go"}),
+	},
+	{
+		Type: "context.deadlineExceededError",
+		Message: func() string {
+			return "context deadline exceeded"
+		},
+		Stack: goStack([2]string{"google.golang.org/grpc.(*ClientConn).Invoke", "/go/pkg/mod/google.golang.org/grpc@v1.71.1/call.go"},
+			[2]string{"main.(*paymentClient).Charge", "/app/payment.go"},
+			[2]string{"main.(*server).handleCheckout", "/app/server.go"}),
+	},
+	{
+		Type: "TypeError",
+		Message: func() string {
+			return fmt.Sprintf("Cannot read properties of undefined (reading '%s')", gofakeit.Word())
+		},
+		Stack: nodeStack("renderProfile (/app/src/views/profile.js:%d:%d)",
+			"UserController.show (/app/src/controllers/user.js:%d:%d)",
+			"Layer.handle [as handle_request] (/app/node_modules/express/lib/router/layer.js:95:5)"),
+	},
+}
+
+func javaStack(frames ...string) func(typ, message string) string {
+	return func(typ, message string) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s: %s", typ, message)
+		for _, frame := range frames {
+			b.WriteString("\n\tat ")
+			b.WriteString(withLineNumbers(frame))
+		}
+		return b.String()
+	}
+}
+
+// pythonStack takes frames as file and function, outermost first
+func pythonStack(frames ...[2]string) func(typ, message string) string {
+	return func(typ, message string) string {
+		var b strings.Builder
+		b.WriteString("Traceback (most recent call last):")
+		for _, frame := range frames {
+			fmt.Fprintf(&b, "\n  File \"%s\", line %d, in %s", frame[0], 10+rand.Intn(300), frame[1])
+		}
+		fmt.Fprintf(&b, "\n%s: %s", typ, message)
+		return b.String()
+	}
+}
+
+// goStack takes frames as function and file, innermost first as a
+// goroutine dump lists them
+func goStack(frames ...[2]string) func(typ, message string) string {
+	return func(typ, message string) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "goroutine %d [running]:", 1+rand.Intn(5000))
+		for _, frame := range frames {
+			fmt.Fprintf(&b, "\n%s(...)\n\t%s:%d +0x%x", frame[0], frame[1], 10+rand.Intn(500), rand.Intn(0x400))
+		}
+		return b.String()
+	}
+}
+
+func nodeStack(frames ...string) func(typ, message string) string {
+	return func(typ, message string) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s: %s", typ, message)
+		for _, frame := range frames {
+			b.WriteString("\n    at ")
+			b.WriteString(withLineNumbers(frame))
+		}
+		return b.String()
+	}
+}
+
+// withLineNumbers fills the %d verbs of a frame with random line numbers
+func withLineNumbers(frame string) string {
+	n := strings.Count(frame, "%d")
+	if n == 0 {
+		return frame
+	}
+	args := make([]any, n)
+	for i := range args {
+		args[i] = 1 + rand.Intn(400)
+	}
+	return fmt.Sprintf(frame, args...)
+}
+
+// exceptionEvent returns an OTel exception event recorded at nanos
+func exceptionEvent(nanos int64) SpanEvent {
+	t := exceptionTemplates[rand.Intn(len(exceptionTemplates))]
+	message := t.Message()
+	return SpanEvent{
+		Name: "exception",
+		Time: nanos,
+		Attributes: map[string]string{
+			"exception.type":       t.Type,
+			"exception.message":    message,
+			"exception.stacktrace": t.Stack(t.Type, message),
+		},
+	}
+}
+
+// failSpan marks span as an error with an exception event shortly before
+// it ends. The span's end time must be set.
+func failSpan(span *Span) {
+	event := exceptionEvent(span.EndTime - rand.Int63n(max(1, (span.EndTime-span.StartTime)/10)))
+	span.Error = true
+	span.StatusMessage = event.Attributes["exception.message"]
+	span.Attributes["error.type"] = event.Attributes["exception.type"]
+	span.Events = append(span.Events, event)
+	markFailedStatus(span.Attributes)
+}
+
+// propagateError fails parent when its call to child failed, as a caller
+// that cannot handle the error returns it to its own caller
+func propagateError(parent *Span, child Span) {
+	if !child.Error || parent.Error {
+		return
+	}
+	parent.Error = true
+	parent.StatusMessage = fmt.Sprintf("call to %s failed", child.ServiceName)
+	parent.Attributes["error.type"] = child.Attributes["error.type"]
+	markFailedStatus(parent.Attributes)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// traceExemplar is a trace that was successfully sent, kept so metrics and
+// logs can reference it
+type traceExemplar struct {
+	TraceID string
+	SpanID  string
+	// Value is the root span duration in seconds
+	Value float64
+	Time  time.Time
+	// Spans are every span of the trace, for logs written inside them
+	Spans []traceExemplarSpan
+}
+
+// traceExemplarSpan is a span of a remembered trace and its service
+type traceExemplarSpan struct {
+	SpanID  string
+	Service string
+}
+
+// exemplarRing keeps the most recently sent traces
+type exemplarRing struct {
+	mu    sync.Mutex
+	items []traceExemplar
+	next  int
+}
+
+// recentTracesSize bounds how many sent traces are remembered
+const recentTracesSize = 256
+
+var recentTraces = &exemplarRing{}
+
+// add remembers a sent trace, evicting the oldest once full
+func (r *exemplarRing) add(e traceExemplar) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) < recentTracesSize {
+		r.items = append(r.items, e)
+		return
+	}
+	r.items[r.next] = e
+	r.next = (r.next + 1) % recentTracesSize
+}
+
+// random returns one of the remembered traces, if any
+func (r *exemplarRing) random() (traceExemplar, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.items) == 0 {
+		return traceExemplar{}, false
+	}
+	return r.items[rand.Intn(len(r.items))], true
+}
+
+// correlateWithTrace places record inside a random span of a recently sent
+// trace, taking its ids and service; it reports false before any trace has
+// been sent
+func correlateWithTrace(record *LogRecord) bool {
+	e, ok := recentTraces.random()
+	if !ok || len(e.Spans) == 0 {
+		return false
+	}
+	span := e.Spans[rand.Intn(len(e.Spans))]
+	record.TraceID = e.TraceID
+	record.SpanID = span.SpanID
+	record.Job = span.Service
+	return true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// expHistogram is a base-2 exponential histogram as defined by OTLP. Bucket
+// i at scale s covers (2^(i/2^s), 2^((i+1)/2^s)]. When the populated range
+// would need more than maxBuckets buckets the scale is lowered, halving the
+// resolution, the same way OpenTelemetry SDKs do.
+type expHistogram struct {
+	scale      int
+	maxBuckets int
+	zeroCount  uint64
+	offset     int
+	counts     []uint64
+}
+
+func newExpHistogram(scale, maxBuckets int) *expHistogram {
+	return &expHistogram{scale: scale, maxBuckets: maxBuckets}
+}
+
+// bucketIndex returns the bucket holding v at the current scale
+func (h *expHistogram) bucketIndex(v float64) int {
+	return int(math.Ceil(math.Ldexp(math.Log2(v), h.scale))) - 1
+}
+
+// observe records a non-negative value
+func (h *expHistogram) observe(v float64) {
+	if v <= 0 {
+		h.zeroCount++
+		return
+	}
+	index := h.bucketIndex(v)
+	for len(h.counts) > 0 {
+		low, high := min(h.offset, index), max(h.offset+len(h.counts)-1, index)
+		if high-low+1 <= h.maxBuckets {
+			break
+		}
+		h.downscale()
+		index = h.bucketIndex(v)
+	}
+
+	switch {
+	case len(h.counts) == 0:
+		h.offset = index
+		h.counts = []uint64{0}
+	case index < h.offset:
+		grown := make([]uint64, h.offset-index+len(h.counts))
+		copy(grown[h.offset-index:], h.counts)
+		h.counts = grown
+		h.offset = index
+	case index >= h.offset+len(h.counts):
+		h.counts = append(h.counts, make([]uint64, index-h.offset-len(h.counts)+1)...)
+	}
+	h.counts[index-h.offset]++
+}
+
+// downscale halves the resolution by merging adjacent bucket pairs
+func (h *expHistogram) downscale() {
+	h.scale--
+	newOffset := h.offset >> 1
+	merged := make([]uint64, ((h.offset+len(h.counts)-1)>>1)-newOffset+1)
+	for i, c := range h.counts {
+		merged[((h.offset+i)>>1)-newOffset] += c
+	}
+	h.offset = newOffset
+	h.counts = merged
+}
+
+// appendNativeHistogram encodes the histogram as a remote_write Histogram
+// message. Prometheus native histograms share the OTLP bucket layout, with
+// bucket indexes shifted by one.
+func appendNativeHistogram(b []byte, h *expHistogram, count uint64, sum float64, timestamp int64) []byte {
+	var m []byte
+	m = protowire.AppendTag(m, 1, protowire.VarintType) // count_int
+	m = protowire.AppendVarint(m, count)
+	m = protowire.AppendTag(m, 3, protowire.Fixed64Type) // sum
+	m = protowire.AppendFixed64(m, math.Float64bits(sum))
+	m = protowire.AppendTag(m, 4, protowire.VarintType) // schema
+	m = protowire.AppendVarint(m, protowire.EncodeZigZag(int64(h.scale)))
+	m = protowire.AppendTag(m, 5, protowire.Fixed64Type) // zero_threshold
+	m = protowire.AppendFixed64(m, math.Float64bits(0))
+	m = protowire.AppendTag(m, 6, protowire.VarintType) // zero_count_int
+	m = protowire.AppendVarint(m, h.zeroCount)
+
+	if len(h.counts) > 0 {
+		var span []byte
+		span = protowire.AppendTag(span, 1, protowire.VarintType) // offset
+		span = protowire.AppendVarint(span, protowire.EncodeZigZag(int64(h.offset+1)))
+		span = protowire.AppendTag(span, 2, protowire.VarintType) // length
+		span = protowire.AppendVarint(span, uint64(len(h.counts)))
+		m = protowire.AppendTag(m, 11, protowire.BytesType) // positive_spans
+		m = protowire.AppendBytes(m, span)
+
+		var deltas []byte
+		var prev int64
+		for _, c := range h.counts {
+			deltas = protowire.AppendVarint(deltas, protowire.EncodeZigZag(int64(c)-prev))
+			prev = int64(c)
+		}
+		m = protowire.AppendTag(m, 12, protowire.BytesType) // positive_deltas, packed
+		m = protowire.AppendBytes(m, deltas)
+	}
+
+	m = protowire.AppendTag(m, 15, protowire.VarintType) // timestamp
+	m = protowire.AppendVarint(m, uint64(timestamp))
+
+	b = protowire.AppendTag(b, 4, protowire.BytesType) // TimeSeries.histograms
+	return protowire.AppendBytes(b, m)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Fluent Forward messages are sent over the socket transport (TCP or TLS)
+// in Forward mode: one [tag, entries, option] message per batch, encoded as
+// msgpack. With FLUENT_ACK the receiver must acknowledge every batch.
+
+const logFormatFluentForward = "fluent_forward"
+
+// fluentConfig tags and acknowledges LOG_FORMAT=fluent_forward batches
+var fluentConfig = struct {
+	Tag string
+	// Ack asks the receiver to acknowledge every batch, as
+	// require_ack_response does in Fluentd's out_forward
+	Ack bool
+}{
+	Tag: getEnvOrDefault("FLUENT_TAG", "load-gen"),
+	Ack: getEnvBool("FLUENT_ACK", false),
+}
+
+// ackLogEncoder is implemented by log encoders whose receiver acknowledges
+// batches on the same connection
+type ackLogEncoder interface {
+	logEncoder
+	// EncodeAcked serializes the batch like Encode and returns a function
+	// that reads and checks its acknowledgement, or nil when none is expected
+	EncodeAcked(batch []LogRecord) ([]byte, func(io.Reader) error, error)
+}
+
+// fluentForwardLogEncoder sends records as Fluent Forward messages
+type fluentForwardLogEncoder struct{}
+
+func (fluentForwardLogEncoder) ContentType() string { return "application/msgpack" }
+
+func (e fluentForwardLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	data, _, err := e.EncodeAcked(batch)
+	return data, err
+}
+
+func (fluentForwardLogEncoder) EncodeAcked(batch []LogRecord) ([]byte, func(io.Reader) error, error) {
+	b := appendMsgpackArrayHeader(nil, 3)
+	b = appendMsgpackString(b, fluentConfig.Tag)
+	b = appendMsgpackArrayHeader(b, len(batch))
+	for _, record := range batch {
+		fields := 3
+		if record.TraceID != "" {
+			fields += 2
+		}
+		if record.logEmitter != nil {
+			fields += 4
+		}
+		b = appendMsgpackArrayHeader(b, 2)
+		b = appendFluentEventTime(b, uint32(record.Time.Unix()), uint32(record.Time.Nanosecond()))
+		b = appendMsgpackMapHeader(b, fields)
+		b = appendMsgpackString(b, "level")
+		b = appendMsgpackString(b, record.Level)
+		b = appendMsgpackString(b, "job")
+		b = appendMsgpackString(b, record.Job)
+		b = appendMsgpackString(b, "log")
+		b = appendMsgpackString(b, record.Log)
+		if record.TraceID != "" {
+			b = appendMsgpackString(b, "trace_id")
+			b = appendMsgpackString(b, record.TraceID)
+			b = appendMsgpackString(b, "span_id")
+			b = appendMsgpackString(b, record.SpanID)
+		}
+		if e := record.logEmitter; e != nil {
+			// The keys Fluent Bit's docker and tail inputs enrich records with
+			for _, field := range [][2]string{{"host", e.HostName}, {"container_id", e.ContainerID}, {"filepath", e.LogFilePath}, {"region", e.CloudRegion}} {
+				b = appendMsgpackString(b, field[0])
+				b = appendMsgpackString(b, field[1])
+			}
+		}
+	}
+
+	if !fluentConfig.Ack {
+		b = appendMsgpackMapHeader(b, 1)
+		b = appendMsgpackString(b, "size")
+		b = appendMsgpackUint(b, uint64(len(batch)))
+		return b, nil, nil
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	chunk := base64.StdEncoding.EncodeToString(id)
+	b = appendMsgpackMapHeader(b, 2)
+	b = appendMsgpackString(b, "size")
+	b = appendMsgpackUint(b, uint64(len(batch)))
+	b = appendMsgpackString(b, "chunk")
+	b = appendMsgpackString(b, chunk)
+	return b, func(r io.Reader) error { return readFluentAck(r, chunk) }, nil
+}
+
+// readFluentAck reads a {"ack": chunk} response and checks it acknowledges chunk
+func readFluentAck(r io.Reader, chunk string) error {
+	var header [1]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("failed to read forward ack: %w", err)
+	}
+	if header[0]&0xf0 != 0x80 {
+		return fmt.Errorf("forward ack is not a msgpack map (0x%02x)", header[0])
+	}
+	var acked string
+	for i := 0; i < int(header[0]&0x0f); i++ {
+		key, err := readMsgpackString(r)
+		if err != nil {
+			return fmt.Errorf("failed to read forward ack: %w", err)
+		}
+		value, err := readMsgpackString(r)
+		if err != nil {
+			return fmt.Errorf("failed to read forward ack: %w", err)
+		}
+		if key == "ack" {
+			acked = value
+		}
+	}
+	if acked != chunk {
+		return fmt.Errorf("forward ack %q does not match chunk %q", acked, chunk)
+	}
+	return nil
+}
+
+// appendFluentEventTime appends a Fluentd EventTime, msgpack extension type 0
+func appendFluentEventTime(b []byte, sec, nsec uint32) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, sec)
+	return binary.BigEndian.AppendUint32(b, nsec)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(b, byte(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+// readMsgpackString reads a msgpack str of any width
+func readMsgpackString(r io.Reader) (string, error) {
+	var header [1]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case header[0]&0xe0 == 0xa0:
+		n = int(header[0] & 0x1f)
+	case header[0] == 0xd9, header[0] == 0xda, header[0] == 0xdb:
+		size := map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4}[header[0]]
+		length := make([]byte, 4)
+		if _, err := io.ReadFull(r, length[4-size:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint32(length))
+	default:
+		return "", fmt.Errorf("expected a msgpack string, got 0x%02x", header[0])
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
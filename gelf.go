@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// GELF messages are sent over the socket transport: null-byte delimited on
+// TCP and TLS streams, and compressed and chunked on UDP
+
+const logFormatGELF = "gelf"
+
+// Supported values for GELF_COMPRESSION
+const (
+	gelfCompressionNone = "none"
+	gelfCompressionGzip = "gzip"
+	gelfCompressionZlib = "zlib"
+)
+
+// gelfMaxChunks is the most chunks a GELF receiver reassembles
+const gelfMaxChunks = 128
+
+// gelfChunkHeaderSize is the size of the magic bytes, message id, sequence
+// number and sequence count before every chunk
+const gelfChunkHeaderSize = 12
+
+var gelfConfig = loadGELFConfig()
+
+type GELFConfig struct {
+	// Compression applies to UDP datagrams only; GELF over TCP is never
+	// compressed
+	Compression string
+	// ChunkSize is the largest UDP datagram; longer messages are chunked
+	ChunkSize int
+	// Fields are additional fields added to every message, without the
+	// leading underscore
+	Fields map[string]string
+}
+
+func loadGELFConfig() GELFConfig {
+	cfg := GELFConfig{
+		Compression: getEnvOrDefault("GELF_COMPRESSION", gelfCompressionGzip),
+		ChunkSize:   getEnvInt("GELF_CHUNK_SIZE", 1420),
+		Fields:      map[string]string{},
+	}
+	if value := os.Getenv("GELF_FIELDS"); value != "" {
+		fields, err := parseKeyValueList(value)
+		if err != nil {
+			configProblem("GELF_FIELDS=%q is invalid: %v", value, err)
+		} else {
+			cfg.Fields = fields
+		}
+	}
+	return cfg
+}
+
+// gelfMessage builds the GELF 1.1 document of record
+func gelfMessage(record LogRecord) map[string]any {
+	message := map[string]any{
+		"version":       "1.1",
+		"host":          recordHostname(record),
+		"short_message": record.Log,
+		"timestamp":     float64(record.Time.UnixMicro()) / 1e6,
+		"level":         syslogLevelSeverities[baseLogLevel(record.Level)],
+		"_job":          record.Job,
+		"_level_name":   record.Level,
+	}
+	if record.TraceID != "" {
+		message["_trace_id"] = record.TraceID
+		message["_span_id"] = record.SpanID
+	}
+	if e := record.logEmitter; e != nil {
+		message["_container_id"] = e.ContainerID
+		message["_file"] = e.LogFilePath
+		message["_region"] = e.CloudRegion
+	}
+	for key, value := range gelfConfig.Fields {
+		message["_"+key] = value
+	}
+	return message
+}
+
+// gelfLogEncoder sends records as GELF messages
+type gelfLogEncoder struct{}
+
+func (gelfLogEncoder) ContentType() string { return "application/json" }
+
+func (gelfLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range batch {
+		data, err := json.Marshal(gelfMessage(record))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal GELF message: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeRecord writes a message uncompressed and unchunked
+func (gelfLogEncoder) EncodeRecord(record LogRecord) ([]byte, error) {
+	return json.Marshal(gelfMessage(record))
+}
+
+func (gelfLogEncoder) Datagrams(record LogRecord) ([][]byte, error) {
+	data, err := json.Marshal(gelfMessage(record))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal GELF message: %w", err)
+	}
+	if data, err = gelfCompress(data); err != nil {
+		return nil, err
+	}
+	if len(data) <= gelfConfig.ChunkSize {
+		return [][]byte{data}, nil
+	}
+	return gelfChunks(data)
+}
+
+// gelfCompress compresses a message per GELF_COMPRESSION
+func gelfCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch gelfConfig.Compression {
+	case gelfCompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case gelfCompressionZlib:
+		w = zlib.NewWriter(&buf)
+	default:
+		return data, nil
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress GELF message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress GELF message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// gelfChunks splits a message into chunked GELF datagrams sharing a random
+// message id
+func gelfChunks(data []byte) ([][]byte, error) {
+	size := gelfConfig.ChunkSize - gelfChunkHeaderSize
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %d bytes needs %d chunks, more than the %d allowed",
+			len(data), count, gelfMaxChunks)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*size, len(data))
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*size)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, data[i*size:end]...))
+	}
+	return chunks, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var graphiteConfig = loadGraphiteConfig()
+
+type GraphiteConfig struct {
+	// Addr is the host:port of the carbon plaintext listener; empty disables it
+	Addr   string
+	Prefix string
+	// Depth is the number of extra namespace levels between the prefix and
+	// the series path
+	Depth int
+}
+
+func loadGraphiteConfig() GraphiteConfig {
+	return GraphiteConfig{
+		Addr:   os.Getenv("GRAPHITE_ADDR"),
+		Prefix: getEnvOrDefault("GRAPHITE_PREFIX", "loadgen"),
+		Depth:  getEnvInt("GRAPHITE_DEPTH", 0),
+	}
+}
+
+// graphiteEncoder renders series as Graphite plaintext lines
+// (`path value timestamp`). The path is the prefix, GRAPHITE_DEPTH levels
+// derived from the label set, every label value and the metric name.
+type graphiteEncoder struct{}
+
+func (graphiteEncoder) ContentType() string { return "text/plain" }
+
+func (graphiteEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, s := range series {
+		timestamp := strconv.FormatInt(s.sampleTime(now).Unix(), 10)
+		path := graphitePath(s)
+		write := func(suffix string, value float64) {
+			fmt.Fprintf(&buf, "%s%s %s %s\n", path, suffix, strconv.FormatFloat(value, 'f', -1, 64), timestamp)
+		}
+		switch s.def.Kind {
+		case metricCounter, metricGauge:
+			write("", s.value)
+		case metricHistogram:
+			var cumulative uint64
+			for i, count := range s.bucketCounts {
+				cumulative += count
+				write(".bucket.le_"+graphiteNode(histogramLe(i)), float64(cumulative))
+			}
+			write(".count", float64(s.count))
+			write(".sum", s.sum)
+		case metricExpHistogram:
+			write(".count", float64(s.count))
+			write(".sum", s.sum)
+		case metricSummary:
+			for i, value := range s.quantiles() {
+				write(".p"+graphiteNode(formatPromFloat(metricsConfig.SummaryQuantiles[i]*100)), value)
+			}
+			write(".count", float64(s.count))
+			write(".sum", s.sum)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// graphitePath builds the dotted path of a series without the kind suffix
+func graphitePath(s *metricSeries) string {
+	nodes := []string{graphiteConfig.Prefix}
+	if graphiteConfig.Depth > 0 {
+		h := fnv.New32a()
+		for _, label := range s.labels {
+			h.Write([]byte(label.Value))
+		}
+		sum := h.Sum32()
+		for level := 0; level < graphiteConfig.Depth; level++ {
+			nodes = append(nodes, fmt.Sprintf("l%d_%d", level, (sum>>level)%uint32(metricsConfig.LabelValues)))
+		}
+	}
+	for _, label := range s.labels {
+		nodes = append(nodes, graphiteNode(label.Value))
+	}
+	nodes = append(nodes, s.def.Name)
+	return strings.Join(nodes, ".")
+}
+
+// graphiteNode makes a value safe to use as a single path node
+func graphiteNode(value string) string {
+	return graphiteNodeEscaper.Replace(value)
+}
+
+var graphiteNodeEscaper = strings.NewReplacer(".", "_", " ", "_", "+", "")
+
+// pushGraphite sends the metric set to carbon over TCP every metric interval
+// until ctx is done, reconnecting after write errors
+func pushGraphite(ctx context.Context, wg *sync.WaitGroup, metrics *metricSet) {
+	defer wg.Done()
+	log.Printf("Pushing Graphite metrics to %s", graphiteConfig.Addr)
+
+	ticker := time.NewTicker(metricRate.Interval())
+	defer ticker.Stop()
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping Graphite push...")
+			return
+		case <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			atomic.AddInt64(&metricSendAttempts, 1)
+			if conn == nil {
+				var err error
+				if conn, err = dialer.DialContext(ctx, "tcp", graphiteConfig.Addr); err != nil {
+					atomic.AddInt64(&metricSendErrors, 1)
+					log.Printf("Failed to connect to Graphite: %v", err)
+					continue
+				}
+			}
+
+			data, points, err := metrics.encode(graphiteEncoder{}, time.Now())
+			if err != nil {
+				log.Printf("Failed to encode Graphite metrics: %v", err)
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Write(data); err != nil {
+				atomic.AddInt64(&metricSendErrors, 1)
+				log.Printf("Failed to send Graphite metrics, reconnecting: %v", err)
+				conn.Close()
+				conn = nil
+				continue
+			}
+			atomic.AddInt64(&metricPointsSent, int64(points))
+			atomic.AddInt64(&totalBytesSent, int64(len(data)))
+		}
+	}
+}
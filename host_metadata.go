@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// hostMetadataConfig attaches the host and container a record came from,
+// as a log shipping agent enriching records would
+var hostMetadataConfig = struct {
+	Enabled bool
+	// Hosts is the size of the synthetic fleet every service runs on
+	Hosts int
+}{
+	Enabled: getEnvBool("LOG_HOST_METADATA", false),
+	Hosts:   getEnvInt("LOG_HOSTS", 10),
+}
+
+// logEmitter is the container on a host that wrote a record. Field names
+// follow OpenTelemetry and ECS, which agree on them.
+type logEmitter struct {
+	HostName    string `json:"host.name"`
+	ContainerID string `json:"container.id"`
+	LogFilePath string `json:"log.file.path"`
+	CloudRegion string `json:"cloud.region"`
+}
+
+// logEmitters caches the container of every service on every host
+var logEmitters = struct {
+	sync.Mutex
+	byService map[string][]*logEmitter
+}{byService: make(map[string][]*logEmitter)}
+
+// randomLogEmitter returns the container of service on a random host of
+// the fleet
+func randomLogEmitter(service string) *logEmitter {
+	logEmitters.Lock()
+	defer logEmitters.Unlock()
+	emitters, ok := logEmitters.byService[service]
+	if !ok {
+		for host := 0; host < hostMetadataConfig.Hosts; host++ {
+			emitters = append(emitters, newLogEmitter(host, service))
+		}
+		logEmitters.byService[service] = emitters
+	}
+	return emitters[rand.Intn(len(emitters))]
+}
+
+// newLogEmitter returns the container of service on host. Emitters are
+// derived from the host number and service name, so the fleet is the same
+// on every run.
+func newLogEmitter(host int, service string) *logEmitter {
+	r := rand.New(rand.NewSource(int64(host)))
+	regions := cloudRegions["aws"]
+	region := regions[r.Intn(len(regions))]
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%s", host, service)))
+	id := hex.EncodeToString(sum[:])
+	return &logEmitter{
+		HostName:    fmt.Sprintf("ip-10-0-%d-%d.%s.compute.internal", r.Intn(256), 1+r.Intn(254), region),
+		ContainerID: id,
+		LogFilePath: "/var/lib/docker/containers/" + id + "/" + id + "-json.log",
+		CloudRegion: region,
+	}
+}
+
+// attributes returns the emitter as OTel resource attributes
+func (e *logEmitter) attributes() map[string]string {
+	return map[string]string{
+		"host.name":    e.HostName,
+		"container.id": e.ContainerID,
+		"cloud.region": e.CloudRegion,
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricsFormatInflux = "influx"
+
+// influxEncoder renders series as InfluxDB line protocol with nanosecond
+// timestamps, accepted by both the v1 /write and v2 /api/v2/write APIs.
+// Each series becomes one line; histograms and summaries use the field
+// layout of Telegraf's Prometheus input: count, sum and one field per bucket
+// bound or quantile.
+type influxEncoder struct{}
+
+func (influxEncoder) ContentType() string { return "text/plain; charset=utf-8" }
+
+func (influxEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, s := range series {
+		timestamp := strconv.FormatInt(s.sampleTime(now).UnixNano(), 10)
+		buf.WriteString(influxMeasurementEscaper.Replace(s.def.Name))
+		for _, label := range s.labels {
+			if label.Value == "" {
+				continue
+			}
+			buf.WriteByte(',')
+			buf.WriteString(influxTagEscaper.Replace(label.Name))
+			buf.WriteByte('=')
+			buf.WriteString(influxTagEscaper.Replace(label.Value))
+		}
+
+		var fields []string
+		switch s.def.Kind {
+		case metricCounter:
+			fields = append(fields, influxField("counter", s.value))
+		case metricGauge:
+			fields = append(fields, influxField("gauge", s.value))
+		case metricHistogram:
+			fields = append(fields, influxField("count", float64(s.count)), influxField("sum", s.sum))
+			var cumulative uint64
+			for i, count := range s.bucketCounts {
+				cumulative += count
+				fields = append(fields, influxField(histogramLe(i), float64(cumulative)))
+			}
+		case metricExpHistogram:
+			fields = append(fields, influxField("count", float64(s.count)), influxField("sum", s.sum))
+		case metricSummary:
+			fields = append(fields, influxField("count", float64(s.count)), influxField("sum", s.sum))
+			for i, value := range s.quantiles() {
+				fields = append(fields, influxField(formatPromFloat(metricsConfig.SummaryQuantiles[i]), value))
+			}
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(strings.Join(fields, ","))
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// influxField formats a float field as key=value
+func influxField(key string, value float64) string {
+	return influxTagEscaper.Replace(key) + "=" + strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
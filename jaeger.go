@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Jaeger's native ingestion formats, both written by hand like the other
+// binary encoders:
+//
+//   - jaeger_thrift posts a Thrift binary jaeger.Batch to the collector's
+//     /api/traces (port 14268). A batch holds one process, so a trace is
+//     sent as one request per service.
+//   - jaeger_proto calls CollectorService/PostSpans over gRPC (port 14250)
+//     with the whole trace in one batch and the process set per span.
+
+const jaegerPostSpansMethod = "/jaeger.api_v2.CollectorService/PostSpans"
+
+// jaegerThriftEncoder sends a trace as a Thrift binary jaeger.Batch
+type jaegerThriftEncoder struct{}
+
+func (jaegerThriftEncoder) ContentType() string { return "application/x-thrift" }
+
+// Split puts each service's spans into a trace of their own
+func (jaegerThriftEncoder) Split(trace *Trace) []*Trace {
+	var parts []*Trace
+	byService := make(map[string]*Trace)
+	for _, span := range trace.Spans {
+		part, ok := byService[span.ServiceName]
+		if !ok {
+			part = &Trace{}
+			byService[span.ServiceName] = part
+			parts = append(parts, part)
+		}
+		part.Spans = append(part.Spans, span)
+	}
+	return parts
+}
+
+func (jaegerThriftEncoder) Encode(trace *Trace) ([]byte, error) {
+	if len(trace.Spans) == 0 {
+		return nil, fmt.Errorf("empty trace")
+	}
+	var w thriftWriter
+	// Batch.process
+	w.fieldHeader(thriftStruct, 1)
+	w.fieldHeader(thriftString, 1)
+	w.string(trace.Spans[0].ServiceName)
+	if tags := jaegerProcessTags(trace.Spans[0]); len(tags) > 0 {
+		w.fieldHeader(thriftList, 2)
+		w.listHeader(thriftStruct, len(tags))
+		for _, tag := range tags {
+			w.stringTag(tag.Key, *tag.Value.StringValue)
+		}
+	}
+	w.stop()
+	// Batch.spans
+	w.fieldHeader(thriftList, 2)
+	w.listHeader(thriftStruct, len(trace.Spans))
+	for _, span := range trace.Spans {
+		traceHigh, traceLow, err := jaegerTraceID(span.TraceID)
+		if err != nil {
+			return nil, err
+		}
+		spanID, err := jaegerSpanID(span.SpanID)
+		if err != nil {
+			return nil, err
+		}
+		parentID, err := jaegerSpanID(span.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		w.fieldHeader(thriftI64, 1)
+		w.i64(traceLow)
+		w.fieldHeader(thriftI64, 2)
+		w.i64(traceHigh)
+		w.fieldHeader(thriftI64, 3)
+		w.i64(spanID)
+		w.fieldHeader(thriftI64, 4)
+		w.i64(parentID)
+		w.fieldHeader(thriftString, 5)
+		w.string(span.Name)
+		if len(span.Links) > 0 {
+			// Links become FOLLOWS_FROM references
+			w.fieldHeader(thriftList, 6)
+			w.listHeader(thriftStruct, len(span.Links))
+			for _, link := range span.Links {
+				linkHigh, linkLow, err := jaegerTraceID(link.TraceID)
+				if err != nil {
+					return nil, err
+				}
+				linkSpan, err := jaegerSpanID(link.SpanID)
+				if err != nil {
+					return nil, err
+				}
+				w.fieldHeader(thriftI32, 1)
+				w.i32(1)
+				w.fieldHeader(thriftI64, 2)
+				w.i64(linkLow)
+				w.fieldHeader(thriftI64, 3)
+				w.i64(linkHigh)
+				w.fieldHeader(thriftI64, 4)
+				w.i64(linkSpan)
+				w.stop()
+			}
+		}
+		w.fieldHeader(thriftI32, 7)
+		w.i32(jaegerFlags(span))
+		w.fieldHeader(thriftI64, 8)
+		w.i64(uint64(span.StartTime / 1000))
+		w.fieldHeader(thriftI64, 9)
+		w.i64(uint64(max(span.EndTime/1000-span.StartTime/1000, 1)))
+		tags := jaegerTags(span)
+		w.fieldHeader(thriftList, 10)
+		if span.Error {
+			w.listHeader(thriftStruct, len(tags)+2)
+			w.boolTag("error", true)
+			w.stringTag("otel.status_description", span.StatusMessage)
+		} else {
+			w.listHeader(thriftStruct, len(tags))
+		}
+		for _, key := range tags {
+			w.stringTag(key, span.Attributes[key])
+		}
+		if len(span.Events) > 0 {
+			w.fieldHeader(thriftList, 11)
+			w.listHeader(thriftStruct, len(span.Events))
+			for _, event := range span.Events {
+				w.fieldHeader(thriftI64, 1)
+				w.i64(uint64(event.Time / 1000))
+				keys := slices.Sorted(maps.Keys(event.Attributes))
+				w.fieldHeader(thriftList, 2)
+				w.listHeader(thriftStruct, len(keys)+1)
+				w.stringTag("event", event.Name)
+				for _, key := range keys {
+					w.stringTag(key, event.Attributes[key])
+				}
+				w.stop()
+			}
+		}
+		w.stop()
+	}
+	w.stop()
+	return w.buf, nil
+}
+
+// jaegerProtoEncoder sends a trace as an api_v2 PostSpansRequest
+type jaegerProtoEncoder struct{}
+
+func (jaegerProtoEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (jaegerProtoEncoder) Encode(trace *Trace) ([]byte, error) {
+	var batch []byte
+	for _, span := range trace.Spans {
+		var m []byte
+		var err error
+		if m, err = appendOTLPID(m, 1, span.TraceID); err != nil {
+			return nil, err
+		}
+		if m, err = appendOTLPID(m, 2, span.SpanID); err != nil {
+			return nil, err
+		}
+		m = appendOTLPString(m, 3, span.Name)
+		if span.ParentID != "" {
+			var ref []byte
+			if ref, err = appendOTLPID(ref, 1, span.TraceID); err != nil {
+				return nil, err
+			}
+			if ref, err = appendOTLPID(ref, 2, span.ParentID); err != nil {
+				return nil, err
+			}
+			// ref_type CHILD_OF is the zero value
+			m = appendOTLPMessage(m, 4, ref)
+		}
+		for _, link := range span.Links {
+			var ref []byte
+			if ref, err = appendOTLPID(ref, 1, link.TraceID); err != nil {
+				return nil, err
+			}
+			if ref, err = appendOTLPID(ref, 2, link.SpanID); err != nil {
+				return nil, err
+			}
+			ref = protowire.AppendTag(ref, 3, protowire.VarintType) // FOLLOWS_FROM
+			ref = protowire.AppendVarint(ref, 1)
+			m = appendOTLPMessage(m, 4, ref)
+		}
+		m = protowire.AppendTag(m, 5, protowire.VarintType)
+		m = protowire.AppendVarint(m, uint64(jaegerFlags(span)))
+		m = appendOTLPMessage(m, 6, appendProtoTimestamp(nil, span.StartTime))
+		m = appendOTLPMessage(m, 7, appendProtoTimestamp(nil, span.EndTime-span.StartTime))
+		if span.Error {
+			var kv []byte
+			kv = appendOTLPString(kv, 1, "error")
+			kv = protowire.AppendTag(kv, 2, protowire.VarintType) // v_type BOOL
+			kv = protowire.AppendVarint(kv, 1)
+			kv = protowire.AppendTag(kv, 4, protowire.VarintType)
+			kv = protowire.AppendVarint(kv, 1)
+			m = appendOTLPMessage(m, 8, kv)
+			m = appendJaegerStringTag(m, 8, "otel.status_description", span.StatusMessage)
+		}
+		for _, key := range jaegerTags(span) {
+			m = appendJaegerStringTag(m, 8, key, span.Attributes[key])
+		}
+		for _, event := range span.Events {
+			entry := appendOTLPMessage(nil, 1, appendProtoTimestamp(nil, event.Time))
+			entry = appendJaegerStringTag(entry, 2, "event", event.Name)
+			for _, key := range slices.Sorted(maps.Keys(event.Attributes)) {
+				entry = appendJaegerStringTag(entry, 2, key, event.Attributes[key])
+			}
+			m = appendOTLPMessage(m, 9, entry)
+		}
+		process := appendOTLPString(nil, 1, span.ServiceName)
+		for _, tag := range jaegerProcessTags(span) {
+			process = appendJaegerStringTag(process, 2, tag.Key, *tag.Value.StringValue)
+		}
+		m = appendOTLPMessage(m, 10, process)
+		batch = appendOTLPMessage(batch, 1, m)
+	}
+	// Spans carry their own process; the batch process only names the sender
+	batch = appendOTLPMessage(batch, 2, appendOTLPString(nil, 1, "load-gen"))
+	return appendOTLPMessage(nil, 1, batch), nil
+}
+
+// appendProtoTimestamp encodes nanoseconds as a google.protobuf.Timestamp
+// or Duration, which share their layout
+func appendProtoTimestamp(b []byte, nanos int64) []byte {
+	if seconds := nanos / 1e9; seconds != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(seconds))
+	}
+	if rest := nanos % 1e9; rest != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(rest))
+	}
+	return b
+}
+
+// appendJaegerStringTag appends a string KeyValue field
+func appendJaegerStringTag(b []byte, num protowire.Number, key, value string) []byte {
+	var kv []byte
+	kv = appendOTLPString(kv, 1, key)
+	kv = appendOTLPString(kv, 3, value)
+	return appendOTLPMessage(b, num, kv)
+}
+
+// jaegerProcessTags returns the resource attributes of the span's service
+// other than its name
+func jaegerProcessTags(span Span) []otlpKeyValue {
+	attrs := resourceAttributes(span.ServiceName, resourceInstance(span.TraceID), nil)
+	return slices.DeleteFunc(attrs, func(kv otlpKeyValue) bool { return kv.Key == "service.name" })
+}
+
+// jaegerFlags returns the span's Jaeger flags; bit 1 is sampled
+func jaegerFlags(span Span) int32 {
+	if span.Sampled {
+		return 1
+	}
+	return 0
+}
+
+// jaegerTags returns the span's tag keys in order. span.kind stays a tag,
+// as Jaeger clients report it; service.name belongs to the process.
+func jaegerTags(span Span) []string {
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		if key != "service.name" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jaegerTraceID splits a 32-hex trace id into its high and low halves
+func jaegerTraceID(id string) (high, low uint64, err error) {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != 16 {
+		return 0, 0, fmt.Errorf("invalid trace id %q", id)
+	}
+	return binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:]), nil
+}
+
+// jaegerSpanID parses a hex span id into the int64 Thrift uses; empty ids are 0
+func jaegerSpanID(id string) (uint64, error) {
+	if id == "" {
+		return 0, nil
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 8 {
+		return 0, fmt.Errorf("invalid span id %q", id)
+	}
+	return binary.BigEndian.Uint64(raw), nil
+}
+
+// Thrift binary protocol type ids
+const (
+	thriftBool   = 2
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftList   = 15
+)
+
+// thriftWriter appends values in the Thrift binary protocol
+type thriftWriter struct {
+	buf []byte
+}
+
+func (w *thriftWriter) fieldHeader(typ byte, id int16) {
+	w.buf = append(w.buf, typ)
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(id))
+}
+
+func (w *thriftWriter) listHeader(elem byte, size int) {
+	w.buf = append(w.buf, elem)
+	w.i32(int32(min(size, math.MaxInt32)))
+}
+
+// stringTag writes a Tag struct with a string value
+func (w *thriftWriter) stringTag(key, value string) {
+	w.fieldHeader(thriftString, 1)
+	w.string(key)
+	w.fieldHeader(thriftI32, 2) // vType STRING
+	w.i32(0)
+	w.fieldHeader(thriftString, 3)
+	w.string(value)
+	w.stop()
+}
+
+// boolTag writes a Tag struct with a bool value
+func (w *thriftWriter) boolTag(key string, value bool) {
+	w.fieldHeader(thriftString, 1)
+	w.string(key)
+	w.fieldHeader(thriftI32, 2) // vType BOOL
+	w.i32(2)
+	w.fieldHeader(thriftBool, 4)
+	if value {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+	w.stop()
+}
+
+func (w *thriftWriter) stop() { w.buf = append(w.buf, 0) }
+
+func (w *thriftWriter) i32(v int32) { w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v)) }
+
+func (w *thriftWriter) i64(v uint64) { w.buf = binary.BigEndian.AppendUint64(w.buf, v) }
+
+func (w *thriftWriter) string(s string) {
+	w.i32(int32(len(s)))
+	w.buf = append(w.buf, s...)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// LOG_CONTENT value for Kubernetes API server audit events
+const logContentK8sAudit = "k8s_audit"
+
+type k8sAuditUser struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid,omitempty"`
+	Groups   []string `json:"groups"`
+}
+
+type k8sAuditObjectRef struct {
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+	APIGroup    string `json:"apiGroup,omitempty"`
+	APIVersion  string `json:"apiVersion"`
+}
+
+type k8sAuditStatus struct {
+	Metadata struct{} `json:"metadata"`
+	Status   string   `json:"status,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Code     int      `json:"code"`
+}
+
+// k8sAuditEvent mirrors an audit.k8s.io/v1 Event
+type k8sAuditEvent struct {
+	Kind                     string             `json:"kind"`
+	APIVersion               string             `json:"apiVersion"`
+	Level                    string             `json:"level"`
+	AuditID                  string             `json:"auditID"`
+	Stage                    string             `json:"stage"`
+	RequestURI               string             `json:"requestURI"`
+	Verb                     string             `json:"verb"`
+	User                     k8sAuditUser       `json:"user"`
+	SourceIPs                []string           `json:"sourceIPs"`
+	UserAgent                string             `json:"userAgent"`
+	ObjectRef                *k8sAuditObjectRef `json:"objectRef,omitempty"`
+	ResponseStatus           *k8sAuditStatus    `json:"responseStatus,omitempty"`
+	RequestReceivedTimestamp string             `json:"requestReceivedTimestamp"`
+	StageTimestamp           string             `json:"stageTimestamp"`
+	Annotations              map[string]string  `json:"annotations,omitempty"`
+}
+
+// k8sAuditResource is an API resource and the verbs clients use on it
+type k8sAuditResource struct {
+	Resource, Subresource, APIGroup, APIVersion string
+	Namespaced                                  bool
+	Verbs                                       []weightedName
+}
+
+var k8sAuditResources = []struct {
+	k8sAuditResource
+	Weight float64
+}{
+	{k8sAuditResource{"leases", "", "coordination.k8s.io", "v1", true, []weightedName{{"get", 1}, {"update", 1}}}, 30},
+	{k8sAuditResource{"pods", "", "", "v1", true, []weightedName{{"get", 4}, {"list", 3}, {"watch", 2}, {"create", 1}, {"delete", 1}, {"patch", 1}}}, 20},
+	{k8sAuditResource{"configmaps", "", "", "v1", true, []weightedName{{"get", 5}, {"list", 2}, {"watch", 2}, {"update", 1}}}, 10},
+	{k8sAuditResource{"secrets", "", "", "v1", true, []weightedName{{"get", 6}, {"list", 2}, {"watch", 1}, {"create", 1}}}, 8},
+	{k8sAuditResource{"deployments", "", "apps", "v1", true, []weightedName{{"get", 4}, {"list", 2}, {"watch", 2}, {"patch", 1}, {"update", 1}}}, 8},
+	{k8sAuditResource{"services", "", "", "v1", true, []weightedName{{"get", 3}, {"list", 2}, {"watch", 2}}}, 6},
+	{k8sAuditResource{"nodes", "", "", "v1", false, []weightedName{{"get", 3}, {"list", 1}, {"watch", 1}, {"patch", 2}}}, 6},
+	{k8sAuditResource{"events", "", "", "v1", true, []weightedName{{"create", 4}, {"patch", 2}}}, 5},
+	{k8sAuditResource{"serviceaccounts", "token", "", "v1", true, []weightedName{{"create", 1}}}, 3},
+	{k8sAuditResource{"pods", "exec", "", "v1", true, []weightedName{{"create", 1}}}, 1},
+	{k8sAuditResource{"clusterrolebindings", "", "rbac.authorization.k8s.io", "v1", false, []weightedName{{"get", 2}, {"list", 1}, {"create", 1}, {"delete", 1}}}, 1},
+}
+
+// k8sAuditUsers are the clients of the API server, most of them controllers
+var k8sAuditUsers = []weightedName{
+	{"system:kube-controller-manager", 25},
+	{"system:kube-scheduler", 10},
+	{"system:node", 25},
+	{"system:serviceaccount", 25},
+	{"human", 10},
+	{"system:anonymous", 5},
+}
+
+// k8sAuditPending holds requests whose RequestReceived stage was logged,
+// waiting for their completion to be logged
+var k8sAuditPending struct {
+	sync.Mutex
+	events []*k8sAuditEvent
+}
+
+// generateK8sAudit fills record with an audit event as the API server's
+// JSON log backend writes it: a request's RequestReceived stage and,
+// usually a little later, its ResponseComplete (or ResponseStarted for
+// watches). Denied and failed requests are logged as warnings.
+func generateK8sAudit(record *LogRecord) {
+	record.Job = "kube-apiserver"
+	event := nextK8sAuditEvent(record.Time)
+	record.Level = "info"
+	if event.ResponseStatus != nil && event.ResponseStatus.Code >= 400 {
+		record.Level = "warn"
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		record.Log = fmt.Sprintf("failed to marshal audit event: %v", err)
+		return
+	}
+	record.Log = string(data)
+}
+
+// nextK8sAuditEvent completes a pending request or receives a new one
+func nextK8sAuditEvent(now time.Time) k8sAuditEvent {
+	k8sAuditPending.Lock()
+	defer k8sAuditPending.Unlock()
+	if n := len(k8sAuditPending.events); n > 0 && (rand.Intn(2) == 0 || n >= 100) {
+		i := rand.Intn(n)
+		event := *k8sAuditPending.events[i]
+		k8sAuditPending.events = append(k8sAuditPending.events[:i], k8sAuditPending.events[i+1:]...)
+		completeK8sAuditEvent(&event, now)
+		return event
+	}
+
+	event := newK8sAuditEvent(now)
+	k8sAuditPending.events = append(k8sAuditPending.events, &event)
+	return event
+}
+
+// newK8sAuditEvent returns the RequestReceived stage of a new request
+func newK8sAuditEvent(now time.Time) k8sAuditEvent {
+	resource := pickK8sAuditResource()
+	verb := pickWeighted(resource.Verbs)
+
+	ref := &k8sAuditObjectRef{
+		Resource:    resource.Resource,
+		Subresource: resource.Subresource,
+		APIGroup:    resource.APIGroup,
+		APIVersion:  resource.APIVersion,
+	}
+	if resource.Namespaced {
+		ref.Namespace = k8sAuditNamespace()
+	}
+	if verb != "list" && verb != "watch" {
+		ref.Name = k8sAuditObjectName(resource.Resource, ref.Namespace)
+	}
+
+	path := "/api/" + resource.APIVersion
+	if resource.APIGroup != "" {
+		path = "/apis/" + resource.APIGroup + "/" + resource.APIVersion
+	}
+	if ref.Namespace != "" {
+		path += "/namespaces/" + ref.Namespace
+	}
+	path += "/" + resource.Resource
+	if ref.Name != "" {
+		path += "/" + ref.Name
+	}
+	if resource.Subresource != "" {
+		path += "/" + resource.Subresource
+	}
+	switch verb {
+	case "watch":
+		path += fmt.Sprintf("?allowWatchBookmarks=true&resourceVersion=%d&watch=true", 1000000+rand.Intn(9000000))
+	case "list":
+		path += "?limit=500"
+	}
+
+	user, sourceIP, userAgent := k8sAuditClient()
+	stamp := now.UTC().Format("2006-01-02T15:04:05.000000Z")
+	level := "Metadata"
+	if resource.Resource != "secrets" && (verb == "create" || verb == "update" || verb == "patch") {
+		level = "RequestResponse"
+	}
+	return k8sAuditEvent{
+		Kind:                     "Event",
+		APIVersion:               "audit.k8s.io/v1",
+		Level:                    level,
+		AuditID:                  gofakeit.UUID(),
+		Stage:                    "RequestReceived",
+		RequestURI:               path,
+		Verb:                     verb,
+		User:                     user,
+		SourceIPs:                []string{sourceIP},
+		UserAgent:                userAgent,
+		ObjectRef:                ref,
+		RequestReceivedTimestamp: stamp,
+		StageTimestamp:           stamp,
+	}
+}
+
+// completeK8sAuditEvent turns a received request into its final stage with
+// the response and authorization decision
+func completeK8sAuditEvent(event *k8sAuditEvent, now time.Time) {
+	// Batches share a timestamp, so the time the request took is added
+	took := time.Duration(1+rand.Intn(50)) * time.Millisecond
+	event.StageTimestamp = now.Add(took).UTC().Format("2006-01-02T15:04:05.000000Z")
+	code := 200
+	switch {
+	case event.User.Username == "system:anonymous":
+		code = 403
+	case event.Verb == "create":
+		code = 201
+	case event.Verb == "get" && rand.Intn(20) == 0:
+		code = 404
+	case (event.Verb == "update" || event.Verb == "patch") && rand.Intn(20) == 0:
+		code = 409
+	case rand.Intn(200) == 0:
+		code = 500
+	}
+	if event.Verb == "watch" && code == 200 {
+		event.Stage = "ResponseStarted"
+	} else {
+		event.Stage = "ResponseComplete"
+	}
+	event.ResponseStatus = &k8sAuditStatus{Code: code}
+	decision := "allow"
+	if code == 403 {
+		decision = "forbid"
+		event.ResponseStatus.Status = "Failure"
+		event.ResponseStatus.Reason = "Forbidden"
+	}
+	event.Annotations = map[string]string{
+		"authorization.k8s.io/decision": decision,
+		"authorization.k8s.io/reason":   k8sAuditReason(event.User.Username, decision),
+	}
+}
+
+// pickK8sAuditResource returns a resource chosen proportionally to its weight
+func pickK8sAuditResource() k8sAuditResource {
+	total := 0.0
+	for _, r := range k8sAuditResources {
+		total += r.Weight
+	}
+	x := rand.Float64() * total
+	for _, r := range k8sAuditResources {
+		if x -= r.Weight; x < 0 {
+			return r.k8sAuditResource
+		}
+	}
+	return k8sAuditResources[len(k8sAuditResources)-1].k8sAuditResource
+}
+
+// k8sAuditClient returns the user, source address and user agent of a request
+func k8sAuditClient() (k8sAuditUser, string, string) {
+	node := fmt.Sprintf("node-%02d", rand.Intn(k8sLogsConfig.Nodes))
+	switch kind := pickWeighted(k8sAuditUsers); kind {
+	case "system:node":
+		return k8sAuditUser{Username: "system:node:" + node, Groups: []string{"system:nodes", "system:authenticated"}},
+			fmt.Sprintf("10.0.0.%d", 10+rand.Intn(k8sLogsConfig.Nodes)), "kubelet/v1.30.4 (linux/amd64) kubernetes/0ea6c39"
+	case "system:serviceaccount":
+		namespace := k8sAuditNamespace()
+		service := randomJob()
+		return k8sAuditUser{
+				Username: "system:serviceaccount:" + namespace + ":" + service,
+				UID:      gofakeit.UUID(),
+				Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated"},
+			},
+			fmt.Sprintf("10.244.%d.%d", rand.Intn(k8sLogsConfig.Nodes), 2+rand.Intn(250)), "Go-http-client/2.0"
+	case "human":
+		return k8sAuditUser{
+				Username: strings.ToLower(gofakeit.FirstName()) + "@example.com",
+				Groups:   []string{"developers", "system:authenticated"},
+			},
+			gofakeit.IPv4Address(), "kubectl/v1.30.2 (darwin/arm64) kubernetes/3968350"
+	case "system:anonymous":
+		return k8sAuditUser{Username: "system:anonymous", Groups: []string{"system:unauthenticated"}},
+			gofakeit.IPv4Address(), gofakeit.UserAgent()
+	default:
+		component := strings.TrimPrefix(kind, "system:")
+		return k8sAuditUser{Username: kind, Groups: []string{"system:authenticated"}},
+			"10.0.0.2", component + "/v1.30.4 (linux/amd64) kubernetes/0ea6c39/leader-election"
+	}
+}
+
+// k8sAuditReason is the RBAC explanation of an authorization decision
+func k8sAuditReason(username, decision string) string {
+	if decision == "forbid" {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(username, "system:node:"):
+		return "allowed by Node authorizer"
+	case strings.HasPrefix(username, "system:serviceaccount:"):
+		return `RBAC: allowed by RoleBinding "app-reader" of Role "app-reader" to ServiceAccount`
+	case strings.HasPrefix(username, "system:"):
+		return fmt.Sprintf(`RBAC: allowed by ClusterRoleBinding "%s" of ClusterRole "%s" to User "%s"`, username, username, username)
+	default:
+		return `RBAC: allowed by ClusterRoleBinding "developers" of ClusterRole "edit" to Group "developers"`
+	}
+}
+
+// k8sAuditNamespace picks a namespace of the simulated cluster
+func k8sAuditNamespace() string {
+	if rand.Intn(4) == 0 {
+		return "kube-system"
+	}
+	return k8sLogsConfig.Namespaces[rand.Intn(len(k8sLogsConfig.Namespaces))]
+}
+
+// k8sAuditObjectName returns the name of an object of resource
+func k8sAuditObjectName(resource, namespace string) string {
+	service := randomJob()
+	switch resource {
+	case "nodes":
+		return fmt.Sprintf("node-%02d", rand.Intn(k8sLogsConfig.Nodes))
+	case "leases":
+		if namespace == "kube-system" {
+			return []string{"kube-controller-manager", "kube-scheduler"}[rand.Intn(2)]
+		}
+		return service + "-leader"
+	case "pods":
+		if pod := randomK8sPod(service); pod.NamespaceName == namespace {
+			return pod.PodName
+		}
+		return fmt.Sprintf("%s-%s", service, strings.ToLower(gofakeit.LetterN(5)))
+	case "secrets":
+		return service + "-credentials"
+	case "clusterrolebindings":
+		return service + "-binding"
+	default:
+		return service
+	}
+}
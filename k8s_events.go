@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// Supported values for K8S_EVENTS_FORMAT
+const (
+	k8sEventsOTLP = "otlp"
+	k8sEventsAPI  = "k8s"
+)
+
+var (
+	k8sEventsSent         int64
+	k8sEventsSendAttempts int64
+	k8sEventsSendErrors   int64
+
+	k8sEventsConfig = loadK8sEventsConfig()
+	k8sEventsRate   = newRateController(k8sEventsConfig.Rate)
+)
+
+type K8sEventsConfig struct {
+	// Endpoint receives events and may contain a {namespace} placeholder;
+	// empty disables events
+	Endpoint string
+	// Format is otlp (OTLP/JSON logs) or k8s (core/v1 Event objects)
+	Format     string
+	Rate       float64
+	Namespaces []string
+}
+
+func loadK8sEventsConfig() K8sEventsConfig {
+	cfg := K8sEventsConfig{
+		Endpoint: os.Getenv("K8S_EVENTS_ENDPOINT"),
+		Format:   getEnvOrDefault("K8S_EVENTS_FORMAT", k8sEventsOTLP),
+		Rate:     getEnvFloat("K8S_EVENTS_RATE", 1),
+	}
+	for _, ns := range strings.Split(getEnvOrDefault("K8S_EVENTS_NAMESPACES", "default,kube-system,payments"), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			cfg.Namespaces = append(cfg.Namespaces, ns)
+		}
+	}
+	return cfg
+}
+
+// k8sObjectReference is the involvedObject of an Event
+type k8sObjectReference struct {
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	APIVersion string `json:"apiVersion"`
+	FieldPath  string `json:"fieldPath,omitempty"`
+}
+
+type k8sEventSource struct {
+	Component string `json:"component"`
+	Host      string `json:"host,omitempty"`
+}
+
+type k8sObjectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	UID       string `json:"uid"`
+}
+
+// k8sEvent mirrors the fields of a core/v1 Event that pipelines look at
+type k8sEvent struct {
+	APIVersion         string             `json:"apiVersion"`
+	Kind               string             `json:"kind"`
+	Metadata           k8sObjectMeta      `json:"metadata"`
+	InvolvedObject     k8sObjectReference `json:"involvedObject"`
+	Reason             string             `json:"reason"`
+	Message            string             `json:"message"`
+	Source             k8sEventSource     `json:"source"`
+	FirstTimestamp     string             `json:"firstTimestamp"`
+	LastTimestamp      string             `json:"lastTimestamp"`
+	Count              int                `json:"count"`
+	Type               string             `json:"type"`
+	ReportingComponent string             `json:"reportingComponent"`
+	ReportingInstance  string             `json:"reportingInstance"`
+}
+
+// k8sEventTemplate describes one kind of event; message may use %[1]s for
+// the namespace, %[2]s for the object name, %[3]s for the node and %[4]s for
+// the application
+type k8sEventTemplate struct {
+	Kind, Type, Reason, Component, Message string
+}
+
+var k8sEventTemplates = []k8sEventTemplate{
+	{"Pod", "Normal", "Scheduled", "default-scheduler", "Successfully assigned %[1]s/%[2]s to %[3]s"},
+	{"Pod", "Normal", "Pulling", "kubelet", `Pulling image "registry.local/%[4]s:latest"`},
+	{"Pod", "Normal", "Pulled", "kubelet", `Successfully pulled image "registry.local/%[4]s:latest" in 1.2s`},
+	{"Pod", "Normal", "Created", "kubelet", "Created container app"},
+	{"Pod", "Normal", "Started", "kubelet", "Started container app"},
+	{"Pod", "Normal", "Killing", "kubelet", "Stopping container app"},
+	{"Pod", "Warning", "BackOff", "kubelet", "Back-off restarting failed container app in pod %[2]s_%[1]s"},
+	{"Pod", "Warning", "Unhealthy", "kubelet", "Readiness probe failed: HTTP probe failed with statuscode: 503"},
+	{"Pod", "Warning", "FailedScheduling", "default-scheduler", "0/5 nodes are available: 5 Insufficient memory."},
+	{"Deployment", "Normal", "ScalingReplicaSet", "deployment-controller", "Scaled up replica set %[2]s to 3"},
+	{"ReplicaSet", "Normal", "SuccessfulCreate", "replicaset-controller", "Created pod: %[2]s"},
+	{"Node", "Warning", "NodeNotReady", "node-controller", "Node %[3]s status is now: NodeNotReady"},
+	{"Node", "Warning", "OOMKilling", "kernel-monitor", "Memory cgroup out of memory: Killed process 4242 (app)"},
+}
+
+// recentK8sEvents are re-emitted with a higher count, like the event
+// recorder does for repeating events
+var recentK8sEvents []*k8sEvent
+
+// nextK8sEvent returns either a repeat of a recent event or a new one, and
+// whether it is a repeat
+func nextK8sEvent(now time.Time) (*k8sEvent, bool) {
+	stamp := now.UTC().Format(time.RFC3339)
+	if len(recentK8sEvents) > 0 && rand.Float64() < 0.3 {
+		e := recentK8sEvents[rand.Intn(len(recentK8sEvents))]
+		e.Count++
+		e.LastTimestamp = stamp
+		return e, true
+	}
+
+	t := k8sEventTemplates[rand.Intn(len(k8sEventTemplates))]
+	namespace := k8sEventsConfig.Namespaces[rand.Intn(len(k8sEventsConfig.Namespaces))]
+	node := fmt.Sprintf("node-%d", 1+rand.Intn(5))
+	app := randomJob()
+	name := app
+	apiVersion := "v1"
+	switch t.Kind {
+	case "Pod":
+		name = fmt.Sprintf("%s-%s-%s", name, strings.ToLower(gofakeit.LetterN(10)), strings.ToLower(gofakeit.LetterN(5)))
+	case "ReplicaSet":
+		name = fmt.Sprintf("%s-%s", name, strings.ToLower(gofakeit.LetterN(10)))
+		apiVersion = "apps/v1"
+	case "Deployment":
+		apiVersion = "apps/v1"
+	case "Node":
+		name, namespace = node, "default"
+	}
+
+	e := &k8sEvent{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata: k8sObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", name, now.UnixNano()),
+			Namespace: namespace,
+			UID:       gofakeit.UUID(),
+		},
+		InvolvedObject: k8sObjectReference{
+			Kind: t.Kind, Namespace: namespace, Name: name, UID: gofakeit.UUID(), APIVersion: apiVersion,
+		},
+		Reason:             t.Reason,
+		Message:            fmt.Sprintf(t.Message, namespace, name, node, app),
+		Source:             k8sEventSource{Component: t.Component, Host: node},
+		FirstTimestamp:     stamp,
+		LastTimestamp:      stamp,
+		Count:              1,
+		Type:               t.Type,
+		ReportingComponent: t.Component,
+		ReportingInstance:  node,
+	}
+	if t.Kind == "Pod" && t.Component == "kubelet" {
+		e.InvolvedObject.FieldPath = "spec.containers{app}"
+	}
+	if t.Type == "Warning" {
+		if len(recentK8sEvents) >= 50 {
+			recentK8sEvents = recentK8sEvents[1:]
+		}
+		recentK8sEvents = append(recentK8sEvents, e)
+	}
+	return e, false
+}
+
+// encodeK8sEvent renders an event as a core/v1 Event or as an OTLP log
+// record laid out like the OpenTelemetry k8s events receiver
+func encodeK8sEvent(e *k8sEvent, now time.Time) ([]byte, error) {
+	if k8sEventsConfig.Format == k8sEventsAPI {
+		return json.Marshal(e)
+	}
+
+	severity, severityText := severityNumbers["info"], "INFO"
+	if e.Type == "Warning" {
+		severity, severityText = severityNumbers["warn"], "WARN"
+	}
+	nanos := otlpUnixNano(now.UnixNano())
+	body := e.Message
+	record := otlpLogRecord{
+		TimeUnixNano:         nanos,
+		ObservedTimeUnixNano: nanos,
+		SeverityNumber:       severity,
+		SeverityText:         severityText,
+		Body:                 otlpAnyValue{StringValue: &body},
+		Attributes: []otlpKeyValue{
+			otlpString("k8s.event.reason", e.Reason),
+			otlpString("k8s.event.action", ""),
+			otlpString("k8s.event.start_time", e.FirstTimestamp),
+			otlpString("k8s.event.name", e.Metadata.Name),
+			otlpString("k8s.event.uid", e.Metadata.UID),
+			otlpString("k8s.namespace.name", e.Metadata.Namespace),
+			otlpInt("k8s.event.count", int64(e.Count)),
+		},
+	}
+	request := otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			otlpString("k8s.node.name", e.Source.Host),
+			otlpString("k8s.object.kind", e.InvolvedObject.Kind),
+			otlpString("k8s.object.name", e.InvolvedObject.Name),
+			otlpString("k8s.object.uid", e.InvolvedObject.UID),
+			otlpString("k8s.object.fieldpath", e.InvolvedObject.FieldPath),
+			otlpString("k8s.object.api_version", e.InvolvedObject.APIVersion),
+		}},
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: otlpScopeName}, LogRecords: []otlpLogRecord{record}}},
+	}}}
+	return json.Marshal(request)
+}
+
+// sendK8sEvent sends one event. With the Kubernetes API a repeated event
+// replaces the existing object, as the event recorder does.
+func sendK8sEvent(ctx context.Context, client *http.Client, now time.Time) error {
+	e, repeat := nextK8sEvent(now)
+	payload, err := encodeK8sEvent(e, now)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	method := http.MethodPost
+	endpoint := expandEndpoint(k8sEventsConfig.Endpoint, map[string]string{"namespace": e.Metadata.Namespace})
+	if repeat && k8sEventsConfig.Format == k8sEventsAPI {
+		method = http.MethodPut
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/" + e.Metadata.Name
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.apply(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+	}
+	atomic.AddInt64(&k8sEventsSent, 1)
+	atomic.AddInt64(&totalBytesSent, int64(len(payload)))
+	return nil
+}
+
+// generateK8sEvents sends events at K8S_EVENTS_RATE until ctx is done
+func generateK8sEvents(ctx context.Context, wg *sync.WaitGroup, client *http.Client) {
+	defer wg.Done()
+	log.Printf("Starting Kubernetes event generation (%s) at %.2f events/sec", k8sEventsConfig.Format, k8sEventsConfig.Rate)
+
+	interval := k8sEventsRate.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping Kubernetes event generation...")
+			return
+		case now := <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			atomic.AddInt64(&k8sEventsSendAttempts, 1)
+			if err := sendK8sEvent(ctx, client, now); err != nil {
+				if errors.Is(err, context.Canceled) {
+					log.Println("Stopping Kubernetes event generation...")
+					return
+				}
+				atomic.AddInt64(&k8sEventsSendErrors, 1)
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					k8sEventsRate.OnThrottle()
+					log.Printf("Events endpoint throttled, reducing rate to %.2f events/sec and pausing %v",
+						k8sEventsRate.Rate(), throttled.RetryAfter)
+					select {
+					case <-ctx.Done():
+						log.Println("Stopping Kubernetes event generation...")
+						return
+					case <-time.After(throttled.RetryAfter):
+					}
+				} else {
+					log.Printf("Failed to send Kubernetes event: %v", err)
+				}
+			} else {
+				k8sEventsRate.OnSuccess()
+			}
+
+			if next := k8sEventsRate.Interval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// criMaxLineBytes is the size at which the kubelet splits a container log
+// line into partial (P) lines
+const criMaxLineBytes = 16 * 1024
+
+var k8sLogsConfig = loadK8sLogsConfig()
+
+type K8sLogsConfig struct {
+	// Enabled writes messages as CRI container log lines and attaches the
+	// metadata of the pod that wrote them
+	Enabled    bool
+	Namespaces []string
+	// Nodes and PodsPerService size the synthetic cluster
+	Nodes          int
+	PodsPerService int
+}
+
+func loadK8sLogsConfig() K8sLogsConfig {
+	cfg := K8sLogsConfig{
+		Enabled:        getEnvBool("LOG_K8S_METADATA", false),
+		Nodes:          getEnvInt("K8S_NODES", 5),
+		PodsPerService: getEnvInt("K8S_PODS_PER_SERVICE", 3),
+	}
+	for _, ns := range strings.Split(getEnvOrDefault("K8S_NAMESPACES", "shop,payments,platform"), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			cfg.Namespaces = append(cfg.Namespaces, ns)
+		}
+	}
+	return cfg
+}
+
+// k8sMetadata is the pod a record was logged by, in the field names of
+// the Fluent Bit kubernetes filter
+type k8sMetadata struct {
+	PodName       string            `json:"pod_name"`
+	NamespaceName string            `json:"namespace_name"`
+	PodID         string            `json:"pod_id"`
+	ContainerName string            `json:"container_name"`
+	Host          string            `json:"host"`
+	Labels        map[string]string `json:"labels"`
+}
+
+// k8sPod returns pod n of the deployment running service. Pods are derived
+// from the service name, so the inventory is the same on every run.
+func k8sPod(service string, n int) *k8sMetadata {
+	h := fnv.New64a()
+	h.Write([]byte(service))
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	namespace := k8sLogsConfig.Namespaces[r.Intn(len(k8sLogsConfig.Namespaces))]
+	hash := fmt.Sprintf("%08x", r.Uint32())[:8]
+	teams := []string{"checkout", "platform", "growth", "core"}
+	team := teams[r.Intn(len(teams))]
+	version := fmt.Sprintf("v%d.%d.%d", 1+r.Intn(3), r.Intn(20), r.Intn(10))
+
+	rp := rand.New(rand.NewSource(int64(h.Sum64()) + int64(n) + 1))
+	return &k8sMetadata{
+		PodName:       fmt.Sprintf("%s-%s-%05x", service, hash, rp.Intn(1<<20)),
+		NamespaceName: namespace,
+		PodID: fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+			rp.Uint32(), rp.Intn(1<<16), rp.Intn(1<<16), rp.Intn(1<<16), rp.Int63n(1<<48)),
+		ContainerName: service,
+		Host:          fmt.Sprintf("node-%02d", rp.Intn(k8sLogsConfig.Nodes)),
+		Labels: map[string]string{
+			"app.kubernetes.io/name":    service,
+			"app.kubernetes.io/version": version,
+			"pod-template-hash":         hash,
+			"team":                      team,
+		},
+	}
+}
+
+// criLogRecords writes record as the kubelet does for a container of pod:
+// a CRI log line "<time> <stream> <P|F> <message>" per line of the message,
+// split into partial lines above 16KiB. Errors and warnings go to stderr.
+func criLogRecords(record LogRecord, pod *k8sMetadata) []LogRecord {
+	record.Kubernetes = pod
+	// The message is no longer the schema document once it is a CRI line
+	record.Document = nil
+	stream := "stdout"
+	if severityNumbers[record.Level] >= severityNumbers["warn"] {
+		stream = "stderr"
+	}
+	prefix := record.Time.UTC().Format(time.RFC3339Nano) + " " + stream + " "
+
+	var records []LogRecord
+	for _, line := range strings.Split(record.Log, "\n") {
+		for len(line) > criMaxLineBytes {
+			partial := record
+			partial.Log = prefix + "P " + line[:criMaxLineBytes]
+			records = append(records, partial)
+			line = line[criMaxLineBytes:]
+		}
+		full := record
+		full.Log = prefix + "F " + line
+		records = append(records, full)
+	}
+	return records
+}
+
+// k8sPods caches the pods of every service
+var k8sPods = struct {
+	sync.Mutex
+	byService map[string][]*k8sMetadata
+}{byService: make(map[string][]*k8sMetadata)}
+
+// randomK8sPod returns one of the pods running service
+func randomK8sPod(service string) *k8sMetadata {
+	k8sPods.Lock()
+	defer k8sPods.Unlock()
+	pods, ok := k8sPods.byService[service]
+	if !ok {
+		for n := 0; n < k8sLogsConfig.PodsPerService; n++ {
+			pods = append(pods, k8sPod(service, n))
+		}
+		k8sPods.byService[service] = pods
+	}
+	return pods[rand.Intn(len(pods))]
+}
+
+// k8sResourceAttributes returns the OTel resource attributes of a pod
+func k8sResourceAttributes(pod *k8sMetadata) map[string]string {
+	attrs := map[string]string{
+		"k8s.namespace.name": pod.NamespaceName,
+		"k8s.pod.name":       pod.PodName,
+		"k8s.pod.uid":        pod.PodID,
+		"k8s.container.name": pod.ContainerName,
+		"k8s.node.name":      pod.Host,
+	}
+	for key, value := range pod.Labels {
+		attrs["k8s.pod.label."+key] = value
+	}
+	return attrs
+}
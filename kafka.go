@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Kafka is selected per signal by giving its endpoint a kafka:// (plain
+// text) or kafkas:// (TLS) scheme with the bootstrap brokers and topic, e.g.
+// LOG_ENDPOINT=kafka://broker1:9092,broker2:9092/logs. Messages are produced
+// with the franz-go client, which finds the partition leaders, batches and
+// compresses records and retries them when leaders move.
+
+// Supported values for KAFKA_PARTITION_KEY
+const (
+	kafkaKeyNone    = "none"
+	kafkaKeyJob     = "job"
+	kafkaKeyTraceID = "trace_id"
+)
+
+// Supported values for KAFKA_COMPRESSION, with their record batch codec
+var kafkaCodecs = map[string]kgo.CompressionCodec{
+	"none":   kgo.NoCompression(),
+	"gzip":   kgo.GzipCompression(),
+	"snappy": kgo.SnappyCompression(),
+}
+
+var kafkaConfig = loadKafkaConfig()
+
+type KafkaConfig struct {
+	// PartitionKey keys messages by job or trace id; unkeyed messages stick
+	// to a partition until its batch is sent
+	PartitionKey string
+	// Acks is 0, 1 or all
+	Acks        string
+	Compression string
+	ClientID    string
+}
+
+func loadKafkaConfig() KafkaConfig {
+	return KafkaConfig{
+		PartitionKey: getEnvOrDefault("KAFKA_PARTITION_KEY", kafkaKeyNone),
+		Acks:         getEnvOrDefault("KAFKA_ACKS", "all"),
+		Compression:  getEnvOrDefault("KAFKA_COMPRESSION", "none"),
+		ClientID:     getEnvOrDefault("KAFKA_CLIENT_ID", "load-gen"),
+	}
+}
+
+// validateKafkaConfig checks the KAFKA_* settings
+func validateKafkaConfig() {
+	switch kafkaConfig.PartitionKey {
+	case kafkaKeyNone, kafkaKeyJob, kafkaKeyTraceID:
+	default:
+		configProblem("KAFKA_PARTITION_KEY=%q is not supported (use none, job or trace_id)", kafkaConfig.PartitionKey)
+	}
+	switch kafkaConfig.Acks {
+	case "0", "1", "all":
+	default:
+		configProblem("KAFKA_ACKS=%q is not supported (use 0, 1 or all)", kafkaConfig.Acks)
+	}
+	if _, ok := kafkaCodecs[kafkaConfig.Compression]; !ok {
+		configProblem("KAFKA_COMPRESSION=%q is not supported (use none, gzip or snappy)", kafkaConfig.Compression)
+	}
+}
+
+// kafkaAcks returns KAFKA_ACKS as the client has it
+func kafkaAcks() kgo.Acks {
+	switch kafkaConfig.Acks {
+	case "0":
+		return kgo.NoAck()
+	case "1":
+		return kgo.LeaderAck()
+	}
+	return kgo.AllISRAcks()
+}
+
+// isKafkaEndpoint reports whether endpoint selects the Kafka transport
+func isKafkaEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "kafka://") || strings.HasPrefix(endpoint, "kafkas://")
+}
+
+// kafkaEndpoint is a parsed kafka:// endpoint
+type kafkaEndpoint struct {
+	TLS     bool
+	Brokers []string
+	Topic   string
+}
+
+// parseKafkaEndpoint splits endpoint into its brokers and topic. Brokers
+// are a comma-separated list, which net/url cannot parse as a host.
+func parseKafkaEndpoint(endpoint string) (kafkaEndpoint, error) {
+	scheme, rest, _ := strings.Cut(endpoint, "://")
+	brokers, topic, _ := strings.Cut(rest, "/")
+	topic, err := url.PathUnescape(topic)
+	if err != nil {
+		return kafkaEndpoint{}, err
+	}
+	e := kafkaEndpoint{TLS: scheme == "kafkas", Topic: topic}
+	for _, broker := range strings.Split(brokers, ",") {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return kafkaEndpoint{}, fmt.Errorf("broker %q must be host:port", broker)
+		}
+		e.Brokers = append(e.Brokers, broker)
+	}
+	if e.Topic == "" {
+		return kafkaEndpoint{}, fmt.Errorf("no topic")
+	}
+	return e, nil
+}
+
+// validateKafkaEndpoint checks a kafka:// endpoint
+func validateKafkaEndpoint(key, endpoint string) {
+	if _, err := parseKafkaEndpoint(endpoint); err != nil {
+		configProblem("%s=%q is not a valid Kafka endpoint (e.g. kafka://broker1:9092,broker2:9092/topic): %v", key, endpoint, err)
+	}
+}
+
+// kafkaClients holds one client per scheme and broker list, shared by all
+// signals and topics
+var kafkaClients = struct {
+	sync.Mutex
+	byBrokers map[string]*kgo.Client
+}{byBrokers: make(map[string]*kgo.Client)}
+
+// produceKafka sends messages to the topic of endpoint and waits until the
+// brokers acknowledged them as KAFKA_ACKS asks
+func produceKafka(ctx context.Context, endpoint string, messages []brokerMessage) error {
+	e, err := parseKafkaEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+	client, err := kafkaClientFor(e)
+	if err != nil {
+		return err
+	}
+	records := make([]*kgo.Record, len(messages))
+	for i, m := range messages {
+		records[i] = &kgo.Record{Topic: e.Topic, Key: m.Key, Value: m.Value}
+	}
+	if err := client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return fmt.Errorf("failed to produce to kafka topic %s: %w", e.Topic, err)
+	}
+	return nil
+}
+
+// kafkaClientFor returns the client for the brokers of e, creating it when
+// there is none. Creating a client doesn't connect; it connects to the
+// brokers as records are produced.
+func kafkaClientFor(e kafkaEndpoint) (*kgo.Client, error) {
+	key := strconv.FormatBool(e.TLS) + "/" + strings.Join(e.Brokers, ",")
+	kafkaClients.Lock()
+	defer kafkaClients.Unlock()
+	if client, ok := kafkaClients.byBrokers[key]; ok {
+		return client, nil
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(e.Brokers...),
+		kgo.ClientID(kafkaConfig.ClientID),
+		kgo.DialTimeout(10 * time.Second),
+		kgo.RequiredAcks(kafkaAcks()),
+		kgo.ProducerBatchCompression(kafkaCodecs[kafkaConfig.Compression]),
+		// Keyed messages are hashed with murmur2, as the Java client does
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+		kgo.ProduceRequestTimeout(10 * time.Second),
+		// A batch fails rather than waiting for a broker that is down
+		kgo.RecordDeliveryTimeout(30 * time.Second),
+	}
+	// Idempotent writes need every in-sync replica to acknowledge
+	if kafkaConfig.Acks != "all" {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+	if e.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{}))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client for %s: %w", strings.Join(e.Brokers, ","), err)
+	}
+	kafkaClients.byBrokers[key] = client
+	return client, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestProduceKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "logs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var messages []brokerMessage
+	for i := range 12 {
+		messages = append(messages, brokerMessage{
+			Key:   []byte(fmt.Sprintf("job-%d", i%3)),
+			Value: []byte(fmt.Sprintf("message %d", i)),
+		})
+	}
+	endpoint := "kafka://" + strings.Join(cluster.ListenAddrs(), ",") + "/logs"
+	if err := produceKafka(ctx, endpoint, messages); err != nil {
+		t.Fatalf("produceKafka: %v", err)
+	}
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics("logs"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	values := make(map[string]string)
+	partitions := make(map[string]int32)
+	for len(values) < len(messages) {
+		fetches := consumer.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("consumed %d of %d messages: %v", len(values), len(messages), err)
+		}
+		fetches.EachRecord(func(r *kgo.Record) {
+			key := string(r.Key)
+			values[string(r.Value)] = key
+			if p, ok := partitions[key]; ok && p != r.Partition {
+				t.Errorf("key %s was produced to partitions %d and %d, want one", key, p, r.Partition)
+			}
+			partitions[key] = r.Partition
+		})
+	}
+	for _, m := range messages {
+		if key := values[string(m.Value)]; key != string(m.Key) {
+			t.Errorf("message %q has key %q, want %q", m.Value, key, m.Key)
+		}
+	}
+}
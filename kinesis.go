@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	firehosetypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Kinesis Data Streams and Firehose are selected per signal by giving its
+// endpoint a kinesis:// or firehose:// scheme with the stream name, e.g.
+// LOG_ENDPOINT=kinesis://logs or firehose://logs-to-s3. Records are put with
+// the AWS SDK (PutRecords and PutRecordBatch), which finds the credentials,
+// region and endpoint the way the AWS CLI does.
+
+// kinesisKeyRandom gives every Kinesis record a random partition key, which
+// spreads records evenly over the shards
+const kinesisKeyRandom = "random"
+
+var kinesisConfig = struct {
+	// PartitionKey keys Kinesis records by job or trace id, or randomly
+	PartitionKey string
+	// Aggregate packs several messages into each record: in the KPL
+	// aggregated format for Kinesis, or newline-delimited for Firehose
+	Aggregate bool
+	// MaxRetries is how often requests and records that were throttled or
+	// failed internally are sent again before the batch fails
+	MaxRetries int
+}{
+	PartitionKey: getEnvOrDefault("KINESIS_PARTITION_KEY", kinesisKeyRandom),
+	Aggregate:    getEnvBool("KINESIS_AGGREGATE", false),
+	MaxRetries:   getEnvInt("KINESIS_MAX_RETRIES", 5),
+}
+
+// awsRegion is AWS_REGION, or AWS_DEFAULT_REGION as the AWS CLI reads it;
+// when both are unset the SDK takes the region of the AWS_PROFILE
+var awsRegion = getEnvOrDefault("AWS_REGION", os.Getenv("AWS_DEFAULT_REGION"))
+
+// validateKinesisConfig checks the KINESIS_* settings
+func validateKinesisConfig() {
+	switch kinesisConfig.PartitionKey {
+	case kinesisKeyRandom, kafkaKeyJob, kafkaKeyTraceID:
+	default:
+		configProblem("KINESIS_PARTITION_KEY=%q is not supported (use random, job or trace_id)", kinesisConfig.PartitionKey)
+	}
+	if kinesisConfig.MaxRetries < 0 {
+		configProblem("KINESIS_MAX_RETRIES=%d must not be negative", kinesisConfig.MaxRetries)
+	}
+}
+
+// isKinesisEndpoint reports whether endpoint selects a Kinesis data stream
+func isKinesisEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "kinesis://")
+}
+
+// isFirehoseEndpoint reports whether endpoint selects a Firehose delivery
+// stream
+func isFirehoseEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "firehose://")
+}
+
+// kinesisStreamName matches stream names, which may use endpoint templates
+var kinesisStreamName = regexp.MustCompile(`^[a-zA-Z0-9_.{}-]{1,128}$`)
+
+// validateKinesisEndpoint checks a kinesis:// or firehose:// endpoint
+func validateKinesisEndpoint(key, endpoint string) {
+	_, name, _ := strings.Cut(endpoint, "://")
+	if !kinesisStreamName.MatchString(name) {
+		configProblem("%s=%q must name a stream, e.g. kinesis://logs or firehose://logs-to-s3", key, endpoint)
+	}
+}
+
+// kinesisTarget is the stream a kinesis:// or firehose:// endpoint puts to
+type kinesisTarget struct {
+	Service, Stream string
+	// MaxRecordSize and MaxRequestSize are the service quotas in bytes
+	MaxRecordSize, MaxRequestSize int
+}
+
+func kinesisTargetOf(endpoint string) kinesisTarget {
+	_, stream, _ := strings.Cut(endpoint, "://")
+	if isFirehoseEndpoint(endpoint) {
+		return kinesisTarget{Service: "firehose", Stream: stream, MaxRecordSize: 1000 << 10, MaxRequestSize: 4 << 20}
+	}
+	return kinesisTarget{Service: "kinesis", Stream: stream, MaxRecordSize: 1 << 20, MaxRequestSize: 5 << 20}
+}
+
+// awsClients are the Kinesis and Firehose clients, made on first use. The
+// SDK retries throttled and failed requests up to KINESIS_MAX_RETRIES
+// times with exponential backoff; it doesn't hold retries back when many
+// fail, since a generator is expected to be throttled.
+var awsClients struct {
+	once     sync.Once
+	kinesis  *kinesis.Client
+	firehose *firehose.Client
+	err      error
+}
+
+func loadAWSClients() error {
+	awsClients.once.Do(func() {
+		opts := []func(*awsconfig.LoadOptions) error{
+			awsconfig.WithRetryer(func() aws.Retryer {
+				return retry.NewStandard(func(o *retry.StandardOptions) {
+					o.MaxAttempts = kinesisConfig.MaxRetries + 1
+					o.MaxBackoff = 5 * time.Second
+					o.RateLimiter = ratelimit.None
+				})
+			}),
+		}
+		if awsRegion != "" {
+			opts = append(opts, awsconfig.WithRegion(awsRegion))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+		if err != nil {
+			awsClients.err = fmt.Errorf("failed to load AWS configuration: %w", err)
+			return
+		}
+		awsClients.kinesis = kinesis.NewFromConfig(cfg)
+		awsClients.firehose = firehose.NewFromConfig(cfg)
+	})
+	return awsClients.err
+}
+
+// kinesisMaxRecords is the most records PutRecords and PutRecordBatch take
+const kinesisMaxRecords = 500
+
+// kinesisRecord is a record of a PutRecords or PutRecordBatch request;
+// Firehose records have no partition key
+type kinesisRecord struct {
+	Data         []byte
+	PartitionKey string
+}
+
+// size is what the record counts against the quotas
+func (r kinesisRecord) size() int {
+	return len(r.Data) + len(r.PartitionKey)
+}
+
+// publishKinesis puts messages to the stream of endpoint, in as few requests
+// as the quotas allow
+func publishKinesis(ctx context.Context, endpoint string, messages []brokerMessage) error {
+	if err := loadAWSClients(); err != nil {
+		return err
+	}
+	t := kinesisTargetOf(endpoint)
+	records := t.records(messages)
+	for len(records) > 0 {
+		n, size := 0, 0
+		for n < len(records) && n < kinesisMaxRecords && size+records[n].size() <= t.MaxRequestSize {
+			if records[n].size() > t.MaxRecordSize {
+				return fmt.Errorf("%d-byte record exceeds the %d-byte limit of %s", records[n].size(), t.MaxRecordSize, t.Service)
+			}
+			size += records[n].size()
+			n++
+		}
+		if n == 0 {
+			return fmt.Errorf("%d-byte record exceeds the %d-byte request limit of %s", records[0].size(), t.MaxRequestSize, t.Service)
+		}
+		if err := t.putWithRetries(ctx, records[:n]); err != nil {
+			return fmt.Errorf("failed to put records to %s stream %s: %w", t.Service, t.Stream, err)
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// records turns messages into records, aggregating them with
+// KINESIS_AGGREGATE. Unkeyed Kinesis records get a random partition key.
+func (t kinesisTarget) records(messages []brokerMessage) []kinesisRecord {
+	records := make([]kinesisRecord, 0, len(messages))
+	for _, m := range messages {
+		r := kinesisRecord{Data: m.Value}
+		if t.Service == "kinesis" {
+			r.PartitionKey = string(m.Key)
+			if r.PartitionKey == "" {
+				r.PartitionKey = randomHexID(8)
+			}
+		}
+		records = append(records, r)
+	}
+	if !kinesisConfig.Aggregate || len(records) < 2 {
+		return records
+	}
+	if t.Service == "firehose" {
+		return joinFirehoseRecords(records, t.MaxRecordSize)
+	}
+	return aggregateKinesisRecords(records, t.MaxRecordSize)
+}
+
+// joinFirehoseRecords joins records into newline-delimited records of up to
+// limit bytes, as Firehose delivers them to S3 and most destinations
+func joinFirehoseRecords(records []kinesisRecord, limit int) []kinesisRecord {
+	var joined []kinesisRecord
+	var data []byte
+	for _, r := range records {
+		if len(data) > 0 && len(data)+1+len(r.Data) > limit {
+			joined = append(joined, kinesisRecord{Data: data})
+			data = nil
+		}
+		if len(data) > 0 {
+			data = append(data, '\n')
+		}
+		data = append(data, r.Data...)
+	}
+	return append(joined, kinesisRecord{Data: data})
+}
+
+// kplMagic starts records in the aggregated format of the Kinesis Producer
+// Library, which the KCL and Lambda's Kinesis integrations deaggregate
+var kplMagic = []byte{0xf3, 0x89, 0x9a, 0xc2}
+
+// aggregateKinesisRecords packs records into KPL aggregated records of up to
+// limit bytes. An aggregated record is routed by the partition key of its
+// first record; the keys of all of them are kept for consumers.
+func aggregateKinesisRecords(records []kinesisRecord, limit int) []kinesisRecord {
+	var aggregated []kinesisRecord
+	var keyTable, entries []byte
+	keys := make(map[string]uint64)
+	first := ""
+	flush := func() {
+		data := append(append([]byte{}, kplMagic...), keyTable...)
+		data = append(data, entries...)
+		sum := md5.Sum(data[len(kplMagic):])
+		aggregated = append(aggregated, kinesisRecord{Data: append(data, sum[:]...), PartitionKey: first})
+		keyTable, entries, keys, first = nil, nil, make(map[string]uint64), ""
+	}
+	for _, r := range records {
+		key, entry := kplEntry(keys, r)
+		size := len(kplMagic) + len(keyTable) + len(entries) + md5.Size + len(first)
+		if first != "" && size+len(key)+len(entry) > limit {
+			flush()
+			key, entry = kplEntry(keys, r)
+		}
+		if first == "" {
+			first = r.PartitionKey
+		}
+		if key != nil {
+			keys[r.PartitionKey] = uint64(len(keys))
+			keyTable = append(keyTable, key...)
+		}
+		entries = append(entries, entry...)
+	}
+	flush()
+	return aggregated
+}
+
+// kplEntry encodes r as a record of an AggregatedRecord, with the entry of
+// its partition key in the key table unless keys already has it
+func kplEntry(keys map[string]uint64, r kinesisRecord) (key, entry []byte) {
+	index, known := keys[r.PartitionKey]
+	if !known {
+		index = uint64(len(keys))
+		key = protowire.AppendTag(nil, 1, protowire.BytesType)
+		key = protowire.AppendString(key, r.PartitionKey)
+	}
+	var record []byte
+	record = protowire.AppendTag(record, 1, protowire.VarintType)
+	record = protowire.AppendVarint(record, index)
+	record = protowire.AppendTag(record, 3, protowire.BytesType)
+	record = protowire.AppendBytes(record, r.Data)
+	entry = protowire.AppendTag(nil, 3, protowire.BytesType)
+	return key, protowire.AppendBytes(entry, record)
+}
+
+// kinesisRetryable are the errors of throttled or internally failed
+// records, which are sent again
+var kinesisRetryable = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"ServiceUnavailableException":            true,
+	"InternalFailure":                        true,
+}
+
+// putWithRetries puts records, sending those that were throttled or failed
+// internally again with exponential backoff, up to KINESIS_MAX_RETRIES
+// times. Failed requests have been retried by the SDK already.
+func (t kinesisTarget) putWithRetries(ctx context.Context, records []kinesisRecord) error {
+	backoff := 100 * time.Millisecond
+	for retry := 0; ; retry++ {
+		failed, err := t.put(ctx, records)
+		if err == nil {
+			return nil
+		}
+		if len(failed) == 0 {
+			return err
+		}
+		if retry == kinesisConfig.MaxRetries {
+			return fmt.Errorf("%d of %d records still failing after %d retries: %w", len(failed), len(records), retry, err)
+		}
+		// Full jitter keeps generators that were throttled together from
+		// retrying together
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff = min(backoff*2, 5*time.Second)
+		records = failed
+	}
+}
+
+// kinesisResult is the outcome of a record in a PutRecords or
+// PutRecordBatch response; ErrorCode is empty for records that were stored
+type kinesisResult struct {
+	ErrorCode, ErrorMessage string
+}
+
+// put sends one request. Along with the error of a failed request or
+// record, it returns the throttled records to send again.
+func (t kinesisTarget) put(ctx context.Context, records []kinesisRecord) ([]kinesisRecord, error) {
+	var results []kinesisResult
+	if t.Service == "firehose" {
+		entries := make([]firehosetypes.Record, len(records))
+		for i, r := range records {
+			entries[i] = firehosetypes.Record{Data: r.Data}
+		}
+		out, err := awsClients.firehose.PutRecordBatch(ctx, &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(t.Stream),
+			Records:            entries,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range out.RequestResponses {
+			results = append(results, kinesisResult{aws.ToString(r.ErrorCode), aws.ToString(r.ErrorMessage)})
+		}
+	} else {
+		entries := make([]kinesistypes.PutRecordsRequestEntry, len(records))
+		for i, r := range records {
+			entries[i] = kinesistypes.PutRecordsRequestEntry{Data: r.Data, PartitionKey: aws.String(r.PartitionKey)}
+		}
+		out, err := awsClients.kinesis.PutRecords(ctx, &kinesis.PutRecordsInput{
+			StreamName: aws.String(t.Stream),
+			Records:    entries,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range out.Records {
+			results = append(results, kinesisResult{aws.ToString(r.ErrorCode), aws.ToString(r.ErrorMessage)})
+		}
+	}
+
+	if len(results) != len(records) {
+		return nil, fmt.Errorf("response has %d results for %d records", len(results), len(records))
+	}
+	var failed []kinesisRecord
+	var firstErr error
+	for i, r := range results {
+		if r.ErrorCode == "" {
+			continue
+		}
+		if !kinesisRetryable[r.ErrorCode] {
+			return nil, fmt.Errorf("record failed: %s %s", r.ErrorCode, r.ErrorMessage)
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s %s", r.ErrorCode, r.ErrorMessage)
+		}
+		failed = append(failed, records[i])
+	}
+	return failed, firstErr
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// gofakeit v6 only knows English data, so the names, places and messages of
+// other locales are built in here. Each locale writes its messages natively
+// rather than as translations of the English events, so tokenizers see
+// real word boundaries (or the lack of them in CJK text).
+
+// logLocale is the sample data of one language and region
+type logLocale struct {
+	FirstNames, LastNames []string
+	// FamilyFirst writes the last name first, joined by NameSeparator
+	FamilyFirst   bool
+	NameSeparator string
+	Cities        []string
+	Streets       []string
+	// Address formats a street, house number and city the local way
+	Address func(street string, number int, city string) string
+	// Messages are templates with {name}, {address}, {city}, {id}, {ms} and
+	// {emoji} placeholders
+	Messages []string
+}
+
+var logLocaleData = map[string]*logLocale{
+	"en": {
+		Messages: []string{
+			"Updated user profile for {name}",
+			"Order {id} shipped to {address}",
+			"Handled request in {ms}ms",
+			"Payment from {name} declined: card refused",
+			"New session for {name} from {city}",
+		},
+	},
+	"de": {
+		FirstNames: []string{"Jürgen", "Lena", "Maximilian", "Sophie", "Björn", "Jörg", "Käthe", "Ömer"},
+		LastNames:  []string{"Müller", "Schröder", "Weiß", "Groß", "Bäcker", "Köhler", "Fuchs", "Schmidt"},
+		Cities:     []string{"München", "Köln", "Düsseldorf", "Nürnberg", "Zürich", "Würzburg"},
+		Streets:    []string{"Hauptstraße", "Schloßallee", "Königstraße", "Bahnhofstraße"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%s %d, %05d %s", street, number, 10000+rand.Intn(89999), city)
+		},
+		Messages: []string{
+			"Benutzerprofil für {name} aktualisiert",
+			"Bestellung {id} an {address} versandt",
+			"Anfrage in {ms} ms bearbeitet",
+			"Zahlung von {name} fehlgeschlagen: Karte abgelehnt",
+			"Neue Sitzung für {name} aus {city}",
+		},
+	},
+	"fr": {
+		FirstNames: []string{"Anaïs", "Benoît", "Cécile", "François", "Hélène", "Jérôme", "Loïc", "Zoé"},
+		LastNames:  []string{"Lefèvre", "Dubois", "Moreau", "Girard", "Rousseau", "Bézier", "Lemaître", "Chevalier"},
+		Cities:     []string{"Besançon", "Orléans", "Nîmes", "Saint-Étienne", "Paris", "Montréal"},
+		Streets:    []string{"rue de la Paix", "avenue des Champs-Élysées", "boulevard Saint-Germain", "rue Victor-Hugo"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%d %s, %05d %s", number, street, 1000+rand.Intn(94000), city)
+		},
+		Messages: []string{
+			"Profil utilisateur mis à jour pour {name}",
+			"Commande {id} expédiée à {address}",
+			"Requête traitée en {ms} ms",
+			"Échec du paiement de {name} : carte refusée",
+			"Nouvelle session pour {name} depuis {city}",
+		},
+	},
+	"es": {
+		FirstNames: []string{"José", "María", "Begoña", "Íñigo", "Sofía", "Martín", "Ángela", "Raúl"},
+		LastNames:  []string{"García", "Muñoz", "Peña", "Ibáñez", "Núñez", "López", "Gómez", "Domínguez"},
+		Cities:     []string{"Cádiz", "Málaga", "Córdoba", "León", "Bogotá", "Ciudad de México"},
+		Streets:    []string{"Calle Mayor", "Avenida de la Constitución", "Calle de Alcalá", "Paseo de Gracia"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%s %d, %05d %s", street, number, 1000+rand.Intn(51000), city)
+		},
+		Messages: []string{
+			"Perfil de usuario actualizado para {name}",
+			"Pedido {id} enviado a {address}",
+			"Solicitud procesada en {ms} ms",
+			"Pago de {name} rechazado: tarjeta denegada",
+			"Nueva sesión de {name} desde {city}",
+		},
+	},
+	"pt": {
+		FirstNames: []string{"João", "Conceição", "Gonçalo", "Inês", "Luís", "Márcia", "Sebastião", "Lúcia"},
+		LastNames:  []string{"Gonçalves", "Araújo", "Magalhães", "Simões", "Peixoto", "Brandão", "Lopes", "Assunção"},
+		Cities:     []string{"São Paulo", "Belém", "Goiânia", "Lisboa", "Maceió", "Florianópolis"},
+		Streets:    []string{"Rua Augusta", "Avenida Paulista", "Rua da Consolação", "Praça da Sé"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%s, %d - %s", street, number, city)
+		},
+		Messages: []string{
+			"Perfil do usuário atualizado para {name}",
+			"Pedido {id} enviado para {address}",
+			"Requisição processada em {ms} ms",
+			"Pagamento de {name} recusado: cartão negado",
+			"Nova sessão de {name} a partir de {city}",
+		},
+	},
+	"ru": {
+		FirstNames: []string{"Алексей", "Екатерина", "Дмитрий", "Ольга", "Сергей", "Наталья", "Юрий", "Татьяна"},
+		LastNames:  []string{"Иванов", "Смирнов", "Кузнецов", "Попов", "Соколов", "Лебедев", "Козлов", "Новиков"},
+		Cities:     []string{"Москва", "Санкт-Петербург", "Новосибирск", "Екатеринбург", "Казань", "Нижний Новгород"},
+		Streets:    []string{"ул. Ленина", "Невский проспект", "ул. Тверская", "ул. Пушкина"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("г. %s, %s, д. %d", city, street, number)
+		},
+		Messages: []string{
+			"Профиль пользователя {name} обновлён",
+			"Заказ {id} отправлен по адресу {address}",
+			"Запрос обработан за {ms} мс",
+			"Платёж от {name} отклонён: карта заблокирована",
+			"Новый сеанс {name} из города {city}",
+		},
+	},
+	"ja": {
+		FirstNames:  []string{"翔太", "さくら", "大輔", "陽菜", "健一", "美咲", "拓海", "結衣"},
+		LastNames:   []string{"佐藤", "鈴木", "高橋", "田中", "渡辺", "伊藤", "山本", "中村"},
+		FamilyFirst: true,
+		Cities:      []string{"東京都", "大阪市", "京都市", "札幌市", "福岡市", "名古屋市"},
+		Streets:     []string{"渋谷区神南", "北区梅田", "中京区河原町", "中央区大通西"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%s%s%d丁目%d-%d", city, street, 1+number%5, 1+rand.Intn(30), 1+rand.Intn(20))
+		},
+		Messages: []string{
+			"ユーザー{name}のプロフィールを更新しました",
+			"注文{id}を{address}に発送しました",
+			"リクエストを{ms}ミリ秒で処理しました",
+			"{name}様の支払いが拒否されました：カードが無効です",
+			"{city}から{name}様の新しいセッション",
+		},
+	},
+	"zh": {
+		FirstNames:  []string{"伟", "芳", "娜", "秀英", "敏", "静", "强", "磊"},
+		LastNames:   []string{"王", "李", "张", "刘", "陈", "杨", "黄", "赵"},
+		FamilyFirst: true,
+		Cities:      []string{"北京市", "上海市", "广州市", "深圳市", "成都市", "杭州市"},
+		Streets:     []string{"朝阳区建国路", "浦东新区世纪大道", "天河区天河路", "南山区深南大道"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%s%s%d号", city, street, number)
+		},
+		Messages: []string{
+			"已更新用户{name}的资料",
+			"订单{id}已发往{address}",
+			"请求处理耗时{ms}毫秒",
+			"{name}的付款被拒绝：银行卡无效",
+			"{name}从{city}登录了新会话",
+		},
+	},
+	"ko": {
+		FirstNames:  []string{"민준", "서연", "지훈", "하은", "도윤", "지우", "예준", "수빈"},
+		LastNames:   []string{"김", "이", "박", "최", "정", "강", "조", "윤"},
+		FamilyFirst: true,
+		Cities:      []string{"서울특별시", "부산광역시", "인천광역시", "대구광역시", "대전광역시", "광주광역시"},
+		Streets:     []string{"강남구 테헤란로", "중구 세종대로", "해운대구 해운대로", "서구 둔산로"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%s %s %d", city, street, number)
+		},
+		Messages: []string{
+			"사용자 {name}의 프로필을 업데이트했습니다",
+			"주문 {id}을(를) {address}(으)로 발송했습니다",
+			"요청을 {ms}ms 만에 처리했습니다",
+			"{name}님의 결제가 거절되었습니다: 카드 거부",
+			"{city}에서 {name}님의 새 세션",
+		},
+	},
+	"ar": {
+		FirstNames: []string{"محمد", "فاطمة", "أحمد", "مريم", "علي", "نور", "عمر", "ليلى"},
+		LastNames:  []string{"العلي", "الحسن", "الخطيب", "المصري", "الشامي", "النجار", "حداد", "الزهراني"},
+		Cities:     []string{"القاهرة", "دبي", "الرياض", "عمّان", "بيروت", "الدار البيضاء"},
+		Streets:    []string{"شارع الملك فهد", "شارع التحرير", "شارع الشيخ زايد", "شارع الحمراء"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%d %s، %s", number, street, city)
+		},
+		Messages: []string{
+			"تم تحديث الملف الشخصي للمستخدم {name}",
+			"تم شحن الطلب {id} إلى {address}",
+			"تمت معالجة الطلب في {ms} مللي ثانية",
+			"تم رفض الدفع من {name}: البطاقة مرفوضة",
+			"جلسة جديدة لـ {name} من {city}",
+		},
+	},
+	"hi": {
+		FirstNames: []string{"अमित", "प्रिया", "राहुल", "अनीता", "विकास", "सुनीता", "अर्जुन", "पूजा"},
+		LastNames:  []string{"शर्मा", "वर्मा", "गुप्ता", "सिंह", "पटेल", "कुमार", "जोशी", "मिश्रा"},
+		Cities:     []string{"नई दिल्ली", "मुंबई", "बेंगलुरु", "कोलकाता", "चेन्नई", "जयपुर"},
+		Streets:    []string{"महात्मा गांधी मार्ग", "नेहरू रोड", "स्टेशन रोड", "राजपथ"},
+		Address: func(street string, number int, city string) string {
+			return fmt.Sprintf("%d, %s, %s", number, street, city)
+		},
+		Messages: []string{
+			"उपयोगकर्ता {name} की प्रोफ़ाइल अपडेट की गई",
+			"ऑर्डर {id} को {address} पर भेजा गया",
+			"अनुरोध {ms} ms में संसाधित हुआ",
+			"{name} का भुगतान अस्वीकृत: कार्ड अस्वीकार",
+			"{city} से {name} का नया सत्र",
+		},
+	},
+	// emoji keeps English text but adds emoji, including multi-codepoint
+	// ZWJ sequences and flags, through gofakeit's emoji data
+	"emoji": {
+		Messages: []string{
+			"🚀 Deployed build {id} for {name}",
+			"✅ Order {id} shipped to {address} 📦",
+			"⚠️ Slow request: {ms}ms 🐢",
+			"❌ Payment from {name} declined 💳",
+			"👋 New session for {name} from {city} {emoji}",
+			"👩‍💻 {name} pushed a fix 🇺🇸🇯🇵",
+		},
+	},
+}
+
+// logLocales are the LOG_LOCALES app messages are written in, by weight,
+// or nil for the default English events
+var logLocales = loadLogLocales(os.Getenv("LOG_LOCALES"))
+
+func loadLogLocales(value string) []weightedName {
+	if value == "" {
+		return nil
+	}
+	locales, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("LOG_LOCALES=%q is invalid: %v", value, err)
+		return nil
+	}
+	for _, locale := range locales {
+		if _, ok := logLocaleData[locale.Name]; !ok {
+			configProblem("LOG_LOCALES=%q is invalid: unknown locale %q (use %s)", value, locale.Name, strings.Join(logLocaleNames(), ", "))
+			return nil
+		}
+	}
+	return locales
+}
+
+// logLocaleNames lists the supported locales
+func logLocaleNames() []string {
+	names := make([]string, 0, len(logLocaleData))
+	for name := range logLocaleData {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// randomLocale picks one of LOG_LOCALES, or any locale when none are set
+func randomLocale() *logLocale {
+	if logLocales == nil {
+		names := logLocaleNames()
+		return logLocaleData[names[rand.Intn(len(names))]]
+	}
+	return logLocaleData[pickWeighted(logLocales)]
+}
+
+func (l *logLocale) name() string {
+	if l.FirstNames == nil {
+		return gofakeit.Name()
+	}
+	first := l.FirstNames[rand.Intn(len(l.FirstNames))]
+	last := l.LastNames[rand.Intn(len(l.LastNames))]
+	if l.FamilyFirst {
+		return last + l.NameSeparator + first
+	}
+	return first + " " + last
+}
+
+func (l *logLocale) city() string {
+	if l.Cities == nil {
+		return gofakeit.City()
+	}
+	return l.Cities[rand.Intn(len(l.Cities))]
+}
+
+func (l *logLocale) address() string {
+	if l.Address == nil {
+		a := gofakeit.Address()
+		return fmt.Sprintf("%s, %s, %s %s", a.Street, a.City, a.State, a.Zip)
+	}
+	return l.Address(l.Streets[rand.Intn(len(l.Streets))], 1+rand.Intn(200), l.city())
+}
+
+// message fills one of the locale's message templates
+func (l *logLocale) message() string {
+	return strings.NewReplacer(
+		"{name}", l.name(),
+		"{address}", l.address(),
+		"{city}", l.city(),
+		"{id}", strconv.Itoa(100000+rand.Intn(900000)),
+		"{ms}", strconv.Itoa(int(latencyDist.Sample())),
+		"{emoji}", gofakeit.Emoji(),
+	).Replace(l.Messages[rand.Intn(len(l.Messages))])
+}
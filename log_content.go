@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported values for LOG_CONTENT
+const logContentApp = "app"
+
+// logContentGenerators fill in the message of a record whose level, job and
+// time are already set. They may change the level to match the message.
+var logContentGenerators = map[string]func(record *LogRecord){
+	logContentApp:          func(record *LogRecord) { record.Log = appMessage(record) },
+	accessLogApache:        func(record *LogRecord) { generateAccessLog(record, accessLogApache) },
+	accessLogNginx:         func(record *LogRecord) { generateAccessLog(record, accessLogNginx) },
+	accessLogEnvoy:         func(record *LogRecord) { generateAccessLog(record, accessLogEnvoy) },
+	logContentK8sAudit:     generateK8sAudit,
+	logContentCloudTrail:   func(record *LogRecord) { generateCloudAudit(record, logContentCloudTrail) },
+	logContentGCPAudit:     func(record *LogRecord) { generateCloudAudit(record, logContentGCPAudit) },
+	logContentWindowsEvent: generateWindowsEvent,
+	logContentCEF:          func(record *LogRecord) { generateSecurityEvent(record, logContentCEF) },
+	logContentLEEF:         func(record *LogRecord) { generateSecurityEvent(record, logContentLEEF) },
+}
+
+// logContentNames lists the supported LOG_CONTENT values
+func logContentNames() []string {
+	names := make([]string, 0, len(logContentGenerators))
+	for name := range logContentGenerators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newLogContent returns the generator registered for content
+func newLogContent(content string) (func(record *LogRecord), error) {
+	if generate, ok := logContentGenerators[content]; ok {
+		return generate, nil
+	}
+	return nil, fmt.Errorf("LOG_CONTENT=%q is not supported (use %s)",
+		content, strings.Join(logContentNames(), ", "))
+}
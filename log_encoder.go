@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Supported values for LOG_FORMAT
+const (
+	logFormatJSON      = "json"
+	logFormatOTLP      = "otlp"
+	logFormatOTLPProto = "otlp_proto"
+)
+
+// logEncoder turns a batch of records into a single request body
+type logEncoder interface {
+	// ContentType is sent as the Content-Type header of every request
+	ContentType() string
+	// Encode serializes the whole batch
+	Encode(batch []LogRecord) ([]byte, error)
+}
+
+var logEncoders = map[string]logEncoder{
+	logFormatJSON:          jsonLogEncoder{},
+	logFormatOTLP:          otlpLogEncoder{},
+	logFormatOTLPProto:     otlpProtoLogEncoder{},
+	logFormatEMF:           emfLogEncoder{},
+	logFormatLoki:          lokiLogEncoder{},
+	logFormatESBulk:        esBulkLogEncoder{},
+	logFormatSplunkHEC:     splunkHECLogEncoder{},
+	logFormatDatadog:       datadogLogEncoder{},
+	logFormatSyslog:        syslogLogEncoder{},
+	logFormatGELF:          gelfLogEncoder{},
+	logFormatFluentForward: fluentForwardLogEncoder{},
+	logFormatLogfmt:        logfmtLogEncoder{},
+	logFormatText:          textLogEncoder{},
+}
+
+// logFormatNames lists the supported LOG_FORMAT values
+func logFormatNames() []string {
+	names := make([]string, 0, len(logEncoders))
+	for name := range logEncoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newLogEncoder returns the encoder registered for format
+func newLogEncoder(format string) (logEncoder, error) {
+	if enc, ok := logEncoders[format]; ok {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("LOG_FORMAT=%q is not supported (use %s)",
+		format, strings.Join(logFormatNames(), ", "))
+}
+
+// jsonLogEncoder sends records as a JSON array of LogRecord objects
+type jsonLogEncoder struct{}
+
+func (jsonLogEncoder) ContentType() string { return "application/json" }
+
+func (jsonLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	if batch == nil {
+		batch = []LogRecord{}
+	}
+	return json.Marshal(batch)
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	Flags                uint32         `json:"flags,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+// otlpLogEncoder sends records as an OTLP/JSON ExportLogsServiceRequest with
+// one resource per job
+type otlpLogEncoder struct{}
+
+func (otlpLogEncoder) ContentType() string { return "application/json" }
+
+func (otlpLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	return json.Marshal(toOTLPLogs(batch))
+}
+
+// otlpProtoLogEncoder sends records as a protobuf ExportLogsServiceRequest
+type otlpProtoLogEncoder struct{}
+
+func (otlpProtoLogEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (otlpProtoLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	return encodeOTLPLogsProto(toOTLPLogs(batch))
+}
+
+// toOTLPLogs builds an OTLP logs request with one resource per job, or per
+// pod with LOG_K8S_METADATA and per container with LOG_HOST_METADATA
+func toOTLPLogs(batch []LogRecord) otlpLogsRequest {
+	request := otlpLogsRequest{ResourceLogs: make([]otlpResourceLogs, 0)}
+	groups := groupLogs(batch, func(record LogRecord) string {
+		key := record.Job
+		if record.Kubernetes != nil {
+			key += "/" + record.Kubernetes.PodName
+		}
+		if record.logEmitter != nil {
+			key += "/" + record.ContainerID
+		}
+		return key
+	})
+	for _, group := range groups {
+		records := make([]otlpLogRecord, len(group))
+		for i, record := range group {
+			records[i] = toOTLPLogRecord(record)
+		}
+		var extra map[string]string
+		if pod := group[0].Kubernetes; pod != nil {
+			extra = k8sResourceAttributes(pod)
+		}
+		if e := group[0].logEmitter; e != nil {
+			if extra == nil {
+				extra = make(map[string]string)
+			}
+			for key, value := range e.attributes() {
+				extra[key] = value
+			}
+		}
+		request.ResourceLogs = append(request.ResourceLogs, otlpResourceLogs{
+			Resource: otlpResource{
+				Attributes: resourceAttributes(group[0].Job, rand.Intn(max(1, resourceConfig.Instances)), extra),
+			},
+			ScopeLogs: []otlpScopeLogs{{
+				Scope:      otlpScope{Name: otlpScopeName},
+				LogRecords: records,
+			}},
+		})
+	}
+	return request
+}
+
+func toOTLPLogRecord(record LogRecord) otlpLogRecord {
+	nanos := otlpUnixNano(record.Time.UnixNano())
+	body := record.Log
+	otlpRecord := otlpLogRecord{
+		TimeUnixNano:         nanos,
+		ObservedTimeUnixNano: nanos,
+		SeverityNumber:       severityNumbers[record.Level],
+		SeverityText:         strings.ToUpper(record.Level),
+		Body:                 otlpAnyValue{StringValue: &body},
+		Attributes:           []otlpKeyValue{otlpString("job", record.Job)},
+		TraceID:              record.TraceID,
+		SpanID:               record.SpanID,
+	}
+	// Records are only logged inside spans that were recorded
+	if record.TraceID != "" {
+		otlpRecord.Flags = otlpTraceFlagSampled
+	}
+	if record.logEmitter != nil {
+		otlpRecord.Attributes = append(otlpRecord.Attributes, otlpString("log.file.path", record.LogFilePath))
+	}
+	if record.logClient != nil {
+		otlpRecord.Attributes = append(otlpRecord.Attributes, record.logClient.attributes()...)
+	}
+	if s := record.logSequence; s != nil {
+		otlpRecord.Attributes = append(otlpRecord.Attributes,
+			otlpString("generator", s.Generator),
+			otlpInt("seq", int64(s.Seq)),
+			otlpString("checksum", s.Checksum))
+	}
+	if record.ID != "" {
+		otlpRecord.Attributes = append(otlpRecord.Attributes, otlpString("log.record.uid", record.ID))
+	}
+	return otlpRecord
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOTLPLogSeverity(t *testing.T) {
+	tests := []struct {
+		level  string
+		number int
+		text   string
+	}{
+		{"debug", 5, "DEBUG"},
+		{"info", 9, "INFO"},
+		{"warn", 13, "WARN"},
+		{"error", 17, "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			if got := severityNumbers[tt.level]; got != tt.number {
+				t.Errorf("severityNumbers[%q] = %d, want %d", tt.level, got, tt.number)
+			}
+
+			data, err := otlpLogEncoder{}.Encode([]LogRecord{{
+				Level: tt.level,
+				Job:   "user-service",
+				Log:   "hello",
+				Time:  time.Unix(1700000000, 0),
+			}})
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			var request struct {
+				ResourceLogs []struct {
+					ScopeLogs []struct {
+						LogRecords []struct {
+							SeverityNumber int    `json:"severityNumber"`
+							SeverityText   string `json:"severityText"`
+						} `json:"logRecords"`
+					} `json:"scopeLogs"`
+				} `json:"resourceLogs"`
+			}
+			if err := json.Unmarshal(data, &request); err != nil {
+				t.Fatalf("Encode produced invalid JSON: %v\n%s", err, data)
+			}
+			if len(request.ResourceLogs) != 1 || len(request.ResourceLogs[0].ScopeLogs) != 1 ||
+				len(request.ResourceLogs[0].ScopeLogs[0].LogRecords) != 1 {
+				t.Fatalf("Encode produced %s, want a single log record", data)
+			}
+			record := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+			if record.SeverityNumber != tt.number {
+				t.Errorf("severityNumber = %d, want %d", record.SeverityNumber, tt.number)
+			}
+			if record.SeverityText != tt.text {
+				t.Errorf("severityText = %q, want %q", record.SeverityText, tt.text)
+			}
+		})
+	}
+}
+
+func TestOTLPLogContentType(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{logFormatOTLP, "application/json"},
+		{logFormatOTLPProto, "application/x-protobuf"},
+	}
+	for _, tt := range tests {
+		enc, err := newLogEncoder(tt.format)
+		if err != nil {
+			t.Fatalf("newLogEncoder(%q): %v", tt.format, err)
+		}
+		if got := enc.ContentType(); got != tt.want {
+			t.Errorf("LOG_FORMAT=%s content type = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
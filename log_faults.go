@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// logRecordTime returns the time to stamp a record generated at now:
+// LOG_BACKDATE_PERCENT of records are back-dated by between
+// LOG_BACKDATE_MIN and LOG_BACKDATE_MAX, spread evenly across orders of
+// magnitude so seconds-old records are as common as hours-old ones
+func logRecordTime(now time.Time) time.Time {
+	if config.BackdatePercent <= 0 || rand.Float64()*100 >= config.BackdatePercent {
+		return now
+	}
+	lo, hi := math.Log(config.BackdateMin.Seconds()), math.Log(config.BackdateMax.Seconds())
+	age := math.Exp(lo + rand.Float64()*(hi-lo))
+	return now.Add(-time.Duration(age * float64(time.Second)))
+}
+
+// assignStableIDs gives every record an ID with LOG_STABLE_IDS. It runs
+// before records are numbered, so the checksum covers the ID.
+func assignStableIDs(batch []LogRecord) {
+	if !config.StableIDs {
+		return
+	}
+	for i := range batch {
+		batch[i].ID = generateTraceID()
+	}
+}
+
+// addDuplicateRecords appends an exact copy of LOG_DUPLICATE_PERCENT of the
+// records to the batch
+func addDuplicateRecords(batch []LogRecord) []LogRecord {
+	if config.DuplicatePercent <= 0 {
+		return batch
+	}
+	for _, record := range batch[:len(batch):len(batch)] {
+		if rand.Float64()*100 < config.DuplicatePercent {
+			batch = append(batch, record)
+		}
+	}
+	return batch
+}
+
+// invalidTextKinds are the byte sequences LOG_INVALID_TEXT_KINDS can insert
+var invalidTextKinds = map[string][]string{
+	// A stray continuation byte, a truncated sequence, an overlong
+	// encoding, a UTF-16 surrogate and a byte that never appears in UTF-8
+	"invalid_utf8": {"\x80", "\xe2\x82", "\xc0\xaf", "\xed\xa0\x80", "\xff"},
+	"nul":          {"\x00"},
+	// Colours, a cursor move, a line clear and a terminal title change
+	"ansi":    {"\x1b[31m", "\x1b[1;33m", "\x1b[0m", "\x1b[2K", "\x1b[10;1H", "\x1b]0;pwned\x07"},
+	"control": {"\a", "\b", "\v", "\f", "\r", "\x7f", "\x1a"},
+}
+
+// logInvalidText are the LOG_INVALID_TEXT_KINDS inserted into
+// LOG_INVALID_TEXT_PERCENT of log messages
+var logInvalidText = loadInvalidTextKinds(getEnvOrDefault("LOG_INVALID_TEXT_KINDS", "invalid_utf8,nul,ansi,control"))
+
+func loadInvalidTextKinds(value string) []weightedName {
+	kinds, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("LOG_INVALID_TEXT_KINDS=%q is invalid: %v", value, err)
+		return nil
+	}
+	for _, kind := range kinds {
+		if _, ok := invalidTextKinds[kind.Name]; !ok {
+			configProblem("LOG_INVALID_TEXT_KINDS=%q is invalid: unknown kind %q (use invalid_utf8, nul, ansi or control)", value, kind.Name)
+			return nil
+		}
+	}
+	return kinds
+}
+
+// injectInvalidText inserts one to three sequences of a random
+// LOG_INVALID_TEXT_KINDS kind at random places in the record's message
+func injectInvalidText(record *LogRecord) {
+	if config.InvalidTextPercent <= 0 || logInvalidText == nil || rand.Float64()*100 >= config.InvalidTextPercent {
+		return
+	}
+	sequences := invalidTextKinds[pickWeighted(logInvalidText)]
+	message := record.Log
+	positions := make([]int, 1+rand.Intn(3))
+	for i := range positions {
+		// Insert between characters so only the injected bytes are invalid
+		at := rand.Intn(len(message) + 1)
+		for at < len(message) && !utf8.RuneStart(message[at]) {
+			at++
+		}
+		positions[i] = at
+	}
+	// Inserting from the end keeps earlier positions, and sequences, intact
+	sort.Sort(sort.Reverse(sort.IntSlice(positions)))
+	for _, at := range positions {
+		message = message[:at] + sequences[rand.Intn(len(sequences))] + message[at:]
+	}
+	record.Log = message
+}
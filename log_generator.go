@@ -2,13 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,75 +20,189 @@ import (
 
 // LogRecord represents a single log entry
 type LogRecord struct {
-	Level     string `json:"level"`
-	Job       string `json:"job"`
-	Log       string `json:"log"`
-	Timestamp string `json:"_timestamp"`
+	Level string `json:"level"`
+	// SeverityNumber is the OTel number of Level, with LOG_SEVERITY_NUMBERS
+	SeverityNumber int    `json:"severity_number,omitempty"`
+	Job            string `json:"job"`
+	Log            string `json:"log"`
+	Timestamp      string `json:"_timestamp"`
+	// Time is the unformatted timestamp, used by encoders that need nanoseconds
+	Time time.Time `json:"-"`
+	// LatencyMs is a request latency for encoders that emit metrics
+	LatencyMs float64 `json:"-"`
+	// TraceID and SpanID tie the record to the span it was logged in
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+	// Kubernetes is the pod that logged the record, with LOG_K8S_METADATA
+	Kubernetes *k8sMetadata `json:"kubernetes,omitempty"`
+	// logEmitter is the host and container that logged the record, with
+	// LOG_HOST_METADATA; its fields are written alongside the record's
+	*logEmitter
+	// logClient is the client of access log requests, with LOG_CLIENT_GEO;
+	// its fields are written alongside the record's
+	*logClient
+	// logSequence numbers the record, with LOG_SEQUENCE; its fields are
+	// written alongside the record's
+	*logSequence
+	// ID identifies the record and its duplicates, with LOG_STABLE_IDS
+	ID string `json:"id,omitempty"`
+	// PII lists the values LOG_PII_PERCENT seeded the message with
+	PII []piiValue `json:"-"`
+	// Document is the LOG_SCHEMA_FILE document the record was generated as.
+	// It replaces the record in JSON output; Log holds it as text.
+	Document json.RawMessage `json:"-"`
+}
+
+func (r LogRecord) MarshalJSON() ([]byte, error) {
+	if r.Document != nil {
+		return r.Document, nil
+	}
+	if logTimestamp.Field != "_timestamp" || logTimestampIsNumber() {
+		return r.customTimestampJSON()
+	}
+	type plain LogRecord
+	return json.Marshal(plain(r))
 }
 
 // Global variables
 var (
 	totalBytesSent int64
-	jobTypes       = []string{
-		"user-service", "payment-processor", "order-management",
-		"inventory-service", "notification-service", "authentication-service",
-		"search-service", "recommendation-engine", "email-service", "analytics-processor",
-	}
-	dbTypes = []string{"postgres", "mysql", "mongodb", "redis", "elasticsearch", "cassandra"}
-	config  struct {
+	logRate        *rateController
+	logEnc         logEncoder
+	logContent     func(record *LogRecord)
+	// logJobs are the LOG_JOBS services that log, with their share of the
+	// traffic; jobTypes are their names
+	logJobs  = loadLogJobs()
+	jobTypes = weightedNames(logJobs)
+	dbTypes  = []string{"postgres", "mysql", "mongodb", "redis", "elasticsearch", "cassandra"}
+	config   struct {
+		// LogEndpoint may contain {job} and {stream} placeholders
 		LogEndpoint string
-		AuthHeader  string
-		LogRate     int
-		BatchSize   int
+		LogMethod   string
+		LogStream   string
+		LogFormat   string
+		// LogContent selects what the messages look like
+		LogContent string
+		LogRate    int
+		BatchSize  int
+		// MaxPayloadBytes caps a single request body; 0 means unlimited
+		MaxPayloadBytes int
+		// TraceContextPercent of records carry a trace and span id
+		TraceContextPercent float64
+		// TraceCorrelationPercent of records are written inside a span of a
+		// recently sent trace, taking its ids and service
+		TraceCorrelationPercent float64
+		// MultilinePercent of records are stack traces
+		MultilinePercent float64
+		// MultilineSplit sends every line of a stack trace as its own record
+		MultilineSplit bool
+		// BackdatePercent of records are stamped between BackdateMin and
+		// BackdateMax in the past, arriving out of order
+		BackdatePercent float64
+		BackdateMin     time.Duration
+		BackdateMax     time.Duration
+		// DuplicatePercent of records and DuplicateBatchPercent of batches
+		// are sent twice; StableIDs gives each record an ID its duplicate
+		// shares
+		DuplicatePercent      float64
+		DuplicateBatchPercent float64
+		StableIDs             bool
+		// InvalidTextPercent of messages get invalid UTF-8, NUL bytes, ANSI
+		// escapes or control characters
+		InvalidTextPercent float64
+		// SeverityNumbers writes the OTel SeverityNumber of every record
+		// into formats without a native one
+		SeverityNumbers bool
 	}
 )
 
 func init() {
 	config.LogEndpoint = os.Getenv("LOG_ENDPOINT")
-	if config.LogEndpoint == "" {
-		log.Fatal("LOG_ENDPOINT environment variable is required")
+	method, err := parseHTTPMethod("LOG_METHOD", os.Getenv("LOG_METHOD"))
+	if err != nil {
+		configProblem("%v", err)
+		method = http.MethodPost
+	}
+	config.LogMethod = method
+	config.LogStream = getEnvOrDefault("LOG_STREAM", "default")
+	config.LogFormat = getEnvOrDefault("LOG_FORMAT", logFormatJSON)
+	if logEnc, err = newLogEncoder(config.LogFormat); err != nil {
+		configProblem("%v", err)
+	}
+	if (config.LogFormat == logFormatOTLP || config.LogFormat == logFormatOTLPProto) &&
+		!isGRPCEndpoint(config.LogEndpoint) && !isBrokerEndpoint(config.LogEndpoint) && !strings.HasSuffix(config.LogEndpoint, "/v1/logs") {
+		log.Printf("Warning: LOG_FORMAT=%s usually targets an OTLP/HTTP endpoint ending in /v1/logs", config.LogFormat)
+	}
+	if config.LogFormat == logFormatLoki && !strings.HasSuffix(config.LogEndpoint, "/loki/api/v1/push") {
+		log.Printf("Warning: LOG_FORMAT=loki usually targets an endpoint ending in /loki/api/v1/push")
+	}
+	if config.LogFormat == logFormatESBulk && !strings.HasSuffix(config.LogEndpoint, "/_bulk") {
+		log.Printf("Warning: LOG_FORMAT=es_bulk usually targets an endpoint ending in /_bulk")
+	}
+	if config.LogFormat == logFormatSplunkHEC && !strings.HasSuffix(config.LogEndpoint, "/services/collector/event") {
+		log.Printf("Warning: LOG_FORMAT=splunk_hec usually targets an endpoint ending in /services/collector/event")
+	}
+	if config.LogFormat == logFormatDatadog && !strings.HasSuffix(config.LogEndpoint, "/api/v2/logs") {
+		log.Printf("Warning: LOG_FORMAT=datadog usually targets an endpoint ending in /api/v2/logs")
+	}
+	config.LogContent = getEnvOrDefault("LOG_CONTENT", logContentApp)
+	if logContent, err = newLogContent(config.LogContent); err != nil {
+		configProblem("%v", err)
+	}
+	if logSchema != nil {
+		logContent = generateSchemaRecord
 	}
-	config.AuthHeader = os.Getenv("AUTH_HEADER")
 	config.LogRate = getEnvInt("LOG_RATE", 1)
 	config.BatchSize = getEnvInt("BATCH_SIZE", 100)
-
-	log.Printf("Initialized with LOG_RATE=%d, BATCH_SIZE=%d, endpoint=%s",
-		config.LogRate, config.BatchSize, config.LogEndpoint)
+	config.MaxPayloadBytes = getEnvInt("MAX_PAYLOAD_BYTES", 0)
+	config.TraceContextPercent = getEnvFloat("LOG_TRACE_CONTEXT_PERCENT", 0)
+	config.TraceCorrelationPercent = getEnvFloat("LOG_TRACE_CORRELATION_PERCENT", 0)
+	config.MultilinePercent = getEnvFloat("LOG_MULTILINE_PERCENT", 0)
+	config.MultilineSplit = getEnvBool("LOG_MULTILINE_SPLIT", false)
+	config.BackdatePercent = getEnvFloat("LOG_BACKDATE_PERCENT", 0)
+	config.BackdateMin = getEnvDuration("LOG_BACKDATE_MIN", time.Second)
+	config.BackdateMax = getEnvDuration("LOG_BACKDATE_MAX", 2*time.Hour)
+	config.DuplicatePercent = getEnvFloat("LOG_DUPLICATE_PERCENT", 0)
+	config.DuplicateBatchPercent = getEnvFloat("LOG_DUPLICATE_BATCH_PERCENT", 0)
+	config.StableIDs = getEnvBool("LOG_STABLE_IDS", false)
+	config.InvalidTextPercent = getEnvFloat("LOG_INVALID_TEXT_PERCENT", 0)
+	config.SeverityNumbers = getEnvBool("LOG_SEVERITY_NUMBERS", false)
+	logRate = newRateController(float64(config.LogRate))
 
 	// Initialize random seed
 	rand.Seed(time.Now().UnixNano())
 }
 
-// getEnvInt retrieves an integer from environment variables with a default value
-func getEnvInt(key string, defaultValue int) int {
-	if val, err := strconv.Atoi(os.Getenv(key)); err == nil {
-		return val
+// defaultJobTypes are the services that log when LOG_JOBS is unset
+var defaultJobTypes = []string{
+	"user-service", "payment-processor", "order-management",
+	"inventory-service", "notification-service", "authentication-service",
+	"search-service", "recommendation-engine", "email-service", "analytics-processor",
+}
+
+// loadLogJobs reads LOG_JOBS ("name[:weight],...") falling back to
+// defaultJobTypes
+func loadLogJobs() []weightedName {
+	value := os.Getenv("LOG_JOBS")
+	if value == "" {
+		return uniformWeights(defaultJobTypes)
+	}
+	jobs, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("LOG_JOBS=%q is invalid: %v", value, err)
+		return uniformWeights(defaultJobTypes)
 	}
-	return defaultValue
+	return jobs
+}
+
+// randomJob returns a job chosen by its LOG_JOBS weight
+func randomJob() string {
+	return pickWeighted(logJobs)
 }
 
-// getRandomLogLevel returns a random log level based on weighted distribution
+// getRandomLogLevel returns a random log level weighted by LOG_LEVELS
 func getRandomLogLevel() string {
-	weights := map[string]int{
-		"debug": 15,
-		"info":  60,
-		"warn":  20,
-		"error": 5,
-	}
-	total := 0
-	for _, weight := range weights {
-		total += weight
-	}
-
-	r := rand.Intn(total)
-	current := 0
-	for level, weight := range weights {
-		current += weight
-		if r < current {
-			return level
-		}
-	}
-	return "info"
+	return pickWeighted(logLevels)
 }
 
 // generateRandomEvent creates a random log message
@@ -107,15 +223,19 @@ func generateRandomEvent() string {
 
 	switch eventTemplate {
 	case "Processing request from %s":
-		return fmt.Sprintf(eventTemplate, gofakeit.Email())
+		return fmt.Sprintf(eventTemplate, logUserEmail())
 	case "Handled %s request in %dms":
-		return fmt.Sprintf(eventTemplate, gofakeit.HTTPMethod(), rand.Intn(490)+10)
+		latency := rand.Intn(490) + 10
+		if latencyInLogs {
+			latency = int(latencyDist.Sample())
+		}
+		return fmt.Sprintf(eventTemplate, gofakeit.HTTPMethod(), latency)
 	case "Connected to %s":
 		return fmt.Sprintf(eventTemplate, dbTypes[rand.Intn(len(dbTypes))])
 	case "Cache hit for key: %s":
 		return fmt.Sprintf(eventTemplate, gofakeit.UUID())
 	case "Updated user profile for %s":
-		return fmt.Sprintf(eventTemplate, gofakeit.Email())
+		return fmt.Sprintf(eventTemplate, logUserEmail())
 	case "Received webhook from %s":
 		return fmt.Sprintf(eventTemplate, gofakeit.URL())
 	case "API rate limit: %d requests remaining":
@@ -132,9 +252,10 @@ func generateRandomEvent() string {
 }
 
 // generateLogData continuously generates and sends log data
-func generateLogData(wg *sync.WaitGroup, client *http.Client, done chan bool) {
+func generateLogData(ctx context.Context, wg *sync.WaitGroup, client *http.Client) {
 	defer wg.Done()
-	ticker := time.NewTicker(time.Second / time.Duration(config.LogRate))
+	interval := logRate.Interval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	batchCount := 0
@@ -142,26 +263,96 @@ func generateLogData(wg *sync.WaitGroup, client *http.Client, done chan bool) {
 
 	for {
 		select {
-		case <-done:
+		case <-ctx.Done():
 			log.Printf("Shutting down generator after %d batches", batchCount)
 			return
 		case <-ticker.C:
+			if paused.Load() {
+				continue
+			}
 			batchStart := time.Now()
-			batch := make([]LogRecord, config.BatchSize)
+			batch := make([]LogRecord, 0, config.BatchSize)
 			now := time.Now()
 
 			for i := 0; i < config.BatchSize; i++ {
-				batch[i] = LogRecord{
+				stamp := logRecordTime(now)
+				record := LogRecord{
 					Level:     getRandomLogLevel(),
-					Job:       jobTypes[rand.Intn(len(jobTypes))],
-					Log:       generateRandomEvent(),
-					Timestamp: now.Format(time.RFC3339),
+					Job:       randomJob(),
+					Timestamp: formatLogTimestamp(stamp),
+					Time:      stamp,
+					LatencyMs: latencyDist.Sample(),
+				}
+				correlated := rand.Float64()*100 < config.TraceCorrelationPercent && correlateWithTrace(&record)
+				logContent(&record)
+				if record.Document == nil {
+					seedPII(&record)
+					resizeLogMessage(&record)
+					injectInvalidText(&record)
+				}
+				if hostMetadataConfig.Enabled {
+					record.logEmitter = randomLogEmitter(record.Job)
+				}
+				if !correlated && rand.Float64()*100 < config.TraceContextPercent {
+					record.TraceID = logTraceIDPool.get(generateTraceID)
+					record.SpanID = generateSpanID()
+				}
+				records := []LogRecord{record}
+				if rand.Float64()*100 < config.MultilinePercent {
+					records = stackTraceRecords(record)
+				}
+				if k8sLogsConfig.Enabled {
+					pod := randomK8sPod(record.Job)
+					for _, r := range records {
+						batch = append(batch, criLogRecords(r, pod)...)
+					}
+				} else {
+					batch = append(batch, records...)
 				}
 			}
+			batch = append(batch, securityScenarioRecords(now)...)
+			if config.SeverityNumbers {
+				for i := range batch {
+					batch[i].SeverityNumber = severityNumbers[batch[i].Level]
+				}
+			}
+			assignStableIDs(batch)
+			numbered := numberLogRecords(batch)
+			batch = addDuplicateRecords(batch)
 
-			if err := sendLogBatch(client, batch); err != nil {
-				log.Printf("Failed to send log batch: %v", err)
+			atomic.AddInt64(&logSendAttempts, 1)
+			err := sendLogBatch(ctx, client, batch)
+			numbered.count(err, errors.Is(err, context.Canceled))
+			if err != nil {
+				// A send aborted by shutdown is not a failure of the endpoint
+				if errors.Is(err, context.Canceled) {
+					log.Printf("Shutting down generator after %d batches", batchCount)
+					return
+				}
+				atomic.AddInt64(&logSendErrors, 1)
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					logRate.OnThrottle()
+					log.Printf("Log endpoint throttled, reducing rate to %.2f batches/sec and pausing %v",
+						logRate.Rate(), throttled.RetryAfter)
+					select {
+					case <-ctx.Done():
+						log.Printf("Shutting down generator after %d batches", batchCount)
+						return
+					case <-time.After(throttled.RetryAfter):
+					}
+				} else {
+					log.Printf("Failed to send log batch: %v", err)
+				}
 			} else {
+				logRate.OnSuccess()
+				writePIIManifest(batch)
+				if rand.Float64()*100 < config.DuplicateBatchPercent {
+					// As a client retrying a batch whose response it never saw
+					if err := sendLogBatch(ctx, client, batch); err != nil && !errors.Is(err, context.Canceled) {
+						log.Printf("Failed to resend duplicate log batch: %v", err)
+					}
+				}
 				batchCount++
 				if batchCount%100 == 0 {
 					elapsed := time.Since(start)
@@ -174,26 +365,183 @@ func generateLogData(wg *sync.WaitGroup, client *http.Client, done chan bool) {
 			if processingTime := time.Since(batchStart); processingTime > time.Second {
 				log.Printf("Warning: batch processing took %v", processingTime)
 			}
+
+			if next := logRate.Interval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
 		}
 	}
 }
 
-// sendLogBatch sends a batch of logs to the configured endpoint
-func sendLogBatch(client *http.Client, logBatch []LogRecord) error {
-	batchData, err := json.Marshal(logBatch)
+// sendLogBatch sends a batch of logs to the configured endpoint. When the
+// endpoint template references {job}, records are grouped by job and each
+// group is sent to its own URL.
+func sendLogBatch(ctx context.Context, client *http.Client, logBatch []LogRecord) error {
+	if !strings.Contains(config.LogEndpoint, "{job}") {
+		return sendLogRequests(ctx, client, logEndpointFor(""), logBatch)
+	}
+
+	var sendErr error
+	for _, group := range groupLogsByJob(logBatch) {
+		if err := sendLogRequests(ctx, client, logEndpointFor(group[0].Job), group); err != nil {
+			sendErr = err
+		}
+	}
+	return sendErr
+}
+
+// logEndpointFor expands the log endpoint template for the given job
+func logEndpointFor(job string) string {
+	return expandEndpoint(config.LogEndpoint, map[string]string{
+		"job":    job,
+		"stream": config.LogStream,
+	})
+}
+
+// groupLogsByJob splits a batch by job, keeping groups in order of first appearance
+func groupLogsByJob(logBatch []LogRecord) [][]LogRecord {
+	return groupLogs(logBatch, func(record LogRecord) string { return record.Job })
+}
+
+// groupLogs splits a batch by key, keeping groups in order of first appearance
+func groupLogs(logBatch []LogRecord, key func(LogRecord) string) [][]LogRecord {
+	index := make(map[string]int)
+	var groups [][]LogRecord
+	for _, record := range logBatch {
+		k := key(record)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], record)
+	}
+	return groups
+}
+
+// sendLogRequests sends records to a single endpoint, splitting them into
+// several requests when the payload would exceed MAX_PAYLOAD_BYTES. Socket
+// endpoints get the whole batch.
+func sendLogRequests(ctx context.Context, client *http.Client, endpoint string, logBatch []LogRecord) error {
+	if isSocketEndpoint(endpoint) {
+		return sendSocket(ctx, endpoint, logBatch)
+	}
+	if isBrokerEndpoint(endpoint) {
+		return sendBrokerLogs(ctx, endpoint, logBatch)
+	}
+
+	batchData, err := logEnc.Encode(logBatch)
 	if err != nil {
 		log.Printf("Error marshaling batch: %v", err)
 		return fmt.Errorf("failed to marshal log batch: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", config.LogEndpoint, bytes.NewBuffer(batchData))
+	if config.MaxPayloadBytes <= 0 || len(batchData) <= config.MaxPayloadBytes || len(logBatch) < 2 {
+		return postLogPayload(ctx, client, endpoint, batchData, len(logBatch))
+	}
+
+	groups, err := splitLogBatch(logBatch, config.MaxPayloadBytes)
+	if err != nil {
+		return err
+	}
+	log.Printf("Split %d-record batch (%d bytes) into %d requests to stay under MAX_PAYLOAD_BYTES=%d",
+		len(logBatch), len(batchData), len(groups), config.MaxPayloadBytes)
+
+	var sendErr error
+	for _, group := range groups {
+		groupData, err := logEnc.Encode(group)
+		if err != nil {
+			return fmt.Errorf("failed to marshal log batch: %w", err)
+		}
+		if err := postLogPayload(ctx, client, endpoint, groupData, len(group)); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			sendErr = err
+		}
+	}
+	return sendErr
+}
+
+// splitLogBatch packs records into groups whose encoded size stays under
+// maxBytes. Each record's size is measured on its own, net of the encoder's
+// envelope, and groups are filled incrementally. A single record larger than
+// maxBytes still forms its own group.
+func splitLogBatch(logBatch []LogRecord, maxBytes int) ([][]LogRecord, error) {
+	envelope, err := logEnc.Encode(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log batch: %w", err)
+	}
+
+	var groups [][]LogRecord
+	var current []LogRecord
+	size := len(envelope)
+	for _, record := range logBatch {
+		recordData, err := logEnc.Encode([]LogRecord{record})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal log record: %w", err)
+		}
+		// Allow one byte per record for separators
+		needed := len(recordData) - len(envelope) + 1
+		if len(current) > 0 && size+needed > maxBytes {
+			groups = append(groups, current)
+			current = nil
+			size = len(envelope)
+		}
+		current = append(current, record)
+		size += needed
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups, nil
+}
+
+// postLogPayload sends an already encoded batch of records to endpoint
+func postLogPayload(ctx context.Context, client *http.Client, endpoint string, batchData []byte, records int) error {
+	if config.MaxPayloadBytes > 0 && len(batchData) > config.MaxPayloadBytes {
+		log.Printf("Warning: sending %d-byte payload above MAX_PAYLOAD_BYTES=%d (single record too large to split)",
+			len(batchData), config.MaxPayloadBytes)
+	}
+
+	if isGRPCEndpoint(endpoint) {
+		if err := exportGRPC(ctx, endpoint, otlpLogsExportMethod, batchData); err != nil {
+			return fmt.Errorf("failed to send log batch: %w", err)
+		}
+	} else if err := postLogHTTP(ctx, client, endpoint, batchData); err != nil {
+		return err
+	}
+
+	countLogsSent(records, len(batchData))
+	return nil
+}
+
+// countLogsSent records a successfully sent batch in the stats
+func countLogsSent(records, size int) {
+	atomic.AddInt64(&logBatchesSent, 1)
+	atomic.AddInt64(&logRecordsSent, int64(records))
+	bytes := atomic.AddInt64(&totalBytesSent, int64(size))
+	if bytes%(1024*1024) == 0 {
+		log.Printf("Total data sent: %d MB", bytes/(1024*1024))
+	}
+}
+
+// postLogHTTP sends an encoded batch in a single HTTP request
+func postLogHTTP(ctx context.Context, client *http.Client, endpoint string, batchData []byte) error {
+	req, err := http.NewRequestWithContext(ctx, config.LogMethod, endpoint, bytes.NewBuffer(batchData))
 	if err != nil {
 		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if config.AuthHeader != "" {
-		req.Header.Set("Authorization", config.AuthHeader)
+	req.Header.Set("Content-Type", logEnc.ContentType())
+	auth.apply(req)
+	if config.LogFormat == logFormatSplunkHEC && splunkHECConfig.Token != "" {
+		req.Header.Set("Authorization", "Splunk "+splunkHECConfig.Token)
+	}
+	if config.LogFormat == logFormatDatadog && datadogConfig.APIKey != "" {
+		req.Header.Set("DD-API-KEY", datadogConfig.APIKey)
 	}
 
 	resp, err := client.Do(req)
@@ -202,15 +550,13 @@ func sendLogBatch(client *http.Client, logBatch []LogRecord) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
 	if resp.StatusCode >= 400 {
 		log.Printf("Server error: status=%d, batch_size=%d bytes",
 			resp.StatusCode, len(batchData))
 		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
 	}
-
-	bytes := atomic.AddInt64(&totalBytesSent, int64(len(batchData)))
-	if bytes%(1024*1024) == 0 {
-		log.Printf("Total data sent: %d MB", bytes/(1024*1024))
-	}
 	return nil
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingServer accepts requests and holds them until the client goes away.
+// started receives a value as each request arrives.
+func blockingServer(t *testing.T) (srv *httptest.Server, started chan struct{}) {
+	t.Helper()
+	started = make(chan struct{}, 16)
+	release := make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv, started
+}
+
+// withLogEndpoint points the log generator at endpoint for the test
+func withLogEndpoint(t *testing.T, endpoint string) {
+	t.Helper()
+	saved := config.LogEndpoint
+	config.LogEndpoint = endpoint
+	t.Cleanup(func() { config.LogEndpoint = saved })
+}
+
+func TestSendLogBatchCanceled(t *testing.T) {
+	srv, started := blockingServer(t)
+	withLogEndpoint(t, srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	batch := []LogRecord{{Level: "info", Job: "user-service", Log: "hello"}}
+	start := time.Now()
+	err := sendLogBatch(ctx, srv.Client(), batch)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("sendLogBatch returned after %v, want promptly after cancel", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("sendLogBatch error = %v, want context.Canceled", err)
+	}
+}
+
+func TestGenerateLogDataCancelIsNotAFailure(t *testing.T) {
+	srv, started := blockingServer(t)
+	withLogEndpoint(t, srv.URL)
+	savedRate, savedSize := logRate, config.BatchSize
+	logRate, config.BatchSize = newRateController(100), 5
+	t.Cleanup(func() { logRate, config.BatchSize = savedRate, savedSize })
+
+	errorsBefore := atomic.LoadInt64(&logSendErrors)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go generateLogData(ctx, &wg, srv.Client())
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("generator sent no batch")
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("generator did not stop after cancel")
+	}
+	if n := atomic.LoadInt64(&logSendErrors) - errorsBefore; n != 0 {
+		t.Errorf("canceled send counted as %d send errors, want 0", n)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// logLevelBases are the OpenTelemetry severity ranges, each spanning four
+// SeverityNumbers: "info" is 9, "info2" 10, up to "info4" at 12
+var logLevelBases = []struct {
+	Name     string
+	Severity int
+}{
+	{"trace", 1}, {"debug", 5}, {"info", 9}, {"warn", 13}, {"error", 17}, {"fatal", 21},
+}
+
+// severityNumbers maps our levels onto OTLP SeverityNumber values
+var severityNumbers = func() map[string]int {
+	numbers := make(map[string]int)
+	for _, base := range logLevelBases {
+		numbers[base.Name] = base.Severity
+		for n := 2; n <= 4; n++ {
+			numbers[base.Name+strconv.Itoa(n)] = base.Severity + n - 1
+		}
+	}
+	return numbers
+}()
+
+// logLevels are the LOG_LEVELS records are logged at, by weight
+var logLevels = loadLogLevels(getEnvOrDefault("LOG_LEVELS", "debug:15,info:60,warn:20,error:5"))
+
+func loadLogLevels(value string) []weightedName {
+	levels, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("LOG_LEVELS=%q is invalid: %v", value, err)
+		return uniformWeights([]string{"info"})
+	}
+	for _, level := range levels {
+		if _, ok := severityNumbers[level.Name]; !ok {
+			configProblem("LOG_LEVELS=%q is invalid: unknown level %q (use trace, debug, info, warn, error or fatal, optionally numbered 2-4 as info2)", value, level.Name)
+			return uniformWeights([]string{"info"})
+		}
+	}
+	return levels
+}
+
+// baseLogLevel strips the number from a level such as "warn3"
+func baseLogLevel(level string) string {
+	return strings.TrimRight(level, "234")
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"gopkg.in/yaml.v3"
+)
+
+// logSchema is the document shape read from LOG_SCHEMA_FILE, or nil when
+// records keep the built-in {level, job, log, _timestamp} shape
+var logSchema = loadLogSchema(os.Getenv("LOG_SCHEMA_FILE"))
+
+// logSchemaFile describes the documents to generate, one field at a time in
+// the order they appear in each document:
+//
+//	level_field: log.level
+//	job_field: service.name
+//	nest_dotted_names: true
+//	fields:
+//	  - name: "@timestamp"
+//	    type: timestamp
+//	    format: rfc3339nano
+//	  - name: log.level
+//	    type: enum
+//	    values: [info, warn, error]
+//	    weights: [85, 10, 5]
+//	  - name: service.name
+//	    type: job
+//	  - name: user.id
+//	    type: faker
+//	    faker: uuid
+//	    cardinality: 500
+//	  - name: http.status_code
+//	    type: int
+//	    min: 200
+//	    max: 599
+//	  - name: message
+//	    type: template
+//	    template: "{service.name} served {user.id} with {http.status_code}"
+type logSchemaFile struct {
+	// LevelField and JobField name the fields whose values become the
+	// record's level and job, which encoders other than json use
+	LevelField string `yaml:"level_field"`
+	JobField   string `yaml:"job_field"`
+	// NestDottedNames turns "a.b" fields into {"a": {"b": ...}}
+	NestDottedNames bool             `yaml:"nest_dotted_names"`
+	Fields          []logSchemaField `yaml:"fields"`
+}
+
+type logSchemaField struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Format of timestamp fields: rfc3339, rfc3339nano, unix, unix_ms or a
+	// Go time layout
+	Format string `yaml:"format"`
+	// Values and Weights of enum fields; weights default to 1
+	Values  []any     `yaml:"values"`
+	Weights []float64 `yaml:"weights"`
+	// Faker names the fake data of faker fields
+	Faker string `yaml:"faker"`
+	// Min and Max bound int and float fields
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+	// Template of template fields; {name} is replaced with the value of an
+	// earlier field
+	Template string `yaml:"template"`
+	// Value of constant fields
+	Value any `yaml:"value"`
+	// Cardinality limits faker, int and float fields to that many distinct
+	// values; 0 leaves them unlimited
+	Cardinality int `yaml:"cardinality"`
+	// Percent of documents that have the field; defaults to 100
+	Percent *float64 `yaml:"percent"`
+
+	pool struct {
+		sync.Mutex
+		values []any
+	}
+}
+
+// logSchemaFakers are the faker field generators
+var logSchemaFakers = map[string]func() any{
+	"uuid":        func() any { return gofakeit.UUID() },
+	"email":       func() any { return gofakeit.Email() },
+	"name":        func() any { return gofakeit.Name() },
+	"first_name":  func() any { return gofakeit.FirstName() },
+	"username":    func() any { return gofakeit.Username() },
+	"ipv4":        func() any { return gofakeit.IPv4Address() },
+	"ipv6":        func() any { return gofakeit.IPv6Address() },
+	"url":         func() any { return gofakeit.URL() },
+	"domain":      func() any { return gofakeit.DomainName() },
+	"user_agent":  func() any { return gofakeit.UserAgent() },
+	"http_method": func() any { return gofakeit.HTTPMethod() },
+	"word":        func() any { return gofakeit.Word() },
+	"sentence":    func() any { return gofakeit.Sentence(8) },
+	"city":        func() any { return gofakeit.City() },
+	"country":     func() any { return gofakeit.CountryAbr() },
+	"phone":       func() any { return gofakeit.Phone() },
+	"company":     func() any { return gofakeit.Company() },
+	"trace_id":    func() any { return generateTraceID() },
+	"span_id":     func() any { return generateSpanID() },
+	"message":     func() any { return generateRandomEvent() },
+	// Local data is in one of LOG_LOCALES, or any locale
+	"local_name":    func() any { return randomLocale().name() },
+	"local_city":    func() any { return randomLocale().city() },
+	"local_address": func() any { return randomLocale().address() },
+	"local_message": func() any { return randomLocale().message() },
+}
+
+// logSchemaTypes are the supported field types
+var logSchemaTypes = []string{"timestamp", "level", "job", "enum", "faker", "int", "float", "bool", "template", "constant"}
+
+var logSchemaPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// loadLogSchema reads and checks a schema file; path "" disables schemas
+func loadLogSchema(path string) *logSchemaFile {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		configProblem("LOG_SCHEMA_FILE: %v", err)
+		return nil
+	}
+	var schema logSchemaFile
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		configProblem("LOG_SCHEMA_FILE=%s is not valid YAML: %v", path, err)
+		return nil
+	}
+	if err := schema.validate(); err != nil {
+		configProblem("LOG_SCHEMA_FILE=%s: %v", path, err)
+		return nil
+	}
+	log.Printf("Using log schema with %d fields", len(schema.Fields))
+	return &schema
+}
+
+func (s *logSchemaFile) validate() error {
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("no fields defined")
+	}
+	seen := make(map[string]bool)
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if f.Name == "" {
+			return fmt.Errorf("field %d has no name", i+1)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("field %s is defined twice", f.Name)
+		}
+		switch f.Type {
+		case "timestamp", "level", "job", "bool":
+		case "enum":
+			if len(f.Values) == 0 {
+				return fmt.Errorf("field %s: enum needs values", f.Name)
+			}
+			if len(f.Weights) != 0 && len(f.Weights) != len(f.Values) {
+				return fmt.Errorf("field %s: %d weights for %d values", f.Name, len(f.Weights), len(f.Values))
+			}
+		case "faker":
+			if _, ok := logSchemaFakers[f.Faker]; !ok {
+				return fmt.Errorf("field %s: unknown faker %q", f.Name, f.Faker)
+			}
+		case "int", "float":
+			if f.Max < f.Min {
+				return fmt.Errorf("field %s: max is below min", f.Name)
+			}
+		case "template":
+			for _, m := range logSchemaPlaceholder.FindAllStringSubmatch(f.Template, -1) {
+				if !seen[m[1]] {
+					return fmt.Errorf("field %s: template references %q, which is not an earlier field", f.Name, m[1])
+				}
+			}
+		case "constant":
+			if f.Value == nil {
+				return fmt.Errorf("field %s: constant needs a value", f.Name)
+			}
+		default:
+			return fmt.Errorf("field %s: unknown type %q (use %s)", f.Name, f.Type, strings.Join(logSchemaTypes, ", "))
+		}
+		if f.Cardinality < 0 {
+			return fmt.Errorf("field %s: cardinality must not be negative", f.Name)
+		}
+		if p := f.Percent; p != nil && (*p < 0 || *p > 100) {
+			return fmt.Errorf("field %s: percent must be between 0 and 100", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	for _, name := range []string{s.LevelField, s.JobField} {
+		if name != "" && !seen[name] {
+			return fmt.Errorf("%q is not a field", name)
+		}
+	}
+	return nil
+}
+
+// generateSchemaRecord fills record with a document of the LOG_SCHEMA_FILE
+// schema. Level and job fields default to the record's own.
+func generateSchemaRecord(record *LogRecord) {
+	values := make(map[string]any, len(logSchema.Fields))
+	doc := &orderedDocument{}
+	for i := range logSchema.Fields {
+		f := &logSchema.Fields[i]
+		if f.Percent != nil && rand.Float64()*100 >= *f.Percent {
+			continue
+		}
+		value := f.generate(record, values)
+		values[f.Name] = value
+		if logSchema.NestDottedNames {
+			doc.setPath(strings.Split(f.Name, "."), value)
+		} else {
+			doc.set(f.Name, value)
+		}
+	}
+	if v, ok := values[logSchema.LevelField]; ok {
+		record.Level = fmt.Sprint(v)
+	}
+	if v, ok := values[logSchema.JobField]; ok {
+		record.Job = fmt.Sprint(v)
+	}
+	data, err := doc.MarshalJSON()
+	if err != nil {
+		record.Log = fmt.Sprintf("failed to marshal schema document: %v", err)
+		return
+	}
+	record.Document = data
+	record.Log = string(data)
+}
+
+// generate returns a value of the field; values holds the earlier fields
+func (f *logSchemaField) generate(record *LogRecord, values map[string]any) any {
+	switch f.Type {
+	case "timestamp":
+		return formatSchemaTime(record.Time, f.Format)
+	case "level":
+		return record.Level
+	case "job":
+		return record.Job
+	case "enum":
+		if len(f.Weights) == 0 {
+			return f.Values[rand.Intn(len(f.Values))]
+		}
+		total := 0.0
+		for _, w := range f.Weights {
+			total += w
+		}
+		x := rand.Float64() * total
+		for i, w := range f.Weights {
+			if x -= w; x < 0 {
+				return f.Values[i]
+			}
+		}
+		return f.Values[len(f.Values)-1]
+	case "bool":
+		return rand.Intn(2) == 0
+	case "template":
+		return logSchemaPlaceholder.ReplaceAllStringFunc(f.Template, func(m string) string {
+			if v, ok := values[m[1:len(m)-1]]; ok {
+				return fmt.Sprint(v)
+			}
+			return ""
+		})
+	case "constant":
+		return f.Value
+	}
+	return f.pooled(f.sample)
+}
+
+// sample returns a fresh value of a faker, int or float field
+func (f *logSchemaField) sample() any {
+	switch f.Type {
+	case "int":
+		return int64(f.Min) + rand.Int63n(int64(f.Max)-int64(f.Min)+1)
+	case "float":
+		return f.Min + rand.Float64()*(f.Max-f.Min)
+	default:
+		return logSchemaFakers[f.Faker]()
+	}
+}
+
+// pooled returns a value from sample, drawn from a pool of Cardinality
+// values when the field's cardinality is limited
+func (f *logSchemaField) pooled(sample func() any) any {
+	if f.Cardinality == 0 {
+		return sample()
+	}
+	f.pool.Lock()
+	defer f.pool.Unlock()
+	if len(f.pool.values) < f.Cardinality {
+		value := sample()
+		f.pool.values = append(f.pool.values, value)
+		return value
+	}
+	return f.pool.values[rand.Intn(len(f.pool.values))]
+}
+
+// formatSchemaTime renders t in a timestamp field's format
+func formatSchemaTime(t time.Time, format string) any {
+	switch format {
+	case "", "rfc3339nano":
+		return t.UTC().Format(time.RFC3339Nano)
+	case "rfc3339":
+		return t.UTC().Format(time.RFC3339)
+	case "unix":
+		return t.Unix()
+	case "unix_ms":
+		return t.UnixMilli()
+	default:
+		return t.Format(format)
+	}
+}
+
+// orderedDocument is a JSON object that keeps its keys in insertion order
+type orderedDocument struct {
+	keys   []string
+	values map[string]any
+}
+
+func (d *orderedDocument) set(key string, value any) {
+	if d.values == nil {
+		d.values = make(map[string]any)
+	}
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+// setPath sets the value at a path of nested objects, creating them as needed
+func (d *orderedDocument) setPath(path []string, value any) {
+	if len(path) == 1 {
+		d.set(path[0], value)
+		return
+	}
+	child, ok := d.values[path[0]].(*orderedDocument)
+	if !ok {
+		child = &orderedDocument{}
+		d.set(path[0], child)
+	}
+	child.setPath(path[1:], value)
+}
+
+func (d *orderedDocument) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range d.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(d.values[key])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", key, err)
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log"
+)
+
+// logSequenceConfig numbers records so a receiver can prove whether the
+// pipeline dropped, duplicated or altered any of them
+var logSequenceConfig = struct {
+	Enabled bool
+	// Generator tells the sequences of concurrent generators apart
+	Generator string
+}{
+	Enabled:   getEnvBool("LOG_SEQUENCE", false),
+	Generator: getEnvOrDefault("LOG_GENERATOR_ID", randomHexID(4)),
+}
+
+// logSequence is the sequence number of a record and its checksum; its
+// fields are written alongside the record's
+type logSequence struct {
+	Generator string `json:"generator"`
+	Seq       uint64 `json:"seq"`
+	// Checksum is the CRC-32C, in hex, of the record as LOG_FORMAT=json
+	// encodes it without its checksum member, whatever LOG_FORMAT is
+	Checksum string `json:"checksum,omitempty"`
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// sequenceRange is the records of one batch, for the shutdown totals
+type sequenceRange struct {
+	First, Last uint64
+	// Sum adds up the checksums of the records
+	Sum uint64
+}
+
+// logSequenceTotals counts what happened to the numbered records
+var logSequenceTotals struct {
+	Numbered uint64
+	// Delivered records were in a batch the endpoint accepted, with the
+	// sum of their checksums
+	Delivered, DeliveredSum uint64
+	// Failed records were in a batch the endpoint rejected
+	Failed uint64
+	// Unconfirmed records were being sent at shutdown
+	Unconfirmed uint64
+}
+
+// numberLogRecords gives every record of batch the next sequence number and
+// its checksum. It runs before duplicates are added, so a duplicate shares
+// the number of its original.
+func numberLogRecords(batch []LogRecord) sequenceRange {
+	if !logSequenceConfig.Enabled || len(batch) == 0 {
+		return sequenceRange{}
+	}
+	r := sequenceRange{First: logSequenceTotals.Numbered + 1}
+	for i := range batch {
+		logSequenceTotals.Numbered++
+		seq := &logSequence{
+			Generator: logSequenceConfig.Generator,
+			Seq:       logSequenceTotals.Numbered,
+		}
+		batch[i].logSequence = seq
+		sum := recordChecksum(batch[i])
+		seq.Checksum = fmt.Sprintf("%08x", sum)
+		r.Sum += uint64(sum)
+	}
+	r.Last = logSequenceTotals.Numbered
+	return r
+}
+
+// recordChecksum is the CRC-32C of the JSON encoding of record, which leaves
+// out the checksum member while it is empty
+func recordChecksum(record LogRecord) uint32 {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return 0
+	}
+	return crc32.Checksum(b, crc32c)
+}
+
+// count adds the records of r to the totals
+func (r sequenceRange) count(err error, canceled bool) {
+	if r.First == 0 {
+		return
+	}
+	n := r.Last - r.First + 1
+	switch {
+	case err == nil:
+		logSequenceTotals.Delivered += n
+		logSequenceTotals.DeliveredSum += r.Sum
+	case canceled:
+		logSequenceTotals.Unconfirmed += n
+	default:
+		logSequenceTotals.Failed += n
+		log.Printf("Records %d-%d of generator %s were not delivered", r.First, r.Last, logSequenceConfig.Generator)
+	}
+}
+
+// logSequenceSummary prints what a receiver should have seen
+func logSequenceSummary() {
+	t := logSequenceTotals
+	log.Printf("Sequence totals for generator %s: numbered 1-%d, %d delivered (checksum sum %d), %d failed, %d unconfirmed at shutdown",
+		logSequenceConfig.Generator, t.Numbered, t.Delivered, t.DeliveredSum, t.Failed, t.Unconfirmed)
+}
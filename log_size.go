@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// logSizeEnabled is set when LOG_SIZE_DISTRIBUTION sizes log messages;
+	// otherwise messages keep their natural length
+	logSizeEnabled = os.Getenv("LOG_SIZE_DISTRIBUTION") != ""
+	// logSizeDist is the length of log messages in bytes, clamped to
+	// LOG_SIZE_MIN_BYTES and LOG_SIZE_MAX_BYTES
+	logSizeDist = loadDistribution("LOG_SIZE", "_BYTES", valueDistribution{
+		Kind: distLognormal, Min: 20, Max: 4096, Mean: 250, StdDev: 200, Alpha: 1.5,
+		SlowMean: 2000, SlowPercent: 5,
+	})
+	// hugeLinePercent of messages are between half of hugeLineBytes and
+	// hugeLineBytes long, whether or not other messages are sized
+	hugeLinePercent = getEnvFloat("LOG_HUGE_LINE_PERCENT", 0)
+	hugeLineBytes   = getEnvInt("LOG_HUGE_LINE_BYTES", 1<<20)
+)
+
+// resizeLogMessage pads or truncates the record's message to a size drawn
+// from LOG_SIZE_DISTRIBUTION, or to a huge size for LOG_HUGE_LINE_PERCENT of
+// records. Padding is a payload= field of random text after the message.
+func resizeLogMessage(record *LogRecord) {
+	var size int
+	switch {
+	case hugeLinePercent > 0 && rand.Float64()*100 < hugeLinePercent:
+		size = hugeLineBytes/2 + rand.Intn(hugeLineBytes/2+1)
+	case logSizeEnabled:
+		size = min(max(logSizeDist.SampleInt(), int(logSizeDist.Min)), int(logSizeDist.Max))
+	default:
+		return
+	}
+	record.Log = sizedMessage(record.Log, size)
+}
+
+// sizedMessage returns message cut or padded to exactly size bytes, never
+// splitting a UTF-8 sequence
+func sizedMessage(message string, size int) string {
+	const padding = " payload="
+	if len(message) >= size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		return message[:cut]
+	}
+	if size-len(message) <= len(padding) {
+		return message + strings.Repeat(" ", size-len(message))
+	}
+	return message + padding + randomText(size-len(message)-len(padding))
+}
+
+// formatLogSize describes message sizing for the effective config
+func formatLogSize() string {
+	if !logSizeEnabled {
+		return "natural"
+	}
+	return fmt.Sprintf("%s (%g-%g bytes)", logSizeDist.Kind, logSizeDist.Min, logSizeDist.Max)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+	// Embedded so LOG_TIMEZONES works in images without zoneinfo
+	_ "time/tzdata"
+)
+
+// Named LOG_TIMESTAMP_FORMAT values; anything else is a Go time layout
+const (
+	timestampRFC3339     = "rfc3339"
+	timestampRFC3339Nano = "rfc3339nano"
+	timestampUnix        = "unix"
+	timestampUnixMs      = "unix_ms"
+	timestampUnixUs      = "unix_us"
+	timestampUnixNs      = "unix_ns"
+)
+
+// logTimestamp is how json records write their timestamp: the field name
+// and its format
+var logTimestamp = struct {
+	Field  string
+	Format string
+}{
+	Field:  getEnvOrDefault("LOG_TIMESTAMP_FIELD", "_timestamp"),
+	Format: getEnvOrDefault("LOG_TIMESTAMP_FORMAT", timestampRFC3339),
+}
+
+// logTimezones are the LOG_TIMEZONES zones timestamps are written in, by
+// weight; none keeps local time
+var logTimezones, logTimezoneLocations = loadLogTimezones(os.Getenv("LOG_TIMEZONES"))
+
+var utcOffsetPattern = regexp.MustCompile(`^[+-]\d{2}(\d{2})?$`)
+
+// loadLogTimezones parses a weighted list of IANA zone names, UTC, Local and
+// UTC offsets such as +0530 or -08, e.g. "UTC:5,America/New_York,+0530"
+func loadLogTimezones(value string) ([]weightedName, map[string]*time.Location) {
+	if value == "" {
+		return nil, nil
+	}
+	zones, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("LOG_TIMEZONES=%q is invalid: %v", value, err)
+		return nil, nil
+	}
+	locations := make(map[string]*time.Location, len(zones))
+	for _, zone := range zones {
+		loc, err := parseTimezone(zone.Name)
+		if err != nil {
+			configProblem("LOG_TIMEZONES=%q is invalid: %v", value, err)
+			return nil, nil
+		}
+		locations[zone.Name] = loc
+	}
+	return zones, locations
+}
+
+func parseTimezone(name string) (*time.Location, error) {
+	if !utcOffsetPattern.MatchString(name) {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", name)
+		}
+		return loc, nil
+	}
+	hours, _ := strconv.Atoi(name[1:3])
+	minutes := 0
+	if len(name) == 5 {
+		minutes, _ = strconv.Atoi(name[3:])
+	}
+	if hours > 14 || minutes > 59 {
+		return nil, fmt.Errorf("offset %q is out of range", name)
+	}
+	seconds := hours*3600 + minutes*60
+	if name[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone(name, seconds), nil
+}
+
+// formatLogTimestamp renders t in the LOG_TIMESTAMP_FORMAT, as the text of
+// a number for the epoch formats, in a random LOG_TIMEZONES zone
+func formatLogTimestamp(t time.Time) string {
+	if logTimezones != nil {
+		t = t.In(logTimezoneLocations[pickWeighted(logTimezones)])
+	}
+	switch logTimestamp.Format {
+	case timestampRFC3339:
+		return t.Format(time.RFC3339)
+	case timestampRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case timestampUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case timestampUnixMs:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case timestampUnixUs:
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	case timestampUnixNs:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	default:
+		return t.Format(logTimestamp.Format)
+	}
+}
+
+// logTimestampIsNumber reports whether timestamps are epoch numbers, which
+// json records write unquoted
+func logTimestampIsNumber() bool {
+	switch logTimestamp.Format {
+	case timestampUnix, timestampUnixMs, timestampUnixUs, timestampUnixNs:
+		return true
+	}
+	return false
+}
+
+// customTimestampJSON marshals r with its timestamp under LOG_TIMESTAMP_FIELD,
+// keeping the field order of the default record
+func (r LogRecord) customTimestampJSON() ([]byte, error) {
+	doc := &orderedDocument{}
+	doc.set("level", r.Level)
+	if r.SeverityNumber != 0 {
+		doc.set("severity_number", r.SeverityNumber)
+	}
+	doc.set("job", r.Job)
+	doc.set("log", r.Log)
+	if logTimestampIsNumber() {
+		doc.set(logTimestamp.Field, json.Number(r.Timestamp))
+	} else {
+		doc.set(logTimestamp.Field, r.Timestamp)
+	}
+	if r.TraceID != "" {
+		doc.set("trace_id", r.TraceID)
+		doc.set("span_id", r.SpanID)
+	}
+	if r.Kubernetes != nil {
+		doc.set("kubernetes", r.Kubernetes)
+	}
+	if e := r.logEmitter; e != nil {
+		doc.set("host.name", e.HostName)
+		doc.set("container.id", e.ContainerID)
+		doc.set("log.file.path", e.LogFilePath)
+		doc.set("cloud.region", e.CloudRegion)
+	}
+	if c := r.logClient; c != nil {
+		doc.set("client.ip", c.IP)
+		if c.Location != nil {
+			doc.set("client.geo.country_iso_code", c.Country)
+			doc.set("client.geo.region_iso_code", c.Region)
+			doc.set("client.geo.city_name", c.City)
+			doc.set("client.geo.location", c.Location)
+		}
+	}
+	if s := r.logSequence; s != nil {
+		doc.set("generator", s.Generator)
+		doc.set("seq", s.Seq)
+		if s.Checksum != "" {
+			doc.set("checksum", s.Checksum)
+		}
+	}
+	if r.ID != "" {
+		doc.set("id", r.ID)
+	}
+	return doc.MarshalJSON()
+}
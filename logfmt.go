@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line formats write one newline-terminated line per record and can be sent
+// over HTTP as well as the socket transport, one line per UDP datagram
+const (
+	logFormatLogfmt = "logfmt"
+	logFormatText   = "text"
+)
+
+// lineLogFormats are the log formats sent over both HTTP and sockets
+var lineLogFormats = []string{logFormatLogfmt, logFormatText}
+
+// logfmtLogEncoder writes records as logfmt key=value lines
+type logfmtLogEncoder struct{}
+
+func (logfmtLogEncoder) ContentType() string { return "text/plain" }
+
+func (logfmtLogEncoder) Datagrams(record LogRecord) ([][]byte, error) {
+	return [][]byte{logfmtLine(record)}, nil
+}
+
+func (logfmtLogEncoder) EncodeRecord(record LogRecord) ([]byte, error) {
+	return logfmtLine(record), nil
+}
+
+func (logfmtLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range batch {
+		buf.Write(logfmtLine(record))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// logfmtLine renders record as time, level, job and msg pairs followed by
+// any trace context, pod, host and client location
+func logfmtLine(record LogRecord) []byte {
+	pairs := [][2]string{
+		{"time", record.Time.UTC().Format(time.RFC3339Nano)},
+		{"level", record.Level},
+		{"job", record.Job},
+		{"msg", record.Log},
+	}
+	if record.SeverityNumber != 0 {
+		pairs = append(pairs, [2]string{"severity", strconv.Itoa(record.SeverityNumber)})
+	}
+	if record.TraceID != "" {
+		pairs = append(pairs, [2]string{"trace_id", record.TraceID}, [2]string{"span_id", record.SpanID})
+	}
+	if pod := record.Kubernetes; pod != nil {
+		pairs = append(pairs,
+			[2]string{"namespace", pod.NamespaceName},
+			[2]string{"pod", pod.PodName},
+			[2]string{"container", pod.ContainerName})
+	}
+	if e := record.logEmitter; e != nil {
+		pairs = append(pairs,
+			[2]string{"host", e.HostName},
+			[2]string{"container_id", e.ContainerID},
+			[2]string{"file", e.LogFilePath},
+			[2]string{"region", e.CloudRegion})
+	}
+	if c := record.logClient; c != nil && c.Location != nil {
+		pairs = append(pairs,
+			[2]string{"client_country", c.Country},
+			[2]string{"client_region", c.Region},
+			[2]string{"client_city", c.City})
+	}
+	if s := record.logSequence; s != nil {
+		pairs = append(pairs,
+			[2]string{"generator", s.Generator},
+			[2]string{"seq", strconv.FormatUint(s.Seq, 10)},
+			[2]string{"checksum", s.Checksum})
+	}
+
+	var buf bytes.Buffer
+	for i, pair := range pairs {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(pair[0])
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(pair[1]))
+	}
+	return buf.Bytes()
+}
+
+// logfmtValue quotes values that are empty or contain spaces, quotes, equals
+// signs or control characters, escaping them as Go strings are
+func logfmtValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " =\"\\\t\r\n") {
+		return value
+	}
+	return `"` + logfmtEscaper.Replace(value) + `"`
+}
+
+var logfmtEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// textLogEncoder writes records as unstructured lines the way a typical
+// application logger does: "<time> <LEVEL> [<job>] <message>", with the
+// trace context in the brackets as Spring's [app,trace,span]. Multiline
+// messages keep their line breaks.
+type textLogEncoder struct{}
+
+func (textLogEncoder) ContentType() string { return "text/plain" }
+
+func (textLogEncoder) Datagrams(record LogRecord) ([][]byte, error) {
+	return [][]byte{textLine(record)}, nil
+}
+
+func (textLogEncoder) EncodeRecord(record LogRecord) ([]byte, error) {
+	return textLine(record), nil
+}
+
+func (textLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range batch {
+		buf.Write(textLine(record))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func textLine(record LogRecord) []byte {
+	context := record.Job
+	if record.TraceID != "" {
+		context += "," + record.TraceID + "," + record.SpanID
+	}
+	return []byte(fmt.Sprintf("%s %-5s [%s] %s", record.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
+		strings.ToUpper(record.Level), context, record.Log))
+}
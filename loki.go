@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const logFormatLoki = "loki"
+
+// lokiExtraLabels and lokiLabelValues set the stream cardinality: every
+// record gets lokiExtraLabels labels named label_NN on top of job and level,
+// each with one of lokiLabelValues values
+var (
+	lokiExtraLabels = getEnvInt("LOKI_EXTRA_LABELS", 0)
+	lokiLabelValues = getEnvInt("LOKI_LABEL_VALUES", 10)
+)
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiLogEncoder sends records as a Loki push API request with one stream
+// per distinct label set
+type lokiLogEncoder struct{}
+
+func (lokiLogEncoder) ContentType() string { return "application/json" }
+
+func (lokiLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	request := lokiPushRequest{Streams: make([]lokiStream, 0)}
+	index := make(map[string]int)
+	for _, record := range batch {
+		labels := lokiLabels(record)
+		key := lokiStreamKey(labels)
+		i, ok := index[key]
+		if !ok {
+			i = len(request.Streams)
+			index[key] = i
+			request.Streams = append(request.Streams, lokiStream{Stream: labels})
+		}
+		request.Streams[i].Values = append(request.Streams[i].Values,
+			[2]string{strconv.FormatInt(record.Time.UnixNano(), 10), record.Log})
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Loki push request: %w", err)
+	}
+	return data, nil
+}
+
+// lokiLabels returns the label set of the stream record is pushed to
+func lokiLabels(record LogRecord) map[string]string {
+	labels := map[string]string{
+		"job":   record.Job,
+		"level": record.Level,
+	}
+	if pod := record.Kubernetes; pod != nil {
+		labels["namespace"] = pod.NamespaceName
+		labels["pod"] = pod.PodName
+		labels["container"] = pod.ContainerName
+	}
+	if record.logEmitter != nil {
+		labels["host"] = record.HostName
+	}
+	for i := 0; i < lokiExtraLabels; i++ {
+		labels[fmt.Sprintf("label_%02d", i)] = fmt.Sprintf("value-%d", rand.Intn(lokiLabelValues))
+	}
+	return labels
+}
+
+// lokiStreamKey renders labels in Loki's {name="value",...} selector form
+func lokiStreamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -6,12 +6,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 )
 
 func main() {
+	if problems := validateConfig(); len(problems) > 0 {
+		log.Fatalf("Invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	logEffectiveConfig()
+
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -19,37 +25,116 @@ func main() {
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	pauseChan := make(chan os.Signal, 1)
+	signal.Notify(pauseChan, syscall.SIGUSR1)
 
 	var wg sync.WaitGroup
-	done := make(chan bool)
 	client := &http.Client{Timeout: 10 * time.Second}
+	start := time.Now()
+
+	// Keep short-lived credentials fresh
+	if auth.refreshes() {
+		wg.Add(1)
+		go auth.startAuthRefresh(ctx, &wg)
+	}
+
+	// Start the control and health endpoint
+	if controlAddr != "" {
+		wg.Add(1)
+		go startControlServer(ctx, &wg, controlAddr)
+	}
+
+	// Start periodic stats reporting
+	if statsInterval > 0 {
+		wg.Add(1)
+		go startStatsReporter(ctx, &wg, statsInterval)
+	}
 
 	// Start log generation
 	wg.Add(1)
-	go generateLogData(&wg, client, done)
+	go generateLogData(ctx, &wg, client)
+
+	// Start metrics generation, pushed, sent to Graphite and/or served for scraping
+	if metricsConfig.Endpoint != "" || metricsConfig.ListenAddr != "" || graphiteConfig.Addr != "" {
+		metrics := newMetricSet(time.Now())
+		wg.Add(1)
+		go generateMetrics(ctx, &wg, client, metrics)
+		if metricsConfig.ListenAddr != "" {
+			wg.Add(1)
+			go serveMetrics(ctx, &wg, metricsConfig.ListenAddr, metrics)
+		}
+		if graphiteConfig.Addr != "" {
+			wg.Add(1)
+			go pushGraphite(ctx, &wg, metrics)
+		}
+	}
+
+	// Start browser RUM generation
+	if rumConfig.Endpoint != "" {
+		wg.Add(1)
+		go generateRUM(ctx, &wg, client)
+	}
+
+	// Start synthetic checks
+	if checksConfig.Endpoint != "" {
+		wg.Add(1)
+		go generateChecks(ctx, &wg, client)
+	}
+
+	// Start Kubernetes event generation
+	if k8sEventsConfig.Endpoint != "" {
+		wg.Add(1)
+		go generateK8sEvents(ctx, &wg, client)
+	}
+
+	// Start profile generation
+	if profilesConfig.Endpoint != "" {
+		wg.Add(1)
+		go generateProfiles(ctx, &wg, client)
+	}
+
+	// Start StatsD generation
+	if statsdConfig.Addr != "" {
+		wg.Add(1)
+		go generateStatsd(ctx, &wg)
+	}
 
 	// Start trace generation
-	// wg.Add(1)
-	// go func() {
-	// 	defer wg.Done()
-	// 	if err := startTraceGeneration(ctx); err != nil && err != context.Canceled {
-	// 		log.Printf("Trace generation failed: %v", err)
-	// 		cancel()
-	// 	}
-	// }()
-
-	// Wait for shutdown signal
-	select {
-	case sig := <-sigChan:
-		log.Printf("Received signal: %v", sig)
-		cancel()
-	case <-ctx.Done():
-		log.Println("Context cancelled")
+	if tracesConfig.Enabled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := startTraceGeneration(ctx); err != nil && err != context.Canceled {
+				log.Printf("Trace generation failed: %v", err)
+				cancel()
+			}
+		}()
+	}
+
+	// Wait for shutdown signal; SIGUSR1 toggles pause
+waitLoop:
+	for {
+		select {
+		case <-pauseChan:
+			setPaused(!paused.Load())
+		case sig := <-sigChan:
+			log.Printf("Received signal: %v", sig)
+			cancel()
+			break waitLoop
+		case <-ctx.Done():
+			log.Println("Context cancelled")
+			break waitLoop
+		}
 	}
 
 	// Initiate shutdown
-	close(done)
 	log.Println("Waiting for goroutines to finish...")
 	wg.Wait()
+	if logSequenceConfig.Enabled {
+		logSequenceSummary()
+	}
+	if statsInterval > 0 {
+		logFinalStats(start)
+	}
 	log.Println("Shutdown complete")
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// messageTemplates are the LOG_TEMPLATES_FILE templates of LOG_CONTENT=app
+// messages, or nil to use the built-in events of generateRandomEvent
+var messageTemplates = loadMessageTemplates(os.Getenv("LOG_TEMPLATES_FILE"))
+
+// messageTemplateFuncs exposes every gofakeit generator to templates by its
+// method name ({{Email}}, {{Number 1 100}}, {{RandomString (SliceString
+// "a" "b")}}), plus the generator's own jobs, databases and latencies
+func messageTemplateFuncs() template.FuncMap {
+	faker := gofakeit.New(time.Now().UnixNano())
+	funcs := template.FuncMap{}
+	v := reflect.ValueOf(faker)
+	for i := 0; i < v.NumMethod(); i++ {
+		method := v.Type().Method(i)
+		// Template and SQL would recurse into gofakeit's own templates
+		if method.Type.NumOut() == 0 || method.Name == "Template" || method.Name == "SQL" || method.Name == "RandomMapKey" {
+			continue
+		}
+		funcs[method.Name] = v.Method(i).Interface()
+	}
+	funcs["ToUpper"] = strings.ToUpper
+	funcs["ToLower"] = strings.ToLower
+	funcs["Job"] = func() string { return randomJob() }
+	funcs["DBType"] = func() string { return dbTypes[rand.Intn(len(dbTypes))] }
+	funcs["Latency"] = func() int { return int(latencyDist.Sample()) }
+	funcs["TraceID"] = generateTraceID
+	funcs["SpanID"] = generateSpanID
+	funcs["LocalName"] = func() string { return randomLocale().name() }
+	funcs["LocalCity"] = func() string { return randomLocale().city() }
+	funcs["LocalAddress"] = func() string { return randomLocale().address() }
+	funcs["LocalMessage"] = func() string { return randomLocale().message() }
+	return funcs
+}
+
+// loadMessageTemplates reads one Go text/template per line of path,
+// skipping blank lines and # comments. Every template is run once against
+// a sample record so mistakes are reported at startup.
+func loadMessageTemplates(path string) []*template.Template {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		configProblem("LOG_TEMPLATES_FILE: %v", err)
+		return nil
+	}
+	defer file.Close()
+
+	funcs := messageTemplateFuncs()
+	sample := LogRecord{Level: "info", Job: jobTypes[0], Time: time.Now(), LatencyMs: 42}
+	var templates []*template.Template
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		t, err := template.New(fmt.Sprintf("line %d", line)).Funcs(funcs).Parse(text)
+		if err != nil {
+			configProblem("LOG_TEMPLATES_FILE=%s: %v", path, err)
+			return nil
+		}
+		if err := t.Execute(&bytes.Buffer{}, sample); err != nil {
+			configProblem("LOG_TEMPLATES_FILE=%s: %v", path, err)
+			return nil
+		}
+		templates = append(templates, t)
+	}
+	if err := scanner.Err(); err != nil {
+		configProblem("LOG_TEMPLATES_FILE: %v", err)
+		return nil
+	}
+	if len(templates) == 0 {
+		configProblem("LOG_TEMPLATES_FILE=%s has no templates", path)
+		return nil
+	}
+	log.Printf("Using %d message templates from %s", len(templates), path)
+	return templates
+}
+
+// appMessage returns an application event message for record, from a
+// random LOG_TEMPLATES_FILE template when one was loaded, or in one of
+// LOG_LOCALES. Templates see the
+// record, so {{.Job}}, {{.Level}} and {{.LatencyMs}} describe it.
+func appMessage(record *LogRecord) string {
+	if messageTemplates == nil {
+		if logLocales != nil {
+			return randomLocale().message()
+		}
+		return generateRandomEvent()
+	}
+	var buf bytes.Buffer
+	t := messageTemplates[rand.Intn(len(messageTemplates))]
+	if err := t.Execute(&buf, record); err != nil {
+		return fmt.Sprintf("failed to execute message template: %v", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+var (
+	messagingSystems = []string{"kafka", "rabbitmq"}
+	messagingTopics  = []string{"orders", "payments", "notifications", "inventory-updates", "audit-events"}
+
+	// consumerLagDist is the time in milliseconds between a message being
+	// published and a consumer starting to process it
+	consumerLagDist = loadTraceDistribution("TRACE_CONSUMER_LAG", "_MS", valueDistribution{
+		Kind: distLognormal, Min: 5, Max: 500, Mean: 50, StdDev: 100, Alpha: 1.5,
+	})
+)
+
+// messagingProducerSpan returns the name and attributes of publishing a message
+func messagingProducerSpan() (string, map[string]string) {
+	system := messagingSystems[rand.Intn(len(messagingSystems))]
+	topic := messagingTopics[rand.Intn(len(messagingTopics))]
+	attrs := map[string]string{
+		"span.kind":                  "producer",
+		"messaging.system":           system,
+		"messaging.operation":        "publish",
+		"messaging.destination.name": topic,
+		"messaging.message.id":       gofakeit.UUID(),
+		"net.peer.name":              system + ".internal",
+	}
+	switch system {
+	case "kafka":
+		attrs["messaging.kafka.destination.partition"] = strconv.Itoa(rand.Intn(12))
+	case "rabbitmq":
+		attrs["messaging.rabbitmq.destination.routing_key"] = topic + "." + []string{"created", "updated", "deleted"}[rand.Intn(3)]
+	}
+	return topic + " publish", attrs
+}
+
+// messagingConsumerSpan returns the span of another service processing the
+// message producer published. It continues the producer's trace and also
+// links to the producer span, as consumers that batch messages do, and
+// starts once the consumer lag has passed.
+func messagingConsumerSpan(producer Span) Span {
+	service := pickWeighted(traceServices)
+	for i := 0; service == producer.ServiceName && i < 3; i++ {
+		service = pickWeighted(traceServices)
+	}
+	attrs := map[string]string{
+		"span.kind":                  "consumer",
+		"messaging.operation":        "process",
+		"messaging.system":           producer.Attributes["messaging.system"],
+		"messaging.destination.name": producer.Attributes["messaging.destination.name"],
+		"messaging.message.id":       producer.Attributes["messaging.message.id"],
+	}
+	switch attrs["messaging.system"] {
+	case "kafka":
+		attrs["messaging.kafka.consumer.group"] = service
+		attrs["messaging.kafka.destination.partition"] = producer.Attributes["messaging.kafka.destination.partition"]
+		attrs["messaging.kafka.message.offset"] = strconv.Itoa(rand.Intn(10000000))
+	case "rabbitmq":
+		attrs["messaging.rabbitmq.destination.routing_key"] = producer.Attributes["messaging.rabbitmq.destination.routing_key"]
+	}
+
+	start := producer.EndTime + int64(consumerLagDist.SampleDuration())
+	return Span{
+		TraceID:     producer.TraceID,
+		SpanID:      generateSpanID(),
+		ParentID:    producer.SpanID,
+		Name:        attrs["messaging.destination.name"] + " process",
+		StartTime:   start,
+		EndTime:     start + int64(latencyDist.SampleDuration()),
+		ServiceName: service,
+		Attributes:  attrs,
+		Links:       []SpanLink{{TraceID: producer.TraceID, SpanID: producer.SpanID}},
+	}
+}
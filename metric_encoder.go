@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for METRICS_FORMAT
+const (
+	metricsFormatOTLP      = "otlp"
+	metricsFormatOTLPProto = "otlp_proto"
+)
+
+// metricsEncoder turns the current state of all series into a request body
+type metricsEncoder interface {
+	// ContentType is sent as the Content-Type header of every request
+	ContentType() string
+	// Encode serializes every series as of now
+	Encode(series []*metricSeries, now time.Time) ([]byte, error)
+}
+
+// encoderHeaders is implemented by encoders that need request headers
+// besides Content-Type
+type encoderHeaders interface {
+	Headers() map[string]string
+}
+
+var (
+	metricsEncoders = map[string]metricsEncoder{
+		metricsFormatOTLP:        otlpMetricsEncoder{},
+		metricsFormatOTLPProto:   otlpProtoMetricsEncoder{},
+		metricsFormatRemoteWrite: remoteWriteEncoder{},
+		metricsFormatPrometheus:  promTextEncoder{},
+		metricsFormatInflux:      influxEncoder{},
+	}
+	metricsEnc = newMetricsEncoder(metricsConfig.Format)
+)
+
+// newMetricsEncoder returns the encoder registered for format
+func newMetricsEncoder(format string) metricsEncoder {
+	if enc, ok := metricsEncoders[format]; ok {
+		return enc
+	}
+	names := make([]string, 0, len(metricsEncoders))
+	for name := range metricsEncoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	configProblem("METRICS_FORMAT=%q is not supported (use %s)", format, strings.Join(names, ", "))
+	return nil
+}
+
+// OTLP aggregation temporality values
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+)
+
+// otlpTemporality returns the aggregation temporality selected by METRIC_TEMPORALITY
+func otlpTemporality() int {
+	if metricsConfig.Temporality == temporalityDelta {
+		return otlpTemporalityDelta
+	}
+	return otlpTemporalityCumulative
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+	Exemplars         []otlpExemplar `json:"exemplars,omitempty"`
+}
+
+type otlpExemplar struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+	SpanID       string  `json:"spanId"`
+	TraceID      string  `json:"traceId"`
+}
+
+type otlpQuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpSummaryDataPoint struct {
+	Attributes        []otlpKeyValue      `json:"attributes"`
+	StartTimeUnixNano string              `json:"startTimeUnixNano"`
+	TimeUnixNano      string              `json:"timeUnixNano"`
+	Count             string              `json:"count"`
+	Sum               float64             `json:"sum"`
+	QuantileValues    []otlpQuantileValue `json:"quantileValues"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpExpBuckets struct {
+	Offset       int      `json:"offset"`
+	BucketCounts []string `json:"bucketCounts"`
+}
+
+type otlpExpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	Scale             int            `json:"scale"`
+	ZeroCount         string         `json:"zeroCount"`
+	Positive          otlpExpBuckets `json:"positive"`
+	Exemplars         []otlpExemplar `json:"exemplars,omitempty"`
+}
+
+type otlpExpHistogram struct {
+	DataPoints             []otlpExpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                         `json:"aggregationTemporality"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Unit        string         `json:"unit,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	Summary     *otlpSummary   `json:"summary,omitempty"`
+
+	ExponentialHistogram *otlpExpHistogram `json:"exponentialHistogram,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// otlpMetricsEncoder sends series as an OTLP/JSON ExportMetricsServiceRequest
+type otlpMetricsEncoder struct{}
+
+func (otlpMetricsEncoder) ContentType() string { return "application/json" }
+
+func (otlpMetricsEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	data, err := json.Marshal(toOTLPMetrics(series, now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal OTLP metrics: %w", err)
+	}
+	return data, nil
+}
+
+// otlpProtoMetricsEncoder sends series as a protobuf ExportMetricsServiceRequest
+type otlpProtoMetricsEncoder struct{}
+
+func (otlpProtoMetricsEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (otlpProtoMetricsEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	return encodeOTLPMetricsProto(toOTLPMetrics(series, now))
+}
+
+// toOTLPMetrics groups series into one OTLP metric per definition
+func toOTLPMetrics(series []*metricSeries, now time.Time) otlpMetricsRequest {
+	byMetric := make(map[*metricDefinition]*otlpMetric)
+	var metrics []*otlpMetric
+
+	for _, s := range series {
+		m, ok := byMetric[s.def]
+		if !ok {
+			m = &otlpMetric{Name: s.def.Name, Description: s.def.Description, Unit: s.def.Unit}
+			switch s.def.Kind {
+			case metricCounter:
+				m.Sum = &otlpSum{AggregationTemporality: otlpTemporality(), IsMonotonic: true}
+			case metricGauge:
+				m.Gauge = &otlpGauge{}
+			case metricHistogram:
+				m.Histogram = &otlpHistogram{AggregationTemporality: otlpTemporality()}
+			case metricSummary:
+				m.Summary = &otlpSummary{}
+			case metricExpHistogram:
+				m.ExponentialHistogram = &otlpExpHistogram{AggregationTemporality: otlpTemporality()}
+			}
+			byMetric[s.def] = m
+			metrics = append(metrics, m)
+		}
+
+		attrs := make([]otlpKeyValue, len(s.labels))
+		for i, label := range s.labels {
+			attrs[i] = otlpString(label.Name, label.Value)
+		}
+		startNano := otlpUnixNano(s.startTime.UnixNano())
+		nowNano := otlpUnixNano(s.sampleTime(now).UnixNano())
+
+		switch s.def.Kind {
+		case metricCounter, metricGauge:
+			point := otlpNumberDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				AsDouble:          s.value,
+			}
+			if m.Sum != nil {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+			} else {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, point)
+			}
+		case metricHistogram:
+			m.Histogram.DataPoints = append(m.Histogram.DataPoints, otlpHistogramDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				Count:             strconv.FormatUint(s.count, 10),
+				Sum:               s.sum,
+				BucketCounts:      formatCounts(s.bucketCounts),
+				ExplicitBounds:    metricsConfig.HistogramBounds,
+				Exemplars:         otlpExemplars(s),
+			})
+		case metricSummary:
+			quantiles := s.quantiles()
+			values := make([]otlpQuantileValue, len(quantiles))
+			for i, value := range quantiles {
+				values[i] = otlpQuantileValue{Quantile: metricsConfig.SummaryQuantiles[i], Value: value}
+			}
+			m.Summary.DataPoints = append(m.Summary.DataPoints, otlpSummaryDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				Count:             strconv.FormatUint(s.count, 10),
+				Sum:               s.sum,
+				QuantileValues:    values,
+			})
+		case metricExpHistogram:
+			m.ExponentialHistogram.DataPoints = append(m.ExponentialHistogram.DataPoints, otlpExpHistogramDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				Count:             strconv.FormatUint(s.count, 10),
+				Sum:               s.sum,
+				Scale:             s.exp.scale,
+				ZeroCount:         strconv.FormatUint(s.exp.zeroCount, 10),
+				Positive:          otlpExpBuckets{Offset: s.exp.offset, BucketCounts: formatCounts(s.exp.counts)},
+				Exemplars:         otlpExemplars(s),
+			})
+		}
+	}
+
+	resourceAttrs := resourceAttributes(metricsConfig.ResourceAttributes["service.name"], 0, metricsConfig.ResourceAttributes)
+
+	scope := otlpScopeMetrics{Scope: otlpScope{Name: otlpScopeName}, Metrics: make([]otlpMetric, len(metrics))}
+	for i, m := range metrics {
+		scope.Metrics[i] = *m
+	}
+	return otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: resourceAttrs},
+		ScopeMetrics: []otlpScopeMetrics{scope},
+	}}}
+}
+
+// formatCounts renders uint64 counts as OTLP/JSON decimal strings
+func formatCounts(counts []uint64) []string {
+	formatted := make([]string, len(counts))
+	for i, c := range counts {
+		formatted[i] = strconv.FormatUint(c, 10)
+	}
+	return formatted
+}
+
+// otlpExemplars returns the exemplar of a series, if it has one
+func otlpExemplars(s *metricSeries) []otlpExemplar {
+	if s.exemplar == nil {
+		return nil
+	}
+	return []otlpExemplar{{
+		TimeUnixNano: otlpUnixNano(s.exemplar.Time.UnixNano()),
+		AsDouble:     s.exemplar.Value,
+		SpanID:       s.exemplar.SpanID,
+		TraceID:      s.exemplar.TraceID,
+	}}
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// metricKind is the data point type of a metric
+type metricKind int
+
+const (
+	metricCounter metricKind = iota
+	metricGauge
+	metricHistogram
+	metricSummary
+	metricExpHistogram
+)
+
+// metricDefinition describes a metric independent of its label sets
+type metricDefinition struct {
+	Name        string
+	Description string
+	Unit        string
+	Kind        metricKind
+}
+
+// metricLabel is a single label of a series
+type metricLabel struct {
+	Name  string
+	Value string
+}
+
+// metricSeries holds the running state of one label set of a metric.
+// Counters and histograms accumulate since startTime, which moves to the
+// export time after every export with delta temporality.
+type metricSeries struct {
+	def       *metricDefinition
+	labels    []metricLabel
+	startTime time.Time
+
+	// value is the counter total or the current gauge reading
+	value float64
+
+	// Histogram and summary state; bucketCounts has one more entry than the bounds
+	count        uint64
+	sum          float64
+	bucketCounts []uint64
+
+	// window holds the most recent summary observations, used for quantiles
+	window     []float64
+	windowNext int
+
+	// exp holds the buckets of an exponential histogram
+	exp *expHistogram
+
+	// exemplar is the most recent sent trace observed by a histogram
+	exemplar *traceExemplar
+
+	// lastSent is the newest timestamp encoded for the series; backdated,
+	// when set, is an older timestamp used for the next sample instead of now
+	lastSent  time.Time
+	backdated time.Time
+}
+
+// summaryWindowSize bounds the observations kept per summary series
+const summaryWindowSize = 1024
+
+// defaultHistogramBounds are the Prometheus client default buckets, in seconds
+var defaultHistogramBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// defaultSummaryQuantiles are reported by summary series unless configured otherwise
+var defaultSummaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+var defaultMetrics = []metricDefinition{
+	{Name: "http_requests_total", Description: "Total HTTP requests handled", Unit: "1", Kind: metricCounter},
+	{Name: "process_resident_memory_bytes", Description: "Resident memory size", Unit: "By", Kind: metricGauge},
+	{Name: "http_request_duration_seconds", Description: "HTTP request latency", Unit: "s", Kind: metricHistogram},
+	{Name: "rpc_duration_seconds", Description: "RPC latency", Unit: "s", Kind: metricSummary},
+}
+
+// expHistogramMetric is added when exponential histograms are enabled
+var expHistogramMetric = metricDefinition{
+	Name: "rpc_server_duration_seconds", Description: "RPC server latency", Unit: "s", Kind: metricExpHistogram,
+}
+
+// Supported values for METRIC_TEMPORALITY
+const (
+	temporalityCumulative = "cumulative"
+	temporalityDelta      = "delta"
+)
+
+var (
+	metricPointsSent   int64
+	metricSendAttempts int64
+	metricSendErrors   int64
+
+	metricsConfig = loadMetricsConfig()
+	metricRate    = newRateController(metricsConfig.Rate)
+)
+
+type MetricsConfig struct {
+	// Endpoint receives metric exports; metrics generation is off when empty
+	Endpoint string
+	Method   string
+	Format   string
+	// Rate is the number of exports per second
+	Rate float64
+	// Series is the number of label sets generated per metric
+	Series             int
+	ResourceAttributes map[string]string
+	// Headers are added to every export, e.g. tenancy headers
+	Headers map[string]string
+	// ListenAddr serves the series for scraping; empty disables it
+	ListenAddr string
+	// ExtraLabels adds label_N labels to every series, each with LabelValues distinct values
+	ExtraLabels   int
+	LabelValues   int
+	ChurnInterval time.Duration
+	// ChurnPercent is the share of series replaced at every churn
+	ChurnPercent float64
+	// CounterResetInterval zeroes cumulative series periodically; 0 disables
+	CounterResetInterval time.Duration
+	// HighCardinality gives every series unique pod and user_id labels and
+	// sizes the set to ActiveSeries instead of Series per metric
+	HighCardinality bool
+	ActiveSeries    int
+	// HistogramBounds are the explicit bucket upper bounds of histograms
+	HistogramBounds  []float64
+	SummaryQuantiles []float64
+	// ValueDist produces the values observed by histograms and summaries
+	ValueDist valueDistribution
+	// ExpHistograms adds an exponential (native) histogram metric
+	ExpHistograms          bool
+	ExpHistogramScale      int
+	ExpHistogramMaxBuckets int
+	// Exemplars links histogram points to sent traces when traces are enabled
+	Exemplars bool
+	// Temporality is cumulative or delta; delta is only supported by OTLP
+	Temporality string
+	// OutOfOrderPercent of pushed samples are timestamped up to
+	// OutOfOrderMaxAge before the newest sample already sent for the series
+	OutOfOrderPercent float64
+	OutOfOrderMaxAge  time.Duration
+	// InfluxToken is sent as "Authorization: Token ..." in place of AUTH_*
+	InfluxToken string
+}
+
+func loadMetricsConfig() MetricsConfig {
+	cfg := MetricsConfig{
+		Endpoint: os.Getenv("METRICS_ENDPOINT"),
+		Method:   http.MethodPost,
+		Format:   getEnvOrDefault("METRICS_FORMAT", metricsFormatOTLP),
+		Rate:     getEnvFloat("METRIC_RATE", 1),
+		Series:   getEnvInt("METRIC_SERIES", 10),
+
+		ListenAddr:    os.Getenv("METRICS_LISTEN_ADDR"),
+		ExtraLabels:   getEnvInt("METRIC_EXTRA_LABELS", 0),
+		LabelValues:   getEnvInt("METRIC_LABEL_VALUES", 10),
+		ChurnInterval: getEnvDuration("METRIC_CHURN_INTERVAL", 0),
+		ChurnPercent:  getEnvFloat("METRIC_CHURN_PERCENT", 100),
+
+		CounterResetInterval: getEnvDuration("METRIC_COUNTER_RESET_INTERVAL", 0),
+
+		HighCardinality: getEnvBool("METRIC_HIGH_CARDINALITY", false),
+		ActiveSeries:    getEnvInt("METRIC_ACTIVE_SERIES", 10000),
+
+		HistogramBounds:  getEnvFloatList("METRIC_HISTOGRAM_BUCKETS", defaultHistogramBounds),
+		SummaryQuantiles: getEnvFloatList("METRIC_SUMMARY_QUANTILES", defaultSummaryQuantiles),
+		ValueDist: loadDistribution("METRIC_VALUE", "", valueDistribution{
+			Kind: distLognormal, Min: 0.1, Max: 0.3, Mean: 0.2, StdDev: 0.15, Alpha: 1.5,
+		}),
+		ExpHistograms:          getEnvBool("METRIC_EXP_HISTOGRAMS", false),
+		ExpHistogramScale:      getEnvInt("METRIC_EXP_HISTOGRAM_SCALE", 8),
+		ExpHistogramMaxBuckets: getEnvInt("METRIC_EXP_HISTOGRAM_MAX_BUCKETS", 160),
+		Exemplars:              getEnvBool("METRIC_EXEMPLARS", true),
+		Temporality:            getEnvOrDefault("METRIC_TEMPORALITY", temporalityCumulative),
+		InfluxToken:            os.Getenv("INFLUX_TOKEN"),
+		OutOfOrderPercent:      getEnvFloat("METRIC_OUT_OF_ORDER_PERCENT", 0),
+		OutOfOrderMaxAge:       getEnvDuration("METRIC_OUT_OF_ORDER_MAX_AGE", time.Minute),
+	}
+
+	if method, err := parseHTTPMethod("METRICS_METHOD", os.Getenv("METRICS_METHOD")); err != nil {
+		configProblem("%v", err)
+	} else {
+		cfg.Method = method
+	}
+
+	attrs, err := parseKeyValueList(getEnvOrDefault("METRIC_RESOURCE_ATTRIBUTES", "service.name=load-gen"))
+	if err != nil {
+		configProblem("METRIC_RESOURCE_ATTRIBUTES is invalid: %v", err)
+	}
+	cfg.ResourceAttributes = attrs
+
+	headers, err := parseKeyValueList(os.Getenv("METRICS_HEADERS"))
+	if err != nil {
+		configProblem("METRICS_HEADERS is invalid: %v", err)
+	}
+	cfg.Headers = headers
+	if tenant := os.Getenv("METRICS_TENANT"); tenant != "" {
+		cfg.Headers["X-Scope-OrgID"] = tenant
+	}
+	return cfg
+}
+
+// metricSet is the collection of series shared by the push generator and
+// the scrape endpoint
+type metricSet struct {
+	mu     sync.Mutex
+	series []*metricSeries
+	// generation increases on every churn so replacement series get new identities
+	generation int
+}
+
+func newMetricSet(now time.Time) *metricSet {
+	m := &metricSet{}
+	defs := metricDefinitions()
+	for _, def := range defs {
+		for n := 0; n < seriesPerMetric(len(defs)); n++ {
+			m.series = append(m.series, newMetricSeries(def, n, 0, now))
+		}
+	}
+	return m
+}
+
+// seriesPerMetric returns how many label sets each of the metrics gets
+func seriesPerMetric(metrics int) int {
+	if metricsConfig.HighCardinality {
+		return (metricsConfig.ActiveSeries + metrics - 1) / metrics
+	}
+	return metricsConfig.Series
+}
+
+// metricDefinitions returns the metrics enabled by the configuration
+func metricDefinitions() []*metricDefinition {
+	defs := make([]*metricDefinition, 0, len(defaultMetrics)+1)
+	for i := range defaultMetrics {
+		defs = append(defs, &defaultMetrics[i])
+	}
+	if metricsConfig.ExpHistograms {
+		defs = append(defs, &expHistogramMetric)
+	}
+	return defs
+}
+
+// newMetricSeries creates the n-th series of a metric
+func newMetricSeries(def *metricDefinition, n, generation int, now time.Time) *metricSeries {
+	methods := []string{"GET", "POST", "PUT", "DELETE"}
+	statuses := []string{"200", "200", "200", "201", "404", "500"}
+
+	labels := []metricLabel{
+		{Name: "service", Value: jobTypes[n%len(jobTypes)]},
+		{Name: "instance", Value: fmt.Sprintf("instance-%d", n)},
+	}
+	if generation > 0 {
+		labels[1].Value = fmt.Sprintf("instance-%d-%d", n, generation)
+	}
+	if def.Kind == metricCounter {
+		labels = append(labels,
+			metricLabel{Name: "method", Value: methods[n%len(methods)]},
+			metricLabel{Name: "status", Value: statuses[n%len(statuses)]})
+	}
+	if metricsConfig.HighCardinality {
+		labels = append(labels,
+			metricLabel{Name: "pod", Value: fmt.Sprintf("%s-%s", labels[0].Value, strings.ToLower(gofakeit.LetterN(10)))},
+			metricLabel{Name: "user_id", Value: gofakeit.UUID()})
+	}
+	for l := 0; l < metricsConfig.ExtraLabels; l++ {
+		labels = append(labels, metricLabel{
+			Name:  fmt.Sprintf("label_%d", l),
+			Value: fmt.Sprintf("value-%d", (n+l)%metricsConfig.LabelValues),
+		})
+	}
+	sort.Slice(labels, func(a, b int) bool { return labels[a].Name < labels[b].Name })
+
+	s := &metricSeries{def: def, labels: labels, startTime: now}
+	if def.Kind == metricHistogram {
+		s.bucketCounts = make([]uint64, len(metricsConfig.HistogramBounds)+1)
+	}
+	if def.Kind == metricExpHistogram {
+		s.exp = newExpHistogram(metricsConfig.ExpHistogramScale, metricsConfig.ExpHistogramMaxBuckets)
+	}
+	if def.Kind == metricGauge {
+		s.value = float64(64+rand.Intn(448)) * 1024 * 1024
+	}
+	return s
+}
+
+// advance moves every series forward by one interval
+func (m *metricSet) advance() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.series {
+		s.advance()
+	}
+}
+
+// resetCounters zeroes every counter, histogram and summary as if the
+// processes behind them restarted; labels are kept so the series continue
+func (m *metricSet) resetCounters(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reset := 0
+	for _, s := range m.series {
+		if s.def.Kind != metricGauge {
+			s.reset(now)
+			reset++
+		}
+	}
+	log.Printf("Reset %d cumulative metric series", reset)
+}
+
+// churn replaces METRIC_CHURN_PERCENT of the series, picked at random, with
+// fresh ones as if those instances were restarted or rolled out
+func (m *metricSet) churn(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	perMetric := seriesPerMetric(len(metricDefinitions()))
+	retire := int(math.Round(float64(len(m.series)) * metricsConfig.ChurnPercent / 100))
+	for _, i := range rand.Perm(len(m.series))[:retire] {
+		m.series[i] = newMetricSeries(m.series[i].def, i%perMetric, m.generation, now)
+	}
+	log.Printf("Churned %d of %d metric series (generation %d)", retire, len(m.series), m.generation)
+}
+
+// encode serializes a consistent view of every series
+func (m *metricSet) encode(enc metricsEncoder, now time.Time) ([]byte, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.series {
+		s.backdated = time.Time{}
+		if !s.lastSent.IsZero() && rand.Float64()*100 < metricsConfig.OutOfOrderPercent {
+			s.backdated = s.lastSent.Add(-time.Duration(1 + rand.Int63n(int64(metricsConfig.OutOfOrderMaxAge))))
+		} else {
+			s.lastSent = now
+		}
+	}
+	data, err := enc.Encode(m.series, now)
+	if metricsConfig.Temporality == temporalityDelta {
+		for _, s := range m.series {
+			s.resetDelta(now)
+		}
+	}
+	return data, len(m.series), err
+}
+
+// sampleTime returns the timestamp of the sample being encoded: now, or an
+// older time when out-of-order injection picked the series
+func (s *metricSeries) sampleTime(now time.Time) time.Time {
+	if !s.backdated.IsZero() {
+		return s.backdated
+	}
+	return now
+}
+
+// resetDelta starts a new delta interval at now. Gauges are left alone and
+// summaries stay cumulative because OTLP summaries have no temporality.
+func (s *metricSeries) resetDelta(now time.Time) {
+	switch s.def.Kind {
+	case metricCounter, metricHistogram, metricExpHistogram:
+		s.reset(now)
+	}
+}
+
+// reset zeroes the accumulated state of a series, starting it over at now
+func (s *metricSeries) reset(now time.Time) {
+	s.startTime = now
+	s.exemplar = nil
+	switch s.def.Kind {
+	case metricCounter:
+		s.value = 0
+	case metricHistogram:
+		s.count, s.sum = 0, 0
+		s.bucketCounts = make([]uint64, len(s.bucketCounts))
+	case metricExpHistogram:
+		s.count, s.sum = 0, 0
+		s.exp = newExpHistogram(metricsConfig.ExpHistogramScale, metricsConfig.ExpHistogramMaxBuckets)
+	case metricSummary:
+		s.count, s.sum = 0, 0
+		s.window, s.windowNext = nil, 0
+	}
+}
+
+// advance moves a series forward by one export interval
+func (s *metricSeries) advance() {
+	switch s.def.Kind {
+	case metricCounter:
+		s.value += float64(rand.Intn(100))
+	case metricGauge:
+		// Random walk of up to 5% per interval
+		s.value *= 1 + (rand.Float64()-0.5)*0.1
+	case metricHistogram, metricSummary, metricExpHistogram:
+		for i := rand.Intn(50); i > 0; i-- {
+			s.observe(metricsConfig.ValueDist.Sample())
+		}
+		if s.def.Kind != metricSummary && metricsConfig.Exemplars && tracesConfig.Enabled {
+			// Observe the duration of a real trace so the exemplar lands in
+			// the bucket that matches it
+			if e, ok := recentTraces.random(); ok {
+				s.observe(e.Value)
+				s.exemplar = &e
+			}
+		}
+	}
+}
+
+// observe records one value into a histogram or summary series
+func (s *metricSeries) observe(v float64) {
+	s.count++
+	s.sum += v
+	if s.def.Kind == metricSummary {
+		if len(s.window) < summaryWindowSize {
+			s.window = append(s.window, v)
+		} else {
+			s.window[s.windowNext] = v
+			s.windowNext = (s.windowNext + 1) % summaryWindowSize
+		}
+		return
+	}
+	if s.exp != nil {
+		s.exp.observe(v)
+		return
+	}
+	i := sort.SearchFloat64s(metricsConfig.HistogramBounds, v)
+	s.bucketCounts[i]++
+}
+
+// quantiles returns the configured quantiles over the recent observations
+func (s *metricSeries) quantiles() []float64 {
+	values := make([]float64, len(metricsConfig.SummaryQuantiles))
+	if len(s.window) == 0 {
+		return values
+	}
+	sorted := append([]float64(nil), s.window...)
+	sort.Float64s(sorted)
+	for i, q := range metricsConfig.SummaryQuantiles {
+		values[i] = sorted[int(q*float64(len(sorted)-1))]
+	}
+	return values
+}
+
+// generateMetrics advances all series every interval and, when an endpoint
+// is configured, exports them until ctx is done
+func generateMetrics(ctx context.Context, wg *sync.WaitGroup, client *http.Client, metrics *metricSet) {
+	defer wg.Done()
+	log.Printf("Starting metrics generation with %d series", len(metrics.series))
+
+	interval := metricRate.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var churnC <-chan time.Time
+	if metricsConfig.ChurnInterval > 0 {
+		churnTicker := time.NewTicker(metricsConfig.ChurnInterval)
+		defer churnTicker.Stop()
+		churnC = churnTicker.C
+	}
+	var resetC <-chan time.Time
+	if metricsConfig.CounterResetInterval > 0 {
+		resetTicker := time.NewTicker(metricsConfig.CounterResetInterval)
+		defer resetTicker.Stop()
+		resetC = resetTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping metrics generation...")
+			return
+		case now := <-churnC:
+			metrics.churn(now)
+		case now := <-resetC:
+			metrics.resetCounters(now)
+		case <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			metrics.advance()
+			if metricsConfig.Endpoint == "" {
+				continue
+			}
+
+			atomic.AddInt64(&metricSendAttempts, 1)
+			if err := sendMetrics(ctx, client, metrics, time.Now()); err != nil {
+				if errors.Is(err, context.Canceled) {
+					log.Println("Stopping metrics generation...")
+					return
+				}
+				atomic.AddInt64(&metricSendErrors, 1)
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					metricRate.OnThrottle()
+					log.Printf("Metrics endpoint throttled, reducing rate to %.2f exports/sec and pausing %v",
+						metricRate.Rate(), throttled.RetryAfter)
+					select {
+					case <-ctx.Done():
+						log.Println("Stopping metrics generation...")
+						return
+					case <-time.After(throttled.RetryAfter):
+					}
+				} else {
+					log.Printf("Failed to send metrics: %v", err)
+				}
+			} else {
+				metricRate.OnSuccess()
+			}
+
+			if next := metricRate.Interval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+// sendMetrics encodes the current state of all series and sends it
+func sendMetrics(ctx context.Context, client *http.Client, metrics *metricSet, now time.Time) error {
+	payload, points, err := metrics.encode(metricsEnc, now)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	if isGRPCEndpoint(metricsConfig.Endpoint) {
+		if err := exportGRPC(ctx, metricsConfig.Endpoint, otlpMetricsExportMethod, payload); err != nil {
+			return fmt.Errorf("failed to send metrics: %w", err)
+		}
+	} else if isBrokerEndpoint(metricsConfig.Endpoint) {
+		if err := publishBroker(ctx, metricsConfig.Endpoint, []brokerMessage{{Value: payload}}); err != nil {
+			return fmt.Errorf("failed to send metrics: %w", err)
+		}
+	} else if err := postMetricsHTTP(ctx, client, payload); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&metricPointsSent, int64(points))
+	atomic.AddInt64(&totalBytesSent, int64(len(payload)))
+	return nil
+}
+
+// postMetricsHTTP sends an encoded export to METRICS_ENDPOINT
+func postMetricsHTTP(ctx context.Context, client *http.Client, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, metricsConfig.Method, metricsConfig.Endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", metricsEnc.ContentType())
+	if extra, ok := metricsEnc.(encoderHeaders); ok {
+		for key, value := range extra.Headers() {
+			req.Header.Set(key, value)
+		}
+	}
+	for key, value := range metricsConfig.Headers {
+		req.Header.Set(key, value)
+	}
+	auth.apply(req)
+	if metricsConfig.InfluxToken != "" {
+		req.Header.Set("Authorization", "Token "+metricsConfig.InfluxToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serveMetrics exposes the metric set on /metrics for scraping until ctx is done
+func serveMetrics(ctx context.Context, wg *sync.WaitGroup, addr string, metrics *metricSet) {
+	defer wg.Done()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// Scrapers that ask for OpenMetrics get it, everyone else gets the
+		// Prometheus text format
+		var enc metricsEncoder = promTextEncoder{}
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			enc = openMetricsEncoder{}
+		}
+		data, points, err := metrics.encode(enc, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", enc.ContentType())
+		w.Write(data)
+		atomic.AddInt64(&metricPointsSent, int64(points))
+		atomic.AddInt64(&totalBytesSent, int64(len(data)))
+	})
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving synthetic metrics on %s/metrics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Metrics server failed: %v", err)
+	}
+}
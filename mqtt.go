@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT is selected per signal by giving its endpoint an mqtt:// (plain text)
+// or mqtts:// (TLS) scheme with the broker and topic, e.g.
+// LOG_ENDPOINT=mqtt://broker:1883/devices/{device}/logs. Every message is
+// published by one of MQTT_DEVICES simulated devices, each a paho MQTT 3.1.1
+// client with a connection and client id of its own, so one process looks
+// like a fleet of small publishers to the broker.
+
+var mqttConfig = struct {
+	// Devices is the number of simulated devices messages are spread over
+	Devices int
+	// QoS is the quality of service of every publish: 0, 1 or 2
+	QoS int
+	// ClientIDPrefix starts the client id of every device, and should differ
+	// between generators sharing a broker
+	ClientIDPrefix string
+}{
+	Devices:        getEnvInt("MQTT_DEVICES", 1),
+	QoS:            getEnvInt("MQTT_QOS", 1),
+	ClientIDPrefix: getEnvOrDefault("MQTT_CLIENT_ID_PREFIX", "load-gen-"+randomHexID(4)),
+}
+
+// mqttKeepAlive is the keep-alive sent to brokers; the client pings idle
+// connections so the broker keeps them open
+const mqttKeepAlive = 60 * time.Second
+
+// validateMQTTConfig checks the MQTT_* settings
+func validateMQTTConfig() {
+	if mqttConfig.Devices < 1 || mqttConfig.Devices > 100000 {
+		configProblem("MQTT_DEVICES=%d must be between 1 and 100000", mqttConfig.Devices)
+	}
+	if mqttConfig.QoS < 0 || mqttConfig.QoS > 2 {
+		configProblem("MQTT_QOS=%d is not supported (use 0, 1 or 2)", mqttConfig.QoS)
+	}
+	if mqttConfig.ClientIDPrefix == "" {
+		configProblem("MQTT_CLIENT_ID_PREFIX must not be empty")
+	}
+}
+
+// isMQTTEndpoint reports whether endpoint selects the MQTT transport
+func isMQTTEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "mqtt://") || strings.HasPrefix(endpoint, "mqtts://")
+}
+
+// validateMQTTEndpoint checks an mqtt:// or mqtts:// endpoint
+func validateMQTTEndpoint(key, endpoint string) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		configProblem("%s=%q is not a valid URL: %v", key, endpoint, err)
+		return
+	}
+	if u.Host == "" {
+		configProblem("%s=%q has no host", key, endpoint)
+	}
+	if topic := strings.TrimPrefix(u.Path, "/"); topic == "" || strings.ContainsAny(topic, "+#") {
+		configProblem("%s=%q must end in a topic without wildcards, e.g. mqtt://broker:1883/devices/{device}/logs", key, endpoint)
+	}
+}
+
+// mqttDeviceName names device i, as {device} is replaced with in topics
+func mqttDeviceName(i int) string {
+	return "device-" + strconv.Itoa(i+1)
+}
+
+// mqttDevices holds the client of each device on each broker, which
+// connects when the device first publishes
+var mqttDevices = struct {
+	sync.Mutex
+	byKey map[string]*mqttDevice
+}{byKey: make(map[string]*mqttDevice)}
+
+// mqttDevice is the client of a device. A connection the broker drops is
+// opened again on the next publish.
+type mqttDevice struct {
+	client mqtt.Client
+
+	mu sync.Mutex
+	// connecting is the token of the latest connection attempt
+	connecting mqtt.Token
+}
+
+// publishMQTT publishes every message from a random device to the topic of
+// endpoint, with {device} replaced with the device's name. Devices publish
+// concurrently.
+func publishMQTT(ctx context.Context, endpoint string, messages []brokerMessage) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT endpoint %q: %w", endpoint, err)
+	}
+	byDevice := make(map[int][]brokerMessage)
+	for _, m := range messages {
+		device := rand.Intn(mqttConfig.Devices)
+		byDevice[device] = append(byDevice[device], m)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(byDevice))
+	for device, deviceMessages := range byDevice {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := publishMQTTDevice(ctx, u, device, deviceMessages); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// publishMQTTDevice publishes messages at MQTT_QOS from device, then waits
+// for the broker to acknowledge them: PUBACK for QoS 1, or PUBREC, PUBREL
+// and PUBCOMP for QoS 2. QoS 0 messages are only written.
+func publishMQTTDevice(ctx context.Context, u *url.URL, device int, messages []brokerMessage) error {
+	name := mqttDeviceName(device)
+	topic := strings.ReplaceAll(strings.TrimPrefix(u.Path, "/"), "{device}", name)
+	d := mqttDeviceFor(u, name)
+	if err := d.connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to %s://%s as %s: %w", u.Scheme, u.Host, name, err)
+	}
+
+	tokens := make([]mqtt.Token, len(messages))
+	for i, m := range messages {
+		tokens[i] = d.client.Publish(topic, byte(mqttConfig.QoS), false, m.Value)
+	}
+	for _, token := range tokens {
+		if err := waitMQTT(ctx, token); err != nil {
+			if !d.client.IsConnectionOpen() {
+				err = fmt.Errorf("broker closed the connection; the device may not be allowed to publish to the topic: %w", err)
+			}
+			return fmt.Errorf("failed to publish to %s as %s: %w", topic, name, err)
+		}
+	}
+	return nil
+}
+
+// mqttDeviceFor returns the client of the device called name on the broker
+// of u. A client id may only be connected once, so signals published by a
+// device share its client, made with the credentials of the first.
+func mqttDeviceFor(u *url.URL, name string) *mqttDevice {
+	key := u.Scheme + "://" + u.Host + "#" + name
+	mqttDevices.Lock()
+	defer mqttDevices.Unlock()
+	if d, ok := mqttDevices.byKey[key]; ok {
+		return d
+	}
+
+	addr, scheme := u.Host, "tcp"
+	if u.Scheme == "mqtts" {
+		scheme = "ssl"
+	}
+	if u.Port() == "" {
+		port := "1883"
+		if u.Scheme == "mqtts" {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(scheme + "://" + addr).
+		SetClientID(mqttConfig.ClientIDPrefix + "-" + name).
+		SetCleanSession(true).
+		SetKeepAlive(mqttKeepAlive).
+		SetConnectTimeout(10 * time.Second).
+		SetWriteTimeout(10 * time.Second).
+		SetAutoReconnect(false).
+		SetOrderMatters(false)
+	if u.User != nil {
+		opts.SetUsername(u.User.Username())
+		if pass, ok := u.User.Password(); ok {
+			opts.SetPassword(pass)
+		}
+	}
+	d := &mqttDevice{client: mqtt.NewClient(opts)}
+	mqttDevices.byKey[key] = d
+	return d
+}
+
+// connect waits until the device is connected, starting a connection
+// attempt unless one is under way
+func (d *mqttDevice) connect(ctx context.Context) error {
+	d.mu.Lock()
+	if d.client.IsConnectionOpen() {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.connecting == nil || mqttTokenDone(d.connecting) {
+		d.connecting = d.client.Connect()
+	}
+	token := d.connecting
+	d.mu.Unlock()
+	return waitMQTT(ctx, token)
+}
+
+// waitMQTT waits for token to complete, or ctx to end
+func waitMQTT(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func mqttTokenDone(token mqtt.Token) bool {
+	select {
+	case <-token.Done():
+		return true
+	default:
+		return false
+	}
+}
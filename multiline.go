@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// stackTraceRecords turns record into an error carrying a Java exception,
+// Python traceback, Go panic or Node.js error with its stack trace. The
+// trace stays in one record with embedded newlines, or with
+// LOG_MULTILINE_SPLIT becomes one record per line, the way a collector
+// tailing the raw log file would first see it.
+func stackTraceRecords(record LogRecord) []LogRecord {
+	t := exceptionTemplates[rand.Intn(len(exceptionTemplates))]
+	message := t.Message()
+	stack := t.Stack(t.Type, message)
+	if strings.HasPrefix(stack, "goroutine ") {
+		stack = "panic: " + t.Type + ": " + message + "\n\n" + stack
+	}
+	record.Level = "error"
+	record.Document = nil
+	if !config.MultilineSplit {
+		record.Log = stack
+		return []LogRecord{record}
+	}
+
+	lines := strings.Split(stack, "\n")
+	records := make([]LogRecord, len(lines))
+	for i, line := range lines {
+		records[i] = record
+		records[i].Log = line
+	}
+	return records
+}
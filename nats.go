@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATS is selected per signal by giving its endpoint a nats:// scheme with
+// the server and subject, e.g. LOG_ENDPOINT=nats://nats:4222/logs.{job}.
+// Publishes go through the nats.go client, which upgrades to TLS when the
+// server requires it and reconnects on its own. With NATS_JETSTREAM, every
+// message waits for the acknowledgement of the stream that stores it.
+
+var natsConfig = struct {
+	JetStream bool
+}{
+	JetStream: getEnvBool("NATS_JETSTREAM", false),
+}
+
+// isNATSEndpoint reports whether endpoint selects the NATS transport
+func isNATSEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "nats://")
+}
+
+// validateNATSEndpoint checks a nats:// endpoint
+func validateNATSEndpoint(key, endpoint string) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		configProblem("%s=%q is not a valid URL: %v", key, endpoint, err)
+		return
+	}
+	if u.Host == "" {
+		configProblem("%s=%q has no host", key, endpoint)
+	}
+	if subject := strings.TrimPrefix(u.Path, "/"); subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		configProblem("%s=%q must end in a subject without whitespace, e.g. nats://nats:4222/logs", key, endpoint)
+	}
+}
+
+// natsConns holds one connection per server and credentials, shared by
+// all signals and subjects
+var natsConns = struct {
+	sync.Mutex
+	byServer map[string]*natsConn
+}{byServer: make(map[string]*natsConn)}
+
+// natsConn is a connection to a NATS server and its JetStream context
+type natsConn struct {
+	nc *nats.Conn
+	js jetstream.JetStream
+}
+
+// publishNATS publishes messages to the subject of endpoint
+func publishNATS(ctx context.Context, endpoint string, messages []brokerMessage) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid NATS endpoint %q: %w", endpoint, err)
+	}
+	subject := strings.TrimPrefix(u.Path, "/")
+	c, err := natsConnFor(u)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if c.js != nil {
+		err = c.publishJetStream(ctx, subject, messages)
+	} else {
+		err = c.publish(ctx, subject, messages)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish to nats://%s/%s: %w", u.Host, subject, err)
+	}
+	return nil
+}
+
+// natsConnFor returns the connection to the server of u, connecting first
+// if there is none. A connection the client gave up reconnecting is
+// replaced.
+func natsConnFor(u *url.URL) (*natsConn, error) {
+	key := u.User.String() + "@" + u.Host
+	natsConns.Lock()
+	c, ok := natsConns.byServer[key]
+	natsConns.Unlock()
+	if ok && !c.nc.IsClosed() {
+		return c, nil
+	}
+
+	c, err := dialNATS(u)
+	if err != nil {
+		return nil, err
+	}
+	natsConns.Lock()
+	defer natsConns.Unlock()
+	// Another generator may have connected in the meantime
+	if existing, ok := natsConns.byServer[key]; ok && !existing.nc.IsClosed() {
+		c.nc.Close()
+		return existing, nil
+	}
+	natsConns.byServer[key] = c
+	return c, nil
+}
+
+// dialNATS connects to the server of u, authenticating with its user and
+// password, or its user as a token
+func dialNATS(u *url.URL) (*natsConn, error) {
+	server := &url.URL{Scheme: "nats", User: u.User, Host: u.Host}
+	nc, err := nats.Connect(server.String(),
+		nats.Name("load-gen"),
+		nats.Timeout(10*time.Second),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats://%s: %w", u.Host, err)
+	}
+	c := &natsConn{nc: nc}
+	if natsConfig.JetStream {
+		if c.js, err = jetstream.New(nc); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("failed to connect to nats://%s: %w", u.Host, err)
+		}
+	}
+	return c, nil
+}
+
+// publish sends messages to subject, then waits for a round trip to the
+// server so they are known to have been processed
+func (c *natsConn) publish(ctx context.Context, subject string, messages []brokerMessage) error {
+	for _, m := range messages {
+		if err := c.nc.Publish(subject, m.Value); err != nil {
+			return err
+		}
+	}
+	return c.nc.FlushWithContext(ctx)
+}
+
+// publishJetStream sends messages to subject without waiting between them,
+// then waits for the stream to acknowledge every one. It returns the first
+// error after all acknowledgements are in.
+func (c *natsConn) publishJetStream(ctx context.Context, subject string, messages []brokerMessage) error {
+	futures := make([]jetstream.PubAckFuture, 0, len(messages))
+	for _, m := range messages {
+		future, err := c.js.PublishAsync(subject, m.Value)
+		if err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+	var firstErr error
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			if firstErr == nil {
+				if errors.Is(err, jetstream.ErrNoStreamResponse) {
+					err = fmt.Errorf("no JetStream stream captures the subject: %w", err)
+				}
+				firstErr = err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openMetricsEncoder renders series in the OpenMetrics 1.0 text format. On
+// top of the Prometheus text format it adds _created samples for counters,
+// histograms and summaries, trace exemplars on histogram buckets and the
+// closing # EOF.
+type openMetricsEncoder struct{}
+
+func (openMetricsEncoder) ContentType() string {
+	return "application/openmetrics-text; version=1.0.0; charset=utf-8"
+}
+
+func (openMetricsEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	var current *metricDefinition
+	for _, s := range series {
+		// Counter families are named without the _total suffix
+		family := s.def.Name
+		if s.def.Kind == metricCounter {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		if s.def != current {
+			current = s.def
+			fmt.Fprintf(&buf, "# HELP %s %s\n", family, openMetricsHelpEscaper.Replace(s.def.Description))
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", family, promTypeName(s.def.Kind))
+		}
+		for _, sample := range promSamples([]*metricSeries{s}) {
+			writePromSample(&buf, sample)
+			if sample.exemplar != nil {
+				writeOpenMetricsExemplar(&buf, sample.exemplar)
+			}
+			buf.WriteByte('\n')
+		}
+		if s.def.Kind != metricGauge {
+			created := promSample{
+				labels: promLabels(family+"_created", s.labels),
+				value:  float64(s.startTime.UnixMilli()) / 1000,
+			}
+			writePromSample(&buf, created)
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteString("# EOF\n")
+	return buf.Bytes(), nil
+}
+
+// writeOpenMetricsExemplar appends ` # {trace_id="...",span_id="..."} value timestamp`
+func writeOpenMetricsExemplar(buf *bytes.Buffer, e *traceExemplar) {
+	fmt.Fprintf(buf, ` # {trace_id="%s",span_id="%s"} %s %s`,
+		promLabelEscaper.Replace(e.TraceID), promLabelEscaper.Replace(e.SpanID),
+		formatPromFloat(e.Value), strconv.FormatFloat(float64(e.Time.UnixMilli())/1000, 'f', 3, 64))
+}
+
+var openMetricsHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
@@ -0,0 +1,51 @@
+package main
+
+import "strconv"
+
+// Shared building blocks of the OTLP/JSON encoding. Field names follow the
+// protobuf JSON mapping used by OTLP/HTTP: lowerCamelCase keys and 64-bit
+// integers encoded as decimal strings.
+
+const otlpScopeName = "github.com/ctrlb-hq/load-gen"
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// otlpString builds a string attribute
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+// otlpUnixNano encodes a nanosecond timestamp the way OTLP/JSON expects
+func otlpUnixNano(nanos int64) string {
+	return strconv.FormatInt(nanos, 10)
+}
+
+// otlpInt builds an integer attribute
+func otlpInt(key string, value int64) otlpKeyValue {
+	v := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &v}}
+}
+
+// otlpBool builds a boolean attribute
+func otlpBool(key string, value bool) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &value}}
+}
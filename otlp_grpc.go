@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// OTLP/gRPC is selected per signal by giving its endpoint a grpc:// (plain
+// text) or grpcs:// (TLS) scheme, e.g. LOG_ENDPOINT=grpc://collector:4317.
+// Payloads are the otlp_proto encodings, sent through a pass-through codec
+// so the generated OTLP service stubs are not needed.
+
+// Full method names of the OTLP collector services
+const (
+	otlpLogsExportMethod    = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpTracesExportMethod  = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	otlpMetricsExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+)
+
+var grpcConfig = loadGRPCConfig()
+
+type GRPCConfig struct {
+	// Keepalive is the interval between HTTP/2 pings on idle connections;
+	// 0 disables them
+	Keepalive time.Duration
+	// Metadata is sent with every RPC, next to the Authorization header
+	Metadata map[string]string
+}
+
+func loadGRPCConfig() GRPCConfig {
+	cfg := GRPCConfig{
+		Keepalive: getEnvDuration("OTLP_GRPC_KEEPALIVE", 30*time.Second),
+		Metadata:  map[string]string{},
+	}
+	if value := getEnvOrDefault("OTLP_GRPC_METADATA", ""); value != "" {
+		metadata, err := parseKeyValueList(value)
+		if err != nil {
+			configProblem("OTLP_GRPC_METADATA=%q is invalid: %v", value, err)
+		} else {
+			cfg.Metadata = metadata
+		}
+	}
+	return cfg
+}
+
+// isGRPCEndpoint reports whether endpoint selects the OTLP/gRPC transport
+func isGRPCEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "grpc" || u.Scheme == "grpcs")
+}
+
+// validateGRPCEndpoint checks a grpc:// endpoint and that the signal is
+// encoded as protobuf, the only payload gRPC can carry. formats lists the
+// accepted formats besides otlp_proto.
+func validateGRPCEndpoint(key, endpoint, formatKey, format string, formats ...string) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		configProblem("%s=%q is not a valid URL: %v", key, endpoint, err)
+		return
+	}
+	if u.Port() == "" {
+		configProblem("%s=%q must include a port, e.g. grpc://collector:4317", key, endpoint)
+	}
+	formats = append([]string{"otlp_proto"}, formats...)
+	if !slices.Contains(formats, format) {
+		configProblem("%s=%q uses gRPC, which requires %s=%s (got %q)",
+			key, endpoint, formatKey, strings.Join(formats, " or "), format)
+	}
+}
+
+// rawCodec passes already encoded protobuf messages through unchanged
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec cannot marshal %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
+
+// grpcConns holds one client connection per endpoint, shared by all signals
+var grpcConns = struct {
+	sync.Mutex
+	byTarget map[string]*grpc.ClientConn
+}{byTarget: make(map[string]*grpc.ClientConn)}
+
+// grpcConn returns the connection for endpoint, creating it on first use.
+// Connections dial lazily and reconnect on their own.
+func grpcConn(endpoint string) (*grpc.ClientConn, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gRPC endpoint %q: %w", endpoint, err)
+	}
+	grpcConns.Lock()
+	defer grpcConns.Unlock()
+	key := u.Scheme + "://" + u.Host
+	if conn, ok := grpcConns.byTarget[key]; ok {
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if u.Scheme == "grpcs" {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})),
+	}
+	if grpcConfig.Keepalive > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                grpcConfig.Keepalive,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}))
+	}
+	conn, err := grpc.NewClient(u.Host, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client for %s: %w", u.Host, err)
+	}
+	grpcConns.byTarget[key] = conn
+	return conn, nil
+}
+
+// exportGRPC sends an encoded OTLP export request. RESOURCE_EXHAUSTED and
+// UNAVAILABLE responses carrying RetryInfo are reported as throttling, as
+// OTLP/gRPC specifies.
+func exportGRPC(ctx context.Context, endpoint, method string, payload []byte) error {
+	conn, err := grpcConn(endpoint)
+	if err != nil {
+		return err
+	}
+
+	pairs := make([]string, 0, 2*len(grpcConfig.Metadata)+2)
+	for key, value := range grpcConfig.Metadata {
+		pairs = append(pairs, key, value)
+	}
+	if header := auth.Header(); header != "" {
+		pairs = append(pairs, "authorization", header)
+	}
+	callCtx, cancel := context.WithTimeout(metadata.AppendToOutgoingContext(ctx, pairs...), 10*time.Second)
+	defer cancel()
+
+	var response []byte
+	err = conn.Invoke(callCtx, method, &payload, &response)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	st := status.Convert(err)
+	if st.Code() == codes.ResourceExhausted || st.Code() == codes.Unavailable {
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.RetryInfo); ok {
+				return &throttledError{RetryAfter: info.GetRetryDelay().AsDuration()}
+			}
+		}
+	}
+	return fmt.Errorf("gRPC export failed: %s: %s", st.Code(), st.Message())
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encoding of the OTLP structures in otlp.go and otlp_traces.go,
+// written with protowire like the remote_write and pprof encoders so the
+// generated OTLP types are not needed. Field numbers follow
+// opentelemetry/proto v1.
+
+// appendOTLPMessage appends an embedded message field
+func appendOTLPMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// appendOTLPString appends a string field, skipping empty values
+func appendOTLPString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendOTLPFixed64 appends a fixed64 timestamp or count given as OTLP/JSON's
+// decimal string
+func appendOTLPFixed64(b []byte, num protowire.Number, value string) ([]byte, error) {
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixed64 %q: %w", value, err)
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v), nil
+}
+
+// appendOTLPID appends a trace or span id given as hex, skipping empty ids
+func appendOTLPID(b []byte, num protowire.Number, id string) ([]byte, error) {
+	if id == "" {
+		return b, nil
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id %q: %w", id, err)
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, raw), nil
+}
+
+func appendOTLPAnyValue(b []byte, v otlpAnyValue) []byte {
+	switch {
+	case v.StringValue != nil:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, *v.StringValue)
+	case v.BoolValue != nil:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(*v.BoolValue))
+	case v.IntValue != nil:
+		n, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(n))
+	case v.DoubleValue != nil:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*v.DoubleValue))
+	}
+	return b
+}
+
+// appendOTLPAttributes appends each attribute as a KeyValue field
+func appendOTLPAttributes(b []byte, num protowire.Number, attrs []otlpKeyValue) []byte {
+	for _, kv := range attrs {
+		var m []byte
+		m = appendOTLPString(m, 1, kv.Key)
+		m = appendOTLPMessage(m, 2, appendOTLPAnyValue(nil, kv.Value))
+		b = appendOTLPMessage(b, num, m)
+	}
+	return b
+}
+
+func appendOTLPResource(b []byte, num protowire.Number, r otlpResource) []byte {
+	return appendOTLPMessage(b, num, appendOTLPAttributes(nil, 1, r.Attributes))
+}
+
+func appendOTLPScope(b []byte, num protowire.Number, s otlpScope) []byte {
+	var m []byte
+	m = appendOTLPString(m, 1, s.Name)
+	m = appendOTLPString(m, 2, s.Version)
+	return appendOTLPMessage(b, num, m)
+}
+
+// encodeOTLPTracesProto serializes an ExportTraceServiceRequest
+func encodeOTLPTracesProto(request otlpTracesRequest) ([]byte, error) {
+	var out []byte
+	for _, rs := range request.ResourceSpans {
+		var r []byte
+		r = appendOTLPResource(r, 1, rs.Resource)
+		for _, ss := range rs.ScopeSpans {
+			var s []byte
+			s = appendOTLPScope(s, 1, ss.Scope)
+			for _, span := range ss.Spans {
+				m, err := encodeOTLPSpanProto(span)
+				if err != nil {
+					return nil, err
+				}
+				s = appendOTLPMessage(s, 2, m)
+			}
+			r = appendOTLPMessage(r, 2, s)
+		}
+		out = appendOTLPMessage(out, 1, r)
+	}
+	return out, nil
+}
+
+func encodeOTLPSpanProto(span otlpSpan) ([]byte, error) {
+	var m []byte
+	var err error
+	if m, err = appendOTLPID(m, 1, span.TraceID); err != nil {
+		return nil, err
+	}
+	if m, err = appendOTLPID(m, 2, span.SpanID); err != nil {
+		return nil, err
+	}
+	m = appendOTLPString(m, 3, span.TraceState)
+	if m, err = appendOTLPID(m, 4, span.ParentSpanID); err != nil {
+		return nil, err
+	}
+	m = appendOTLPString(m, 5, span.Name)
+	m = protowire.AppendTag(m, 6, protowire.VarintType)
+	m = protowire.AppendVarint(m, uint64(span.Kind))
+	if m, err = appendOTLPFixed64(m, 7, span.StartTimeUnixNano); err != nil {
+		return nil, err
+	}
+	if m, err = appendOTLPFixed64(m, 8, span.EndTimeUnixNano); err != nil {
+		return nil, err
+	}
+	m = appendOTLPAttributes(m, 9, span.Attributes)
+	for _, event := range span.Events {
+		var e []byte
+		if e, err = appendOTLPFixed64(e, 1, event.TimeUnixNano); err != nil {
+			return nil, err
+		}
+		e = appendOTLPString(e, 2, event.Name)
+		e = appendOTLPAttributes(e, 3, event.Attributes)
+		m = appendOTLPMessage(m, 11, e)
+	}
+	for _, link := range span.Links {
+		var l []byte
+		if l, err = appendOTLPID(l, 1, link.TraceID); err != nil {
+			return nil, err
+		}
+		if l, err = appendOTLPID(l, 2, link.SpanID); err != nil {
+			return nil, err
+		}
+		l = appendOTLPAttributes(l, 4, link.Attributes)
+		m = appendOTLPMessage(m, 13, l)
+	}
+	var status []byte
+	status = appendOTLPString(status, 2, span.Status.Message)
+	if span.Status.Code != otlpStatusUnset {
+		status = protowire.AppendTag(status, 3, protowire.VarintType)
+		status = protowire.AppendVarint(status, uint64(span.Status.Code))
+	}
+	m = appendOTLPMessage(m, 15, status)
+	if span.Flags != 0 {
+		m = protowire.AppendTag(m, 16, protowire.Fixed32Type)
+		m = protowire.AppendFixed32(m, span.Flags)
+	}
+	return m, nil
+}
+
+// appendOTLPDouble appends a double field
+func appendOTLPDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// appendOTLPPointTimes appends the start_time_unix_nano (2) and
+// time_unix_nano (3) fields shared by every data point type
+func appendOTLPPointTimes(b []byte, start, now string) ([]byte, error) {
+	b, err := appendOTLPFixed64(b, 2, start)
+	if err != nil {
+		return nil, err
+	}
+	return appendOTLPFixed64(b, 3, now)
+}
+
+// encodeOTLPLogsProto serializes an ExportLogsServiceRequest
+func encodeOTLPLogsProto(request otlpLogsRequest) ([]byte, error) {
+	var out []byte
+	for _, rl := range request.ResourceLogs {
+		var r []byte
+		r = appendOTLPResource(r, 1, rl.Resource)
+		for _, sl := range rl.ScopeLogs {
+			var s []byte
+			s = appendOTLPScope(s, 1, sl.Scope)
+			for _, record := range sl.LogRecords {
+				var m []byte
+				var err error
+				if m, err = appendOTLPFixed64(m, 1, record.TimeUnixNano); err != nil {
+					return nil, err
+				}
+				m = protowire.AppendTag(m, 2, protowire.VarintType)
+				m = protowire.AppendVarint(m, uint64(record.SeverityNumber))
+				m = appendOTLPString(m, 3, record.SeverityText)
+				m = appendOTLPMessage(m, 5, appendOTLPAnyValue(nil, record.Body))
+				m = appendOTLPAttributes(m, 6, record.Attributes)
+				if record.Flags != 0 {
+					m = protowire.AppendTag(m, 8, protowire.Fixed32Type)
+					m = protowire.AppendFixed32(m, record.Flags)
+				}
+				if m, err = appendOTLPID(m, 9, record.TraceID); err != nil {
+					return nil, err
+				}
+				if m, err = appendOTLPID(m, 10, record.SpanID); err != nil {
+					return nil, err
+				}
+				if m, err = appendOTLPFixed64(m, 11, record.ObservedTimeUnixNano); err != nil {
+					return nil, err
+				}
+				s = appendOTLPMessage(s, 2, m)
+			}
+			r = appendOTLPMessage(r, 2, s)
+		}
+		out = appendOTLPMessage(out, 1, r)
+	}
+	return out, nil
+}
+
+// encodeOTLPMetricsProto serializes an ExportMetricsServiceRequest
+func encodeOTLPMetricsProto(request otlpMetricsRequest) ([]byte, error) {
+	var out []byte
+	for _, rm := range request.ResourceMetrics {
+		var r []byte
+		r = appendOTLPResource(r, 1, rm.Resource)
+		for _, sm := range rm.ScopeMetrics {
+			var s []byte
+			s = appendOTLPScope(s, 1, sm.Scope)
+			for _, metric := range sm.Metrics {
+				m, err := encodeOTLPMetricProto(metric)
+				if err != nil {
+					return nil, err
+				}
+				s = appendOTLPMessage(s, 2, m)
+			}
+			r = appendOTLPMessage(r, 2, s)
+		}
+		out = appendOTLPMessage(out, 1, r)
+	}
+	return out, nil
+}
+
+func encodeOTLPMetricProto(metric otlpMetric) ([]byte, error) {
+	var m []byte
+	m = appendOTLPString(m, 1, metric.Name)
+	m = appendOTLPString(m, 2, metric.Description)
+	m = appendOTLPString(m, 3, metric.Unit)
+
+	numberPoints := func(points []otlpNumberDataPoint) ([]byte, error) {
+		var data []byte
+		for _, point := range points {
+			p, err := appendOTLPPointTimes(nil, point.StartTimeUnixNano, point.TimeUnixNano)
+			if err != nil {
+				return nil, err
+			}
+			p = appendOTLPDouble(p, 4, point.AsDouble)
+			p = appendOTLPAttributes(p, 7, point.Attributes)
+			data = appendOTLPMessage(data, 1, p)
+		}
+		return data, nil
+	}
+
+	switch {
+	case metric.Gauge != nil:
+		data, err := numberPoints(metric.Gauge.DataPoints)
+		if err != nil {
+			return nil, err
+		}
+		m = appendOTLPMessage(m, 5, data)
+	case metric.Sum != nil:
+		data, err := numberPoints(metric.Sum.DataPoints)
+		if err != nil {
+			return nil, err
+		}
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(metric.Sum.AggregationTemporality))
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, protowire.EncodeBool(metric.Sum.IsMonotonic))
+		m = appendOTLPMessage(m, 7, data)
+	case metric.Histogram != nil:
+		var data []byte
+		for _, point := range metric.Histogram.DataPoints {
+			p, err := appendOTLPPointTimes(nil, point.StartTimeUnixNano, point.TimeUnixNano)
+			if err != nil {
+				return nil, err
+			}
+			if p, err = appendOTLPFixed64(p, 4, point.Count); err != nil {
+				return nil, err
+			}
+			p = appendOTLPDouble(p, 5, point.Sum)
+			var counts []byte
+			for _, count := range point.BucketCounts {
+				v, err := strconv.ParseUint(count, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid bucket count %q: %w", count, err)
+				}
+				counts = protowire.AppendFixed64(counts, v)
+			}
+			p = appendOTLPMessage(p, 6, counts)
+			var bounds []byte
+			for _, bound := range point.ExplicitBounds {
+				bounds = protowire.AppendFixed64(bounds, math.Float64bits(bound))
+			}
+			p = appendOTLPMessage(p, 7, bounds)
+			if p, err = appendOTLPExemplars(p, 8, point.Exemplars); err != nil {
+				return nil, err
+			}
+			p = appendOTLPAttributes(p, 9, point.Attributes)
+			data = appendOTLPMessage(data, 1, p)
+		}
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(metric.Histogram.AggregationTemporality))
+		m = appendOTLPMessage(m, 9, data)
+	case metric.ExponentialHistogram != nil:
+		var data []byte
+		for _, point := range metric.ExponentialHistogram.DataPoints {
+			p := appendOTLPAttributes(nil, 1, point.Attributes)
+			p, err := appendOTLPPointTimes(p, point.StartTimeUnixNano, point.TimeUnixNano)
+			if err != nil {
+				return nil, err
+			}
+			if p, err = appendOTLPFixed64(p, 4, point.Count); err != nil {
+				return nil, err
+			}
+			p = appendOTLPDouble(p, 5, point.Sum)
+			p = protowire.AppendTag(p, 6, protowire.VarintType)
+			p = protowire.AppendVarint(p, protowire.EncodeZigZag(int64(point.Scale)))
+			if p, err = appendOTLPFixed64(p, 7, point.ZeroCount); err != nil {
+				return nil, err
+			}
+			var buckets, counts []byte
+			buckets = protowire.AppendTag(buckets, 1, protowire.VarintType)
+			buckets = protowire.AppendVarint(buckets, protowire.EncodeZigZag(int64(point.Positive.Offset)))
+			for _, count := range point.Positive.BucketCounts {
+				v, err := strconv.ParseUint(count, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid bucket count %q: %w", count, err)
+				}
+				counts = protowire.AppendVarint(counts, v)
+			}
+			buckets = appendOTLPMessage(buckets, 2, counts)
+			p = appendOTLPMessage(p, 8, buckets)
+			if p, err = appendOTLPExemplars(p, 11, point.Exemplars); err != nil {
+				return nil, err
+			}
+			data = appendOTLPMessage(data, 1, p)
+		}
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(metric.ExponentialHistogram.AggregationTemporality))
+		m = appendOTLPMessage(m, 10, data)
+	case metric.Summary != nil:
+		var data []byte
+		for _, point := range metric.Summary.DataPoints {
+			p, err := appendOTLPPointTimes(nil, point.StartTimeUnixNano, point.TimeUnixNano)
+			if err != nil {
+				return nil, err
+			}
+			if p, err = appendOTLPFixed64(p, 4, point.Count); err != nil {
+				return nil, err
+			}
+			p = appendOTLPDouble(p, 5, point.Sum)
+			for _, q := range point.QuantileValues {
+				var v []byte
+				v = appendOTLPDouble(v, 1, q.Quantile)
+				v = appendOTLPDouble(v, 2, q.Value)
+				p = appendOTLPMessage(p, 6, v)
+			}
+			p = appendOTLPAttributes(p, 7, point.Attributes)
+			data = appendOTLPMessage(data, 1, p)
+		}
+		m = appendOTLPMessage(m, 11, data)
+	}
+	return m, nil
+}
+
+// appendOTLPExemplars appends trace exemplars of a histogram data point
+func appendOTLPExemplars(b []byte, num protowire.Number, exemplars []otlpExemplar) ([]byte, error) {
+	for _, exemplar := range exemplars {
+		e, err := appendOTLPFixed64(nil, 2, exemplar.TimeUnixNano)
+		if err != nil {
+			return nil, err
+		}
+		e = appendOTLPDouble(e, 3, exemplar.AsDouble)
+		if e, err = appendOTLPID(e, 4, exemplar.SpanID); err != nil {
+			return nil, err
+		}
+		if e, err = appendOTLPID(e, 5, exemplar.TraceID); err != nil {
+			return nil, err
+		}
+		b = appendOTLPMessage(b, num, e)
+	}
+	return b, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// piiValue is a value seeded into a record, with whether it really is PII;
+// decoys look like PII but aren't, to measure false positives
+type piiValue struct {
+	Type  string
+	Value string
+	PII   bool
+}
+
+// piiKind generates one kind of seeded value and the sentences it appears in
+type piiKind struct {
+	Value     func() string
+	Sentences []string
+	PII       bool
+}
+
+var piiKinds = map[string]piiKind{
+	"email": {
+		Value:     gofakeit.Email,
+		Sentences: []string{"Password reset requested by {v}", "Sending receipt to {v}", "Login failed for user {v}"},
+		PII:       true,
+	},
+	"ssn": {
+		Value:     fakeSSN,
+		Sentences: []string{"Identity check passed for SSN {v}", "Tax form generated for ssn={v}", "KYC verification submitted: {v}"},
+		PII:       true,
+	},
+	"credit_card": {
+		Value:     fakeCardNumber,
+		Sentences: []string{"Charged card {v} for ${amount}", "Payment method {v} added to wallet", "Refund issued to card {v}"},
+		PII:       true,
+	},
+	"phone": {
+		Value:     fakePhoneNumber,
+		Sentences: []string{"SMS verification code sent to {v}", "Callback requested at {v}", "Updated contact phone to {v}"},
+		PII:       true,
+	},
+	// decoy values have the shape of card numbers and SSNs but fail the
+	// Luhn check or use an area number the SSA never issues
+	"decoy": {
+		Value:     fakeDecoy,
+		Sentences: []string{"Order {v} created", "Shipment tracking number {v}", "Ticket {v} escalated"},
+	},
+}
+
+// piiConfig seeds records with PII at known rates
+var piiConfig = struct {
+	// Percent of records seeded with one value of a Types kind
+	Percent float64
+	Types   []weightedName
+	// Manifest is the file every seeded value is written to
+	Manifest string
+}{
+	Percent:  getEnvFloat("LOG_PII_PERCENT", 0),
+	Types:    loadPIITypes(getEnvOrDefault("LOG_PII_TYPES", "email,ssn,credit_card,phone")),
+	Manifest: os.Getenv("LOG_PII_MANIFEST"),
+}
+
+func loadPIITypes(value string) []weightedName {
+	types, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("LOG_PII_TYPES=%q is invalid: %v", value, err)
+		return nil
+	}
+	for _, t := range types {
+		if _, ok := piiKinds[t.Name]; !ok {
+			configProblem("LOG_PII_TYPES=%q is invalid: unknown type %q (use email, ssn, credit_card, phone or decoy)", value, t.Name)
+			return nil
+		}
+	}
+	return types
+}
+
+// seedPII replaces the message of LOG_PII_PERCENT of records with a sentence
+// carrying a value of one of LOG_PII_TYPES
+func seedPII(record *LogRecord) {
+	if piiConfig.Percent <= 0 || piiConfig.Types == nil || rand.Float64()*100 >= piiConfig.Percent {
+		return
+	}
+	name := pickWeighted(piiConfig.Types)
+	kind := piiKinds[name]
+	value := kind.Value()
+	record.Log = strings.NewReplacer(
+		"{v}", value,
+		"{amount}", strconv.FormatFloat(gofakeit.Price(5, 500), 'f', 2, 64),
+	).Replace(kind.Sentences[rand.Intn(len(kind.Sentences))])
+	record.PII = append(record.PII, piiValue{Type: name, Value: value, PII: kind.PII})
+}
+
+// piiManifestEntry is a line of the ground-truth manifest
+type piiManifestEntry struct {
+	Time  string `json:"time"`
+	Job   string `json:"job"`
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	PII   bool   `json:"pii"`
+}
+
+// piiManifest writes LOG_PII_MANIFEST as JSON lines, one per seeded value
+var piiManifest = struct {
+	sync.Mutex
+	w *bufio.Writer
+}{w: createPIIManifest(piiConfig.Manifest)}
+
+// createPIIManifest creates the manifest file, or returns nil when none is
+// configured
+func createPIIManifest(path string) *bufio.Writer {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		configProblem("LOG_PII_MANIFEST: %v", err)
+		return nil
+	}
+	log.Printf("Writing seeded PII to %s", path)
+	return bufio.NewWriter(file)
+}
+
+// writePIIManifest records the seeded values of a batch the endpoint
+// accepted, so failed and canceled batches stay out of the ground truth
+func writePIIManifest(batch []LogRecord) {
+	piiManifest.Lock()
+	defer piiManifest.Unlock()
+	if piiManifest.w == nil {
+		return
+	}
+	enc := json.NewEncoder(piiManifest.w)
+	for _, record := range batch {
+		for _, v := range record.PII {
+			enc.Encode(piiManifestEntry{
+				Time:  record.Time.UTC().Format(time.RFC3339Nano),
+				Job:   record.Job,
+				ID:    record.ID,
+				Type:  v.Type,
+				Value: v.Value,
+				PII:   v.PII,
+			})
+		}
+	}
+	if err := piiManifest.w.Flush(); err != nil {
+		log.Printf("Failed to write LOG_PII_MANIFEST: %v", err)
+	}
+}
+
+// fakeSSN returns a US social security number with a valid area, group and
+// serial, usually written with dashes
+func fakeSSN() string {
+	area := 1 + rand.Intn(899)
+	if area == 666 {
+		area = 667
+	}
+	ssn := fmt.Sprintf("%03d%02d%04d", area, 1+rand.Intn(99), 1+rand.Intn(9999))
+	if rand.Intn(5) == 0 {
+		return ssn
+	}
+	return ssn[:3] + "-" + ssn[3:5] + "-" + ssn[5:]
+}
+
+// fakeCardNumber returns a Luhn-valid Visa, Mastercard, Amex or Discover
+// number, plain or grouped with spaces or dashes
+func fakeCardNumber() string {
+	prefix, length := []string{"4", "51", "55", "34", "37", "6011"}[rand.Intn(6)], 16
+	if prefix == "34" || prefix == "37" {
+		length = 15
+	}
+	digits := prefix
+	for len(digits) < length-1 {
+		digits += strconv.Itoa(rand.Intn(10))
+	}
+	digits += strconv.Itoa(luhnCheckDigit(digits))
+	return groupCardNumber(digits)
+}
+
+// luhnCheckDigit returns the digit that makes number+digit pass the Luhn check
+func luhnCheckDigit(number string) int {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		// Doubled digits are those in odd positions from the check digit
+		if (len(number)-i)%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+func groupCardNumber(digits string) string {
+	sep := []string{"", " ", "-"}[rand.Intn(3)]
+	if sep == "" {
+		return digits
+	}
+	groups := []int{4, 4, 4, 4}
+	if len(digits) == 15 {
+		groups = []int{4, 6, 5}
+	}
+	var parts []string
+	for _, n := range groups {
+		parts = append(parts, digits[:n])
+		digits = digits[n:]
+	}
+	return strings.Join(parts, sep)
+}
+
+// fakePhoneNumber returns a US number in one of its common notations
+func fakePhoneNumber() string {
+	n := fmt.Sprintf("%d%02d%03d%04d", 2+rand.Intn(8), rand.Intn(100), 200+rand.Intn(800), rand.Intn(10000))
+	switch rand.Intn(4) {
+	case 0:
+		return fmt.Sprintf("(%s) %s-%s", n[:3], n[3:6], n[6:])
+	case 1:
+		return fmt.Sprintf("+1-%s-%s-%s", n[:3], n[3:6], n[6:])
+	case 2:
+		return "+1" + n
+	default:
+		return fmt.Sprintf("%s.%s.%s", n[:3], n[3:6], n[6:])
+	}
+}
+
+// fakeDecoy returns a number shaped like PII that isn't: a card number
+// failing the Luhn check or an SSN with area 000, 666 or 9xx
+func fakeDecoy() string {
+	if rand.Intn(2) == 0 {
+		digits := "4"
+		for len(digits) < 15 {
+			digits += strconv.Itoa(rand.Intn(10))
+		}
+		return groupCardNumber(digits + strconv.Itoa((luhnCheckDigit(digits)+1+rand.Intn(9))%10))
+	}
+	area := []string{"000", "666", strconv.Itoa(900 + rand.Intn(100))}[rand.Intn(3)]
+	return fmt.Sprintf("%s-%02d-%04d", area, 1+rand.Intn(99), 1+rand.Intn(9999))
+}
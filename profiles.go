@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Supported entries of PROFILES_TYPES
+const (
+	profileCPU  = "cpu"
+	profileHeap = "heap"
+)
+
+var (
+	profilesSent        int64
+	profileSendAttempts int64
+	profileSendErrors   int64
+
+	profilesConfig = loadProfilesConfig()
+	profileRate    = newRateController(1 / profilesConfig.Interval.Seconds())
+)
+
+type ProfilesConfig struct {
+	// Endpoint receives gzipped pprof profiles and may contain {type},
+	// {from} and {until} placeholders; empty disables profiles
+	Endpoint string
+	Method   string
+	// Interval is the duration covered by each profile, one per type
+	Interval time.Duration
+	Types    []string
+	// Stacks is the number of distinct call stacks sampled per profile
+	Stacks int
+}
+
+func loadProfilesConfig() ProfilesConfig {
+	cfg := ProfilesConfig{
+		Endpoint: os.Getenv("PROFILES_ENDPOINT"),
+		Method:   http.MethodPost,
+		Interval: getEnvDuration("PROFILES_INTERVAL", 10*time.Second),
+		Stacks:   getEnvInt("PROFILES_STACKS", 100),
+	}
+	if method, err := parseHTTPMethod("PROFILES_METHOD", os.Getenv("PROFILES_METHOD")); err != nil {
+		configProblem("%v", err)
+	} else {
+		cfg.Method = method
+	}
+	for _, t := range strings.Split(getEnvOrDefault("PROFILES_TYPES", "cpu,heap"), ",") {
+		t = strings.TrimSpace(t)
+		if t != profileCPU && t != profileHeap {
+			configProblem("PROFILES_TYPES entry %q is not supported (use cpu or heap)", t)
+			continue
+		}
+		cfg.Types = append(cfg.Types, t)
+	}
+	if cfg.Interval <= 0 {
+		configProblem("PROFILES_INTERVAL must be greater than 0 (got %v)", cfg.Interval)
+		// Keep the rate controller finite
+		cfg.Interval = 10 * time.Second
+	}
+	return cfg
+}
+
+// profileFrames are the fake functions that stacks are built from, as
+// package-qualified name and source file
+var profileFrames = [][2]string{
+	{"net/http.(*conn).serve", "net/http/server.go"},
+	{"net/http.serverHandler.ServeHTTP", "net/http/server.go"},
+	{"net/http.(*ServeMux).ServeHTTP", "net/http/server.go"},
+	{"main.(*api).handleOrders", "api/orders.go"},
+	{"main.(*api).handleUsers", "api/users.go"},
+	{"main.(*api).handleSearch", "api/search.go"},
+	{"main.(*store).QueryOrders", "store/orders.go"},
+	{"main.(*store).LoadUser", "store/users.go"},
+	{"main.(*index).Search", "search/index.go"},
+	{"main.(*cache).Get", "cache/cache.go"},
+	{"main.(*cache).Set", "cache/cache.go"},
+	{"database/sql.(*DB).QueryContext", "database/sql/sql.go"},
+	{"database/sql.(*Rows).Next", "database/sql/sql.go"},
+	{"encoding/json.Marshal", "encoding/json/encode.go"},
+	{"encoding/json.Unmarshal", "encoding/json/decode.go"},
+	{"encoding/json.(*encodeState).marshal", "encoding/json/encode.go"},
+	{"compress/gzip.(*Writer).Write", "compress/gzip/gzip.go"},
+	{"crypto/tls.(*Conn).Write", "crypto/tls/conn.go"},
+	{"bytes.(*Buffer).grow", "bytes/buffer.go"},
+	{"strings.(*Builder).WriteString", "strings/builder.go"},
+	{"sort.Slice", "sort/slice.go"},
+	{"regexp.(*Regexp).FindAllString", "regexp/regexp.go"},
+	{"runtime.mallocgc", "runtime/malloc.go"},
+	{"runtime.memmove", "runtime/memmove_amd64.s"},
+	{"runtime.mapassign_faststr", "runtime/map_faststr.go"},
+	{"runtime.gcBgMarkWorker", "runtime/mgc.go"},
+	{"syscall.Syscall", "syscall/syscall_linux.go"},
+}
+
+// profileBuilder accumulates a pprof Profile message. Function and location
+// ids are the 1-based index of the frame in profileFrames.
+type profileBuilder struct {
+	strings map[string]int64
+	table   []string
+	body    []byte
+}
+
+func newProfileBuilder() *profileBuilder {
+	return &profileBuilder{strings: map[string]int64{"": 0}, table: []string{""}}
+}
+
+// str interns s in the string table and returns its index
+func (b *profileBuilder) str(s string) int64 {
+	if i, ok := b.strings[s]; ok {
+		return i
+	}
+	i := int64(len(b.table))
+	b.strings[s] = i
+	b.table = append(b.table, s)
+	return i
+}
+
+// valueType appends a ValueType message as field num
+func (b *profileBuilder) valueType(num protowire.Number, typ, unit string) {
+	var m []byte
+	m = protowire.AppendTag(m, 1, protowire.VarintType)
+	m = protowire.AppendVarint(m, uint64(b.str(typ)))
+	m = protowire.AppendTag(m, 2, protowire.VarintType)
+	m = protowire.AppendVarint(m, uint64(b.str(unit)))
+	b.body = protowire.AppendTag(b.body, num, protowire.BytesType)
+	b.body = protowire.AppendBytes(b.body, m)
+}
+
+// sample appends a Sample with the stack leaf first, as pprof expects
+func (b *profileBuilder) sample(stack []int, values []int64) {
+	var locs, vals, m []byte
+	for i := len(stack) - 1; i >= 0; i-- {
+		locs = protowire.AppendVarint(locs, uint64(stack[i]+1))
+	}
+	for _, v := range values {
+		vals = protowire.AppendVarint(vals, uint64(v))
+	}
+	m = protowire.AppendTag(m, 1, protowire.BytesType)
+	m = protowire.AppendBytes(m, locs)
+	m = protowire.AppendTag(m, 2, protowire.BytesType)
+	m = protowire.AppendBytes(m, vals)
+	b.body = protowire.AppendTag(b.body, 2, protowire.BytesType)
+	b.body = protowire.AppendBytes(b.body, m)
+}
+
+// int64Field appends a varint field
+func (b *profileBuilder) int64Field(num protowire.Number, v int64) {
+	b.body = protowire.AppendTag(b.body, num, protowire.VarintType)
+	b.body = protowire.AppendVarint(b.body, uint64(v))
+}
+
+// finish appends every location, function and the string table and returns
+// the serialized profile
+func (b *profileBuilder) finish() []byte {
+	for i, frame := range profileFrames {
+		id := uint64(i + 1)
+		var line, loc, fn []byte
+		line = protowire.AppendTag(line, 1, protowire.VarintType)
+		line = protowire.AppendVarint(line, id)
+		line = protowire.AppendTag(line, 2, protowire.VarintType)
+		line = protowire.AppendVarint(line, uint64(10+i*7))
+
+		loc = protowire.AppendTag(loc, 1, protowire.VarintType)
+		loc = protowire.AppendVarint(loc, id)
+		loc = protowire.AppendTag(loc, 3, protowire.VarintType)
+		loc = protowire.AppendVarint(loc, 0x401000+id*0x40)
+		loc = protowire.AppendTag(loc, 4, protowire.BytesType)
+		loc = protowire.AppendBytes(loc, line)
+		b.body = protowire.AppendTag(b.body, 4, protowire.BytesType)
+		b.body = protowire.AppendBytes(b.body, loc)
+
+		fn = protowire.AppendTag(fn, 1, protowire.VarintType)
+		fn = protowire.AppendVarint(fn, id)
+		fn = protowire.AppendTag(fn, 2, protowire.VarintType)
+		fn = protowire.AppendVarint(fn, uint64(b.str(frame[0])))
+		fn = protowire.AppendTag(fn, 3, protowire.VarintType)
+		fn = protowire.AppendVarint(fn, uint64(b.str(frame[0])))
+		fn = protowire.AppendTag(fn, 4, protowire.VarintType)
+		fn = protowire.AppendVarint(fn, uint64(b.str(frame[1])))
+		b.body = protowire.AppendTag(b.body, 5, protowire.BytesType)
+		b.body = protowire.AppendBytes(b.body, fn)
+	}
+	for _, s := range b.table {
+		b.body = protowire.AppendTag(b.body, 6, protowire.BytesType)
+		b.body = protowire.AppendString(b.body, s)
+	}
+	return b.body
+}
+
+// randomStack returns frame indexes from the outermost call inwards: an HTTP
+// entry point, a handler and a random chain of library and runtime frames
+func randomStack() []int {
+	stack := []int{0, 1, 2, 3 + rand.Intn(3)}
+	for depth := rand.Intn(6); depth > 0; depth-- {
+		stack = append(stack, 6+rand.Intn(len(profileFrames)-6))
+	}
+	return stack
+}
+
+// buildProfile generates a gzipped pprof profile of the given type covering
+// [start, start+duration)
+func buildProfile(kind string, start time.Time, duration time.Duration) ([]byte, error) {
+	b := newProfileBuilder()
+	switch kind {
+	case profileCPU:
+		const period = int64(10 * time.Millisecond)
+		b.valueType(1, "samples", "count")
+		b.valueType(1, "cpu", "nanoseconds")
+		// Spread roughly one busy core's worth of samples over the stacks
+		limit := max(1, 2*int64(duration)/period/int64(profilesConfig.Stacks))
+		for i := 0; i < profilesConfig.Stacks; i++ {
+			samples := 1 + rand.Int63n(limit)
+			b.sample(randomStack(), []int64{samples, samples * period})
+		}
+		b.valueType(11, "cpu", "nanoseconds")
+		b.int64Field(12, period)
+	case profileHeap:
+		const period = 512 * 1024
+		b.valueType(1, "alloc_objects", "count")
+		b.valueType(1, "alloc_space", "bytes")
+		b.valueType(1, "inuse_objects", "count")
+		b.valueType(1, "inuse_space", "bytes")
+		for i := 0; i < profilesConfig.Stacks; i++ {
+			objects := 1 + rand.Int63n(1000)
+			size := int64(16 << rand.Intn(10))
+			inuse := rand.Int63n(objects + 1)
+			b.sample(randomStack(), []int64{objects, objects * size, inuse, inuse * size})
+		}
+		b.valueType(11, "space", "bytes")
+		b.int64Field(12, period)
+	}
+	b.int64Field(9, start.UnixNano())
+	b.int64Field(10, int64(duration))
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b.finish()); err != nil {
+		return nil, fmt.Errorf("failed to compress profile: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress profile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sendProfiles builds and pushes one profile of each configured type
+func sendProfiles(ctx context.Context, client *http.Client, start, end time.Time) error {
+	for _, kind := range profilesConfig.Types {
+		payload, err := buildProfile(kind, start, end.Sub(start))
+		if err != nil {
+			return err
+		}
+		endpoint := expandEndpoint(profilesConfig.Endpoint, map[string]string{
+			"type":  kind,
+			"from":  strconv.FormatInt(start.Unix(), 10),
+			"until": strconv.FormatInt(end.Unix(), 10),
+		})
+		req, err := http.NewRequestWithContext(ctx, profilesConfig.Method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create HTTP request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		auth.apply(req)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send %s profile: %w", kind, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+		}
+		atomic.AddInt64(&profilesSent, 1)
+		atomic.AddInt64(&totalBytesSent, int64(len(payload)))
+	}
+	return nil
+}
+
+// generateProfiles pushes profiles every interval until ctx is done
+func generateProfiles(ctx context.Context, wg *sync.WaitGroup, client *http.Client) {
+	defer wg.Done()
+	log.Printf("Starting profile generation every %v (%s)", profilesConfig.Interval, strings.Join(profilesConfig.Types, ", "))
+
+	interval := profileRate.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping profile generation...")
+			return
+		case end := <-ticker.C:
+			if paused.Load() {
+				start = end
+				continue
+			}
+			atomic.AddInt64(&profileSendAttempts, 1)
+			err := sendProfiles(ctx, client, start, end)
+			start = end
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					log.Println("Stopping profile generation...")
+					return
+				}
+				atomic.AddInt64(&profileSendErrors, 1)
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					profileRate.OnThrottle()
+					log.Printf("Profiles endpoint throttled, reducing rate to %.2f pushes/sec and pausing %v",
+						profileRate.Rate(), throttled.RetryAfter)
+					select {
+					case <-ctx.Done():
+						log.Println("Stopping profile generation...")
+						return
+					case <-time.After(throttled.RetryAfter):
+					}
+				} else {
+					log.Printf("Failed to send profiles: %v", err)
+				}
+			} else {
+				profileRate.OnSuccess()
+			}
+
+			if next := profileRate.Interval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
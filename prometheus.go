@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const metricsFormatRemoteWrite = "remote_write"
+
+// promSample is one Prometheus sample; labels include __name__ and are sorted
+type promSample struct {
+	labels []metricLabel
+	value  float64
+	// exemplar is set on the histogram bucket holding the series exemplar
+	exemplar *traceExemplar
+}
+
+// promLabels returns the series labels with __name__ (plus an optional
+// extra label such as le) merged in sorted order
+func promLabels(name string, labels []metricLabel, extra ...metricLabel) []metricLabel {
+	merged := make([]metricLabel, 0, len(labels)+len(extra)+1)
+	merged = append(merged, metricLabel{Name: "__name__", Value: name})
+	merged = append(merged, labels...)
+	merged = append(merged, extra...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name < merged[j].Name })
+	return merged
+}
+
+// formatPromFloat renders a float the way Prometheus prints label values such as le
+func formatPromFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// promSamples flattens series into Prometheus samples. Histograms become the
+// usual cumulative _bucket series plus _sum and _count.
+func promSamples(series []*metricSeries) []promSample {
+	var samples []promSample
+	for _, s := range series {
+		switch s.def.Kind {
+		case metricCounter, metricGauge:
+			samples = append(samples, promSample{labels: promLabels(s.def.Name, s.labels), value: s.value})
+		case metricHistogram:
+			exemplarBucket := -1
+			if s.exemplar != nil {
+				exemplarBucket = sort.SearchFloat64s(metricsConfig.HistogramBounds, s.exemplar.Value)
+			}
+			var cumulative uint64
+			for i, count := range s.bucketCounts {
+				cumulative += count
+				sample := promSample{
+					labels: promLabels(s.def.Name+"_bucket", s.labels, metricLabel{Name: "le", Value: histogramLe(i)}),
+					value:  float64(cumulative),
+				}
+				if i == exemplarBucket {
+					sample.exemplar = s.exemplar
+				}
+				samples = append(samples, sample)
+			}
+			samples = append(samples,
+				promSample{labels: promLabels(s.def.Name+"_sum", s.labels), value: s.sum},
+				promSample{labels: promLabels(s.def.Name+"_count", s.labels), value: float64(s.count)})
+		case metricExpHistogram:
+			// The text format cannot carry native buckets; expose the
+			// equivalent classic histogram with a single +Inf bucket
+			samples = append(samples,
+				promSample{labels: promLabels(s.def.Name+"_bucket", s.labels, metricLabel{Name: "le", Value: "+Inf"}), value: float64(s.count)},
+				promSample{labels: promLabels(s.def.Name+"_sum", s.labels), value: s.sum},
+				promSample{labels: promLabels(s.def.Name+"_count", s.labels), value: float64(s.count)})
+		case metricSummary:
+			for i, value := range s.quantiles() {
+				quantile := metricLabel{Name: "quantile", Value: formatPromFloat(metricsConfig.SummaryQuantiles[i])}
+				samples = append(samples, promSample{labels: promLabels(s.def.Name, s.labels, quantile), value: value})
+			}
+			samples = append(samples,
+				promSample{labels: promLabels(s.def.Name+"_sum", s.labels), value: s.sum},
+				promSample{labels: promLabels(s.def.Name+"_count", s.labels), value: float64(s.count)})
+		}
+	}
+	return samples
+}
+
+// histogramLe returns the le label of the i-th explicit bucket
+func histogramLe(i int) string {
+	if i < len(metricsConfig.HistogramBounds) {
+		return formatPromFloat(metricsConfig.HistogramBounds[i])
+	}
+	return "+Inf"
+}
+
+// promMetricType maps a metric kind onto the remote_write MetricMetadata type enum
+func promMetricType(kind metricKind) uint64 {
+	switch kind {
+	case metricCounter:
+		return 1
+	case metricGauge:
+		return 2
+	case metricHistogram, metricExpHistogram:
+		return 3
+	case metricSummary:
+		return 5
+	}
+	return 0
+}
+
+// remoteWriteEncoder sends series as a snappy-compressed Prometheus
+// remote_write (v1) WriteRequest
+type remoteWriteEncoder struct{}
+
+func (remoteWriteEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (remoteWriteEncoder) Headers() map[string]string {
+	return map[string]string{
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
+}
+
+func (remoteWriteEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	// WriteRequest: repeated TimeSeries timeseries = 1; repeated MetricMetadata metadata = 3
+	var request []byte
+	for _, s := range series {
+		timestamp := s.sampleTime(now).UnixMilli()
+		if s.exp != nil {
+			ts := appendRemoteWriteLabels(nil, promLabels(s.def.Name, s.labels))
+			ts = appendNativeHistogram(ts, s.exp, s.count, s.sum, timestamp)
+			if s.exemplar != nil {
+				ts = appendRemoteWriteExemplar(ts, s.exemplar)
+			}
+			request = protowire.AppendTag(request, 1, protowire.BytesType)
+			request = protowire.AppendBytes(request, ts)
+			continue
+		}
+		for _, sample := range promSamples([]*metricSeries{s}) {
+			ts := appendRemoteWriteLabels(nil, sample.labels)
+			var smp []byte
+			smp = protowire.AppendTag(smp, 1, protowire.Fixed64Type)
+			smp = protowire.AppendFixed64(smp, math.Float64bits(sample.value))
+			smp = protowire.AppendTag(smp, 2, protowire.VarintType)
+			smp = protowire.AppendVarint(smp, uint64(timestamp))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, smp)
+			if sample.exemplar != nil {
+				ts = appendRemoteWriteExemplar(ts, sample.exemplar)
+			}
+
+			request = protowire.AppendTag(request, 1, protowire.BytesType)
+			request = protowire.AppendBytes(request, ts)
+		}
+	}
+
+	seen := make(map[*metricDefinition]bool)
+	for _, s := range series {
+		if seen[s.def] {
+			continue
+		}
+		seen[s.def] = true
+		var md []byte
+		md = protowire.AppendTag(md, 1, protowire.VarintType)
+		md = protowire.AppendVarint(md, promMetricType(s.def.Kind))
+		md = protowire.AppendTag(md, 2, protowire.BytesType)
+		md = protowire.AppendString(md, s.def.Name)
+		md = protowire.AppendTag(md, 4, protowire.BytesType)
+		md = protowire.AppendString(md, s.def.Description)
+		md = protowire.AppendTag(md, 5, protowire.BytesType)
+		md = protowire.AppendString(md, s.def.Unit)
+		request = protowire.AppendTag(request, 3, protowire.BytesType)
+		request = protowire.AppendBytes(request, md)
+	}
+
+	return snappy.Encode(nil, request), nil
+}
+
+// appendRemoteWriteLabels appends TimeSeries.labels entries
+func appendRemoteWriteLabels(ts []byte, labels []metricLabel) []byte {
+	for _, label := range labels {
+		var l []byte
+		l = protowire.AppendTag(l, 1, protowire.BytesType)
+		l = protowire.AppendString(l, label.Name)
+		l = protowire.AppendTag(l, 2, protowire.BytesType)
+		l = protowire.AppendString(l, label.Value)
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, l)
+	}
+	return ts
+}
+
+// appendRemoteWriteExemplar appends a TimeSeries.exemplars entry pointing at a trace
+func appendRemoteWriteExemplar(ts []byte, e *traceExemplar) []byte {
+	var ex []byte
+	ex = appendRemoteWriteLabels(ex, []metricLabel{
+		{Name: "span_id", Value: e.SpanID},
+		{Name: "trace_id", Value: e.TraceID},
+	})
+	ex = protowire.AppendTag(ex, 2, protowire.Fixed64Type)
+	ex = protowire.AppendFixed64(ex, math.Float64bits(e.Value))
+	ex = protowire.AppendTag(ex, 3, protowire.VarintType)
+	ex = protowire.AppendVarint(ex, uint64(e.Time.UnixMilli()))
+	ts = protowire.AppendTag(ts, 3, protowire.BytesType)
+	return protowire.AppendBytes(ts, ex)
+}
+
+const metricsFormatPrometheus = "prometheus"
+
+// promTextEncoder renders series in the Prometheus text exposition format
+// (version 0.0.4). It backs the scrape endpoint and can also push to a
+// Pushgateway.
+type promTextEncoder struct{}
+
+func (promTextEncoder) ContentType() string { return "text/plain; version=0.0.4; charset=utf-8" }
+
+func (promTextEncoder) Encode(series []*metricSeries, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	var current *metricDefinition
+	for _, s := range series {
+		if s.def != current {
+			current = s.def
+			fmt.Fprintf(&buf, "# HELP %s %s\n", s.def.Name, escapePromHelp(s.def.Description))
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", s.def.Name, promTypeName(s.def.Kind))
+		}
+		for _, sample := range promSamples([]*metricSeries{s}) {
+			writePromSample(&buf, sample)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// promTypeName returns the exposition format TYPE of a metric kind
+func promTypeName(kind metricKind) string {
+	switch kind {
+	case metricCounter:
+		return "counter"
+	case metricGauge:
+		return "gauge"
+	case metricHistogram, metricExpHistogram:
+		return "histogram"
+	case metricSummary:
+		return "summary"
+	}
+	return "untyped"
+}
+
+// writePromSample writes one `name{labels} value` line without the newline
+func writePromSample(buf *bytes.Buffer, sample promSample) {
+	name := ""
+	first := true
+	for _, label := range sample.labels {
+		if label.Name == "__name__" {
+			name = label.Value
+		}
+	}
+	buf.WriteString(name)
+	for _, label := range sample.labels {
+		if label.Name == "__name__" {
+			continue
+		}
+		if first {
+			buf.WriteByte('{')
+			first = false
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(label.Name)
+		buf.WriteString(`="`)
+		buf.WriteString(promLabelEscaper.Replace(label.Value))
+		buf.WriteByte('"')
+	}
+	if !first {
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatPromFloat(sample.value))
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePromHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// aimdDecreaseFactor is applied to the current rate on every 429
+	aimdDecreaseFactor = 0.5
+	// aimdIncreaseFraction of the target rate is added back on every success
+	aimdIncreaseFraction = 0.05
+	// minRateFraction keeps the rate from collapsing to zero
+	minRateFraction = 0.01
+	// defaultRetryAfter is used when a 429 carries no usable Retry-After
+	defaultRetryAfter = time.Second
+)
+
+// throttledError is returned by senders when the server responds with 429
+type throttledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("server throttled request (retry after %v)", e.RetryAfter)
+}
+
+// parseRetryAfter interprets a Retry-After header given either as
+// delay-seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+// rateController adapts a send rate using AIMD: multiplicative decrease
+// when the server pushes back, additive increase toward the target on success
+type rateController struct {
+	mu      sync.Mutex
+	target  float64
+	current float64
+}
+
+func newRateController(target float64) *rateController {
+	return &rateController{target: target, current: target}
+}
+
+// Rate returns the current send rate in sends per second
+func (rc *rateController) Rate() float64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.current
+}
+
+// Target returns the configured send rate in sends per second
+func (rc *rateController) Target() float64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.target
+}
+
+// Interval returns the delay between sends at the current rate
+func (rc *rateController) Interval() time.Duration {
+	rate := rc.Rate()
+	if rate <= 0 {
+		return time.Second
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+// OnSuccess moves the current rate back toward the target
+func (rc *rateController) OnSuccess() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.current = math.Min(rc.target, rc.current+rc.target*aimdIncreaseFraction)
+}
+
+// OnThrottle cuts the current rate after the server signalled backpressure
+func (rc *rateController) OnThrottle() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.current = math.Max(rc.target*minRateFraction, rc.current*aimdDecreaseFactor)
+}
+
+// rateBudget paces work measured in units, such as spans, to a fixed number
+// of units per second. Callers reserve their units and wait their turn, so
+// a large reservation delays the ones after it.
+type rateBudget struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// newRateBudget returns a budget of rate units per second; 0 is unlimited
+func newRateBudget(rate float64) *rateBudget {
+	return &rateBudget{rate: rate}
+}
+
+// Wait blocks until n units fit the budget or ctx is done
+func (b *rateBudget) Wait(ctx context.Context, n int) error {
+	if b.rate <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	wait := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(float64(n) / b.rate * float64(time.Second)))
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
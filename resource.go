@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+var resourceConfig = loadResourceConfig()
+
+type ResourceConfig struct {
+	// Attributes are added to the resource of every OTLP log, trace and
+	// metric request and override simulated values
+	Attributes map[string]string
+	// Simulate gives every service its own version, host, pod and cloud
+	// attributes
+	Simulate bool
+	// Instances is the number of hosts and pods simulated per service
+	Instances int
+}
+
+func loadResourceConfig() ResourceConfig {
+	cfg := ResourceConfig{
+		Simulate:  getEnvBool("RESOURCE_SIMULATE", false),
+		Instances: getEnvInt("RESOURCE_INSTANCES", 3),
+	}
+	attrs, err := parseKeyValueList(os.Getenv("RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		configProblem("RESOURCE_ATTRIBUTES is invalid: %v", err)
+	}
+	cfg.Attributes = attrs
+	return cfg
+}
+
+// cloudRegions lists a few regions per cloud.provider
+var cloudRegions = map[string][]string{
+	"aws":   {"us-east-1", "us-west-2", "eu-west-1", "ap-southeast-1"},
+	"gcp":   {"us-central1", "europe-west1", "asia-east1"},
+	"azure": {"eastus", "westeurope", "southeastasia"},
+}
+
+// resourceInstance picks the simulated instance that key, such as a trace
+// id, is served by, so every span of a trace agrees on it
+func resourceInstance(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(max(1, resourceConfig.Instances)))
+}
+
+// simulatedResource returns stable attributes for one instance of service.
+// Values are derived from the service name, so they survive restarts.
+func simulatedResource(service string, instance int) map[string]string {
+	h := fnv.New64a()
+	h.Write([]byte(service))
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	providers := []string{"aws", "gcp", "azure"}
+	provider := providers[r.Intn(len(providers))]
+	regions := cloudRegions[provider]
+	replicaSet := fmt.Sprintf("%x", r.Uint32())[:6]
+	// Instances differ in pod, host and zone
+	ri := rand.New(rand.NewSource(int64(h.Sum64()) + int64(instance) + 1))
+	region := regions[r.Intn(len(regions))]
+	pod := fmt.Sprintf("%s-%s-%05x", service, replicaSet, ri.Intn(1<<20))
+	var zone string
+	switch provider {
+	case "aws":
+		zone = fmt.Sprintf("%s%c", region, 'a'+rune(ri.Intn(3)))
+	case "gcp":
+		zone = fmt.Sprintf("%s-%c", region, 'a'+rune(ri.Intn(3)))
+	default:
+		zone = fmt.Sprintf("%s-%d", region, 1+ri.Intn(3))
+	}
+	return map[string]string{
+		"service.version":         fmt.Sprintf("%d.%d.%d", 1+r.Intn(3), r.Intn(20), r.Intn(10)),
+		"service.instance.id":     pod,
+		"deployment.environment":  "production",
+		"host.name":               fmt.Sprintf("node-%s-%02d", region, ri.Intn(40)),
+		"k8s.namespace.name":      "shop",
+		"k8s.deployment.name":     service,
+		"k8s.pod.name":            pod,
+		"cloud.provider":          provider,
+		"cloud.region":            region,
+		"cloud.availability_zone": zone,
+	}
+}
+
+// resourceAttributes returns the sorted resource attributes of service:
+// simulated ones if enabled, then RESOURCE_ATTRIBUTES, then extra
+func resourceAttributes(service string, instance int, extra map[string]string) []otlpKeyValue {
+	attrs := map[string]string{}
+	if service != "" {
+		attrs["service.name"] = service
+	}
+	if resourceConfig.Simulate && service != "" {
+		for key, value := range simulatedResource(service, instance) {
+			attrs[key] = value
+		}
+	}
+	for key, value := range resourceConfig.Attributes {
+		attrs[key] = value
+	}
+	for key, value := range extra {
+		attrs[key] = value
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]otlpKeyValue, len(keys))
+	for i, key := range keys {
+		result[i] = otlpString(key, attrs[key])
+	}
+	return result
+}
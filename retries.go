@@ -0,0 +1,60 @@
+package main
+
+import (
+	"maps"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// retrySpanTypes are the calls a client retries when they fail
+var retrySpanTypes = []string{spanTypeHTTP, spanTypeRPC, spanTypeDB}
+
+// failedAttempts appends one or two failed attempts at the call template
+// describes, made by parent from start, and returns when the attempt that
+// succeeds starts together with the number of failed attempts. Attempts
+// back off exponentially and carry retry.attempt; HTTP client spans also
+// carry http.request.resend_count.
+func failedAttempts(trace *Trace, parent *Span, template Span, paired bool, start int64) (int64, int) {
+	failures := 1 + rand.Intn(2)
+	for n := 1; n <= failures; n++ {
+		attempt := template
+		attempt.SpanID = generateSpanID()
+		attempt.ParentID = parent.SpanID
+		attempt.StartTime = start
+		attempt.Attributes = maps.Clone(template.Attributes)
+		if paired {
+			attempt.ParentID = generateSpanID()
+			attempt.StartTime += networkDelay()
+		}
+		attempt.EndTime = attempt.StartTime + int64(latencyFor(attempt.ServiceName).SampleDuration())
+		markRetry(attempt.Attributes, n)
+		failSpan(&attempt)
+		trace.Spans = append(trace.Spans, attempt)
+
+		end := attempt.EndTime
+		if paired {
+			client := clientSpanFor(attempt, parent.ServiceName, parent.SpanID, start)
+			markRetry(client.Attributes, n)
+			trace.Spans = append(trace.Spans, client)
+			end = client.EndTime
+		}
+		start = end + int64(retryBackoff(n))
+	}
+	return start, failures
+}
+
+// retryBackoff returns the wait before attempt n+1: 50ms doubling with
+// every attempt, with full jitter on the upper half
+func retryBackoff(n int) time.Duration {
+	base := 50 * time.Millisecond << (n - 1)
+	return base/2 + time.Duration(rand.Int63n(int64(base/2)))
+}
+
+// markRetry records that a span is the nth attempt at a call
+func markRetry(attrs map[string]string, n int) {
+	attrs["retry.attempt"] = strconv.Itoa(n)
+	if _, ok := attrs["http.method"]; ok && attrs["span.kind"] == "client" && n > 1 {
+		attrs["http.request.resend_count"] = strconv.Itoa(n - 1)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+var (
+	rumPageViewsSent int64
+	rumSendAttempts  int64
+	rumSendErrors    int64
+
+	rumConfig = loadRUMConfig()
+	rumRate   = newRateController(rumConfig.Rate)
+)
+
+type RUMConfig struct {
+	// Endpoint receives OTLP/JSON traces, one page view per request; empty
+	// disables RUM
+	Endpoint string
+	// Rate is the number of page views per second
+	Rate float64
+	// Sessions is the number of concurrently active browser sessions
+	Sessions int
+	App      string
+	Origin   string
+}
+
+func loadRUMConfig() RUMConfig {
+	return RUMConfig{
+		Endpoint: os.Getenv("RUM_ENDPOINT"),
+		Rate:     getEnvFloat("RUM_RATE", 1),
+		Sessions: getEnvInt("RUM_SESSIONS", 100),
+		App:      getEnvOrDefault("RUM_APP", "web-frontend"),
+		Origin:   getEnvOrDefault("RUM_ORIGIN", "https://shop.example.com"),
+	}
+}
+
+var (
+	rumPages     = []string{"/", "/search", "/product/{id}", "/cart", "/checkout", "/account"}
+	rumResources = []string{"/static/app.js", "/static/vendor.js", "/static/app.css", "/img/hero.webp", "/img/logo.svg", "/fonts/inter.woff2"}
+	rumAPIs      = []string{"/api/products", "/api/cart", "/api/recommendations", "/api/session", "/api/search"}
+)
+
+// rumSession is a simulated browser session
+type rumSession struct {
+	ID        string
+	UserID    string
+	UserAgent string
+	Browser   string
+	Mobile    bool
+	Language  string
+	Geo       clientGeo
+	ClientIP  string
+}
+
+func newRUMSession() *rumSession {
+	s := &rumSession{
+		ID:       randomHexID(16),
+		UserID:   gofakeit.UUID(),
+		Language: gofakeit.LanguageAbbreviation(),
+		ClientIP: randomClientIP(),
+		Mobile:   rand.Intn(3) == 0,
+	}
+	// The location follows the address, unless its network has none
+	if geo := clientGeoOf(s.ClientIP); geo != nil {
+		s.Geo = *geo
+	} else {
+		s.Geo = clientGeos[rand.Intn(len(clientGeos))]
+	}
+	switch rand.Intn(3) {
+	case 0:
+		s.Browser, s.UserAgent = "Chrome", gofakeit.ChromeUserAgent()
+	case 1:
+		s.Browser, s.UserAgent = "Firefox", gofakeit.FirefoxUserAgent()
+	default:
+		s.Browser, s.UserAgent = "Safari", gofakeit.SafariUserAgent()
+	}
+	return s
+}
+
+// rumSessions is the pool of active sessions; sessions end and are replaced
+// at random so session ids keep turning over
+var (
+	rumSessionsMu sync.Mutex
+	rumSessions   []*rumSession
+)
+
+func pickRUMSession() *rumSession {
+	rumSessionsMu.Lock()
+	defer rumSessionsMu.Unlock()
+	if len(rumSessions) < rumConfig.Sessions {
+		s := newRUMSession()
+		rumSessions = append(rumSessions, s)
+		return s
+	}
+	i := rand.Intn(len(rumSessions))
+	if rand.Float64() < 0.05 {
+		rumSessions[i] = newRUMSession()
+	}
+	return rumSessions[i]
+}
+
+// buildPageView returns the spans of one page load: a documentLoad root with
+// documentFetch and resourceFetch children, XHR calls made after load and
+// Core Web Vitals recorded as events on the root
+func buildPageView(session *rumSession, start time.Time) []otlpSpan {
+	traceID := randomHexID(16)
+	page := rumPages[rand.Intn(len(rumPages))]
+	if page == "/product/{id}" {
+		page = "/product/" + strconv.Itoa(1000+rand.Intn(9000))
+	}
+	pageURL := rumConfig.Origin + page
+	at := func(offset time.Duration) string { return otlpUnixNano(start.Add(offset).UnixNano()) }
+	common := []otlpKeyValue{
+		otlpString("session.id", session.ID),
+		otlpString("enduser.id", session.UserID),
+		otlpString("url.full", pageURL),
+	}
+
+	rootID := randomHexID(8)
+	ttfb := time.Duration(50+rand.Intn(400)) * time.Millisecond
+	fetched := ttfb + time.Duration(10+rand.Intn(100))*time.Millisecond
+	spans := []otlpSpan{{
+		TraceID: traceID, SpanID: randomHexID(8), ParentSpanID: rootID,
+		Name: "documentFetch", Kind: otlpSpanKindInternal,
+		StartTimeUnixNano: at(0), EndTimeUnixNano: at(fetched),
+		Attributes: append(common, otlpInt("http.response.status_code", 200)),
+	}}
+
+	// Resources load in parallel after the document arrives
+	loaded := fetched
+	for i := 1 + rand.Intn(len(rumResources)); i > 0; i-- {
+		resource := rumResources[rand.Intn(len(rumResources))]
+		begin := fetched + time.Duration(rand.Intn(50))*time.Millisecond
+		end := begin + time.Duration(20+rand.Intn(600))*time.Millisecond
+		loaded = max(loaded, end)
+		spans = append(spans, otlpSpan{
+			TraceID: traceID, SpanID: randomHexID(8), ParentSpanID: rootID,
+			Name: "resourceFetch", Kind: otlpSpanKindInternal,
+			StartTimeUnixNano: at(begin), EndTimeUnixNano: at(end),
+			Attributes: append(common, otlpString("http.url", rumConfig.Origin+resource)),
+		})
+	}
+
+	// XHR calls made by the page once it is interactive
+	for i := rand.Intn(5); i > 0; i-- {
+		api := rumAPIs[rand.Intn(len(rumAPIs))]
+		begin := loaded + time.Duration(rand.Intn(2000))*time.Millisecond
+		end := begin + latencyDist.SampleDuration()
+		status, code := int64(200), otlpStatusUnset
+		if rand.Intn(20) == 0 {
+			status, code = 500, otlpStatusError
+		}
+		spans = append(spans, otlpSpan{
+			TraceID: traceID, SpanID: randomHexID(8), ParentSpanID: rootID,
+			Name: "HTTP GET", Kind: otlpSpanKindClient,
+			StartTimeUnixNano: at(begin), EndTimeUnixNano: at(end),
+			Attributes: append(common,
+				otlpString("http.request.method", "GET"),
+				otlpString("url.full", rumConfig.Origin+api),
+				otlpInt("http.response.status_code", status)),
+			Status: otlpStatus{Code: code},
+		})
+	}
+
+	lcp := fetched + time.Duration(rand.Intn(int(loaded-fetched)+1))
+	vital := func(name string, value float64, offset time.Duration) otlpSpanEvent {
+		v := value
+		return otlpSpanEvent{TimeUnixNano: at(offset), Name: name, Attributes: []otlpKeyValue{
+			{Key: "value", Value: otlpAnyValue{DoubleValue: &v}},
+		}}
+	}
+	root := otlpSpan{
+		TraceID: traceID, SpanID: rootID,
+		Name: "documentLoad", Kind: otlpSpanKindInternal,
+		StartTimeUnixNano: at(0), EndTimeUnixNano: at(loaded),
+		Attributes: append(common,
+			otlpString("client.address", session.ClientIP),
+			otlpString("geo.country.iso_code", session.Geo.Country),
+			otlpString("geo.region.iso_code", session.Geo.Region),
+			otlpString("geo.locality.name", session.Geo.City),
+			otlpKeyValue{Key: "geo.location.lat", Value: otlpAnyValue{DoubleValue: &session.Geo.Lat}},
+			otlpKeyValue{Key: "geo.location.lon", Value: otlpAnyValue{DoubleValue: &session.Geo.Lon}}),
+		Events: []otlpSpanEvent{
+			vital("TTFB", float64(ttfb.Milliseconds()), ttfb),
+			vital("FCP", float64(fetched.Milliseconds()), fetched),
+			vital("LCP", float64(lcp.Milliseconds()), lcp),
+			vital("INP", float64(20+rand.Intn(480)), loaded),
+			vital("CLS", rand.Float64()*0.3, loaded),
+		},
+	}
+	return append(spans, root)
+}
+
+// sendPageView emits one page view as an OTLP/JSON traces request
+func sendPageView(ctx context.Context, client *http.Client, now time.Time) error {
+	session := pickRUMSession()
+	request := otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			otlpString("service.name", rumConfig.App),
+			otlpString("telemetry.sdk.language", "webjs"),
+			otlpString("browser.name", session.Browser),
+			otlpString("browser.language", session.Language),
+			otlpBool("browser.mobile", session.Mobile),
+			otlpString("user_agent.original", session.UserAgent),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: otlpScopeName},
+			Spans: buildPageView(session, now),
+		}},
+	}}}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal page view: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rumConfig.Endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", session.UserAgent)
+	auth.apply(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send page view: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+	}
+	atomic.AddInt64(&rumPageViewsSent, 1)
+	atomic.AddInt64(&totalBytesSent, int64(len(payload)))
+	return nil
+}
+
+// generateRUM sends page views at RUM_RATE until ctx is done
+func generateRUM(ctx context.Context, wg *sync.WaitGroup, client *http.Client) {
+	defer wg.Done()
+	log.Printf("Starting RUM generation at %.2f page views/sec over %d sessions", rumConfig.Rate, rumConfig.Sessions)
+
+	interval := rumRate.Interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping RUM generation...")
+			return
+		case now := <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			atomic.AddInt64(&rumSendAttempts, 1)
+			if err := sendPageView(ctx, client, now); err != nil {
+				if errors.Is(err, context.Canceled) {
+					log.Println("Stopping RUM generation...")
+					return
+				}
+				atomic.AddInt64(&rumSendErrors, 1)
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					rumRate.OnThrottle()
+					log.Printf("RUM endpoint throttled, reducing rate to %.2f page views/sec and pausing %v",
+						rumRate.Rate(), throttled.RetryAfter)
+					select {
+					case <-ctx.Done():
+						log.Println("Stopping RUM generation...")
+						return
+					case <-time.After(throttled.RetryAfter):
+					}
+				} else {
+					log.Printf("Failed to send page view: %v", err)
+				}
+			} else {
+				rumRate.OnSuccess()
+			}
+
+			if next := rumRate.Interval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
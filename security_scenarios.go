@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attack scenarios injected into the log stream at configured times on top
+// of the background logs, so detection rules and alerting latency can be
+// tested. Each scenario logs when it starts and ends, with the attacker's
+// address, to compare against the time an alert fires.
+
+// Supported SECURITY_SCENARIOS names
+const (
+	scenarioBruteForce   = "brute_force"
+	scenarioSQLInjection = "sql_injection"
+	scenarioPortScan     = "port_scan"
+)
+
+// defaultScenarioDuration is how long a scenario without a duration lasts
+const defaultScenarioDuration = time.Minute
+
+// securityScenario is one scheduled occurrence of an attack
+type securityScenario struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	// Attacker and the Target job stay the same for the whole attack
+	Attacker string
+	Target   string
+	// emitted counts the records logged so far
+	emitted int
+	started bool
+	ended   bool
+}
+
+// securityScenarios are the attacks scheduled by SECURITY_SCENARIOS and the
+// rate, in records per second, at which an active attack logs
+var (
+	securityScenarios    = loadSecurityScenarios(time.Now())
+	securityScenarioRate = getEnvFloat("SECURITY_SCENARIO_RATE", 10)
+	securityScenariosMu  sync.Mutex
+)
+
+// loadSecurityScenarios parses SECURITY_SCENARIOS, a comma-separated list of
+// name@start[/duration] where start is an offset from launch such as 5m or
+// an RFC 3339 time, e.g. "brute_force@5m,port_scan@2026-01-02T15:04:05Z/30s"
+func loadSecurityScenarios(launch time.Time) []*securityScenario {
+	value := os.Getenv("SECURITY_SCENARIOS")
+	if value == "" {
+		return nil
+	}
+	var scenarios []*securityScenario
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		scenario, err := parseSecurityScenario(item, launch)
+		if err != nil {
+			configProblem("SECURITY_SCENARIOS=%q is invalid: %v", value, err)
+			return nil
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios
+}
+
+func parseSecurityScenario(item string, launch time.Time) (*securityScenario, error) {
+	name, schedule, ok := strings.Cut(item, "@")
+	if !ok {
+		return nil, fmt.Errorf("%q is not name@start[/duration]", item)
+	}
+	switch name = strings.TrimSpace(name); name {
+	case scenarioBruteForce, scenarioSQLInjection, scenarioPortScan:
+	default:
+		return nil, fmt.Errorf("unknown scenario %q (use %s, %s or %s)", name, scenarioBruteForce, scenarioSQLInjection, scenarioPortScan)
+	}
+	startText, durationText, hasDuration := strings.Cut(schedule, "/")
+	scenario := &securityScenario{
+		Name:     name,
+		Duration: defaultScenarioDuration,
+		Attacker: randomClientIP(),
+		Target:   randomJob(),
+	}
+	if offset, err := time.ParseDuration(strings.TrimSpace(startText)); err == nil {
+		scenario.Start = launch.Add(offset)
+	} else if start, err := time.Parse(time.RFC3339, strings.TrimSpace(startText)); err == nil {
+		scenario.Start = start
+	} else {
+		return nil, fmt.Errorf("%q: start must be a duration or an RFC 3339 time", item)
+	}
+	if hasDuration {
+		d, err := time.ParseDuration(strings.TrimSpace(durationText))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%q: duration must be positive", item)
+		}
+		scenario.Duration = d
+	}
+	return scenario, nil
+}
+
+// securityScenarioRecords returns the attack records due at now from every
+// active scenario, keeping each at SECURITY_SCENARIO_RATE records per second
+func securityScenarioRecords(now time.Time) []LogRecord {
+	securityScenariosMu.Lock()
+	defer securityScenariosMu.Unlock()
+
+	var records []LogRecord
+	for _, scenario := range securityScenarios {
+		if scenario.ended || now.Before(scenario.Start) {
+			continue
+		}
+		if !scenario.started {
+			scenario.started = true
+			log.Printf("Security scenario %s started from %s", scenario.Name, scenario.Attacker)
+		}
+		end := scenario.Start.Add(scenario.Duration)
+		active := now.Sub(scenario.Start)
+		if now.After(end) {
+			active = scenario.Duration
+		}
+		due := int(active.Seconds() * securityScenarioRate)
+		for ; scenario.emitted < due; scenario.emitted++ {
+			records = append(records, scenario.record(now, scenario.emitted))
+		}
+		if !now.Before(end) {
+			scenario.ended = true
+			if scenario.Name == scenarioBruteForce {
+				records = append(records, scenario.bruteForceSuccess(now))
+			}
+			log.Printf("Security scenario %s ended after %d records", scenario.Name, scenario.emitted)
+		}
+	}
+	return records
+}
+
+// record returns the n-th record of the attack
+func (s *securityScenario) record(now time.Time, n int) LogRecord {
+	record := LogRecord{
+		Level:     "warn",
+		Job:       s.Target,
+		Timestamp: formatLogTimestamp(now),
+		Time:      now,
+	}
+	switch s.Name {
+	case scenarioBruteForce:
+		// Dictionary attacks try root and common service accounts, most of
+		// which don't exist on the host
+		user := []string{"root", "invalid user admin", "invalid user ubuntu", "invalid user test",
+			"invalid user oracle", "postgres", "deploy"}[n%7]
+		record.Job = "sshd"
+		record.Log = fmt.Sprintf("sshd[%d]: Failed password for %s from %s port %s ssh2",
+			1000+rand.Intn(30000), user, s.Attacker, ephemeralPort())
+	case scenarioSQLInjection:
+		style := accessLogNginx
+		if config.LogContent == accessLogApache || config.LogContent == accessLogEnvoy {
+			style = config.LogContent
+		}
+		payload := sqlInjectionPayloads[n%len(sqlInjectionPayloads)]
+		status := []string{"500", "403", "200", "500", "400"}[rand.Intn(5)]
+		writeAccessLog(&record, style, accessLogRequest{
+			ClientIP:   s.Attacker,
+			User:       "-",
+			Method:     "GET",
+			Path:       []string{"/api/v1/products", "/api/v1/search", "/login"}[n%3] + "?id=" + url.QueryEscape(payload),
+			Protocol:   "HTTP/1.1",
+			Status:     status,
+			BytesSent:  200 + rand.Intn(2000),
+			Referer:    "-",
+			UserAgent:  "sqlmap/1.7.2#stable (https://sqlmap.org)",
+			DurationMs: latencyDist.Sample(),
+		})
+	case scenarioPortScan:
+		// A SYN scan of the well-known ports, then the registered ones
+		port := strconv.Itoa(1 + n%65535)
+		e := securityEvent{
+			Vendor: "Cisco", Product: "ASA", Version: "9.16",
+			SignatureID: "106023", Severity: 5,
+			Name: fmt.Sprintf("Deny tcp src outside:%s/%s dst inside:%s/%s by access-group \"outside_access_in\"", s.Attacker, "44321", s.targetIP(), port),
+			Fields: [][2]string{
+				{"src", s.Attacker}, {"spt", "44321"}, {"dst", s.targetIP()}, {"dpt", port},
+				{"proto", "TCP"}, {"act", "Deny"}, {"cs1", "outside_access_in"},
+			},
+		}
+		record.Job = "asa"
+		millis := strconv.FormatInt(now.UnixMilli(), 10)
+		if config.LogContent == logContentLEEF {
+			record.Log = formatLEEF(e, millis)
+		} else {
+			record.Log = formatCEF(e, millis)
+		}
+	}
+	return record
+}
+
+// bruteForceSuccess is the login that ends a brute force attack
+func (s *securityScenario) bruteForceSuccess(now time.Time) LogRecord {
+	return LogRecord{
+		Level:     "info",
+		Job:       "sshd",
+		Timestamp: formatLogTimestamp(now),
+		Time:      now,
+		Log:       fmt.Sprintf("sshd[%d]: Accepted password for deploy from %s port %s ssh2", 1000+rand.Intn(30000), s.Attacker, ephemeralPort()),
+	}
+}
+
+// targetIP is the internal address of the attacked service
+func (s *securityScenario) targetIP() string {
+	return fmt.Sprintf("10.10.0.%d", 10+fnvString(s.Target)%200)
+}
+
+var sqlInjectionPayloads = []string{
+	"1' OR '1'='1",
+	"1' OR 1=1--",
+	"1 UNION SELECT NULL,NULL,NULL--",
+	"1 UNION SELECT username,password FROM users--",
+	"1' AND SLEEP(5)--",
+	"1; DROP TABLE orders--",
+	"1' AND extractvalue(1,concat(0x7e,version()))--",
+	"admin'--",
+}
+
+// formatSecurityScenarios renders the schedule for the effective config
+func formatSecurityScenarios() string {
+	parts := make([]string, len(securityScenarios))
+	for i, s := range securityScenarios {
+		parts[i] = fmt.Sprintf("%s@%s/%s", s.Name, s.Start.UTC().Format(time.RFC3339), s.Duration)
+	}
+	return strings.Join(parts, ",")
+}
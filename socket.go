@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The socket transport is selected by giving LOG_ENDPOINT a udp://, tcp://
+// or tls:// scheme, for the log formats that are not sent over HTTP. TCP and
+// TLS streams carry the encoded batch; UDP sends each record as its own
+// datagrams.
+
+// socketLogFormats are the log formats carried only by the socket transport;
+// lineLogFormats can use it too
+var socketLogFormats = []string{logFormatSyslog, logFormatGELF, logFormatFluentForward}
+
+// datagramLogEncoder is implemented by log encoders that can be sent over UDP
+type datagramLogEncoder interface {
+	logEncoder
+	// Datagrams encodes record as one or more datagrams
+	Datagrams(record LogRecord) ([][]byte, error)
+}
+
+// logHostname is the host name reported by socket log formats
+var logHostname = func() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "-"
+}()
+
+// recordHostname is the host that logged record: its LOG_HOST_METADATA
+// host, or this one
+func recordHostname(record LogRecord) string {
+	if record.logEmitter != nil {
+		return record.HostName
+	}
+	return logHostname
+}
+
+// isSocketEndpoint reports whether endpoint selects the socket transport
+func isSocketEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "udp" || u.Scheme == "tcp" || u.Scheme == "tls")
+}
+
+// validateSocketEndpoint checks a socket endpoint and that logs are encoded
+// in a format it can carry
+func validateSocketEndpoint(key, endpoint string) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		configProblem("%s=%q is not a valid URL: %v", key, endpoint, err)
+		return
+	}
+	if u.Port() == "" {
+		configProblem("%s=%q must include a port, e.g. udp://relay:514", key, endpoint)
+	}
+	if formats := slices.Concat(socketLogFormats, lineLogFormats); !slices.Contains(formats, config.LogFormat) {
+		configProblem("%s=%q uses the socket transport, which requires LOG_FORMAT=%s (got %q)",
+			key, endpoint, strings.Join(formats, ", "), config.LogFormat)
+	} else if _, ok := logEnc.(datagramLogEncoder); !ok && u.Scheme == "udp" {
+		configProblem("%s=%q uses UDP, which LOG_FORMAT=%s cannot be sent over", key, endpoint, config.LogFormat)
+	}
+}
+
+// socketConns holds one connection per endpoint. A stream connection that
+// fails a write is closed and dialled again on the next batch.
+var socketConns = struct {
+	sync.Mutex
+	byTarget map[string]net.Conn
+}{byTarget: make(map[string]net.Conn)}
+
+// socketConn returns the connection for endpoint, dialling it if needed
+func socketConn(ctx context.Context, u *url.URL) (net.Conn, error) {
+	key := u.Scheme + "://" + u.Host
+	if conn, ok := socketConns.byTarget[key]; ok {
+		return conn, nil
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	switch u.Scheme {
+	case "tls":
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", u.Host)
+	default:
+		conn, err = dialer.DialContext(ctx, u.Scheme, u.Host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", key, err)
+	}
+	socketConns.byTarget[key] = conn
+	return conn, nil
+}
+
+// sendSocket sends records to a socket endpoint
+func sendSocket(ctx context.Context, endpoint string, logBatch []LogRecord) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid socket endpoint %q: %w", endpoint, err)
+	}
+	socketConns.Lock()
+	defer socketConns.Unlock()
+	conn, err := socketConn(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	if u.Scheme == "udp" {
+		enc := logEnc.(datagramLogEncoder)
+		for _, record := range logBatch {
+			datagrams, err := enc.Datagrams(record)
+			if err != nil {
+				return fmt.Errorf("failed to marshal log record: %w", err)
+			}
+			for _, datagram := range datagrams {
+				n, err := conn.Write(datagram)
+				if err != nil {
+					return fmt.Errorf("failed to send datagram: %w", err)
+				}
+				sent += n
+			}
+		}
+	} else {
+		var data []byte
+		var ack func(io.Reader) error
+		if enc, ok := logEnc.(ackLogEncoder); ok {
+			data, ack, err = enc.EncodeAcked(logBatch)
+		} else {
+			data, err = logEnc.Encode(logBatch)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to marshal log batch: %w", err)
+		}
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		if sent, err = conn.Write(data); err == nil && ack != nil {
+			err = ack(conn)
+		}
+		if err != nil {
+			conn.Close()
+			delete(socketConns.byTarget, u.Scheme+"://"+u.Host)
+			return fmt.Errorf("failed to write to %s://%s: %w", u.Scheme, u.Host, err)
+		}
+	}
+	countLogsSent(len(logBatch), sent)
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// Kinds of operation a generated span can represent, each with its own
+// OpenTelemetry semantic-convention attributes
+const (
+	spanTypeHTTP      = "http"
+	spanTypeRPC       = "rpc"
+	spanTypeDB        = "db"
+	spanTypeMessaging = "messaging"
+)
+
+// spanTypeWeights picks the type of leaf spans; spans with children handle
+// requests and are always HTTP or RPC servers
+var spanTypeWeights = []weightedName{
+	{Name: spanTypeHTTP, Weight: 3},
+	{Name: spanTypeRPC, Weight: 2},
+	{Name: spanTypeDB, Weight: 3},
+	{Name: spanTypeMessaging, Weight: 1},
+}
+
+var (
+	httpRoutes = []string{
+		"/api/v1/orders", "/api/v1/orders/{id}", "/api/v1/users/{id}", "/api/v1/cart",
+		"/api/v1/products", "/api/v1/products/{id}", "/api/v1/payments", "/api/v1/inventory/{id}",
+	}
+	rpcMethods        = []string{"Get", "List", "Create", "Update", "Delete", "Check", "Reserve"}
+	grpcErrorStatuses = []string{"2", "4", "13", "14"} // UNKNOWN, DEADLINE_EXCEEDED, INTERNAL, UNAVAILABLE
+)
+
+// pickSpanType chooses the type of a span; only leaves may be database or
+// messaging calls
+func pickSpanType(leaf bool) string {
+	if !leaf {
+		if rand.Intn(5) < 3 {
+			return spanTypeHTTP
+		}
+		return spanTypeRPC
+	}
+	return pickWeighted(spanTypeWeights)
+}
+
+// httpServerSpan returns the name and attributes of service handling an
+// HTTP request
+func httpServerSpan(service string) (string, map[string]string) {
+	method := weightedHTTPMethod()
+	route := httpRoutes[rand.Intn(len(httpRoutes))]
+	target := strings.ReplaceAll(route, "{id}", strconv.Itoa(1000+rand.Intn(90000)))
+	return method + " " + route, map[string]string{
+		"span.kind":        "server",
+		"http.method":      method,
+		"http.route":       route,
+		"http.target":      target,
+		"http.scheme":      "http",
+		"http.status_code": strconv.Itoa(successStatus(method)),
+		"net.host.name":    service,
+		"net.host.port":    "8080",
+		"http.user_agent":  gofakeit.UserAgent(),
+	}
+}
+
+// rpcServerSpan returns the name and attributes of service handling a gRPC
+// call to method, or a random method when empty
+func rpcServerSpan(service, method string) (string, map[string]string) {
+	rpcService := rpcServiceName(service)
+	if method == "" {
+		method = rpcMethods[rand.Intn(len(rpcMethods))]
+	}
+	return rpcService + "/" + method, map[string]string{
+		"span.kind":            "server",
+		"rpc.system":           "grpc",
+		"rpc.service":          rpcService,
+		"rpc.method":           method,
+		"rpc.grpc.status_code": "0",
+		"net.host.name":        service,
+		"net.host.port":        "50051",
+	}
+}
+
+// joinSpan returns the span in which parent aggregates the results of
+// calls parallel calls once the last has returned at start
+func joinSpan(parent *Span, name string, calls int, start int64) Span {
+	return Span{
+		TraceID:     parent.TraceID,
+		SpanID:      generateSpanID(),
+		ParentID:    parent.SpanID,
+		Name:        name,
+		StartTime:   start,
+		EndTime:     start + int64(200+rand.Intn(4800))*int64(time.Microsecond),
+		ServiceName: parent.ServiceName,
+		Attributes: map[string]string{
+			"span.kind":       "internal",
+			"fanout.branches": strconv.Itoa(calls),
+		},
+	}
+}
+
+// networkDelay returns the time a request or response spends on the wire
+func networkDelay() int64 {
+	return int64(100+rand.Intn(1900)) * int64(time.Microsecond)
+}
+
+// clientSpanFor returns the caller's side of the request server handled,
+// sent at start. The server span's ParentID must already hold the client
+// span's id and it should start a networkDelay after start. The client span
+// closes after the server span by the network time and reports the same
+// outcome.
+func clientSpanFor(server Span, callerService, callerSpanID string, start int64) Span {
+	attrs := map[string]string{"span.kind": "client", "net.peer.name": server.ServiceName}
+	if _, ok := server.Attributes["rpc.system"]; ok {
+		for _, key := range []string{"rpc.system", "rpc.service", "rpc.method", "rpc.grpc.status_code"} {
+			attrs[key] = server.Attributes[key]
+		}
+		attrs["net.peer.port"] = server.Attributes["net.host.port"]
+	} else {
+		attrs["http.method"] = server.Attributes["http.method"]
+		attrs["http.status_code"] = server.Attributes["http.status_code"]
+		attrs["http.url"] = fmt.Sprintf("http://%s:%s%s", server.ServiceName, server.Attributes["net.host.port"], server.Attributes["http.target"])
+		attrs["net.peer.port"] = server.Attributes["net.host.port"]
+	}
+	if errorType, ok := server.Attributes["error.type"]; ok {
+		attrs["error.type"] = errorType
+	}
+	// HTTP client spans are named by method alone, as the route is unknown
+	// to the caller
+	name := server.Name
+	if method, ok := attrs["http.method"]; ok {
+		name = method
+	}
+	return Span{
+		TraceID:       server.TraceID,
+		SpanID:        server.ParentID,
+		ParentID:      callerSpanID,
+		Name:          name,
+		StartTime:     min(start, server.StartTime),
+		EndTime:       server.EndTime + networkDelay(),
+		ServiceName:   callerService,
+		Attributes:    attrs,
+		Error:         server.Error,
+		StatusMessage: server.StatusMessage,
+	}
+}
+
+// rpcServiceName turns a service such as order-service into a gRPC service
+// name such as order.v1.OrderService
+func rpcServiceName(service string) string {
+	base := strings.TrimSuffix(service, "-service")
+	var camel strings.Builder
+	for _, part := range strings.FieldsFunc(base, func(r rune) bool { return r == '-' || r == '_' }) {
+		camel.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return strings.ReplaceAll(base, "-", "") + ".v1." + camel.String() + "Service"
+}
+
+// weightedHTTPMethod favours reads, as real traffic does
+func weightedHTTPMethod() string {
+	switch r := rand.Intn(10); {
+	case r < 6:
+		return "GET"
+	case r < 8:
+		return "POST"
+	case r < 9:
+		return "PUT"
+	}
+	return "DELETE"
+}
+
+func successStatus(method string) int {
+	switch method {
+	case "POST":
+		return 201
+	case "DELETE":
+		return 204
+	}
+	return 200
+}
+
+// markFailedStatus makes the protocol status of a failed span agree with
+// its error
+func markFailedStatus(attrs map[string]string) {
+	if _, ok := attrs["http.status_code"]; ok {
+		attrs["http.status_code"] = []string{"500", "502", "503", "504"}[rand.Intn(4)]
+	}
+	if _, ok := attrs["rpc.grpc.status_code"]; ok {
+		attrs["rpc.grpc.status_code"] = grpcErrorStatuses[rand.Intn(len(grpcErrorStatuses))]
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counters shared by the generators. They are only ever touched with
+// atomic operations so the reporter can read them without locking. Each
+// generator counts an attempt for every batch, trace, export, packet, event
+// or push it sends and an error for every one that fails, so error rates
+// compare the same units; a batch split for MAX_PAYLOAD_BYTES is one attempt.
+var (
+	logRecordsSent    int64
+	logBatchesSent    int64
+	logSendAttempts   int64
+	logSendErrors     int64
+	tracesSent        int64
+	traceSendAttempts int64
+	traceSendErrors   int64
+
+	statsInterval = getEnvDuration("STATS_INTERVAL", 10*time.Second)
+)
+
+// statsSnapshot is a point-in-time copy of the counters
+type statsSnapshot struct {
+	at              time.Time
+	records         int64
+	batches         int64
+	bytes           int64
+	logAttempts     int64
+	logErrors       int64
+	traces          int64
+	traceAttempts   int64
+	traceErrors     int64
+	metricPoints    int64
+	metricAttempts  int64
+	metricErrors    int64
+	statsd          int64
+	statsdAttempts  int64
+	statsdErrors    int64
+	profiles        int64
+	profileAttempts int64
+	profileErrs     int64
+	events          int64
+	eventAttempts   int64
+	eventErrors     int64
+	pageViews       int64
+	rumAttempts     int64
+	rumErrors       int64
+	checks          int64
+	checkAttempts   int64
+	checkErrors     int64
+}
+
+func takeStatsSnapshot() statsSnapshot {
+	return statsSnapshot{
+		at:              time.Now(),
+		records:         atomic.LoadInt64(&logRecordsSent),
+		batches:         atomic.LoadInt64(&logBatchesSent),
+		bytes:           atomic.LoadInt64(&totalBytesSent),
+		logAttempts:     atomic.LoadInt64(&logSendAttempts),
+		logErrors:       atomic.LoadInt64(&logSendErrors),
+		traces:          atomic.LoadInt64(&tracesSent),
+		traceAttempts:   atomic.LoadInt64(&traceSendAttempts),
+		traceErrors:     atomic.LoadInt64(&traceSendErrors),
+		metricPoints:    atomic.LoadInt64(&metricPointsSent),
+		metricAttempts:  atomic.LoadInt64(&metricSendAttempts),
+		metricErrors:    atomic.LoadInt64(&metricSendErrors),
+		statsd:          atomic.LoadInt64(&statsdPacketsSent),
+		statsdAttempts:  atomic.LoadInt64(&statsdSendAttempts),
+		statsdErrors:    atomic.LoadInt64(&statsdSendErrors),
+		profiles:        atomic.LoadInt64(&profilesSent),
+		profileAttempts: atomic.LoadInt64(&profileSendAttempts),
+		profileErrs:     atomic.LoadInt64(&profileSendErrors),
+		events:          atomic.LoadInt64(&k8sEventsSent),
+		eventAttempts:   atomic.LoadInt64(&k8sEventsSendAttempts),
+		eventErrors:     atomic.LoadInt64(&k8sEventsSendErrors),
+		pageViews:       atomic.LoadInt64(&rumPageViewsSent),
+		rumAttempts:     atomic.LoadInt64(&rumSendAttempts),
+		rumErrors:       atomic.LoadInt64(&rumSendErrors),
+		checks:          atomic.LoadInt64(&checkResultsSent),
+		checkAttempts:   atomic.LoadInt64(&checkSendAttempts),
+		checkErrors:     atomic.LoadInt64(&checkSendErrors),
+	}
+}
+
+// errorRate returns failed attempts as a percentage of all attempts
+func errorRate(failed, attempts int64) float64 {
+	if attempts > 0 {
+		return float64(failed) / float64(attempts) * 100
+	}
+	return 0
+}
+
+// logStatsDelta prints throughput between two snapshots alongside cumulative
+// totals, for the logs and whichever other signals are enabled
+func logStatsDelta(label string, prev, cur statsSnapshot) {
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	parts := []string{fmt.Sprintf("%.2f records/sec, batches=%d (total %d), bytes=%d (total %d), error rate=%.2f%%",
+		float64(cur.records-prev.records)/elapsed,
+		cur.batches-prev.batches, cur.batches,
+		cur.bytes-prev.bytes, cur.bytes,
+		errorRate(cur.logErrors-prev.logErrors, cur.logAttempts-prev.logAttempts))}
+	if tracesConfig.Enabled {
+		parts = append(parts, fmt.Sprintf("traces=%d (total %d), trace error rate=%.2f%%",
+			cur.traces-prev.traces, cur.traces,
+			errorRate(cur.traceErrors-prev.traceErrors, cur.traceAttempts-prev.traceAttempts)))
+	}
+	if metricsConfig.Endpoint != "" || metricsConfig.ListenAddr != "" || graphiteConfig.Addr != "" {
+		parts = append(parts, fmt.Sprintf("metric points=%d (total %d), metric error rate=%.2f%%",
+			cur.metricPoints-prev.metricPoints, cur.metricPoints,
+			errorRate(cur.metricErrors-prev.metricErrors, cur.metricAttempts-prev.metricAttempts)))
+	}
+	if statsdConfig.Addr != "" {
+		parts = append(parts, fmt.Sprintf("statsd packets=%d (total %d), statsd error rate=%.2f%%",
+			cur.statsd-prev.statsd, cur.statsd,
+			errorRate(cur.statsdErrors-prev.statsdErrors, cur.statsdAttempts-prev.statsdAttempts)))
+	}
+	if profilesConfig.Endpoint != "" {
+		parts = append(parts, fmt.Sprintf("profiles=%d (total %d), profile error rate=%.2f%%",
+			cur.profiles-prev.profiles, cur.profiles,
+			errorRate(cur.profileErrs-prev.profileErrs, cur.profileAttempts-prev.profileAttempts)))
+	}
+	if k8sEventsConfig.Endpoint != "" {
+		parts = append(parts, fmt.Sprintf("k8s events=%d (total %d), k8s event error rate=%.2f%%",
+			cur.events-prev.events, cur.events,
+			errorRate(cur.eventErrors-prev.eventErrors, cur.eventAttempts-prev.eventAttempts)))
+	}
+	if rumConfig.Endpoint != "" {
+		parts = append(parts, fmt.Sprintf("page views=%d (total %d), RUM error rate=%.2f%%",
+			cur.pageViews-prev.pageViews, cur.pageViews,
+			errorRate(cur.rumErrors-prev.rumErrors, cur.rumAttempts-prev.rumAttempts)))
+	}
+	if checksConfig.Endpoint != "" {
+		parts = append(parts, fmt.Sprintf("check results=%d (total %d), check error rate=%.2f%%",
+			cur.checks-prev.checks, cur.checks,
+			errorRate(cur.checkErrors-prev.checkErrors, cur.checkAttempts-prev.checkAttempts)))
+	}
+	log.Printf("%s: %s", label, strings.Join(parts, ", "))
+}
+
+// startStatsReporter logs a throughput summary every interval until ctx is done
+func startStatsReporter(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) {
+	defer wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := takeStatsSnapshot()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cur := takeStatsSnapshot()
+			logStatsDelta("Stats", prev, cur)
+			prev = cur
+		}
+	}
+}
+
+// logFinalStats prints a summary covering the whole run
+func logFinalStats(start time.Time) {
+	logStatsDelta("Final stats", statsSnapshot{at: start}, takeStatsSnapshot())
+}
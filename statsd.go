@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Supported values for STATSD_FLAVOR
+const (
+	statsdPlain = "statsd"
+	statsdDog   = "dogstatsd"
+)
+
+var (
+	statsdPacketsSent  int64
+	statsdSendAttempts int64
+	statsdSendErrors   int64
+
+	statsdConfig = loadStatsdConfig()
+)
+
+type StatsdConfig struct {
+	// Addr is the host:port of the UDP listener; empty disables StatsD
+	Addr string
+	// Flavor is statsd, or dogstatsd to add |#tags to every line
+	Flavor string
+	Prefix string
+	// Rate is the number of packets per second
+	Rate float64
+	// LinesPerPacket is how many metric lines share a datagram
+	LinesPerPacket int
+}
+
+func loadStatsdConfig() StatsdConfig {
+	return StatsdConfig{
+		Addr:           os.Getenv("STATSD_ADDR"),
+		Flavor:         getEnvOrDefault("STATSD_FLAVOR", statsdPlain),
+		Prefix:         getEnvOrDefault("STATSD_PREFIX", "loadgen."),
+		Rate:           getEnvFloat("STATSD_RATE", 100),
+		LinesPerPacket: getEnvInt("STATSD_LINES_PER_PACKET", 10),
+	}
+}
+
+// statsdTick is how often the emitter wakes up to send the packets it owes
+const statsdTick = 10 * time.Millisecond
+
+// generateStatsd sends StatsD packets to the configured address until ctx is done
+func generateStatsd(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	conn, err := net.Dial("udp", statsdConfig.Addr)
+	if err != nil {
+		log.Printf("Failed to open StatsD socket: %v", err)
+		return
+	}
+	defer conn.Close()
+	log.Printf("Starting %s generation to %s at %.2f packets/sec", statsdConfig.Flavor, statsdConfig.Addr, statsdConfig.Rate)
+
+	ticker := time.NewTicker(statsdTick)
+	defer ticker.Stop()
+
+	// owed accumulates fractional packets so low rates still send
+	var owed float64
+	var packet bytes.Buffer
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping StatsD generation...")
+			return
+		case <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			owed += statsdConfig.Rate * statsdTick.Seconds()
+			for ; owed >= 1; owed-- {
+				packet.Reset()
+				for i := 0; i < statsdConfig.LinesPerPacket; i++ {
+					if i > 0 {
+						packet.WriteByte('\n')
+					}
+					writeStatsdLine(&packet)
+				}
+				atomic.AddInt64(&statsdSendAttempts, 1)
+				if _, err := conn.Write(packet.Bytes()); err != nil {
+					// UDP errors (usually ICMP port unreachable) repeat for
+					// every packet, so only the first one is logged
+					if atomic.AddInt64(&statsdSendErrors, 1) == 1 {
+						log.Printf("Failed to send StatsD packet: %v", err)
+					}
+					continue
+				}
+				atomic.AddInt64(&statsdPacketsSent, 1)
+				atomic.AddInt64(&totalBytesSent, int64(packet.Len()))
+			}
+		}
+	}
+}
+
+// writeStatsdLine appends one random counter, gauge or timer line
+func writeStatsdLine(buf *bytes.Buffer) {
+	service := randomJob()
+	methods := []string{"GET", "POST", "PUT", "DELETE"}
+	statuses := []string{"200", "200", "200", "201", "404", "500"}
+
+	var name, value, kind string
+	tags := []string{"service:" + service}
+	switch rand.Intn(3) {
+	case 0:
+		name, value, kind = "http.requests", "1", "c"
+		tags = append(tags,
+			"method:"+methods[rand.Intn(len(methods))],
+			"status:"+statuses[rand.Intn(len(statuses))])
+	case 1:
+		name, value, kind = "process.memory.bytes", strconv.Itoa((64+rand.Intn(448))*1024*1024), "g"
+	default:
+		name, kind = "http.request.duration", "ms"
+		value = strconv.FormatFloat(latencyDist.Sample(), 'f', 2, 64)
+	}
+
+	if statsdConfig.Flavor == statsdDog {
+		fmt.Fprintf(buf, "%s%s:%s|%s|#%s", statsdConfig.Prefix, name, value, kind, strings.Join(tags, ","))
+		return
+	}
+	// Plain StatsD has no tags, so the service becomes part of the name
+	fmt.Fprintf(buf, "%s%s.%s:%s|%s", statsdConfig.Prefix, service, name, value, kind)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Syslog messages are sent over the socket transport. UDP sends one message
+// per datagram (RFC 5426); TCP and TLS streams frame messages per
+// SYSLOG_FRAMING (RFC 6587).
+
+const logFormatSyslog = "syslog"
+
+// Supported values for SYSLOG_RFC
+const (
+	syslogRFC5424 = "5424"
+	syslogRFC3164 = "3164"
+)
+
+// Supported values for SYSLOG_FRAMING
+const (
+	syslogFramingOctet   = "octet"
+	syslogFramingNewline = "newline"
+)
+
+// syslogFacilities maps facility names onto their codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverities maps severity names onto their codes
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// syslogLevelSeverities maps our levels onto syslog severities
+var syslogLevelSeverities = map[string]int{
+	"trace": 7,
+	"debug": 7,
+	"info":  6,
+	"warn":  4,
+	"error": 3,
+	"fatal": 2,
+}
+
+var syslogConfig = loadSyslogConfig()
+
+type SyslogConfig struct {
+	// RFC is the message format, 5424 or 3164
+	RFC string
+	// Framing separates messages on TCP and TLS streams
+	Framing  string
+	Facility int
+	// Severity overrides the severity derived from the level; -1 keeps it
+	Severity int
+}
+
+func loadSyslogConfig() SyslogConfig {
+	cfg := SyslogConfig{
+		RFC:      getEnvOrDefault("SYSLOG_RFC", syslogRFC5424),
+		Framing:  getEnvOrDefault("SYSLOG_FRAMING", syslogFramingOctet),
+		Severity: -1,
+	}
+
+	facility := getEnvOrDefault("SYSLOG_FACILITY", "local0")
+	if code, ok := syslogFacilities[facility]; ok {
+		cfg.Facility = code
+	} else if code, err := strconv.Atoi(facility); err == nil && code >= 0 && code <= 23 {
+		cfg.Facility = code
+	} else {
+		configProblem("SYSLOG_FACILITY=%q is not a facility name or a code from 0 to 23", facility)
+	}
+
+	if severity := os.Getenv("SYSLOG_SEVERITY"); severity != "" {
+		if code, ok := syslogSeverities[severity]; ok {
+			cfg.Severity = code
+		} else if code, err := strconv.Atoi(severity); err == nil && code >= 0 && code <= 7 {
+			cfg.Severity = code
+		} else {
+			configProblem("SYSLOG_SEVERITY=%q is not a severity name or a code from 0 to 7", severity)
+		}
+	}
+	return cfg
+}
+
+// syslogFacilityName returns the name of a facility code, or the code itself
+func syslogFacilityName(code int) string {
+	for name, c := range syslogFacilities {
+		if c == code {
+			return name
+		}
+	}
+	return strconv.Itoa(code)
+}
+
+// syslogSeverityName returns the name of a severity code, or "level" when
+// severities follow the record level
+func syslogSeverityName(code int) string {
+	for name, c := range syslogSeverities {
+		if c == code {
+			return name
+		}
+	}
+	return "level"
+}
+
+// syslogMessage formats record as a single syslog message without framing
+func syslogMessage(record LogRecord) []byte {
+	severity := syslogConfig.Severity
+	if severity < 0 {
+		severity = syslogLevelSeverities[baseLogLevel(record.Level)]
+	}
+	pri := syslogConfig.Facility*8 + severity
+
+	var buf bytes.Buffer
+	if syslogConfig.RFC == syslogRFC3164 {
+		fmt.Fprintf(&buf, "<%d>%s %s %s: %s", pri, record.Time.Format(time.Stamp),
+			recordHostname(record), record.Job, record.Log)
+		return buf.Bytes()
+	}
+
+	sd := "-"
+	if record.TraceID != "" {
+		sd = fmt.Sprintf(`[trace@32473 trace_id="%s" span_id="%s"]`, record.TraceID, record.SpanID)
+	}
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s - - %s %s", pri, record.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		recordHostname(record), record.Job, sd, record.Log)
+	return buf.Bytes()
+}
+
+// syslogLogEncoder sends records as a stream of framed syslog messages
+type syslogLogEncoder struct{}
+
+func (syslogLogEncoder) ContentType() string { return "text/plain" }
+
+func (syslogLogEncoder) Datagrams(record LogRecord) ([][]byte, error) {
+	return [][]byte{syslogMessage(record)}, nil
+}
+
+func (syslogLogEncoder) EncodeRecord(record LogRecord) ([]byte, error) {
+	return syslogMessage(record), nil
+}
+
+func (syslogLogEncoder) Encode(batch []LogRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range batch {
+		message := syslogMessage(record)
+		if syslogConfig.Framing == syslogFramingOctet {
+			buf.WriteString(strconv.Itoa(len(message)))
+			buf.WriteByte(' ')
+			buf.Write(message)
+		} else {
+			buf.Write(message)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
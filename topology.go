@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// traceTopology is the call graph read from TRACE_TOPOLOGY_FILE, or nil
+// when traces use the flat SERVICE_NAMES list
+var traceTopology = loadTraceSetting(func() *topology {
+	return loadTopology(os.Getenv("TRACE_TOPOLOGY_FILE"))
+})
+
+// topology describes which services call which. A trace starts at one of
+// the entrypoints and follows the calls of every service it reaches.
+//
+//	entrypoints: [frontend]
+//	services:
+//	  frontend:
+//	    operations: ["GET /", "POST /checkout"]
+//	    latency_ms: 15
+//	    calls:
+//	      - service: cart
+//	        operation: GetCart
+//	      - service: recommendations
+//	        probability: 0.5
+//	  cart:
+//	    latency_ms: 5
+//	    error_percent: 1
+//	  recommendations:
+//	    parallel: true
+//	    join: merge results
+//	    calls: [{service: catalog}, {service: ratings}]
+type topology struct {
+	// Entrypoints default to every service no other service calls
+	Entrypoints []string                    `yaml:"entrypoints"`
+	Services    map[string]*topologyService `yaml:"services"`
+}
+
+type topologyService struct {
+	// Operations names the spans of a service when it is an entrypoint or
+	// its caller does not name the operation
+	Operations []string `yaml:"operations"`
+	// LatencyMs is the typical time the service spends on its own,
+	// excluding downstream calls
+	LatencyMs    float64        `yaml:"latency_ms"`
+	ErrorPercent float64        `yaml:"error_percent"`
+	Calls        []topologyCall `yaml:"calls"`
+	// Parallel calls are made all at once instead of one after another;
+	// Join names a span aggregating their results once all have returned
+	Parallel bool   `yaml:"parallel"`
+	Join     string `yaml:"join"`
+}
+
+type topologyCall struct {
+	Service   string `yaml:"service"`
+	Operation string `yaml:"operation"`
+	// Probability that the call is made; defaults to 1
+	Probability *float64 `yaml:"probability"`
+}
+
+// loadTopology reads and checks a topology file; path "" disables topologies
+func loadTopology(path string) *topology {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		configProblem("TRACE_TOPOLOGY_FILE: %v", err)
+		return nil
+	}
+	var t topology
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		configProblem("TRACE_TOPOLOGY_FILE=%s is not valid YAML: %v", path, err)
+		return nil
+	}
+	if err := t.validate(); err != nil {
+		configProblem("TRACE_TOPOLOGY_FILE=%s: %v", path, err)
+		return nil
+	}
+	log.Printf("Using trace topology with %d services and entrypoints %v", len(t.Services), t.Entrypoints)
+	return &t
+}
+
+// validate checks references, ranges and cycles and fills in the default
+// entrypoints
+func (t *topology) validate() error {
+	if len(t.Services) == 0 {
+		return fmt.Errorf("no services defined")
+	}
+	called := make(map[string]bool)
+	for name, service := range t.Services {
+		if service == nil {
+			service = &topologyService{}
+			t.Services[name] = service
+		}
+		if service.LatencyMs < 0 {
+			return fmt.Errorf("service %s: latency_ms must not be negative", name)
+		}
+		if service.ErrorPercent < 0 || service.ErrorPercent > 100 {
+			return fmt.Errorf("service %s: error_percent must be between 0 and 100", name)
+		}
+		for _, call := range service.Calls {
+			if _, ok := t.Services[call.Service]; !ok {
+				return fmt.Errorf("service %s calls undefined service %q", name, call.Service)
+			}
+			if p := call.Probability; p != nil && (*p < 0 || *p > 1) {
+				return fmt.Errorf("service %s: probability of call to %s must be between 0 and 1", name, call.Service)
+			}
+			called[call.Service] = true
+		}
+	}
+
+	if len(t.Entrypoints) == 0 {
+		for name := range t.Services {
+			if !called[name] {
+				t.Entrypoints = append(t.Entrypoints, name)
+			}
+		}
+		sort.Strings(t.Entrypoints)
+		if len(t.Entrypoints) == 0 {
+			return fmt.Errorf("every service is called by another; list the entrypoints")
+		}
+	}
+	for _, name := range t.Entrypoints {
+		if _, ok := t.Services[name]; !ok {
+			return fmt.Errorf("entrypoint %q is not a defined service", name)
+		}
+	}
+
+	// A cycle would make traces infinitely deep
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("call cycle through service %s", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, call := range t.Services[name].Calls {
+			if err := visit(call.Service); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for name := range t.Services {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildTrace generates one trace following the topology and returns it
+// with its root span. Timestamps are synthesized: each service spends its
+// latency after making its calls one after another.
+func (t *topology) buildTrace(traceID string, start time.Time) (*Trace, Span) {
+	trace := &Trace{}
+	entry := t.Entrypoints[rand.Intn(len(t.Entrypoints))]
+	root := t.buildSpan(trace, traceID, "", entry, "", start.UnixNano())
+	return trace, root
+}
+
+// buildSpan appends the span of service handling operation, preceded by
+// the spans of its downstream calls, and returns it
+func (t *topology) buildSpan(trace *Trace, traceID, parentID, name, operation string, start int64) Span {
+	service := t.Services[name]
+	if operation == "" {
+		operation = "GET /"
+		if len(service.Operations) > 0 {
+			operation = service.Operations[rand.Intn(len(service.Operations))]
+		}
+	}
+	span := Span{
+		TraceID:     traceID,
+		SpanID:      generateSpanID(),
+		ParentID:    parentID,
+		Name:        operation,
+		StartTime:   start,
+		ServiceName: name,
+	}
+	// Operations such as "GET /cart" are HTTP routes, others RPC methods
+	if method, route, ok := strings.Cut(operation, " "); ok && strings.HasPrefix(route, "/") {
+		_, span.Attributes = httpServerSpan(name)
+		span.Attributes["http.method"] = method
+		span.Attributes["http.route"] = route
+		span.Attributes["http.target"] = route
+		span.Attributes["http.status_code"] = strconv.Itoa(successStatus(method))
+	} else {
+		_, span.Attributes = rpcServerSpan(name, operation)
+	}
+
+	cursor := start + spanGap(1000)
+	returned, calls := cursor, 0
+	for _, call := range service.Calls {
+		if call.Probability != nil && rand.Float64() >= *call.Probability {
+			continue
+		}
+		var child Span
+		if tracesConfig.ClientSpans {
+			child = t.buildSpan(trace, traceID, generateSpanID(), call.Service, call.Operation, cursor+networkDelay())
+			child = clientSpanFor(child, name, span.SpanID, cursor)
+			trace.Spans = append(trace.Spans, child)
+		} else {
+			child = t.buildSpan(trace, traceID, span.SpanID, call.Service, call.Operation, cursor)
+		}
+		returned = max(returned, child.EndTime+spanGap(500))
+		if service.Parallel {
+			cursor += spanGap(200)
+		} else {
+			cursor = returned
+		}
+		calls++
+		propagateError(&span, child)
+	}
+	cursor = returned
+	if service.Join != "" && calls > 0 {
+		join := joinSpan(&span, service.Join, calls, cursor)
+		trace.Spans = append(trace.Spans, join)
+		cursor = join.EndTime
+	}
+
+	// Own time varies by up to 50% either side of the typical latency,
+	// unless SERVICE_LATENCY models the service
+	own := time.Duration(service.LatencyMs * (0.5 + rand.Float64()) * float64(time.Millisecond))
+	if dist, ok := serviceLatencyDists[name]; ok {
+		own = dist.SampleDuration()
+	}
+	span.EndTime = cursor + int64(own)
+	if !span.Error && rand.Float64()*100 < service.ErrorPercent {
+		failSpan(&span)
+	}
+	trace.Spans = append(trace.Spans, span)
+	return span
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A business transaction spans several traces, one per stage, such as an
+// order being placed, paid for and fulfilled. Every span of a stage's trace
+// carries transaction.id and transaction.stage, and the root of each stage
+// links to the root of the stage before it.
+
+// pendingStages holds the next stage of every transaction in progress
+var pendingStages struct {
+	sync.Mutex
+	stages []chainStage
+}
+
+type chainStage struct {
+	due           time.Time
+	transactionID string
+	index         int
+	previous      SpanLink
+}
+
+// chainTrace makes trace the next stage of a transaction that is due, or
+// with TRACE_CHAIN_PERCENT chance the first stage of a new one, and
+// schedules the stage after it
+func chainTrace(trace *Trace, root Span) {
+	if tracesConfig.ChainPercent <= 0 || len(tracesConfig.ChainStages) < 2 {
+		return
+	}
+	stage, ok := nextDueStage(time.Now())
+	if !ok {
+		if rand.Float64()*100 >= tracesConfig.ChainPercent {
+			return
+		}
+		stage = chainStage{transactionID: "txn-" + randomHexID(8)}
+	}
+
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		span.Attributes["transaction.id"] = stage.transactionID
+		span.Attributes["transaction.stage"] = tracesConfig.ChainStages[stage.index]
+		span.Attributes["transaction.step"] = strconv.Itoa(stage.index + 1)
+		if span.SpanID == root.SpanID && stage.previous.TraceID != "" {
+			span.Links = append(span.Links, stage.previous)
+		}
+	}
+
+	if stage.index+1 < len(tracesConfig.ChainStages) {
+		delay := time.Duration(float64(tracesConfig.ChainDelay) * (0.5 + rand.Float64()))
+		pendingStages.Lock()
+		pendingStages.stages = append(pendingStages.stages, chainStage{
+			due:           time.Now().Add(delay),
+			transactionID: stage.transactionID,
+			index:         stage.index + 1,
+			previous:      SpanLink{TraceID: root.TraceID, SpanID: root.SpanID},
+		})
+		pendingStages.Unlock()
+	}
+}
+
+// nextDueStage removes and returns a stage whose time has come
+func nextDueStage(now time.Time) (chainStage, bool) {
+	pendingStages.Lock()
+	defer pendingStages.Unlock()
+	for i, stage := range pendingStages.stages {
+		if !stage.due.After(now) {
+			pendingStages.stages = append(pendingStages.stages[:i], pendingStages.stages[i+1:]...)
+			return stage, true
+		}
+	}
+	return chainStage{}, false
+}
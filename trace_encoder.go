@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported values for TRACE_FORMAT
+const (
+	traceFormatJSON      = "json"
+	traceFormatOTLP      = "otlp"
+	traceFormatOTLPProto = "otlp_proto"
+	traceFormatZipkin    = "zipkin"
+
+	traceFormatJaegerThrift = "jaeger_thrift"
+	traceFormatJaegerProto  = "jaeger_proto"
+)
+
+// traceEncoder turns a generated trace into a request body
+type traceEncoder interface {
+	// ContentType is sent as the Content-Type header of every request
+	ContentType() string
+	Encode(trace *Trace) ([]byte, error)
+}
+
+// traceSplitter is implemented by encoders whose requests can only carry
+// part of a trace, such as a single service
+type traceSplitter interface {
+	Split(trace *Trace) []*Trace
+}
+
+var (
+	traceEncoders = map[string]traceEncoder{
+		traceFormatJSON:      jsonTraceEncoder{},
+		traceFormatOTLP:      otlpTraceEncoder{},
+		traceFormatOTLPProto: otlpProtoTraceEncoder{},
+		traceFormatZipkin:    zipkinTraceEncoder{},
+
+		traceFormatJaegerThrift: jaegerThriftEncoder{},
+		traceFormatJaegerProto:  jaegerProtoEncoder{},
+	}
+	traceEnc = newTraceEncoder(tracesConfig.Format)
+)
+
+// newTraceEncoder returns the encoder registered for format
+func newTraceEncoder(format string) traceEncoder {
+	if enc, ok := traceEncoders[format]; ok {
+		return enc
+	}
+	names := make([]string, 0, len(traceEncoders))
+	for name := range traceEncoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	configProblem("TRACE_FORMAT=%q is not supported (use %s)", format, strings.Join(names, ", "))
+	return nil
+}
+
+// traceGRPCMethod returns the RPC that accepts the selected format over gRPC
+func traceGRPCMethod() string {
+	if tracesConfig.Format == traceFormatJaegerProto {
+		return jaegerPostSpansMethod
+	}
+	return otlpTracesExportMethod
+}
+
+// jsonTraceEncoder sends the trace as-is in load-gen's own JSON shape
+type jsonTraceEncoder struct{}
+
+func (jsonTraceEncoder) ContentType() string { return "application/json" }
+
+func (jsonTraceEncoder) Encode(trace *Trace) ([]byte, error) {
+	return json.Marshal(trace)
+}
+
+// otlpTraceEncoder sends the trace as an OTLP/JSON ExportTraceServiceRequest
+type otlpTraceEncoder struct{}
+
+func (otlpTraceEncoder) ContentType() string { return "application/json" }
+
+func (otlpTraceEncoder) Encode(trace *Trace) ([]byte, error) {
+	return json.Marshal(toOTLPTraces(trace))
+}
+
+// otlpProtoTraceEncoder sends the trace as a protobuf ExportTraceServiceRequest
+type otlpProtoTraceEncoder struct{}
+
+func (otlpProtoTraceEncoder) ContentType() string { return "application/x-protobuf" }
+
+func (otlpProtoTraceEncoder) Encode(trace *Trace) ([]byte, error) {
+	return encodeOTLPTracesProto(toOTLPTraces(trace))
+}
+
+// otlpSpanKinds maps the span.kind attribute onto OTLP span kinds
+var otlpSpanKinds = map[string]int{
+	"internal": otlpSpanKindInternal,
+	"server":   otlpSpanKindServer,
+	"client":   otlpSpanKindClient,
+	"producer": otlpSpanKindProducer,
+	"consumer": otlpSpanKindConsumer,
+}
+
+// Supported values for TRACE_OTLP_GROUPING
+const (
+	// otlpGroupingService puts each service's spans in one resource and scope
+	otlpGroupingService = "service"
+	// otlpGroupingScope splits each service's spans by instrumentation library
+	otlpGroupingScope = "scope"
+	// otlpGroupingInstance also spreads a service's spans over its instances
+	otlpGroupingInstance = "instance"
+)
+
+// instrumentationScopes are the libraries that would have recorded each kind
+// of span, keyed by the rpc.system, db.system or messaging.system attribute
+// value, or "http"
+var instrumentationScopes = map[string]otlpScope{
+	"http":          {Name: "go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp", Version: "0.53.0"},
+	"grpc":          {Name: "go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc", Version: "0.53.0"},
+	"postgres":      {Name: "github.com/XSAM/otelsql", Version: "0.32.0"},
+	"mysql":         {Name: "github.com/XSAM/otelsql", Version: "0.32.0"},
+	"cassandra":     {Name: "go.opentelemetry.io/contrib/instrumentation/github.com/gocql/gocql/otelgocql", Version: "0.53.0"},
+	"mongodb":       {Name: "go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo", Version: "0.53.0"},
+	"redis":         {Name: "github.com/redis/go-redis/extra/redisotel", Version: "9.5.1"},
+	"elasticsearch": {Name: "github.com/elastic/go-elasticsearch", Version: "8.14.0"},
+	"kafka":         {Name: "github.com/IBM/sarama/otelsarama", Version: "0.53.0"},
+	"rabbitmq":      {Name: "github.com/rabbitmq/amqp091-go", Version: "1.10.0"},
+}
+
+// spanScope returns the instrumentation scope a span is reported under
+func spanScope(span Span) otlpScope {
+	if tracesConfig.OTLPGrouping == otlpGroupingService {
+		return otlpScope{Name: otlpScopeName}
+	}
+	key := "http"
+	if _, ok := span.Attributes["http.method"]; !ok {
+		key = span.Attributes["rpc.system"] + span.Attributes["db.system"] + span.Attributes["messaging.system"]
+	}
+	if scope, ok := instrumentationScopes[key]; ok {
+		return scope
+	}
+	return otlpScope{Name: otlpScopeName}
+}
+
+// spanInstances returns the instance of its service each span ran on. With
+// TRACE_OTLP_GROUPING=instance every request to a service may land on a
+// different instance, and spans a service records while handling it stay
+// on the instance that handles it; otherwise a trace uses one instance per
+// service.
+func spanInstances(trace *Trace) map[string]int {
+	instances := make(map[string]int, len(trace.Spans))
+	if tracesConfig.OTLPGrouping != otlpGroupingInstance {
+		for _, span := range trace.Spans {
+			instances[span.SpanID] = resourceInstance(span.TraceID)
+		}
+		return instances
+	}
+	byID := make(map[string]*Span, len(trace.Spans))
+	for i := range trace.Spans {
+		byID[trace.Spans[i].SpanID] = &trace.Spans[i]
+	}
+	var instanceOf func(span *Span) int
+	instanceOf = func(span *Span) int {
+		if instance, ok := instances[span.SpanID]; ok {
+			return instance
+		}
+		instance := resourceInstance(span.SpanID)
+		if parent, ok := byID[span.ParentID]; ok && parent.ServiceName == span.ServiceName {
+			instance = instanceOf(parent)
+		}
+		instances[span.SpanID] = instance
+		return instance
+	}
+	for i := range trace.Spans {
+		instanceOf(&trace.Spans[i])
+	}
+	return instances
+}
+
+// toOTLPTraces converts a trace into OTLP with one resource per service, or
+// per service instance, and one scope per instrumentation library as
+// TRACE_OTLP_GROUPING asks. span.kind and service.name attributes become
+// the span kind and the resource's service.name.
+func toOTLPTraces(trace *Trace) otlpTracesRequest {
+	type resourceKey struct {
+		service  string
+		instance int
+	}
+	request := otlpTracesRequest{ResourceSpans: make([]otlpResourceSpans, 0)}
+	resources := make(map[resourceKey]int)
+	scopes := make(map[resourceKey]map[string]int)
+	instances := spanInstances(trace)
+	for _, span := range trace.Spans {
+		key := resourceKey{span.ServiceName, instances[span.SpanID]}
+		i, ok := resources[key]
+		if !ok {
+			i = len(request.ResourceSpans)
+			resources[key] = i
+			scopes[key] = make(map[string]int)
+			request.ResourceSpans = append(request.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{
+					Attributes: resourceAttributes(span.ServiceName, key.instance, nil),
+				},
+			})
+		}
+		resource := &request.ResourceSpans[i]
+		scope := spanScope(span)
+		j, ok := scopes[key][scope.Name]
+		if !ok {
+			j = len(resource.ScopeSpans)
+			scopes[key][scope.Name] = j
+			resource.ScopeSpans = append(resource.ScopeSpans, otlpScopeSpans{Scope: scope})
+		}
+		resource.ScopeSpans[j].Spans = append(resource.ScopeSpans[j].Spans, toOTLPSpan(span))
+	}
+	return request
+}
+
+func toOTLPSpan(span Span) otlpSpan {
+	kind, ok := otlpSpanKinds[span.Attributes["span.kind"]]
+	if !ok {
+		kind = otlpSpanKindInternal
+	}
+	events := make([]otlpSpanEvent, len(span.Events))
+	for i, event := range span.Events {
+		events[i] = otlpSpanEvent{
+			TimeUnixNano: strconv.FormatInt(event.Time, 10),
+			Name:         event.Name,
+			Attributes:   otlpStringAttributes(event.Attributes, nil),
+		}
+	}
+	links := make([]otlpSpanLink, len(span.Links))
+	for i, link := range span.Links {
+		links[i] = otlpSpanLink{TraceID: link.TraceID, SpanID: link.SpanID}
+	}
+	var status otlpStatus
+	if span.Error {
+		status = otlpStatus{Code: otlpStatusError, Message: span.StatusMessage}
+	}
+	var flags uint32
+	if span.Sampled {
+		flags = otlpTraceFlagSampled
+	}
+	return otlpSpan{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		TraceState:        span.TraceState,
+		ParentSpanID:      span.ParentID,
+		Name:              span.Name,
+		Kind:              kind,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime, 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime, 10),
+		Attributes:        otlpStringAttributes(span.Attributes, []string{"span.kind", "service.name"}),
+		Events:            events,
+		Links:             links,
+		Status:            status,
+		Flags:             flags,
+	}
+}
+
+// otlpStringAttributes converts attributes to OTLP in key order, leaving
+// out the keys in skip
+func otlpStringAttributes(attributes map[string]string, skip []string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		if !slices.Contains(skip, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, len(keys))
+	for i, key := range keys {
+		attrs[i] = otlpString(key, attributes[key])
+	}
+	return attrs
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Faults applied to generated traces before they are sent, so backends'
+// handling of incomplete and inconsistent traces can be tested
+
+// skewClocks shifts the spans of every service in SERVICE_CLOCK_SKEW by its
+// offset, so a skewed service's spans may start before their callers or end
+// after them
+func skewClocks(trace *Trace) {
+	if len(tracesConfig.ClockSkew) == 0 {
+		return
+	}
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		skew, ok := tracesConfig.ClockSkew[span.ServiceName]
+		if !ok {
+			continue
+		}
+		span.StartTime += int64(skew)
+		span.EndTime += int64(skew)
+		for j := range span.Events {
+			span.Events[j].Time += int64(skew)
+		}
+	}
+}
+
+// dropParentSpans removes TRACE_DROP_PARENT_PERCENT of the spans below the
+// root that have children, leaving those children pointing at a span the
+// backend never receives
+func dropParentSpans(trace *Trace, rootID string) {
+	if tracesConfig.DropParentPercent <= 0 {
+		return
+	}
+	parents := make(map[string]bool)
+	for _, span := range trace.Spans {
+		parents[span.ParentID] = true
+	}
+	kept := trace.Spans[:0]
+	for _, span := range trace.Spans {
+		if span.SpanID != rootID && parents[span.SpanID] && rand.Float64()*100 < tracesConfig.DropParentPercent {
+			continue
+		}
+		kept = append(kept, span)
+	}
+	trace.Spans = kept
+}
+
+// orphanSpans points TRACE_ORPHAN_PERCENT of the spans below the root at
+// parents that never existed
+func orphanSpans(trace *Trace) {
+	if tracesConfig.OrphanPercent <= 0 {
+		return
+	}
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		if span.ParentID != "" && rand.Float64()*100 < tracesConfig.OrphanPercent {
+			span.ParentID = generateSpanID()
+		}
+	}
+}
+
+// lateSpans holds spans held back by holdLateSpans in the order they fall
+// due; with a fixed delay that is the order they were held back
+var lateSpans struct {
+	sync.Mutex
+	queue []lateBatch
+}
+
+type lateBatch struct {
+	due    time.Time
+	spans  []Span
+	stream string
+}
+
+// holdLateSpans takes TRACE_LATE_PERCENT of the spans out of trace, to be
+// sent TRACE_LATE_DELAY later by sendLateSpans like a slow exporter would
+func holdLateSpans(trace *Trace) {
+	if tracesConfig.LatePercent <= 0 {
+		return
+	}
+	var late []Span
+	kept := trace.Spans[:0]
+	for _, span := range trace.Spans {
+		if rand.Float64()*100 < tracesConfig.LatePercent {
+			late = append(late, span)
+			continue
+		}
+		kept = append(kept, span)
+	}
+	// Something of the trace always arrives on time
+	if len(kept) == 0 {
+		kept, late = append(kept, late[0]), late[1:]
+	}
+	trace.Spans = kept
+	if len(late) == 0 {
+		return
+	}
+	lateSpans.Lock()
+	lateSpans.queue = append(lateSpans.queue, lateBatch{
+		due:    time.Now().Add(tracesConfig.LateDelay),
+		spans:  late,
+		stream: trace.Stream,
+	})
+	lateSpans.Unlock()
+}
+
+// sendLateSpans exports held back spans once they fall due, until ctx is
+// done. While generation is paused they stay held. Spans still held at
+// shutdown are never sent. Late spans belong to traces that were counted
+// already, so they don't add to the trace stats.
+func sendLateSpans(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			lateSpans.Lock()
+			if n := len(lateSpans.queue); n > 0 {
+				log.Printf("Discarding %d batches of late spans at shutdown", n)
+			}
+			lateSpans.Unlock()
+			return
+		case now := <-ticker.C:
+			if paused.Load() {
+				continue
+			}
+			lateSpans.Lock()
+			var due []lateBatch
+			for len(lateSpans.queue) > 0 && !lateSpans.queue[0].due.After(now) {
+				due = append(due, lateSpans.queue[0])
+				lateSpans.queue = lateSpans.queue[1:]
+			}
+			lateSpans.Unlock()
+
+			for _, batch := range due {
+				err := exportSpans(ctx, &Trace{Spans: batch.spans, Stream: batch.stream})
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				if err != nil {
+					log.Printf("Failed to send %d late spans: %v", len(batch.spans), err)
+				}
+			}
+		}
+	}
+}
@@ -3,71 +3,244 @@ package main
 import (
 	"bytes"
 	"context"
-	cryptorand "crypto/rand"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	mathrand "math/rand"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Config struct {
+	// Enabled turns on trace generation
+	Enabled bool `json:"enabled"`
+	// Endpoint may contain a {stream} placeholder
 	Endpoint string            `json:"endpoint"`
+	Method   string            `json:"method"`
+	Format   string            `json:"format"`
 	Headers  map[string]string `json:"headers"`
+	// LinkPercent is the share of spans linking to earlier traces
+	LinkPercent float64 `json:"linkPercent"`
+	// ErrorPercent is the chance a span fails, unless its service has its
+	// own percentage in ServiceErrorPercent
+	ErrorPercent        float64            `json:"errorPercent"`
+	ServiceErrorPercent map[string]float64 `json:"serviceErrorPercent"`
+	// ClientSpans adds the caller's client span to every HTTP and RPC hop
+	ClientSpans bool `json:"clientSpans"`
+	// Rate is the number of traces per second; 0 leaves only SpansPerSec
+	// as the limit
+	Rate float64 `json:"rate"`
+	// SpansPerSec caps the spans sent per second when above 0
+	SpansPerSec float64 `json:"spansPerSec"`
+	// Workers generate and send traces concurrently
+	Workers int `json:"workers"`
+	// DropParentPercent of the spans with children are left out, and
+	// OrphanPercent of the spans point at parents that never existed
+	DropParentPercent float64 `json:"dropParentPercent"`
+	OrphanPercent     float64 `json:"orphanPercent"`
+	// ClockSkew shifts the timestamps of each listed service's spans, as if
+	// its hosts' clocks were off
+	ClockSkew map[string]time.Duration `json:"clockSkew"`
+	// LatePercent of the spans are sent LateDelay after the rest of their
+	// trace
+	LatePercent float64       `json:"latePercent"`
+	LateDelay   time.Duration `json:"lateDelay"`
+	// ContextAttributes records the traceparent and tracestate each span
+	// received as attributes
+	ContextAttributes bool `json:"contextAttributes"`
+	// TraceState is the W3C tracestate carried by every span
+	TraceState string `json:"traceState"`
+	// RetryPercent of the HTTP, RPC and database calls succeed only after
+	// one or two failed attempts
+	RetryPercent float64 `json:"retryPercent"`
+	// ChainPercent of the traces start a business transaction whose
+	// ChainStages follow as separate, linked traces about ChainDelay apart
+	ChainPercent float64       `json:"chainPercent"`
+	ChainStages  []string      `json:"chainStages"`
+	ChainDelay   time.Duration `json:"chainDelay"`
+	// ExtraAttributes random attributes are added to every span, and
+	// LargeAttributePercent of the spans get a value sized around one of
+	// TRACE_ATTRIBUTE_LIMITS
+	ExtraAttributes       int     `json:"extraAttributes"`
+	LargeAttributePercent float64 `json:"largeAttributePercent"`
+	// Streams are the stream-name values traces are sent to in turn
+	Streams []string `json:"streams"`
+	// OTLPGrouping decides how OTLP exports group spans into resources and
+	// scopes
+	OTLPGrouping string `json:"otlpGrouping"`
+	// ParallelPercent of the spans with several children call them in
+	// parallel and join the results
+	ParallelPercent float64 `json:"parallelPercent"`
+	// GiantPercent is the share of traces with TRACE_GIANT_SPANS spans
+	GiantPercent float64 `json:"giantPercent"`
+	// SpansPerRequest splits traces into export requests of at most this
+	// many spans; 0 sends each trace whole
+	SpansPerRequest int `json:"spansPerRequest"`
+	// SamplePercent is the share of traces flagged as sampled; unsampled
+	// traces are still sent unless DropUnsampled is set
+	SamplePercent float64 `json:"samplePercent"`
+	DropUnsampled bool    `json:"dropUnsampled"`
 }
 
 var (
 	defaultConfig = Config{
 		Endpoint: "http://localhost:4318/traces",
+		Method:   http.MethodPost,
+		Format:   traceFormatJSON,
 		Headers: map[string]string{
-			"Content-Type": "application/json",
-			"stream-name":  "default",
+			"stream-name": "default",
 		},
 	}
 	tracesConfig = loadConfig()
 	client       = &http.Client{Timeout: 10 * time.Second}
+	traceRate    = newRateController(tracesConfig.Rate)
+	// traceSpanBudget paces sends to TRACE_SPANS_PER_SEC
+	traceSpanBudget = newRateBudget(tracesConfig.SpansPerSec)
 )
 
-var serviceNames = []string{"user-service", "order-service", "payment-service", "inventory-service"}
+var (
+	serviceNames  = []string{"user-service", "order-service", "payment-service", "inventory-service"}
+	traceServices = loadTraceSetting(loadServices)
+)
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// serviceErrorPercent returns the chance that a span of service fails
+func serviceErrorPercent(service string) float64 {
+	if percent, ok := tracesConfig.ServiceErrorPercent[service]; ok {
+		return percent
 	}
-	return defaultValue
+	return tracesConfig.ErrorPercent
+}
+
+// loadServices reads SERVICE_NAMES ("name[:weight],...") falling back to serviceNames
+func loadServices() []weightedName {
+	value := os.Getenv("SERVICE_NAMES")
+	if value == "" {
+		return uniformWeights(serviceNames)
+	}
+	services, err := parseWeightedList(value)
+	if err != nil {
+		configProblem("SERVICE_NAMES=%q is invalid: %v", value, err)
+		return uniformWeights(serviceNames)
+	}
+	log.Printf("Using %d services for traces", len(services))
+	return services
 }
 
 func loadConfig() Config {
 	cfg := defaultConfig
 	log.Println("Loading trace configuration...")
 
+	cfg.Enabled = getEnvBool("TRACES_ENABLED", false)
+	// The other settings only matter when traces are generated
+	problems := len(configProblems)
+	defer func() {
+		if !cfg.Enabled {
+			configProblems = configProblems[:problems]
+		}
+	}()
+
 	if endpoint := os.Getenv("TRACES_ENDPOINT"); endpoint != "" {
 		log.Printf("Using custom endpoint: %s", endpoint)
 		cfg.Endpoint = endpoint
 	}
 
-	if auth := os.Getenv("AUTH_HEADER"); auth != "" {
-		log.Println("Authorization header found")
-		cfg.Headers["Authorization"] = auth
+	if method, err := parseHTTPMethod("TRACES_METHOD", os.Getenv("TRACES_METHOD")); err != nil {
+		configProblem("%v", err)
+	} else {
+		cfg.Method = method
+	}
+
+	cfg.Format = getEnvOrDefault("TRACE_FORMAT", cfg.Format)
+	cfg.LinkPercent = getEnvFloat("TRACE_LINK_PERCENT", 0)
+	cfg.ErrorPercent = getEnvFloat("TRACE_ERROR_PERCENT", 0)
+	cfg.ClientSpans = getEnvBool("TRACE_CLIENT_SPANS", false)
+	cfg.Rate = getEnvFloat("TRACE_RATE", 1)
+	cfg.SpansPerSec = getEnvFloat("TRACE_SPANS_PER_SEC", 0)
+	cfg.Workers = getEnvInt("TRACE_WORKERS", 1)
+	cfg.DropParentPercent = getEnvFloat("TRACE_DROP_PARENT_PERCENT", 0)
+	cfg.OrphanPercent = getEnvFloat("TRACE_ORPHAN_PERCENT", 0)
+	cfg.ClockSkew = map[string]time.Duration{}
+	if value := os.Getenv("SERVICE_CLOCK_SKEW"); value != "" {
+		skew, err := parseDurationList(value)
+		if err != nil {
+			configProblem("SERVICE_CLOCK_SKEW=%q is invalid: %v", value, err)
+		} else {
+			cfg.ClockSkew = skew
+		}
+	}
+	cfg.LatePercent = getEnvFloat("TRACE_LATE_PERCENT", 0)
+	cfg.LateDelay = getEnvDuration("TRACE_LATE_DELAY", 2*time.Minute)
+	cfg.ContextAttributes = getEnvBool("TRACE_CONTEXT_ATTRIBUTES", false)
+	cfg.TraceState = os.Getenv("TRACE_TRACESTATE")
+	cfg.RetryPercent = getEnvFloat("TRACE_RETRY_PERCENT", 0)
+	cfg.ChainPercent = getEnvFloat("TRACE_CHAIN_PERCENT", 0)
+	cfg.ChainDelay = getEnvDuration("TRACE_CHAIN_DELAY", 10*time.Second)
+	for _, stage := range strings.Split(getEnvOrDefault("TRACE_CHAIN_STAGES", "order.placed,payment.processed,order.fulfilled"), ",") {
+		if stage = strings.TrimSpace(stage); stage != "" {
+			cfg.ChainStages = append(cfg.ChainStages, stage)
+		}
+	}
+	cfg.ExtraAttributes = getEnvInt("TRACE_EXTRA_ATTRIBUTES", 0)
+	cfg.LargeAttributePercent = getEnvFloat("TRACE_LARGE_ATTRIBUTE_PERCENT", 0)
+	cfg.OTLPGrouping = getEnvOrDefault("TRACE_OTLP_GROUPING", otlpGroupingService)
+	cfg.ParallelPercent = getEnvFloat("TRACE_PARALLEL_PERCENT", 0)
+	cfg.GiantPercent = getEnvFloat("TRACE_GIANT_PERCENT", 0)
+	cfg.SpansPerRequest = getEnvInt("TRACE_SPANS_PER_REQUEST", 1000)
+	cfg.SamplePercent = getEnvFloat("TRACE_SAMPLE_PERCENT", 100)
+	cfg.DropUnsampled = getEnvBool("TRACE_DROP_UNSAMPLED", false)
+	cfg.ServiceErrorPercent = map[string]float64{}
+	if value := os.Getenv("SERVICE_ERROR_PERCENT"); value != "" {
+		percents, err := parsePercentList(value)
+		if err != nil {
+			configProblem("SERVICE_ERROR_PERCENT=%q is invalid: %v", value, err)
+		} else {
+			cfg.ServiceErrorPercent = percents
+		}
 	}
 
 	if stream := os.Getenv("TRACES_STREAM"); stream != "" {
 		log.Printf("Using stream: %s", stream)
 		cfg.Headers["stream-name"] = stream
 	}
+	cfg.Streams = []string{cfg.Headers["stream-name"]}
+	if value := os.Getenv("TRACES_STREAMS"); value != "" {
+		cfg.Streams = nil
+		for _, stream := range strings.Split(value, ",") {
+			if stream = strings.TrimSpace(stream); stream != "" {
+				cfg.Streams = append(cfg.Streams, stream)
+			}
+		}
+		log.Printf("Sending traces round-robin to streams %v", cfg.Streams)
+	}
 
 	return cfg
 }
 
-func generateRandomID() string {
-	bytes := make([]byte, 16)
-	_, err := cryptorand.Read(bytes)
-	if err != nil {
-		log.Fatalf("error reading random bytes: %v", err)
+// generateTraceID returns a W3C trace id: 16 random bytes, hex-encoded and
+// never all zero
+func generateTraceID() string {
+	return nonZeroHexID(16)
+}
+
+// generateSpanID returns a W3C span id: 8 random bytes, hex-encoded and
+// never all zero
+func generateSpanID() string {
+	return nonZeroHexID(8)
+}
+
+func nonZeroHexID(n int) string {
+	for {
+		if id := randomHexID(n); strings.Trim(id, "0") != "" {
+			return id
+		}
 	}
-	return fmt.Sprintf("%x", bytes)
 }
 
 // Trace structures
@@ -80,118 +253,469 @@ type Span struct {
 	EndTime     int64             `json:"endTime"`
 	ServiceName string            `json:"serviceName"`
 	Attributes  map[string]string `json:"attributes"`
+	// Error marks a failed operation; StatusMessage says why
+	Error         bool        `json:"error,omitempty"`
+	StatusMessage string      `json:"statusMessage,omitempty"`
+	Events        []SpanEvent `json:"events,omitempty"`
+	Links         []SpanLink  `json:"links,omitempty"`
+	// Sampled is the W3C sampled flag, shared by every span of a trace
+	Sampled    bool   `json:"sampled"`
+	TraceState string `json:"traceState,omitempty"`
+}
+
+// SpanEvent is a timestamped annotation on a span, such as an exception
+type SpanEvent struct {
+	Name       string            `json:"name"`
+	Time       int64             `json:"time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SpanLink points at a span of another trace, such as the producers of the
+// messages a batch consumer processed
+type SpanLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
 }
 
 type Trace struct {
 	Spans []Span `json:"spans"`
+	// Stream is the stream-name the trace is sent to
+	Stream string `json:"-"`
 }
 
-func sendTrace(trace *Trace) error {
-	log.Printf("Sending trace with %d spans...", len(trace.Spans))
-	payload, err := json.Marshal(trace)
-	if err != nil {
+func sendTrace(ctx context.Context, trace *Trace) error {
+	if err := exportSpans(ctx, trace); err != nil {
+		return err
 	}
+	atomic.AddInt64(&tracesSent, 1)
+	return nil
+}
 
-	req, err := http.NewRequest("POST", tracesConfig.Endpoint, bytes.NewBuffer(payload))
+// exportSpans encodes and sends the spans of trace in as many requests as
+// the format and TRACE_SPANS_PER_REQUEST require
+func exportSpans(ctx context.Context, trace *Trace) error {
+	stream := trace.Stream
+	parts := []*Trace{trace}
+	if splitter, ok := traceEnc.(traceSplitter); ok {
+		parts = splitter.Split(trace)
+	}
+	parts = chunkTraces(parts, tracesConfig.SpansPerRequest)
+	for _, part := range parts {
+		// The rest of a trace split into many requests is not sent at shutdown
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		payload, err := traceEnc.Encode(part)
+		if err != nil {
+			return fmt.Errorf("error encoding trace: %w", err)
+		}
+
+		if isGRPCEndpoint(tracesConfig.Endpoint) {
+			if err := exportGRPC(ctx, tracesConfig.Endpoint, traceGRPCMethod(), payload); err != nil {
+				return fmt.Errorf("error sending trace: %w", err)
+			}
+		} else if isBrokerEndpoint(tracesConfig.Endpoint) {
+			endpoint := expandEndpoint(tracesConfig.Endpoint, map[string]string{"stream": stream})
+			if err := publishBroker(ctx, endpoint, []brokerMessage{{Key: brokerTraceKey(endpoint, part), Value: payload}}); err != nil {
+				return fmt.Errorf("error sending trace: %w", err)
+			}
+		} else if err := postTraceHTTP(ctx, payload, stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkTraces splits parts holding more than size spans into several; a
+// size of 0 leaves them whole
+func chunkTraces(parts []*Trace, size int) []*Trace {
+	if size <= 0 {
+		return parts
+	}
+	var chunks []*Trace
+	for _, part := range parts {
+		for spans := part.Spans; len(spans) > 0; {
+			n := min(size, len(spans))
+			chunks = append(chunks, &Trace{Spans: spans[:n]})
+			spans = spans[n:]
+		}
+	}
+	return chunks
+}
+
+// postTraceHTTP sends an encoded trace to TRACES_ENDPOINT for stream
+func postTraceHTTP(ctx context.Context, payload []byte, stream string) error {
+	endpoint := expandEndpoint(tracesConfig.Endpoint, map[string]string{
+		"stream": stream,
+	})
+	req, err := http.NewRequestWithContext(ctx, tracesConfig.Method, endpoint, bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("error creating request: %v", err)
 	}
 
-	fmt.Printf("Auth Header: %v\n", tracesConfig.Headers["Authorization"])
-	fmt.Println("Endpoint: ", tracesConfig.Endpoint)
 	// Set all configured headers
+	req.Header.Set("Content-Type", traceEnc.ContentType())
 	for key, value := range tracesConfig.Headers {
 		req.Header.Set(key, value)
 	}
+	if stream != "" {
+		req.Header.Set("stream-name", stream)
+	}
+	auth.apply(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Error sending trace: %v", err)
-		return fmt.Errorf("error sending trace: %v", err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error sending trace: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Unexpected status code: %d", resp.StatusCode)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &throttledError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	// Zipkin answers 202 Accepted
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
-
-	log.Printf("Successfully sent trace with %d spans", len(trace.Spans))
 	return nil
 }
 
 func generateTrace(ctx context.Context) error {
-	traceID := generateRandomID()
+	traceID := generateTraceID()
+	if traceTopology != nil {
+		trace, root := traceTopology.buildTrace(traceID, time.Now())
+		return sendGeneratedTrace(ctx, trace, root)
+	}
 	trace := &Trace{Spans: make([]Span, 0)}
 	now := time.Now()
 
 	// Root span
+	name, attrs := httpServerSpan("trace-generator")
 	rootSpan := Span{
 		TraceID:     traceID,
-		SpanID:      generateRandomID(),
-		Name:        "API Request",
+		SpanID:      generateSpanID(),
+		Name:        name,
 		StartTime:   now.UnixNano(),
 		ServiceName: "trace-generator",
-		Attributes:  map[string]string{"span.kind": "server"},
+		Attributes:  attrs,
 	}
 
-	// Process services
-	for _, service := range serviceNames {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			childSpan := Span{
-				TraceID:     traceID,
-				SpanID:      generateRandomID(),
-				ParentID:    rootSpan.SpanID,
-				Name:        service,
-				StartTime:   now.Add(time.Duration(mathrand.Intn(100)) * time.Millisecond).UnixNano(),
-				ServiceName: service,
-				Attributes: map[string]string{
-					"span.kind":    "client",
-					"operation":    "process_request",
-					"service.name": service,
-				},
-			}
+	shape := newTraceShape()
+	if tracesConfig.GiantPercent > 0 && mathrand.Float64()*100 < tracesConfig.GiantPercent {
+		// Building a giant trace takes a while; don't start one at shutdown
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		spans := max(1, traceGiantSpansDist.SampleInt())
+		shape = newGiantTraceShape(spans)
+	}
+	rootSpan.EndTime = callChildren(trace, &rootSpan, shape)
+	trace.Spans = append(trace.Spans, rootSpan)
+	return sendGeneratedTrace(ctx, trace, rootSpan)
+}
 
-			// Replace time.Sleep with context-aware sleep
-			timer := time.NewTimer(time.Millisecond * time.Duration(100+mathrand.Intn(200)))
-			select {
-			case <-ctx.Done():
-				timer.Stop()
-				return ctx.Err()
-			case <-timer.C:
-			}
+// spanGap returns a random pause of up to maxMicros microseconds, the time
+// a service spends between calls, in nanoseconds
+func spanGap(maxMicros int) int64 {
+	return int64(mathrand.Intn(maxMicros)) * int64(time.Microsecond)
+}
+
+// callChildren generates the calls span makes for node and returns when
+// the last of them has returned. Calls are made one after another, or all
+// at once, a few microseconds apart, for parallel nodes, whose results are
+// then aggregated in a join span if the node asks for one.
+func callChildren(trace *Trace, span *Span, node *traceShapeNode) int64 {
+	cursor := span.StartTime + spanGap(1000)
+	returned := cursor
+	for _, n := range node.Children {
+		child := generateChildSpans(trace, span, n, cursor)
+		propagateError(span, child)
+		returned = max(returned, child.EndTime+spanGap(500))
+		if node.Parallel {
+			cursor += spanGap(200)
+		} else {
+			cursor = returned
+		}
+	}
+	if node.Join && len(node.Children) > 0 {
+		join := joinSpan(span, "join", len(node.Children), returned)
+		trace.Spans = append(trace.Spans, join)
+		returned = join.EndTime
+	}
+	return returned
+}
 
-			childSpan.EndTime = time.Now().UnixNano()
-			trace.Spans = append(trace.Spans, childSpan)
+// generateChildSpans appends the span for node, starting at start, and its
+// descendants and returns it. Timings are synthesized: the span makes its
+// calls one after another, then spends its own latency. Services handle HTTP
+// and RPC requests themselves, while database and messaging calls are
+// client spans of the calling service.
+func generateChildSpans(trace *Trace, parent *Span, node *traceShapeNode, start int64) Span {
+	span := Span{
+		TraceID:     parent.TraceID,
+		SpanID:      generateSpanID(),
+		ParentID:    parent.SpanID,
+		StartTime:   start,
+		ServiceName: node.Service,
+	}
+	spanType := pickSpanType(len(node.Children) == 0)
+	switch spanType {
+	case spanTypeHTTP:
+		span.Name, span.Attributes = httpServerSpan(node.Service)
+	case spanTypeRPC:
+		span.Name, span.Attributes = rpcServerSpan(node.Service, "")
+	case spanTypeDB:
+		span.ServiceName = parent.ServiceName
+		span.Name, span.Attributes = dbClientSpan()
+	case spanTypeMessaging:
+		span.ServiceName = parent.ServiceName
+		span.Name, span.Attributes = messagingProducerSpan()
+	}
+	paired := tracesConfig.ClientSpans && (spanType == spanTypeHTTP || spanType == spanTypeRPC)
+	retried := slices.Contains(retrySpanTypes, spanType) && mathrand.Float64()*100 < tracesConfig.RetryPercent
+	if retried {
+		// Earlier attempts failed; this one succeeds
+		var failures int
+		start, failures = failedAttempts(trace, parent, span, paired, start)
+		span.StartTime = start
+		markRetry(span.Attributes, failures+1)
+	}
+	if paired {
+		// The server span hangs off the caller's client span and receives
+		// the request once it has crossed the network
+		span.ParentID = generateSpanID()
+		span.StartTime += networkDelay()
+	}
+	span.EndTime = callChildren(trace, &span, node) + int64(latencyFor(node.Service).SampleDuration())
+	if !retried && !span.Error && mathrand.Float64()*100 < serviceErrorPercent(span.ServiceName) {
+		failSpan(&span)
+	}
+	trace.Spans = append(trace.Spans, span)
+	if spanType == spanTypeMessaging && !span.Error {
+		trace.Spans = append(trace.Spans, messagingConsumerSpan(span))
+	}
+	if paired {
+		client := clientSpanFor(span, parent.ServiceName, parent.SpanID, start)
+		if attempt, ok := span.Attributes["retry.attempt"]; ok {
+			n, _ := strconv.Atoi(attempt)
+			markRetry(client.Attributes, n)
 		}
+		trace.Spans = append(trace.Spans, client)
+		return client
 	}
+	return span
+}
 
-	rootSpan.EndTime = time.Now().UnixNano()
-	trace.Spans = append(trace.Spans, rootSpan)
+// sendGeneratedTrace applies head sampling, sends a trace and remembers
+// sampled traces for metric exemplars and links
+func sendGeneratedTrace(ctx context.Context, trace *Trace, root Span) error {
+	sampled := traceSampled(root.TraceID)
+	if !sampled && tracesConfig.DropUnsampled {
+		return nil
+	}
+	for i := range trace.Spans {
+		trace.Spans[i].Sampled = sampled
+	}
+	skewClocks(trace)
+	trace.Stream = nextTraceStream()
+	dropParentSpans(trace, root.SpanID)
+	orphanSpans(trace)
+	addBaggage(trace)
+	addAttributeVolume(trace)
+	addTraceContext(trace)
+	chainTrace(trace, root)
+	holdLateSpans(trace)
+	if err := traceSpanBudget.Wait(ctx, len(trace.Spans)); err != nil {
+		return err
+	}
+	linkSpans(trace)
+	if err := sendTrace(ctx, trace); err != nil {
+		return err
+	}
+	if !sampled {
+		// A backend honouring the flag keeps nothing to point at
+		return nil
+	}
+	spans := make([]traceExemplarSpan, len(trace.Spans))
+	for i, span := range trace.Spans {
+		spans[i] = traceExemplarSpan{SpanID: span.SpanID, Service: span.ServiceName}
+	}
+	recentTraces.add(traceExemplar{
+		TraceID: root.TraceID,
+		SpanID:  root.SpanID,
+		Value:   time.Duration(root.EndTime - root.StartTime).Seconds(),
+		Time:    time.Unix(0, root.EndTime),
+		Spans:   spans,
+	})
+	return nil
+}
 
-	return sendTrace(trace)
+// addTraceContext sets the configured tracestate on every span and, with
+// TRACE_CONTEXT_ATTRIBUTES, records the W3C traceparent and tracestate
+// headers each span was called with
+func addTraceContext(trace *Trace) {
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		span.TraceState = tracesConfig.TraceState
+		if !tracesConfig.ContextAttributes || span.ParentID == "" {
+			continue
+		}
+		flags := "00"
+		if span.Sampled {
+			flags = "01"
+		}
+		span.Attributes["traceparent"] = "00-" + span.TraceID + "-" + span.ParentID + "-" + flags
+		if span.TraceState != "" {
+			span.Attributes["tracestate"] = span.TraceState
+		}
+	}
 }
 
+// validTraceState reports whether value is a W3C tracestate list of up to
+// 32 key=value members
+func validTraceState(value string) bool {
+	members := strings.Split(value, ",")
+	if len(members) > 32 {
+		return false
+	}
+	for _, member := range members {
+		if !traceStateMember.MatchString(strings.TrimSpace(member)) {
+			return false
+		}
+	}
+	return true
+}
+
+var traceStateMember = regexp.MustCompile(`^([a-z][a-z0-9_\-*/]{0,255}|[a-z0-9][a-z0-9_\-*/]{0,240}@[a-z][a-z0-9_\-*/]{0,13})=[\x20-\x2b\x2d-\x3c\x3e-\x7e]{0,255}[\x21-\x2b\x2d-\x3c\x3e-\x7e]$`)
+
+// traceStreamTurn counts traces to round-robin them over TRACES_STREAMS
+var traceStreamTurn atomic.Uint64
+
+// nextTraceStream returns the stream the next trace is sent to
+func nextTraceStream() string {
+	n := traceStreamTurn.Add(1) - 1
+	return tracesConfig.Streams[n%uint64(len(tracesConfig.Streams))]
+}
+
+// traceSampled decides head sampling from the trace id the way the
+// TraceIdRatioBased sampler does, so every span of a trace agrees
+func traceSampled(traceID string) bool {
+	if tracesConfig.SamplePercent >= 100 {
+		return true
+	}
+	if len(traceID) < 32 {
+		return mathrand.Float64()*100 < tracesConfig.SamplePercent
+	}
+	low, err := strconv.ParseUint(traceID[16:32], 16, 64)
+	if err != nil {
+		return mathrand.Float64()*100 < tracesConfig.SamplePercent
+	}
+	bound := uint64(tracesConfig.SamplePercent / 100 * (1 << 63))
+	return low>>1 < bound
+}
+
+// linkSpans gives TRACE_LINK_PERCENT of the spans links to one to three
+// recently sent traces
+func linkSpans(trace *Trace) {
+	if tracesConfig.LinkPercent <= 0 {
+		return
+	}
+	for i := range trace.Spans {
+		if mathrand.Float64()*100 >= tracesConfig.LinkPercent {
+			continue
+		}
+		for n := 1 + mathrand.Intn(3); n > 0; n-- {
+			linked, ok := recentTraces.random()
+			link := SpanLink{TraceID: linked.TraceID, SpanID: linked.SpanID}
+			if ok && !slices.Contains(trace.Spans[i].Links, link) {
+				trace.Spans[i].Links = append(trace.Spans[i].Links, link)
+			}
+		}
+	}
+}
+
+// traceResumeAt holds back trace dispatch until this time (Unix nanos)
+// after the endpoint throttled a request
+var traceResumeAt atomic.Int64
+
+// minTraceDispatchInterval bounds how often the dispatcher wakes up at high
+// rates; each wake-up hands out every trace due since the last one
+const minTraceDispatchInterval = 10 * time.Millisecond
+
+// traceDispatchInterval returns how often the dispatcher hands out traces
+func traceDispatchInterval() time.Duration {
+	if traceRate.Target() <= 0 {
+		return minTraceDispatchInterval
+	}
+	return max(traceRate.Interval(), minTraceDispatchInterval)
+}
+
+// startTraceGeneration hands out traces at TRACE_RATE to TRACE_WORKERS
+// workers until ctx is done. Traces falling due while every worker is busy
+// are skipped rather than queued.
 func startTraceGeneration(ctx context.Context) error {
-	log.Println("Starting trace generation...")
-	ticker := time.NewTicker(time.Second)
+	log.Printf("Starting trace generation at %s with %d workers", describeTraceRate(), tracesConfig.Workers)
+	jobs := make(chan int64, tracesConfig.Workers)
+	var workers sync.WaitGroup
+	for i := 0; i < tracesConfig.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for n := range jobs {
+				runTraceJob(ctx, n)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		workers.Wait()
+	}()
+
+	if tracesConfig.LatePercent > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			sendLateSpans(ctx)
+		}()
+	}
+
+	interval := traceDispatchInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	traceCount := 0
+	var traceCount int64
+	var due float64
+	last := time.Now()
 	for {
 		select {
-		case <-ticker.C:
-			traceCount++
-			log.Printf("Generating trace #%d", traceCount)
-			if err := generateTrace(ctx); err != nil {
-				if err == context.Canceled {
-					log.Println("Trace generation canceled")
-					return err
+		case now := <-ticker.C:
+			elapsed := now.Sub(last)
+			last = now
+			if paused.Load() || now.UnixNano() < traceResumeAt.Load() {
+				due = 0
+				continue
+			}
+			n := tracesConfig.Workers
+			if rate := traceRate.Rate(); rate > 0 {
+				due += elapsed.Seconds() * rate
+				n = int(due + 1e-9)
+				due -= float64(n)
+			}
+		dispatch:
+			for ; n > 0; n-- {
+				select {
+				case jobs <- traceCount + 1:
+					traceCount++
+				default:
+					due = 0
+					break dispatch
 				}
-				log.Printf("Error generating trace #%d: %v", traceCount, err)
+			}
+			if next := traceDispatchInterval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
 			}
 		case <-ctx.Done():
 			log.Println("Stopping trace generation...")
@@ -199,3 +723,38 @@ func startTraceGeneration(ctx context.Context) error {
 		}
 	}
 }
+
+// runTraceJob generates and sends trace #n, adapting the rate to throttling
+func runTraceJob(ctx context.Context, n int64) {
+	atomic.AddInt64(&traceSendAttempts, 1)
+	err := generateTrace(ctx)
+	if err == nil {
+		traceRate.OnSuccess()
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	atomic.AddInt64(&traceSendErrors, 1)
+	var throttled *throttledError
+	if errors.As(err, &throttled) {
+		traceRate.OnThrottle()
+		traceResumeAt.Store(time.Now().Add(throttled.RetryAfter).UnixNano())
+		log.Printf("Reducing trace rate to %.2f traces/sec and pausing %v",
+			traceRate.Rate(), throttled.RetryAfter)
+		return
+	}
+	log.Printf("Error generating trace #%d: %v", n, err)
+}
+
+// describeTraceRate summarizes the trace and span rate limits for logging
+func describeTraceRate() string {
+	rate := "unlimited traces/sec"
+	if tracesConfig.Rate > 0 {
+		rate = fmt.Sprintf("%g traces/sec", tracesConfig.Rate)
+	}
+	if tracesConfig.SpansPerSec > 0 {
+		rate += fmt.Sprintf(" (at most %g spans/sec)", tracesConfig.SpansPerSec)
+	}
+	return rate
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTraceEncoder counts the parts of traces that were encoded
+type countingTraceEncoder struct {
+	traceEncoder
+	encoded atomic.Int64
+}
+
+func (e *countingTraceEncoder) Encode(trace *Trace) ([]byte, error) {
+	e.encoded.Add(1)
+	return e.traceEncoder.Encode(trace)
+}
+
+// cancelingTransport cancels a context once a response has arrived
+type cancelingTransport struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	c.cancel()
+	return resp, err
+}
+
+func TestExportSpansStopsBetweenChunksWhenCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	savedConfig, savedEnc, savedClient := tracesConfig, traceEnc, client
+	t.Cleanup(func() { tracesConfig, traceEnc, client = savedConfig, savedEnc, savedClient })
+	client = &http.Client{Transport: cancelingTransport{cancel}}
+	tracesConfig.Endpoint = srv.URL
+	tracesConfig.SpansPerRequest = 1
+	enc := &countingTraceEncoder{traceEncoder: jsonTraceEncoder{}}
+	traceEnc = enc
+
+	traceID := generateTraceID()
+	trace := &Trace{Spans: []Span{
+		{TraceID: traceID, SpanID: generateSpanID(), Name: "GET /", ServiceName: "frontend"},
+		{TraceID: traceID, SpanID: generateSpanID(), Name: "GET /cart", ServiceName: "cart"},
+		{TraceID: traceID, SpanID: generateSpanID(), Name: "GET /price", ServiceName: "pricing"},
+	}}
+	err := exportSpans(ctx, trace)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("exportSpans error = %v, want context.Canceled", err)
+	}
+	if n := enc.encoded.Load(); n != 1 {
+		t.Errorf("exportSpans encoded %d chunks after being canceled once the first was sent, want 1", n)
+	}
+}
+
+func TestGenerateTraceSkipsGiantTraceWhenCanceled(t *testing.T) {
+	savedConfig, savedEnc, savedTopology := tracesConfig, traceEnc, traceTopology
+	t.Cleanup(func() { tracesConfig, traceEnc, traceTopology = savedConfig, savedEnc, savedTopology })
+	tracesConfig.GiantPercent = 100
+	traceTopology = nil
+	enc := &countingTraceEncoder{traceEncoder: jsonTraceEncoder{}}
+	traceEnc = enc
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := generateTrace(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("generateTrace error = %v, want context.Canceled", err)
+	}
+	if n := enc.encoded.Load(); n != 0 {
+		t.Errorf("generateTrace encoded %d chunks of a giant trace after shutdown, want 0", n)
+	}
+}
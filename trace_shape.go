@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+var (
+	// traceDepthDist is the number of span levels in a trace, root included
+	traceDepthDist = loadTraceDistribution("TRACE_DEPTH", "", valueDistribution{
+		Kind: distUniform, Min: 2, Max: 4, Mean: 3, StdDev: 1, Alpha: 1.5,
+	})
+	// traceFanoutDist is the number of children of each span above the
+	// deepest level
+	traceFanoutDist = loadTraceDistribution("TRACE_FANOUT", "", valueDistribution{
+		Kind: distLognormal, Min: 1, Max: 4, Mean: 2, StdDev: 1.5, Alpha: 1.5,
+	})
+	// traceSpansDist caps the number of spans in a trace
+	traceSpansDist = loadTraceDistribution("TRACE_SPANS", "", valueDistribution{
+		Kind: distLognormal, Min: 5, Max: 30, Mean: 15, StdDev: 10, Alpha: 1.5,
+	})
+	// traceGiantSpansDist is the number of spans in a giant trace
+	traceGiantSpansDist = loadTraceDistribution("TRACE_GIANT_SPANS", "", valueDistribution{
+		Kind: distUniform, Min: 10000, Max: 100000, Mean: 50000, StdDev: 20000, Alpha: 1.5,
+	})
+)
+
+// traceShapeNode is a span-to-be in the call tree of a generated trace
+type traceShapeNode struct {
+	Service  string
+	Children []*traceShapeNode
+	// Parallel children are called concurrently rather than one by one;
+	// Join adds a span aggregating their results once all have returned
+	Parallel bool
+	Join     bool
+}
+
+// newTraceShape draws a depth, a span budget and per-span fan-outs and
+// grows a call tree breadth first, so a small budget trims the deepest
+// levels rather than whole branches
+func newTraceShape() *traceShapeNode {
+	depth := max(1, traceDepthDist.SampleInt())
+	budget := max(1, traceSpansDist.SampleInt())
+	return growTraceShape(depth, budget, false, traceFanoutDist.SampleInt)
+}
+
+// newGiantTraceShape returns a tree of about spans spans, like a batch job
+// fanning out over many items. Its fan-out is sized so the tree reaches the
+// budget within the drawn depth, and calls run in parallel so the trace
+// stays minutes rather than hours long.
+func newGiantTraceShape(spans int) *traceShapeNode {
+	depth := max(3, traceDepthDist.SampleInt())
+	fanout := math.Pow(float64(spans), 1/float64(depth-1))
+	return growTraceShape(depth, spans, true, func() int {
+		// Vary each span's fan-out by up to a quarter either way
+		return int(math.Ceil(fanout * (0.75 + rand.Float64()/2)))
+	})
+}
+
+// growTraceShape grows a call tree of at most budget spans, root included
+func growTraceShape(depth, budget int, parallel bool, fanout func() int) *traceShapeNode {
+	budget--
+	root := &traceShapeNode{Parallel: parallel}
+	level := []*traceShapeNode{root}
+	for d := 1; d < depth && budget > 0 && len(level) > 0; d++ {
+		var next []*traceShapeNode
+		for _, parent := range level {
+			children := min(fanout(), budget)
+			for i := 0; i < children; i++ {
+				child := &traceShapeNode{Service: pickWeighted(traceServices), Parallel: parallel}
+				parent.Children = append(parent.Children, child)
+				next = append(next, child)
+			}
+			budget -= children
+			if !parallel && children > 1 && budget > 0 && rand.Float64()*100 < tracesConfig.ParallelPercent {
+				parent.Parallel, parent.Join = true, true
+				budget--
+			}
+		}
+		level = next
+	}
+	return root
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// weightedName is a named choice with a relative selection weight
+type weightedName struct {
+	Name   string
+	Weight float64
+}
+
+// parseWeightedList parses a comma-separated list of names with optional
+// weights, e.g. "checkout:3,cart,search:0.5". Names without a weight get 1.
+func parseWeightedList(value string) ([]weightedName, error) {
+	var items []weightedName
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, weightStr, hasWeight := strings.Cut(field, ":")
+		item := weightedName{Name: strings.TrimSpace(name), Weight: 1}
+		if hasWeight {
+			weight, err := strconv.ParseFloat(strings.TrimSpace(weightStr), 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight in %q", field)
+			}
+			item.Weight = weight
+		}
+		if item.Name == "" {
+			return nil, fmt.Errorf("missing name in %q", field)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("list is empty")
+	}
+	return items, nil
+}
+
+// uniformWeights gives every name the same weight
+func uniformWeights(names []string) []weightedName {
+	items := make([]weightedName, len(names))
+	for i, name := range names {
+		items[i] = weightedName{Name: name, Weight: 1}
+	}
+	return items
+}
+
+// pickWeighted returns one name chosen proportionally to its weight
+func pickWeighted(items []weightedName) string {
+	total := 0.0
+	for _, item := range items {
+		total += item.Weight
+	}
+	if total <= 0 {
+		return items[rand.Intn(len(items))].Name
+	}
+	r := rand.Float64() * total
+	for _, item := range items {
+		r -= item.Weight
+		if r < 0 {
+			return item.Name
+		}
+	}
+	return items[len(items)-1].Name
+}
+
+// weightedNames returns the names of items
+func weightedNames(items []weightedName) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+	return names
+}
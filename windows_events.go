@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// LOG_CONTENT value for Windows Event Log records
+const logContentWindowsEvent = "windows_event"
+
+// Supported values for WINDOWS_EVENT_FORMAT
+const (
+	windowsEventXML  = "xml"
+	windowsEventJSON = "json"
+)
+
+// windowsEventFormat is how LOG_CONTENT=windows_event records are rendered
+var windowsEventFormat = getEnvOrDefault("WINDOWS_EVENT_FORMAT", windowsEventXML)
+
+// Keywords of Security log audit events
+const (
+	windowsAuditSuccess = "0x8020000000000000"
+	windowsAuditFailure = "0x8010000000000000"
+	windowsClassic      = "0x80000000000000"
+)
+
+// windowsEventData is a named <Data> element of a record's EventData
+type windowsEventData struct {
+	Name  string `xml:"Name,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// windowsEventDef is an event a provider writes, with the data and
+// rendered message of one occurrence on a computer
+type windowsEventDef struct {
+	ID                int
+	Weight            float64
+	Channel, Provider string
+	ProviderGUID      string
+	Level, Task       int
+	Keywords          string
+	Render            func(computer string) ([]windowsEventData, string)
+}
+
+const (
+	windowsSecurityProvider = "Microsoft-Windows-Security-Auditing"
+	windowsSecurityGUID     = "{54849625-5478-4994-a5ba-3e3b0328c30d}"
+	windowsSCMProvider      = "Service Control Manager"
+	windowsSCMGUID          = "{555908d1-a6d7-4695-8e1e-26931d2012f4}"
+)
+
+var windowsEventDefs = []windowsEventDef{
+	{4624, 30, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 12544, windowsAuditSuccess, renderWindowsLogon(true)},
+	{4634, 20, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 12545, windowsAuditSuccess, renderWindowsLogoff},
+	{4672, 10, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 12548, windowsAuditSuccess, renderWindowsSpecialPrivileges},
+	{4688, 15, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 13312, windowsAuditSuccess, renderWindowsProcessCreation},
+	{4625, 4, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 12544, windowsAuditFailure, renderWindowsLogon(false)},
+	{4740, 0.5, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 13824, windowsAuditSuccess, renderWindowsLockout},
+	{4720, 0.2, "Security", windowsSecurityProvider, windowsSecurityGUID, 0, 13824, windowsAuditSuccess, renderWindowsUserCreated},
+	{7036, 10, "System", windowsSCMProvider, windowsSCMGUID, 4, 0, windowsClassic, renderWindowsServiceState},
+	{7000, 1, "System", windowsSCMProvider, windowsSCMGUID, 2, 0, windowsClassic, renderWindowsServiceFailed},
+	{1000, 2, "Application", "Application Error", "", 2, 100, windowsClassic, renderWindowsAppCrash},
+	{1026, 1, "Application", ".NET Runtime", "", 2, 0, windowsClassic, renderWindowsDotNetError},
+}
+
+// windowsLevelNames are the rendered names of event levels
+var windowsLevelNames = map[int]string{0: "Information", 1: "Critical", 2: "Error", 3: "Warning", 4: "Information"}
+
+var (
+	windowsUsers     = []string{"jsmith", "mgarcia", "akhan", "lchen", "svc_backup", "svc_sql", "Administrator"}
+	windowsServices  = []string{"Windows Update", "Background Intelligent Transfer Service", "Print Spooler", "Windows Defender Antivirus Service", "WinHTTP Web Proxy Auto-Discovery Service", "SQL Server (MSSQLSERVER)"}
+	windowsProcesses = []string{`C:\Windows\System32\svchost.exe`, `C:\Windows\System32\cmd.exe`, `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, `C:\Program Files\Google\Chrome\Application\chrome.exe`, `C:\Windows\System32\conhost.exe`, `C:\Windows\explorer.exe`, `C:\Program Files\Microsoft Office\root\Office16\OUTLOOK.EXE`}
+)
+
+// windowsRecordIDs numbers the records of each channel of each computer
+var windowsRecordIDs = struct {
+	sync.Mutex
+	next map[string]uint64
+}{next: make(map[string]uint64)}
+
+// windowsEvent is an event as Get-WinEvent's ToXml() renders it, with the
+// message in RenderingInfo as forwarded events carry it
+type windowsEvent struct {
+	XMLName xml.Name `xml:"Event"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	System  struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+			GUID string `xml:"Guid,attr,omitempty"`
+		}
+		EventID     int
+		Version     int
+		Level       int
+		Task        int
+		Opcode      int
+		Keywords    string
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		}
+		EventRecordID uint64
+		Execution     struct {
+			ProcessID int `xml:"ProcessID,attr"`
+			ThreadID  int `xml:"ThreadID,attr"`
+		}
+		Channel  string
+		Computer string
+	}
+	EventData struct {
+		Data []windowsEventData
+	}
+	RenderingInfo struct {
+		Culture string `xml:"Culture,attr"`
+		Message string
+		Level   string
+	}
+}
+
+// windowsEventJSONRecord is the flat JSON shape of an event
+type windowsEventJSONRecord struct {
+	EventID       int               `json:"EventID"`
+	Channel       string            `json:"Channel"`
+	ProviderName  string            `json:"ProviderName"`
+	ProviderGUID  string            `json:"ProviderGuid,omitempty"`
+	Computer      string            `json:"Computer"`
+	Level         string            `json:"Level"`
+	Task          int               `json:"Task"`
+	Keywords      string            `json:"Keywords"`
+	TimeCreated   string            `json:"TimeCreated"`
+	EventRecordID uint64            `json:"EventRecordID"`
+	ProcessID     int               `json:"ProcessID"`
+	EventData     map[string]string `json:"EventData"`
+	Message       string            `json:"Message"`
+}
+
+// generateWindowsEvent fills record with a Windows Event Log record in
+// WINDOWS_EVENT_FORMAT, with the channel as the job. Failed audits are
+// warnings and Error events errors.
+func generateWindowsEvent(record *LogRecord) {
+	def := pickWindowsEvent()
+	computer := windowsComputer()
+	data, message := def.Render(computer)
+
+	windowsRecordIDs.Lock()
+	key := computer + "/" + def.Channel
+	windowsRecordIDs.next[key]++
+	recordID := windowsRecordIDs.next[key]
+	windowsRecordIDs.Unlock()
+
+	var event windowsEvent
+	event.Xmlns = "http://schemas.microsoft.com/win/2004/08/events/event"
+	event.System.Provider.Name = def.Provider
+	event.System.Provider.GUID = def.ProviderGUID
+	event.System.EventID = def.ID
+	event.System.Level = def.Level
+	event.System.Task = def.Task
+	event.System.Keywords = def.Keywords
+	event.System.TimeCreated.SystemTime = record.Time.UTC().Format("2006-01-02T15:04:05.0000000Z")
+	event.System.EventRecordID = recordID
+	event.System.Execution.ProcessID = 4 * (100 + rand.Intn(2000))
+	event.System.Execution.ThreadID = 4 * (100 + rand.Intn(5000))
+	event.System.Channel = def.Channel
+	event.System.Computer = computer
+	event.EventData.Data = data
+	event.RenderingInfo.Culture = "en-US"
+	event.RenderingInfo.Message = message
+	event.RenderingInfo.Level = windowsLevelNames[def.Level]
+
+	record.Job = strings.ToLower(def.Channel)
+	switch {
+	case def.Level == 1 || def.Level == 2:
+		record.Level = "error"
+	case def.Level == 3 || def.Keywords == windowsAuditFailure:
+		record.Level = "warn"
+	default:
+		record.Level = "info"
+	}
+
+	var out []byte
+	var err error
+	if windowsEventFormat == windowsEventJSON {
+		out, err = json.Marshal(windowsEventJSONRecord{
+			EventID:       def.ID,
+			Channel:       def.Channel,
+			ProviderName:  def.Provider,
+			ProviderGUID:  def.ProviderGUID,
+			Computer:      computer,
+			Level:         windowsLevelNames[def.Level],
+			Task:          def.Task,
+			Keywords:      def.Keywords,
+			TimeCreated:   event.System.TimeCreated.SystemTime,
+			EventRecordID: recordID,
+			ProcessID:     event.System.Execution.ProcessID,
+			EventData:     windowsEventDataMap(data),
+			Message:       message,
+		})
+	} else {
+		out, err = xml.Marshal(event)
+	}
+	if err != nil {
+		record.Log = fmt.Sprintf("failed to marshal Windows event: %v", err)
+		return
+	}
+	record.Log = string(out)
+}
+
+func windowsEventDataMap(data []windowsEventData) map[string]string {
+	m := make(map[string]string, len(data))
+	for i, d := range data {
+		// Unnamed data is numbered the way Winlogbeat does
+		if d.Name == "" {
+			d.Name = fmt.Sprintf("param%d", i+1)
+		}
+		m[d.Name] = d.Value
+	}
+	return m
+}
+
+// pickWindowsEvent returns an event chosen proportionally to its weight
+func pickWindowsEvent() windowsEventDef {
+	total := 0.0
+	for _, def := range windowsEventDefs {
+		total += def.Weight
+	}
+	x := rand.Float64() * total
+	for _, def := range windowsEventDefs {
+		if x -= def.Weight; x < 0 {
+			return def
+		}
+	}
+	return windowsEventDefs[len(windowsEventDefs)-1]
+}
+
+// windowsComputer returns one of a small domain's workstations and servers
+func windowsComputer() string {
+	if rand.Intn(5) == 0 {
+		return fmt.Sprintf("DC%02d.corp.example.com", 1+rand.Intn(2))
+	}
+	if rand.Intn(3) == 0 {
+		return fmt.Sprintf("SRV-APP%02d.corp.example.com", 1+rand.Intn(6))
+	}
+	return fmt.Sprintf("WS-%04d.corp.example.com", 1+rand.Intn(40))
+}
+
+// windowsSID returns the SID of a domain account
+func windowsSID(user string) string {
+	if user == "Administrator" {
+		return "S-1-5-21-3623811015-3361044348-30300820-500"
+	}
+	return fmt.Sprintf("S-1-5-21-3623811015-3361044348-30300820-%d", 1100+fnvString(user)%900)
+}
+
+func windowsLogonID() string {
+	return fmt.Sprintf("0x%x", 0x10000+rand.Intn(0xfffff))
+}
+
+// windowsMessage renders an event message the way Event Viewer does: a
+// summary line followed by indented sections of fields
+func windowsMessage(summary string, sections ...[]string) string {
+	var b strings.Builder
+	b.WriteString(summary)
+	for _, section := range sections {
+		b.WriteString("\r\n\r\n" + section[0] + ":")
+		for i := 1; i+1 < len(section); i += 2 {
+			b.WriteString("\r\n\t" + section[i] + ":\t\t" + section[i+1])
+		}
+	}
+	return b.String()
+}
+
+func renderWindowsLogon(success bool) func(string) ([]windowsEventData, string) {
+	return func(computer string) ([]windowsEventData, string) {
+		user := windowsUsers[rand.Intn(len(windowsUsers))]
+		host := strings.SplitN(computer, ".", 2)[0]
+		logonType := []string{"2", "3", "3", "3", "5", "10"}[rand.Intn(6)]
+		ip := fmt.Sprintf("10.20.%d.%d", rand.Intn(8), 2+rand.Intn(250))
+		process := `C:\Windows\System32\lsass.exe`
+		data := []windowsEventData{
+			{"SubjectUserSid", "S-1-5-18"},
+			{"SubjectUserName", host + "$"},
+			{"SubjectDomainName", "CORP"},
+			{"TargetUserSid", windowsSID(user)},
+			{"TargetUserName", user},
+			{"TargetDomainName", "CORP"},
+			{"LogonType", logonType},
+			{"WorkstationName", host},
+			{"IpAddress", ip},
+			{"IpPort", fmt.Sprint(49152 + rand.Intn(16384))},
+			{"ProcessName", process},
+		}
+		if !success {
+			data[3].Value = "S-1-0-0"
+			data = append(data,
+				windowsEventData{"Status", "0xc000006d"},
+				windowsEventData{"SubStatus", []string{"0xc000006a", "0xc0000064", "0xc0000072"}[rand.Intn(3)]},
+				windowsEventData{"FailureReason", "%%2313"})
+			return data, windowsMessage("An account failed to log on.",
+				[]string{"Subject", "Security ID", "S-1-5-18", "Account Name", host + "$", "Account Domain", "CORP"},
+				[]string{"Logon Information", "Logon Type", logonType},
+				[]string{"Account For Which Logon Failed", "Security ID", "NULL SID", "Account Name", user, "Account Domain", "CORP"},
+				[]string{"Failure Information", "Failure Reason", "Unknown user name or bad password.", "Status", "0xC000006D"},
+				[]string{"Network Information", "Workstation Name", host, "Source Network Address", ip})
+		}
+		data = append(data, windowsEventData{"TargetLogonId", windowsLogonID()}, windowsEventData{"LogonGuid", "{" + gofakeit.UUID() + "}"})
+		return data, windowsMessage("An account was successfully logged on.",
+			[]string{"Subject", "Security ID", "SYSTEM", "Account Name", host + "$", "Account Domain", "CORP"},
+			[]string{"Logon Information", "Logon Type", logonType},
+			[]string{"New Logon", "Security ID", "CORP\\" + user, "Account Name", user, "Account Domain", "CORP"},
+			[]string{"Network Information", "Workstation Name", host, "Source Network Address", ip})
+	}
+}
+
+func renderWindowsLogoff(string) ([]windowsEventData, string) {
+	user := windowsUsers[rand.Intn(len(windowsUsers))]
+	logonID := windowsLogonID()
+	return []windowsEventData{
+		{"TargetUserSid", windowsSID(user)},
+		{"TargetUserName", user},
+		{"TargetDomainName", "CORP"},
+		{"TargetLogonId", logonID},
+		{"LogonType", "3"},
+	}, windowsMessage("An account was logged off.",
+		[]string{"Subject", "Security ID", "CORP\\" + user, "Account Name", user, "Account Domain", "CORP", "Logon ID", logonID},
+		[]string{"Logon Information", "Logon Type", "3"})
+}
+
+func renderWindowsSpecialPrivileges(string) ([]windowsEventData, string) {
+	user := []string{"Administrator", "svc_backup", "svc_sql"}[rand.Intn(3)]
+	logonID := windowsLogonID()
+	privileges := "SeSecurityPrivilege\r\n\t\t\tSeBackupPrivilege\r\n\t\t\tSeRestorePrivilege\r\n\t\t\tSeDebugPrivilege"
+	return []windowsEventData{
+		{"SubjectUserSid", windowsSID(user)},
+		{"SubjectUserName", user},
+		{"SubjectDomainName", "CORP"},
+		{"SubjectLogonId", logonID},
+		{"PrivilegeList", privileges},
+	}, windowsMessage("Special privileges assigned to new logon.",
+		[]string{"Subject", "Security ID", "CORP\\" + user, "Account Name", user, "Account Domain", "CORP", "Logon ID", logonID}) +
+		"\r\n\r\nPrivileges:\t\t" + privileges
+}
+
+func renderWindowsProcessCreation(string) ([]windowsEventData, string) {
+	user := windowsUsers[rand.Intn(len(windowsUsers))]
+	process := windowsProcesses[rand.Intn(len(windowsProcesses))]
+	parent := `C:\Windows\explorer.exe`
+	commandLine := `"` + process + `"`
+	if strings.HasSuffix(process, "powershell.exe") {
+		commandLine += " -NoProfile -ExecutionPolicy Bypass -File C:\\Scripts\\" + gofakeit.Word() + ".ps1"
+	}
+	pid := fmt.Sprintf("0x%x", 4*(100+rand.Intn(5000)))
+	return []windowsEventData{
+		{"SubjectUserSid", windowsSID(user)},
+		{"SubjectUserName", user},
+		{"SubjectDomainName", "CORP"},
+		{"NewProcessId", pid},
+		{"NewProcessName", process},
+		{"TokenElevationType", "%%1938"},
+		{"CommandLine", commandLine},
+		{"ParentProcessName", parent},
+	}, windowsMessage("A new process has been created.",
+		[]string{"Creator Subject", "Security ID", "CORP\\" + user, "Account Name", user, "Account Domain", "CORP"},
+		[]string{"Process Information", "New Process ID", pid, "New Process Name", process, "Creator Process Name", parent, "Process Command Line", commandLine})
+}
+
+func renderWindowsLockout(computer string) ([]windowsEventData, string) {
+	user := windowsUsers[rand.Intn(len(windowsUsers))]
+	caller := fmt.Sprintf("WS-%04d", 1+rand.Intn(40))
+	return []windowsEventData{
+		{"TargetUserName", user},
+		{"TargetDomainName", caller},
+		{"TargetSid", windowsSID(user)},
+		{"SubjectUserSid", "S-1-5-18"},
+		{"SubjectUserName", strings.SplitN(computer, ".", 2)[0] + "$"},
+	}, windowsMessage("A user account was locked out.",
+		[]string{"Account That Was Locked Out", "Security ID", "CORP\\" + user, "Account Name", user},
+		[]string{"Additional Information", "Caller Computer Name", caller})
+}
+
+func renderWindowsUserCreated(string) ([]windowsEventData, string) {
+	user := strings.ToLower(gofakeit.FirstName())
+	return []windowsEventData{
+		{"TargetUserName", user},
+		{"TargetDomainName", "CORP"},
+		{"TargetSid", windowsSID(user)},
+		{"SubjectUserName", "Administrator"},
+		{"SamAccountName", user},
+	}, windowsMessage("A user account was created.",
+		[]string{"Subject", "Account Name", "Administrator", "Account Domain", "CORP"},
+		[]string{"New Account", "Security ID", "CORP\\" + user, "Account Name", user})
+}
+
+func renderWindowsServiceState(string) ([]windowsEventData, string) {
+	service := windowsServices[rand.Intn(len(windowsServices))]
+	state := []string{"running", "stopped"}[rand.Intn(2)]
+	return []windowsEventData{{"param1", service}, {"param2", state}},
+		fmt.Sprintf("The %s service entered the %s state.", service, state)
+}
+
+func renderWindowsServiceFailed(string) ([]windowsEventData, string) {
+	service := windowsServices[rand.Intn(len(windowsServices))]
+	return []windowsEventData{{"param1", service}, {"param2", "%%1053"}},
+		fmt.Sprintf("The %s service failed to start due to the following error: \r\nThe service did not respond to the start or control request in a timely fashion.", service)
+}
+
+func renderWindowsAppCrash(string) ([]windowsEventData, string) {
+	process := windowsProcesses[rand.Intn(len(windowsProcesses))]
+	name := process[strings.LastIndex(process, `\`)+1:]
+	module := []string{"ntdll.dll", "KERNELBASE.dll", "ucrtbase.dll", name}[rand.Intn(4)]
+	code := []string{"0xc0000005", "0xc0000409", "0xe0434352"}[rand.Intn(3)]
+	offset := fmt.Sprintf("0x%016x", rand.Intn(1<<20))
+	return []windowsEventData{
+		{"AppName", name},
+		{"AppVersion", "10.0.19041.3636"},
+		{"ModuleName", module},
+		{"ExceptionCode", strings.TrimPrefix(code, "0x")},
+		{"FaultingOffset", strings.TrimPrefix(offset, "0x")},
+		{"AppPath", process},
+	}, fmt.Sprintf("Faulting application name: %s, version: 10.0.19041.3636\r\nFaulting module name: %s\r\nException code: %s\r\nFault offset: %s\r\nFaulting application path: %s",
+		name, module, code, offset, process)
+}
+
+func renderWindowsDotNetError(string) ([]windowsEventData, string) {
+	exception := []string{"System.NullReferenceException", "System.InvalidOperationException", "System.IO.FileNotFoundException", "System.TimeoutException"}[rand.Intn(4)]
+	app := "OrderService.exe"
+	message := fmt.Sprintf("Application: %s\r\nFramework Version: v4.0.30319\r\nDescription: The process was terminated due to an unhandled exception.\r\nException Info: %s\r\n   at OrderService.Worker.Process()\r\n   at System.Threading.ThreadHelper.ThreadStart()", app, exception)
+	return []windowsEventData{{Value: message}}, message
+}
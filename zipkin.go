@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// zipkinEndpoint identifies the service that recorded a span
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// zipkinSpan is a span in the Zipkin v2 JSON model. Timestamps and durations
+// are in microseconds.
+type zipkinSpan struct {
+	TraceID       string             `json:"traceId"`
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parentId,omitempty"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind,omitempty"`
+	Timestamp     int64              `json:"timestamp"`
+	Duration      int64              `json:"duration"`
+	LocalEndpoint zipkinEndpoint     `json:"localEndpoint"`
+	Annotations   []zipkinAnnotation `json:"annotations,omitempty"`
+	Tags          map[string]string  `json:"tags,omitempty"`
+}
+
+// zipkinAnnotation is a span event. Zipkin annotations carry only a string,
+// so event attributes are folded into it as JSON: {"name":{attributes}}.
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// zipkinTraceEncoder sends the trace as a Zipkin v2 JSON span list, as
+// accepted by POST /api/v2/spans
+type zipkinTraceEncoder struct{}
+
+func (zipkinTraceEncoder) ContentType() string { return "application/json" }
+
+func (zipkinTraceEncoder) Encode(trace *Trace) ([]byte, error) {
+	spans := make([]zipkinSpan, len(trace.Spans))
+	for i, span := range trace.Spans {
+		spans[i] = toZipkinSpan(span)
+	}
+	return json.Marshal(spans)
+}
+
+func toZipkinSpan(span Span) zipkinSpan {
+	tags := make(map[string]string, len(span.Attributes))
+	// Zipkin has no resource, so resource attributes become tags
+	for _, kv := range resourceAttributes(span.ServiceName, resourceInstance(span.TraceID), nil) {
+		if kv.Key != "service.name" {
+			tags[kv.Key] = *kv.Value.StringValue
+		}
+	}
+	for key, value := range span.Attributes {
+		if key != "span.kind" && key != "service.name" {
+			tags[key] = value
+		}
+	}
+	// The error tag holds the error message, or is empty
+	if span.Error {
+		tags["error"] = span.StatusMessage
+	}
+	// Zipkin has no internal kind; local spans leave it empty
+	kind := strings.ToUpper(span.Attributes["span.kind"])
+	if kind == "INTERNAL" {
+		kind = ""
+	}
+	var annotations []zipkinAnnotation
+	for _, event := range span.Events {
+		value := event.Name
+		if len(event.Attributes) > 0 {
+			encoded, _ := json.Marshal(map[string]map[string]string{event.Name: event.Attributes})
+			value = string(encoded)
+		}
+		annotations = append(annotations, zipkinAnnotation{Timestamp: event.Time / 1000, Value: value})
+	}
+	start := span.StartTime / 1000
+	return zipkinSpan{
+		TraceID:       span.TraceID,
+		ID:            span.SpanID,
+		ParentID:      span.ParentID,
+		Name:          span.Name,
+		Kind:          kind,
+		Timestamp:     start,
+		Duration:      max(span.EndTime/1000-start, 1),
+		LocalEndpoint: zipkinEndpoint{ServiceName: span.ServiceName},
+		Annotations:   annotations,
+		Tags:          tags,
+	}
+}